@@ -0,0 +1,729 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"factory-go-api/balancer"
+	"factory-go-api/breaker"
+	"factory-go-api/config"
+	"factory-go-api/metrics"
+	"factory-go-api/provider"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// adminError 管理 API 的请求错误，携带 HTTP 状态码
+type adminError struct {
+	status  int
+	message string
+}
+
+func (e *adminError) Error() string {
+	return e.message
+}
+
+func errAdminNotFound(kind, name string) error {
+	return &adminError{http.StatusNotFound, fmt.Sprintf("%s '%s' not found", kind, name)}
+}
+
+func errAdminConflict(kind, name string) error {
+	return &adminError{http.StatusConflict, fmt.Sprintf("%s '%s' already exists", kind, name)}
+}
+
+// maskKey 隐藏 Key，只保留前 4 位用于辨认
+func maskKey(key string) string {
+	if key == "" {
+		return ""
+	}
+	if len(key) <= 8 {
+		return "***"
+	}
+	return key[:4] + "***"
+}
+
+// generateClientKey 生成新的客户端 Key
+func generateClientKey() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "sk-" + hex.EncodeToString(buf), nil
+}
+
+// adminEndpointView 端点的展示格式，不返回完整的上游 Key
+type adminEndpointView struct {
+	Name           string                  `json:"name"`
+	Type           string                  `json:"type"`
+	BaseURL        string                  `json:"base_url"`
+	Disabled       bool                    `json:"disabled"`
+	APIKeyHint     string                  `json:"api_key_hint,omitempty"`
+	Transport      *config.TransportConfig `json:"transport,omitempty"` // 代理地址中的密码已隐藏
+	Weight         int                     `json:"weight,omitempty"`
+	Priority       int                     `json:"priority,omitempty"`
+	HealthCheckURL string                  `json:"health_check_url,omitempty"`
+}
+
+func newAdminEndpointView(endpoint config.Endpoint) adminEndpointView {
+	view := adminEndpointView{
+		Name:           endpoint.Name,
+		Type:           endpoint.EndpointType(),
+		BaseURL:        endpoint.BaseURL,
+		Disabled:       endpoint.Disabled,
+		APIKeyHint:     maskKey(endpoint.APIKey),
+		Weight:         endpoint.Weight,
+		Priority:       endpoint.Priority,
+		HealthCheckURL: endpoint.HealthCheckURL,
+	}
+	if endpoint.Transport != nil {
+		transport := *endpoint.Transport
+		if proxyURL, err := url.Parse(transport.Proxy); err == nil && proxyURL.User != nil {
+			transport.Proxy = proxyURL.Redacted()
+		}
+		view.Transport = &transport
+	}
+	return view
+}
+
+// adminClientView 客户端的展示格式；Key 只在创建和轮换时完整返回一次
+type adminClientView struct {
+	Name         string                     `json:"name"`
+	Key          string                     `json:"key,omitempty"`
+	KeyHint      string                     `json:"key_hint"`
+	SystemPrompt *config.SystemPromptPolicy `json:"system_prompt,omitempty"`
+}
+
+func newAdminClientView(client config.Client, showKey bool) adminClientView {
+	view := adminClientView{Name: client.Name, KeyHint: maskKey(client.Key), SystemPrompt: client.SystemPrompt}
+	if showKey {
+		view.Key = client.Key
+	}
+	return view
+}
+
+// authorizeAdmin 校验 ADMIN_API_KEY；未配置时管理 API 不可用
+// 支持 Bearer Token，以及供浏览器访问管理面板使用的 Basic 认证（用户名任意，密码为 ADMIN_API_KEY）
+func authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	adminKey := getEnv("ADMIN_API_KEY", "")
+	if adminKey == "" {
+		writeJSONError(w, http.StatusForbidden, "Admin API is disabled, set ADMIN_API_KEY to enable it", "permission_error")
+		return false
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if _, password, ok := r.BasicAuth(); ok {
+		token = password
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(adminKey)) != 1 {
+		log.Printf("❌ 管理 API Key 验证失败")
+		w.Header().Set("WWW-Authenticate", `Basic realm="factory-go-api admin"`)
+		writeJSONError(w, http.StatusUnauthorized, "Invalid admin API key", "authentication_error")
+		return false
+	}
+	return true
+}
+
+// adminHandler 管理 API 入口，按路径分发到各资源
+//
+//	GET    /admin/state
+//	GET    /admin/metrics
+//	POST   /admin/reload
+//	GET    /admin/models                     POST /admin/models
+//	GET    /admin/models/{id}                PATCH / DELETE
+//	GET    /admin/endpoints                  POST /admin/endpoints
+//	GET    /admin/endpoints/{name}           PATCH / DELETE
+//	PUT    /admin/endpoints/{name}/api_key   DELETE
+//	GET    /admin/clients                    POST /admin/clients
+//	GET    /admin/clients/{name}             PATCH / DELETE
+//	POST   /admin/clients/{name}/rotate
+//
+// 停用模型或端点使用 PATCH {"disabled": true}
+func adminHandler(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAdmin(w, r) {
+		return
+	}
+
+	parts := strings.SplitN(strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin"), "/"), "/", 3)
+	resource := parts[0]
+	name, action := "", ""
+	if len(parts) > 1 {
+		name = parts[1]
+	}
+	if len(parts) > 2 {
+		action = parts[2]
+	}
+
+	var err error
+	switch {
+	case resource == "state" && name == "":
+		err = adminState(w, r)
+	case resource == "reload" && name == "":
+		err = adminReload(w, r)
+	case resource == "metrics" && name == "":
+		err = adminMetrics(w, r)
+	case resource == "models" && action == "":
+		err = adminModels(w, r, name)
+	case resource == "endpoints" && action == "":
+		err = adminEndpoints(w, r, name)
+	case resource == "endpoints" && action == "api_key":
+		err = adminEndpointAPIKey(w, r, name)
+	case resource == "clients" && action == "":
+		err = adminClients(w, r, name)
+	case resource == "clients" && action == "rotate":
+		err = adminRotateClientKey(w, r, name)
+	default:
+		err = &adminError{http.StatusNotFound, "Not found"}
+	}
+	if err != nil {
+		writeAdminError(w, err)
+	}
+}
+
+// writeAdminError 将处理错误转换为 HTTP 响应
+func writeAdminError(w http.ResponseWriter, err error) {
+	var adminErr *adminError
+	switch {
+	case errors.As(err, &adminErr):
+		writeJSONError(w, adminErr.status, adminErr.message, "invalid_request_error")
+	case errors.Is(err, config.ErrInvalidConfig):
+		writeJSONError(w, http.StatusBadRequest, err.Error(), "invalid_request_error")
+	default:
+		log.Printf("❌ 管理 API 错误: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error(), "server_error")
+	}
+}
+
+func errMethodNotAllowed() error {
+	return &adminError{http.StatusMethodNotAllowed, "Method not allowed"}
+}
+
+// writeAdminJSON 返回 JSON 响应
+func writeAdminJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("错误: 编码响应失败: %v", err)
+	}
+}
+
+// decodeAdminBody 读取请求体并解析到 v
+func decodeAdminBody(r *http.Request, v interface{}) error {
+	body, err := readAdminBody(r)
+	if err != nil {
+		return err
+	}
+	return decodeAdminJSON(body, v)
+}
+
+// readAdminBody 读取请求体；PATCH 在获取配置写锁之前读取，避免慢客户端阻塞其他配置修改
+func readAdminBody(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, &adminError{http.StatusBadRequest, "Failed to read request body"}
+	}
+	return body, nil
+}
+
+// decodeAdminJSON 将 JSON 解析到 v；v 已有值时只覆盖 JSON 中出现的字段（用于 PATCH）
+// JSON 中出现的 map 字段（如 dns_overrides）整体替换而不是合并，以便删除其中的键
+func decodeAdminJSON(body []byte, v interface{}) error {
+	resetPatchedMaps(body, reflect.ValueOf(v))
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return &adminError{http.StatusBadRequest, "Invalid JSON: " + err.Error()}
+	}
+	return nil
+}
+
+// resetPatchedMaps 清空 body 中出现的 map 字段，嵌套对象逐层处理；body 无法解析时由后续解码报错
+func resetPatchedMaps(body []byte, v reflect.Value) {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return
+	}
+	for i := 0; i < v.NumField(); i++ {
+		name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+		raw, ok := fields[name]
+		if !ok || name == "" || name == "-" || !v.Field(i).CanSet() {
+			continue
+		}
+		field := v.Field(i)
+		if field.Kind() == reflect.Map {
+			field.Set(reflect.Zero(field.Type()))
+			continue
+		}
+		resetPatchedMaps(raw, field)
+	}
+}
+
+// adminState 返回运行时状态
+func adminState(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return errMethodNotAllowed()
+	}
+	cfg := config.GetConfig()
+
+	enabledModels := 0
+	for _, model := range cfg.Models {
+		if !model.Disabled {
+			enabledModels++
+		}
+	}
+	backend, _, _ := currentResponseCache()
+	responseCacheState := map[string]interface{}{"enabled": backend != nil}
+	if counter, ok := backend.(interface{ Len() int }); ok {
+		responseCacheState["entries"] = counter.Len()
+	}
+	recordingState := map[string]interface{}{"mode": "off"}
+	if transport := currentUpstreamRecorder(); transport != nil {
+		recordingState["mode"] = recordingConfig(cfg).Mode
+		recordingState["recordings"] = transport.Len()
+	}
+
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{
+		"started_at":     startTime.UTC().Format(time.RFC3339),
+		"uptime":         time.Since(startTime).Seconds(),
+		"go_version":     runtime.Version(),
+		"goroutines":     runtime.NumGoroutine(),
+		"config_path":    config.GetConfigPath(),
+		"models":         len(cfg.Models),
+		"enabled_models": enabledModels,
+		"endpoints":      len(cfg.Endpoints),
+		"clients":        len(cfg.Clients),
+		"response_cache": responseCacheState,
+		"recording":      recordingState,
+	})
+	return nil
+}
+
+// adminMetricsView 请求统计、熔断器和端点健康状态
+type adminMetricsView struct {
+	metrics.Snapshot
+	CircuitBreakers []breaker.Status  `json:"circuit_breakers"`
+	Endpoints       []balancer.Status `json:"endpoints"`
+}
+
+// adminMetrics 返回请求速率、延迟、用量和上游健康状况，管理面板轮询该接口
+func adminMetrics(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return errMethodNotAllowed()
+	}
+	writeAdminJSON(w, http.StatusOK, adminMetricsView{
+		Snapshot:        proxyMetrics.Snapshot(time.Now()),
+		CircuitBreakers: circuitBreakerStatuses(),
+		Endpoints:       endpointStatuses(),
+	})
+	return nil
+}
+
+// adminReload 重新读取配置文件，用于手动修改 config.json 后免重启生效
+func adminReload(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return errMethodNotAllowed()
+	}
+	cfg, err := config.ReloadConfig()
+	if err != nil {
+		return &adminError{http.StatusBadRequest, err.Error()}
+	}
+	// 响应缓存和录制/回放只在启动时初始化，重新加载时按新配置重建
+	if err := initResponseCache(cfg.ResponseCache); err != nil {
+		return &adminError{http.StatusBadRequest, fmt.Sprintf("Failed to initialize response cache: %v", err)}
+	}
+	if err := initRecording(recordingConfig(cfg)); err != nil {
+		return &adminError{http.StatusBadRequest, fmt.Sprintf("Failed to initialize recording: %v", err)}
+	}
+	log.Printf("🔄 配置已重新加载: %d 个模型", len(cfg.Models))
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{"reloaded": true, "models": len(cfg.Models)})
+	return nil
+}
+
+// validateModelType 检查模型类型是否注册了 Provider
+func validateModelType(model *config.Model) error {
+	if provider.Get(model.Type) != nil {
+		return nil
+	}
+	return &adminError{http.StatusBadRequest, fmt.Sprintf("Unsupported model type '%s', expected one of: %s", model.Type, strings.Join(provider.Types(), ", "))}
+}
+
+// findModel 返回模型在配置中的下标（包含已停用的模型）
+func findModel(cfg *config.Config, id string) int {
+	for i, model := range cfg.Models {
+		if model.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// adminModels 模型的增删改查
+func adminModels(w http.ResponseWriter, r *http.Request, id string) error {
+	if id == "" {
+		switch r.Method {
+		case http.MethodGet:
+			writeAdminJSON(w, http.StatusOK, map[string]interface{}{"data": config.GetConfig().Models})
+			return nil
+		case http.MethodPost:
+			var model config.Model
+			if err := decodeAdminBody(r, &model); err != nil {
+				return err
+			}
+			if err := validateModelType(&model); err != nil {
+				return err
+			}
+			if _, err := config.UpdateConfig(func(cfg *config.Config) error {
+				if findModel(cfg, model.ID) >= 0 {
+					return errAdminConflict("Model", model.ID)
+				}
+				cfg.Models = append(cfg.Models, model)
+				return nil
+			}); err != nil {
+				return err
+			}
+			log.Printf("🛠️ 管理 API: 新增模型 %s [%s]", model.ID, model.Type)
+			writeAdminJSON(w, http.StatusCreated, model)
+			return nil
+		}
+		return errMethodNotAllowed()
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		cfg := config.GetConfig()
+		i := findModel(cfg, id)
+		if i < 0 {
+			return errAdminNotFound("Model", id)
+		}
+		writeAdminJSON(w, http.StatusOK, cfg.Models[i])
+		return nil
+	case http.MethodPatch:
+		body, err := readAdminBody(r)
+		if err != nil {
+			return err
+		}
+		var updated config.Model
+		if _, err := config.UpdateConfig(func(cfg *config.Config) error {
+			i := findModel(cfg, id)
+			if i < 0 {
+				return errAdminNotFound("Model", id)
+			}
+			updated = cfg.Models[i]
+			if err := decodeAdminJSON(body, &updated); err != nil {
+				return err
+			}
+			if updated.ID != id {
+				return &adminError{http.StatusBadRequest, "Model id cannot be changed"}
+			}
+			if err := validateModelType(&updated); err != nil {
+				return err
+			}
+			cfg.Models[i] = updated
+			return nil
+		}); err != nil {
+			return err
+		}
+		log.Printf("🛠️ 管理 API: 更新模型 %s (disabled=%v)", id, updated.Disabled)
+		writeAdminJSON(w, http.StatusOK, updated)
+		return nil
+	case http.MethodDelete:
+		if _, err := config.UpdateConfig(func(cfg *config.Config) error {
+			i := findModel(cfg, id)
+			if i < 0 {
+				return errAdminNotFound("Model", id)
+			}
+			cfg.Models = append(cfg.Models[:i], cfg.Models[i+1:]...)
+			return nil
+		}); err != nil {
+			return err
+		}
+		log.Printf("🛠️ 管理 API: 删除模型 %s", id)
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return errMethodNotAllowed()
+}
+
+// findEndpoint 返回端点在配置中的下标（包含已停用的端点）
+func findEndpoint(cfg *config.Config, name string) int {
+	for i, endpoint := range cfg.Endpoints {
+		if endpoint.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// adminEndpoints 端点的增删改查；上游 Key 不通过这里返回
+func adminEndpoints(w http.ResponseWriter, r *http.Request, name string) error {
+	if name == "" {
+		switch r.Method {
+		case http.MethodGet:
+			cfg := config.GetConfig()
+			views := make([]adminEndpointView, 0, len(cfg.Endpoints))
+			for _, endpoint := range cfg.Endpoints {
+				views = append(views, newAdminEndpointView(endpoint))
+			}
+			writeAdminJSON(w, http.StatusOK, map[string]interface{}{"data": views})
+			return nil
+		case http.MethodPost:
+			var endpoint config.Endpoint
+			if err := decodeAdminBody(r, &endpoint); err != nil {
+				return err
+			}
+			if _, err := config.UpdateConfig(func(cfg *config.Config) error {
+				if findEndpoint(cfg, endpoint.Name) >= 0 {
+					return errAdminConflict("Endpoint", endpoint.Name)
+				}
+				cfg.Endpoints = append(cfg.Endpoints, endpoint)
+				return nil
+			}); err != nil {
+				return err
+			}
+			log.Printf("🛠️ 管理 API: 新增端点 %s", endpoint.Name)
+			writeAdminJSON(w, http.StatusCreated, newAdminEndpointView(endpoint))
+			return nil
+		}
+		return errMethodNotAllowed()
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		cfg := config.GetConfig()
+		i := findEndpoint(cfg, name)
+		if i < 0 {
+			return errAdminNotFound("Endpoint", name)
+		}
+		writeAdminJSON(w, http.StatusOK, newAdminEndpointView(cfg.Endpoints[i]))
+		return nil
+	case http.MethodPatch:
+		body, err := readAdminBody(r)
+		if err != nil {
+			return err
+		}
+		var updated config.Endpoint
+		if _, err := config.UpdateConfig(func(cfg *config.Config) error {
+			i := findEndpoint(cfg, name)
+			if i < 0 {
+				return errAdminNotFound("Endpoint", name)
+			}
+			updated = cfg.Endpoints[i]
+			if err := decodeAdminJSON(body, &updated); err != nil {
+				return err
+			}
+			if updated.Name != name {
+				return &adminError{http.StatusBadRequest, "Endpoint name cannot be changed"}
+			}
+			cfg.Endpoints[i] = updated
+			return nil
+		}); err != nil {
+			return err
+		}
+		log.Printf("🛠️ 管理 API: 更新端点 %s (disabled=%v)", name, updated.Disabled)
+		writeAdminJSON(w, http.StatusOK, newAdminEndpointView(updated))
+		return nil
+	case http.MethodDelete:
+		if _, err := config.UpdateConfig(func(cfg *config.Config) error {
+			i := findEndpoint(cfg, name)
+			if i < 0 {
+				return errAdminNotFound("Endpoint", name)
+			}
+			cfg.Endpoints = append(cfg.Endpoints[:i], cfg.Endpoints[i+1:]...)
+			return nil
+		}); err != nil {
+			return err
+		}
+		log.Printf("🛠️ 管理 API: 删除端点 %s", name)
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return errMethodNotAllowed()
+}
+
+// adminEndpointAPIKey 设置（PUT）或清除（DELETE）端点的上游 Key，清除后使用 FACTORY_API_KEY
+func adminEndpointAPIKey(w http.ResponseWriter, r *http.Request, name string) error {
+	var apiKey string
+	switch r.Method {
+	case http.MethodPut:
+		var body struct {
+			APIKey string `json:"api_key"`
+		}
+		if err := decodeAdminBody(r, &body); err != nil {
+			return err
+		}
+		if body.APIKey == "" {
+			return &adminError{http.StatusBadRequest, "api_key is required"}
+		}
+		apiKey = body.APIKey
+	case http.MethodDelete:
+	default:
+		return errMethodNotAllowed()
+	}
+
+	var updated config.Endpoint
+	if _, err := config.UpdateConfig(func(cfg *config.Config) error {
+		i := findEndpoint(cfg, name)
+		if i < 0 {
+			return errAdminNotFound("Endpoint", name)
+		}
+		cfg.Endpoints[i].APIKey = apiKey
+		updated = cfg.Endpoints[i]
+		return nil
+	}); err != nil {
+		return err
+	}
+	log.Printf("🛠️ 管理 API: 更新端点 %s 的上游 Key", name)
+	writeAdminJSON(w, http.StatusOK, newAdminEndpointView(updated))
+	return nil
+}
+
+// findClient 返回客户端在配置中的下标
+func findClient(cfg *config.Config, name string) int {
+	for i, client := range cfg.Clients {
+		if client.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// adminClients 客户端 Key 的增删改查；未指定 key 时自动生成
+func adminClients(w http.ResponseWriter, r *http.Request, name string) error {
+	if name == "" {
+		switch r.Method {
+		case http.MethodGet:
+			cfg := config.GetConfig()
+			views := make([]adminClientView, 0, len(cfg.Clients))
+			for _, client := range cfg.Clients {
+				views = append(views, newAdminClientView(client, false))
+			}
+			writeAdminJSON(w, http.StatusOK, map[string]interface{}{"data": views})
+			return nil
+		case http.MethodPost:
+			var client config.Client
+			if err := decodeAdminBody(r, &client); err != nil {
+				return err
+			}
+			if client.Key == "" {
+				key, err := generateClientKey()
+				if err != nil {
+					return err
+				}
+				client.Key = key
+			}
+			if _, err := config.UpdateConfig(func(cfg *config.Config) error {
+				if findClient(cfg, client.Name) >= 0 {
+					return errAdminConflict("Client", client.Name)
+				}
+				cfg.Clients = append(cfg.Clients, client)
+				return nil
+			}); err != nil {
+				return err
+			}
+			log.Printf("🛠️ 管理 API: 新增客户端 %s", client.Name)
+			writeAdminJSON(w, http.StatusCreated, newAdminClientView(client, true))
+			return nil
+		}
+		return errMethodNotAllowed()
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		cfg := config.GetConfig()
+		i := findClient(cfg, name)
+		if i < 0 {
+			return errAdminNotFound("Client", name)
+		}
+		writeAdminJSON(w, http.StatusOK, newAdminClientView(cfg.Clients[i], false))
+		return nil
+	case http.MethodPatch:
+		body, err := readAdminBody(r)
+		if err != nil {
+			return err
+		}
+		var updated config.Client
+		if _, err := config.UpdateConfig(func(cfg *config.Config) error {
+			i := findClient(cfg, name)
+			if i < 0 {
+				return errAdminNotFound("Client", name)
+			}
+			updated = cfg.Clients[i]
+			if err := decodeAdminJSON(body, &updated); err != nil {
+				return err
+			}
+			if updated.Name != name {
+				return &adminError{http.StatusBadRequest, "Client name cannot be changed"}
+			}
+			cfg.Clients[i] = updated
+			return nil
+		}); err != nil {
+			return err
+		}
+		log.Printf("🛠️ 管理 API: 更新客户端 %s", name)
+		writeAdminJSON(w, http.StatusOK, newAdminClientView(updated, false))
+		return nil
+	case http.MethodDelete:
+		if _, err := config.UpdateConfig(func(cfg *config.Config) error {
+			i := findClient(cfg, name)
+			if i < 0 {
+				return errAdminNotFound("Client", name)
+			}
+			// 未设置 PROXY_API_KEY 时删除最后一个客户端会让代理切换为无需认证的直连模式
+			if len(cfg.Clients) == 1 && getEnv("PROXY_API_KEY", "") == "" {
+				return &adminError{http.StatusConflict, "Cannot delete the last client while PROXY_API_KEY is not set: the proxy would stop requiring authentication"}
+			}
+			cfg.Clients = append(cfg.Clients[:i], cfg.Clients[i+1:]...)
+			return nil
+		}); err != nil {
+			return err
+		}
+		log.Printf("🛠️ 管理 API: 删除客户端 %s", name)
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return errMethodNotAllowed()
+}
+
+// adminRotateClientKey 为客户端生成新 Key，旧 Key 立即失效
+func adminRotateClientKey(w http.ResponseWriter, r *http.Request, name string) error {
+	if r.Method != http.MethodPost {
+		return errMethodNotAllowed()
+	}
+	key, err := generateClientKey()
+	if err != nil {
+		return err
+	}
+
+	var updated config.Client
+	if _, err := config.UpdateConfig(func(cfg *config.Config) error {
+		i := findClient(cfg, name)
+		if i < 0 {
+			return errAdminNotFound("Client", name)
+		}
+		cfg.Clients[i].Key = key
+		updated = cfg.Clients[i]
+		return nil
+	}); err != nil {
+		return err
+	}
+	log.Printf("🛠️ 管理 API: 轮换客户端 %s 的 Key", name)
+	writeAdminJSON(w, http.StatusOK, newAdminClientView(updated, true))
+	return nil
+}
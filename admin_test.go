@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"factory-go-api/config"
+	"factory-go-api/mockupstream"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newAdminTestUpstream 在 newTestUpstream 的基础上将配置写入临时文件，使管理 API 的修改可以持久化
+func newAdminTestUpstream(t *testing.T) (*mockupstream.Server, string) {
+	t.Helper()
+	upstream := newTestUpstream(t)
+	t.Setenv("ADMIN_API_KEY", "admin-key")
+
+	data, err := json.Marshal(config.GetConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.LoadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+	return upstream, path
+}
+
+// adminRequest 通过 adminHandler 发送请求
+func adminRequest(t *testing.T, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer admin-key")
+	rr := httptest.NewRecorder()
+	adminHandler(rr, req)
+	return rr
+}
+
+func TestAdminRequiresKey(t *testing.T) {
+	newTestUpstream(t)
+	t.Setenv("ADMIN_API_KEY", "")
+	if rr := adminRequest(t, http.MethodGet, "/admin/state", ""); rr.Code != http.StatusForbidden {
+		t.Errorf("disabled admin status = %d, want 403", rr.Code)
+	}
+
+	t.Setenv("ADMIN_API_KEY", "other-key")
+	if rr := adminRequest(t, http.MethodGet, "/admin/state", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("wrong key status = %d, want 401", rr.Code)
+	}
+}
+
+func TestAdminModels(t *testing.T) {
+	_, path := newAdminTestUpstream(t)
+
+	rr := adminRequest(t, http.MethodPost, "/admin/models", `{"name":"Claude New","id":"claude-new","type":"anthropic","max_output":8192}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+	if data, _ := os.ReadFile(path); !strings.Contains(string(data), `"id": "claude-new"`) {
+		t.Errorf("model not persisted: %s", data)
+	}
+	decodeChat(t, postChat(t, `{"model":"claude-new","messages":[{"role":"user","content":"Hi"}]}`))
+
+	if rr := adminRequest(t, http.MethodPost, "/admin/models", `{"id":"claude-new","type":"anthropic"}`); rr.Code != http.StatusConflict {
+		t.Errorf("duplicate status = %d, want 409", rr.Code)
+	}
+	if rr := adminRequest(t, http.MethodPost, "/admin/models", `{"id":"x","type":"unknown"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("unknown type status = %d, want 400", rr.Code)
+	}
+
+	// 停用后不可用，但仍保留在配置中
+	if rr := adminRequest(t, http.MethodPatch, "/admin/models/claude-new", `{"disabled":true}`); rr.Code != http.StatusOK {
+		t.Fatalf("disable status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+	if rr := postChat(t, `{"model":"claude-new","messages":[{"role":"user","content":"Hi"}]}`); rr.Code != http.StatusNotFound {
+		t.Errorf("disabled model status = %d, want 404", rr.Code)
+	}
+	var model config.Model
+	rr = adminRequest(t, http.MethodGet, "/admin/models/claude-new", "")
+	if err := json.Unmarshal(rr.Body.Bytes(), &model); err != nil || !model.Disabled || model.MaxOutput != 8192 {
+		t.Errorf("patched model = %s", rr.Body.String())
+	}
+
+	if rr := adminRequest(t, http.MethodDelete, "/admin/models/claude-new", ""); rr.Code != http.StatusNoContent {
+		t.Errorf("delete status = %d", rr.Code)
+	}
+	if rr := adminRequest(t, http.MethodGet, "/admin/models/claude-new", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("deleted model status = %d, want 404", rr.Code)
+	}
+}
+
+func TestAdminClientKeys(t *testing.T) {
+	newAdminTestUpstream(t)
+
+	rr := adminRequest(t, http.MethodPost, "/admin/clients", `{"name":"ci"}`)
+	var created adminClientView
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil || rr.Code != http.StatusCreated || !strings.HasPrefix(created.Key, "sk-") {
+		t.Fatalf("create status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+
+	chat := func(key string) int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"claude-test","messages":[{"role":"user","content":"Hi"}]}`))
+		req.Header.Set("Authorization", "Bearer "+key)
+		rr := httptest.NewRecorder()
+		chatCompletionsHandler(rr, req)
+		return rr.Code
+	}
+	if code := chat(created.Key); code != http.StatusOK {
+		t.Errorf("new client key status = %d, want 200", code)
+	}
+
+	rr = adminRequest(t, http.MethodGet, "/admin/clients", "")
+	if strings.Contains(rr.Body.String(), created.Key) {
+		t.Errorf("client list leaks key: %s", rr.Body.String())
+	}
+
+	rr = adminRequest(t, http.MethodPost, "/admin/clients/ci/rotate", "")
+	var rotated adminClientView
+	if err := json.Unmarshal(rr.Body.Bytes(), &rotated); err != nil || rotated.Key == "" || rotated.Key == created.Key {
+		t.Fatalf("rotate status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+	if code := chat(created.Key); code != http.StatusUnauthorized {
+		t.Errorf("old key status = %d, want 401", code)
+	}
+	if code := chat(rotated.Key); code != http.StatusOK {
+		t.Errorf("rotated key status = %d, want 200", code)
+	}
+
+	// 未设置 PROXY_API_KEY 时不能删除最后一个客户端，否则代理会变为无需认证
+	if rr = adminRequest(t, http.MethodDelete, "/admin/clients/ci", ""); rr.Code != http.StatusConflict {
+		t.Errorf("delete last client status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+	if code := chat("anything"); code != http.StatusUnauthorized {
+		t.Errorf("unknown key status = %d, want 401", code)
+	}
+	adminRequest(t, http.MethodPost, "/admin/clients", `{"name":"web"}`)
+	if rr = adminRequest(t, http.MethodDelete, "/admin/clients/ci", ""); rr.Code != http.StatusNoContent {
+		t.Errorf("delete status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+	t.Setenv("PROXY_API_KEY", "proxy-key")
+	if rr = adminRequest(t, http.MethodDelete, "/admin/clients/web", ""); rr.Code != http.StatusNoContent {
+		t.Errorf("delete with PROXY_API_KEY status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAdminEndpointAPIKey(t *testing.T) {
+	upstream, _ := newAdminTestUpstream(t)
+
+	rr := adminRequest(t, http.MethodPut, "/admin/endpoints/anthropic/api_key", `{"api_key":"endpoint-secret-key"}`)
+	if rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), "endpoint-secret-key") {
+		t.Fatalf("status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+	decodeChat(t, postChat(t, `{"model":"claude-test","messages":[{"role":"user","content":"Hi"}]}`))
+	if req, _ := upstream.LastRequest(); req.Header.Get("Authorization") != "Bearer endpoint-secret-key" {
+		t.Errorf("upstream Authorization = %q", req.Header.Get("Authorization"))
+	}
+
+	if rr := adminRequest(t, http.MethodDelete, "/admin/endpoints/anthropic/api_key", ""); rr.Code != http.StatusOK {
+		t.Fatalf("clear status = %d", rr.Code)
+	}
+	decodeChat(t, postChat(t, `{"model":"claude-test","messages":[{"role":"user","content":"Hi"}]}`))
+	if req, _ := upstream.LastRequest(); req.Header.Get("Authorization") != "Bearer factory-key" {
+		t.Errorf("upstream Authorization after clear = %q", req.Header.Get("Authorization"))
+	}
+
+	if rr := adminRequest(t, http.MethodPatch, "/admin/endpoints/anthropic", `{"disabled":true}`); rr.Code != http.StatusOK {
+		t.Fatalf("disable status = %d", rr.Code)
+	}
+	if rr := postChat(t, `{"model":"claude-test","messages":[{"role":"user","content":"Hi"}]}`); rr.Code != http.StatusInternalServerError {
+		t.Errorf("disabled endpoint status = %d, want 500", rr.Code)
+	}
+}
+
+// PATCH 中的 map 字段整体替换，可以删除其中的键
+func TestAdminPatchReplacesMaps(t *testing.T) {
+	newAdminTestUpstream(t)
+
+	rr := adminRequest(t, http.MethodPatch, "/admin/endpoints/anthropic", `{"transport":{"timeout_seconds":30,"dns_overrides":{"a.example":"127.0.0.1","b.example":"127.0.0.2"}}}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+	rr = adminRequest(t, http.MethodPatch, "/admin/endpoints/anthropic", `{"transport":{"dns_overrides":{"a.example":"127.0.0.1"}}}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+
+	transport := config.GetEndpointByType("anthropic").Transport
+	if transport == nil || transport.TimeoutSeconds != 30 || len(transport.DNSOverrides) != 1 || transport.DNSOverrides["a.example"] != "127.0.0.1" {
+		t.Errorf("transport = %+v", transport)
+	}
+}
+
+func TestAdminState(t *testing.T) {
+	_, path := newAdminTestUpstream(t)
+
+	rr := adminRequest(t, http.MethodGet, "/admin/state", "")
+	var state map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &state); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+	if state["config_path"] != path || state["models"] != float64(3) {
+		t.Errorf("state = %v", state)
+	}
+	if rr := adminRequest(t, http.MethodGet, "/admin/unknown", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("unknown path status = %d, want 404", rr.Code)
+	}
+}
+
+func TestAdminReload(t *testing.T) {
+	_, path := newAdminTestUpstream(t)
+	t.Cleanup(func() { _ = initResponseCache(config.ResponseCacheConfig{}) })
+
+	// 手动修改配置文件启用响应缓存，重新加载后立即生效
+	cfg := *config.GetConfig()
+	cfg.ResponseCache = config.ResponseCacheConfig{Enabled: true, Backend: "memory", MaxEntries: 10, TTLSeconds: 60}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if rr := adminRequest(t, http.MethodPost, "/admin/reload", ""); rr.Code != http.StatusOK {
+		t.Fatalf("reload status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+	if backend, ttl, _ := currentResponseCache(); backend == nil || ttl != 60*time.Second {
+		t.Errorf("response cache = %v, ttl = %v", backend, ttl)
+	}
+}
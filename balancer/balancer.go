@@ -0,0 +1,195 @@
+package balancer
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencyDecay 延迟指数移动平均中新样本的权重
+const latencyDecay = 0.2
+
+// Candidate 参与选择的端点
+type Candidate struct {
+	Name     string
+	Weight   int // 同一优先级内的权重，小于等于 0 时按 1 处理
+	Priority int // 数值小的优先
+}
+
+// Status 端点的健康检查和延迟快照
+type Status struct {
+	Name                string     `json:"name"`
+	Healthy             bool       `json:"healthy"`
+	ConsecutiveFailures int        `json:"consecutive_failures"` // 健康检查连续失败次数
+	LatencyMs           float64    `json:"latency_ms"`           // 延迟的指数移动平均，没有样本时为 0
+	LastCheck           *time.Time `json:"last_check,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+}
+
+// endpointState 单个端点的统计
+type endpointState struct {
+	healthy   bool
+	failures  int
+	latency   float64 // 毫秒
+	lastCheck time.Time
+	lastError string
+}
+
+// Balancer 记录端点的健康状况和延迟，并据此决定请求尝试端点的顺序
+type Balancer struct {
+	mu        sync.Mutex
+	endpoints map[string]*endpointState
+	rand      *rand.Rand
+}
+
+// New 创建 Balancer
+func New() *Balancer {
+	return &Balancer{
+		endpoints: make(map[string]*endpointState),
+		rand:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (b *Balancer) state(name string) *endpointState {
+	s := b.endpoints[name]
+	if s == nil {
+		s = &endpointState{healthy: true}
+		b.endpoints[name] = s
+	}
+	return s
+}
+
+// Order 返回尝试端点的顺序：先按优先级分组，组内按权重随机排列
+// latencyAware 为 true 时权重再乘以 最低平均延迟 / 该端点平均延迟，尚无延迟样本的端点按最快处理
+// 健康检查失败的端点排在所有健康端点之后，全部异常时仍会依次尝试
+func (b *Balancer) Order(candidates []Candidate, latencyAware bool) []Candidate {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var healthy, unhealthy []Candidate
+	for _, c := range candidates {
+		if b.state(c.Name).healthy {
+			healthy = append(healthy, c)
+		} else {
+			unhealthy = append(unhealthy, c)
+		}
+	}
+	return append(b.orderTiers(healthy, latencyAware), b.orderTiers(unhealthy, latencyAware)...)
+}
+
+// orderTiers 按优先级分组后逐组按权重随机排列
+func (b *Balancer) orderTiers(candidates []Candidate, latencyAware bool) []Candidate {
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Priority < candidates[j].Priority })
+	ordered := make([]Candidate, 0, len(candidates))
+	for start := 0; start < len(candidates); {
+		end := start
+		for end < len(candidates) && candidates[end].Priority == candidates[start].Priority {
+			end++
+		}
+		ordered = append(ordered, b.shuffle(candidates[start:end], latencyAware)...)
+		start = end
+	}
+	return ordered
+}
+
+// shuffle 按权重不放回抽样，权重越大越可能排在前面
+func (b *Balancer) shuffle(tier []Candidate, latencyAware bool) []Candidate {
+	fastest := 0.0
+	if latencyAware {
+		for _, c := range tier {
+			if latency := b.state(c.Name).latency; latency > 0 && (fastest == 0 || latency < fastest) {
+				fastest = latency
+			}
+		}
+	}
+
+	weights := make([]float64, len(tier))
+	for i, c := range tier {
+		weights[i] = float64(max(c.Weight, 1))
+		if latency := b.state(c.Name).latency; fastest > 0 && latency > 0 {
+			weights[i] *= fastest / latency
+		}
+	}
+
+	remaining := append([]Candidate(nil), tier...)
+	ordered := make([]Candidate, 0, len(tier))
+	for len(remaining) > 0 {
+		total := 0.0
+		for _, w := range weights {
+			total += w
+		}
+		pick, r := len(remaining)-1, b.rand.Float64()*total
+		for i, w := range weights {
+			if r < w {
+				pick = i
+				break
+			}
+			r -= w
+		}
+		ordered = append(ordered, remaining[pick])
+		remaining = append(remaining[:pick], remaining[pick+1:]...)
+		weights = append(weights[:pick], weights[pick+1:]...)
+	}
+	return ordered
+}
+
+// ObserveLatency 记录一次成功请求或健康检查的延迟
+func (b *Balancer) ObserveLatency(name string, latency time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := b.state(name)
+	sample := float64(latency) / float64(time.Millisecond)
+	if s.latency == 0 {
+		s.latency = sample
+	} else {
+		s.latency += latencyDecay * (sample - s.latency)
+	}
+}
+
+// ReportHealth 记录一次健康检查结果，连续失败 threshold 次后标记为异常，成功一次即恢复
+func (b *Balancer) ReportHealth(name string, err error, threshold int, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := b.state(name)
+	s.lastCheck = now
+	if err == nil {
+		s.healthy = true
+		s.failures = 0
+		s.lastError = ""
+		return
+	}
+	s.failures++
+	s.lastError = err.Error()
+	if s.failures >= max(threshold, 1) {
+		s.healthy = false
+	}
+}
+
+// Statuses 返回指定端点的状态，按名称排序
+func (b *Balancer) Statuses(names []string) []Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	statuses := make([]Status, 0, len(names))
+	for _, name := range names {
+		s := b.state(name)
+		status := Status{Name: name, Healthy: s.healthy, ConsecutiveFailures: s.failures, LatencyMs: s.latency, LastError: s.lastError}
+		if !s.lastCheck.IsZero() {
+			lastCheck := s.lastCheck.UTC()
+			status.LastCheck = &lastCheck
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// Reset 清除所有统计
+func (b *Balancer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.endpoints = make(map[string]*endpointState)
+}
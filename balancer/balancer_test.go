@@ -0,0 +1,114 @@
+package balancer
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// newTestBalancer 创建使用固定随机种子的 Balancer
+func newTestBalancer() *Balancer {
+	b := New()
+	b.rand = rand.New(rand.NewSource(1))
+	return b
+}
+
+func names(candidates []Candidate) []string {
+	result := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		result = append(result, c.Name)
+	}
+	return result
+}
+
+// firstCounts 统计多次排序中每个端点排在第一位的次数
+func firstCounts(b *Balancer, candidates []Candidate, latencyAware bool) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		counts[b.Order(candidates, latencyAware)[0].Name]++
+	}
+	return counts
+}
+
+func TestOrderByPriority(t *testing.T) {
+	b := newTestBalancer()
+	candidates := []Candidate{
+		{Name: "backup", Priority: 1},
+		{Name: "us", Weight: 5},
+		{Name: "eu", Weight: 5},
+	}
+	for i := 0; i < 100; i++ {
+		ordered := names(b.Order(candidates, false))
+		if len(ordered) != 3 || ordered[2] != "backup" {
+			t.Fatalf("order = %v, backup tier should come last", ordered)
+		}
+	}
+}
+
+func TestOrderByWeight(t *testing.T) {
+	b := newTestBalancer()
+	counts := firstCounts(b, []Candidate{{Name: "heavy", Weight: 3}, {Name: "light"}}, false)
+	// 期望约 3:1
+	if ratio := float64(counts["heavy"]) / float64(counts["light"]); ratio < 2.5 || ratio > 3.5 {
+		t.Errorf("counts = %v, ratio %.2f", counts, ratio)
+	}
+}
+
+func TestUnhealthyEndpointsComeLast(t *testing.T) {
+	b := newTestBalancer()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	candidates := []Candidate{{Name: "primary"}, {Name: "backup", Priority: 1}}
+
+	// 未达到阈值时仍视为健康
+	b.ReportHealth("primary", errors.New("connection refused"), 2, now)
+	if ordered := names(b.Order(candidates, false)); ordered[0] != "primary" {
+		t.Fatalf("order = %v", ordered)
+	}
+	b.ReportHealth("primary", errors.New("connection refused"), 2, now)
+	if ordered := names(b.Order(candidates, false)); ordered[0] != "backup" || ordered[1] != "primary" {
+		t.Fatalf("order = %v, unhealthy primary should be tried last", ordered)
+	}
+
+	statuses := b.Statuses([]string{"primary", "backup"})
+	if statuses[1].Name != "primary" || statuses[1].Healthy || statuses[1].ConsecutiveFailures != 2 || statuses[1].LastError != "connection refused" || !statuses[1].LastCheck.Equal(now) {
+		t.Errorf("statuses = %+v", statuses)
+	}
+
+	// 一次成功即恢复
+	b.ReportHealth("primary", nil, 2, now)
+	if ordered := names(b.Order(candidates, false)); ordered[0] != "primary" {
+		t.Errorf("order = %v after recovery", ordered)
+	}
+}
+
+func TestLatencyAwareOrder(t *testing.T) {
+	b := newTestBalancer()
+	candidates := []Candidate{{Name: "fast"}, {Name: "slow"}}
+	b.ObserveLatency("fast", 100*time.Millisecond)
+	b.ObserveLatency("slow", 400*time.Millisecond)
+
+	// 不考虑延迟时各占一半
+	counts := firstCounts(b, candidates, false)
+	if counts["fast"] < 4500 || counts["fast"] > 5500 {
+		t.Errorf("weighted counts = %v", counts)
+	}
+	// 考虑延迟时约 4:1
+	counts = firstCounts(b, candidates, true)
+	if ratio := float64(counts["fast"]) / float64(counts["slow"]); ratio < 3.3 || ratio > 4.8 {
+		t.Errorf("latency counts = %v, ratio %.2f", counts, ratio)
+	}
+}
+
+func TestObserveLatencyMovingAverage(t *testing.T) {
+	b := newTestBalancer()
+	b.ObserveLatency("a", 100*time.Millisecond)
+	b.ObserveLatency("a", 200*time.Millisecond)
+	if latency := b.Statuses([]string{"a"})[0].LatencyMs; latency != 120 {
+		t.Errorf("latency = %v, want 120", latency)
+	}
+	b.Reset()
+	if latency := b.Statuses([]string{"a"})[0].LatencyMs; latency != 0 {
+		t.Errorf("latency after Reset = %v", latency)
+	}
+}
@@ -0,0 +1,242 @@
+package breaker
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// State 熔断器状态
+type State string
+
+const (
+	Closed   State = "closed"    // 正常放行
+	Open     State = "open"      // 快速失败，不访问上游
+	HalfOpen State = "half_open" // 放行少量探测请求，成功后关闭
+)
+
+// Outcome 一次上游调用的结果
+type Outcome int
+
+const (
+	Success Outcome = iota
+	Failure
+	Ignored // 未实际访问上游（例如请求被取消），只释放探测名额
+)
+
+// Settings 熔断条件，ConsecutiveFailures 或 FailureRate 为 0 时不按该条件判断
+type Settings struct {
+	ConsecutiveFailures int
+	FailureRate         float64
+	MinRequests         int
+	Window              time.Duration
+	OpenDuration        time.Duration
+	HalfOpenRequests    int
+}
+
+// OpenError 熔断器打开时返回的错误
+type OpenError struct {
+	Key        string
+	RetryAfter time.Duration
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("circuit breaker %s is open, retry after %s", e.Key, e.RetryAfter.Round(time.Second))
+}
+
+// bucket 一秒内的请求统计
+type bucket struct {
+	second   int64
+	requests int
+	failures int
+}
+
+// breaker 单个熔断器
+type breaker struct {
+	state       State
+	consecutive int
+	buckets     []bucket
+	openedAt    time.Time
+	probes      int // 半开状态下进行中的探测请求数
+}
+
+// Status 熔断器的状态快照
+type Status struct {
+	Key                 string     `json:"key"`
+	State               State      `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	Requests            int        `json:"requests"` // 统计窗口内的请求数
+	Failures            int        `json:"failures"`
+	FailureRate         float64    `json:"failure_rate"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	RetryAfterSeconds   float64    `json:"retry_after_seconds,omitempty"`
+}
+
+// Set 按 key 管理一组熔断器，设置在每次调用时传入，修改配置后立即生效
+type Set struct {
+	mu       sync.Mutex
+	breakers map[string]*breaker
+	now      func() time.Time
+}
+
+// NewSet 创建熔断器集合
+func NewSet() *Set {
+	return &Set{breakers: make(map[string]*breaker), now: time.Now}
+}
+
+// Allow 判断是否放行请求，放行时返回的 done 必须在请求结束后调用一次
+// 熔断器打开时返回 *OpenError
+func (s *Set) Allow(key string, settings Settings) (done func(Outcome), err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	b := s.breakers[key]
+	if b == nil {
+		b = &breaker{state: Closed}
+		s.breakers[key] = b
+	}
+
+	probe := false
+	switch b.state {
+	case Open:
+		if elapsed := now.Sub(b.openedAt); elapsed < settings.OpenDuration {
+			return nil, &OpenError{Key: key, RetryAfter: settings.OpenDuration - elapsed}
+		}
+		b.state = HalfOpen
+		b.probes = 0
+		fallthrough
+	case HalfOpen:
+		if b.probes >= max(settings.HalfOpenRequests, 1) {
+			return nil, &OpenError{Key: key, RetryAfter: time.Second}
+		}
+		b.probes++
+		probe = true
+	}
+
+	var once sync.Once
+	return func(outcome Outcome) {
+		once.Do(func() { s.record(b, settings, outcome, probe) })
+	}, nil
+}
+
+// record 记录调用结果并更新状态
+func (s *Set) record(b *breaker, settings Settings, outcome Outcome, probe bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if probe && b.probes > 0 {
+		b.probes--
+	}
+	switch outcome {
+	case Success:
+		b.consecutive = 0
+		b.add(now, settings.Window, false)
+		if b.state == HalfOpen && probe {
+			// 探测成功，重新开始统计
+			b.state = Closed
+			b.buckets = nil
+		}
+	case Failure:
+		b.consecutive++
+		b.add(now, settings.Window, true)
+		switch {
+		case b.state == HalfOpen && probe:
+			b.trip(now)
+		case b.state == Closed && b.shouldTrip(now, settings):
+			b.trip(now)
+		}
+	}
+}
+
+func (b *breaker) trip(now time.Time) {
+	b.state = Open
+	b.openedAt = now
+	b.probes = 0
+}
+
+func (b *breaker) shouldTrip(now time.Time, settings Settings) bool {
+	if settings.ConsecutiveFailures > 0 && b.consecutive >= settings.ConsecutiveFailures {
+		return true
+	}
+	if settings.FailureRate <= 0 {
+		return false
+	}
+	requests, failures := b.totals(now, settings.Window)
+	return requests > 0 && requests >= settings.MinRequests && float64(failures)/float64(requests) >= settings.FailureRate
+}
+
+// windowSeconds 统计窗口的秒数，至少 1 秒
+func windowSeconds(window time.Duration) int {
+	if n := int(window / time.Second); n > 0 {
+		return n
+	}
+	return 1
+}
+
+// add 将结果计入当前秒的统计，窗口大小变化时丢弃旧统计
+func (b *breaker) add(now time.Time, window time.Duration, failed bool) {
+	n := windowSeconds(window)
+	if len(b.buckets) != n {
+		b.buckets = make([]bucket, n)
+	}
+	second := now.Unix()
+	slot := &b.buckets[second%int64(n)]
+	if slot.second != second {
+		*slot = bucket{second: second}
+	}
+	slot.requests++
+	if failed {
+		slot.failures++
+	}
+}
+
+// totals 统计窗口内的请求数和失败数
+func (b *breaker) totals(now time.Time, window time.Duration) (requests, failures int) {
+	since := now.Unix() - int64(windowSeconds(window))
+	for _, slot := range b.buckets {
+		if slot.second > since {
+			requests += slot.requests
+			failures += slot.failures
+		}
+	}
+	return requests, failures
+}
+
+// Statuses 返回所有熔断器的状态，按 key 排序
+func (s *Set) Statuses(settings Settings) []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	statuses := make([]Status, 0, len(s.breakers))
+	for key, b := range s.breakers {
+		status := Status{Key: key, State: b.state, ConsecutiveFailures: b.consecutive}
+		status.Requests, status.Failures = b.totals(now, settings.Window)
+		if status.Requests > 0 {
+			status.FailureRate = float64(status.Failures) / float64(status.Requests)
+		}
+		if b.state == Open {
+			openedAt := b.openedAt.UTC()
+			status.OpenedAt = &openedAt
+			if remaining := settings.OpenDuration - now.Sub(b.openedAt); remaining > 0 {
+				status.RetryAfterSeconds = remaining.Seconds()
+			} else {
+				// 下一个请求将作为探测请求放行
+				status.State = HalfOpen
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Key < statuses[j].Key })
+	return statuses
+}
+
+// Reset 清除所有熔断器
+func (s *Set) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.breakers = make(map[string]*breaker)
+}
@@ -0,0 +1,164 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var testSettings = Settings{
+	ConsecutiveFailures: 3,
+	FailureRate:         0.5,
+	MinRequests:         10,
+	Window:              time.Minute,
+	OpenDuration:        30 * time.Second,
+	HalfOpenRequests:    1,
+}
+
+// newTestSet 创建使用可控时钟的熔断器集合
+func newTestSet() (*Set, *time.Time) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	set := NewSet()
+	set.now = func() time.Time { return now }
+	return set, &now
+}
+
+func call(t *testing.T, set *Set, outcome Outcome) error {
+	t.Helper()
+	done, err := set.Allow("endpoint:anthropic", testSettings)
+	if err != nil {
+		return err
+	}
+	done(outcome)
+	return nil
+}
+
+func TestOpensAfterConsecutiveFailures(t *testing.T) {
+	set, now := newTestSet()
+	for i := 0; i < 2; i++ {
+		if err := call(t, set, Failure); err != nil {
+			t.Fatalf("call %d rejected: %v", i, err)
+		}
+	}
+	// 成功会重置连续失败计数
+	_ = call(t, set, Success)
+	for i := 0; i < 3; i++ {
+		if err := call(t, set, Failure); err != nil {
+			t.Fatalf("call %d rejected: %v", i, err)
+		}
+	}
+
+	err := call(t, set, Success)
+	var openErr *OpenError
+	if !errors.As(err, &openErr) || openErr.RetryAfter != 30*time.Second {
+		t.Fatalf("err = %v, want OpenError with 30s retry", err)
+	}
+
+	*now = now.Add(10 * time.Second)
+	statuses := set.Statuses(testSettings)
+	if len(statuses) != 1 || statuses[0].State != Open || statuses[0].RetryAfterSeconds != 20 || statuses[0].ConsecutiveFailures != 3 {
+		t.Errorf("statuses = %+v", statuses)
+	}
+}
+
+func TestOpensOnFailureRate(t *testing.T) {
+	set, _ := newTestSet()
+	for i := 0; i < 10; i++ {
+		outcome := Success
+		if i%2 == 1 {
+			outcome = Failure
+		}
+		if err := call(t, set, outcome); err != nil {
+			t.Fatalf("call %d rejected: %v", i, err)
+		}
+	}
+	if err := call(t, set, Success); err == nil {
+		t.Error("expected breaker to open at 50% failure rate")
+	}
+}
+
+func TestFailureRateWindowExpires(t *testing.T) {
+	set, now := newTestSet()
+	for i := 0; i < 9; i++ {
+		outcome := Success
+		if i%2 == 0 {
+			outcome = Failure
+		}
+		_ = call(t, set, outcome)
+	}
+	// 窗口外的失败不再计入
+	*now = now.Add(2 * time.Minute)
+	_ = call(t, set, Failure)
+	if err := call(t, set, Success); err != nil {
+		t.Errorf("breaker opened on expired failures: %v", err)
+	}
+}
+
+func TestHalfOpenProbe(t *testing.T) {
+	set, now := newTestSet()
+	for i := 0; i < 3; i++ {
+		_ = call(t, set, Failure)
+	}
+
+	// 打开时间结束后只放行一个探测请求
+	*now = now.Add(30 * time.Second)
+	done, err := set.Allow("endpoint:anthropic", testSettings)
+	if err != nil {
+		t.Fatalf("probe rejected: %v", err)
+	}
+	if _, err := set.Allow("endpoint:anthropic", testSettings); err == nil {
+		t.Error("second concurrent probe should be rejected")
+	}
+
+	// 探测失败重新打开
+	done(Failure)
+	if err := call(t, set, Success); err == nil {
+		t.Error("breaker should reopen after failed probe")
+	}
+
+	// 探测成功后关闭
+	*now = now.Add(30 * time.Second)
+	if err := call(t, set, Success); err != nil {
+		t.Fatalf("probe rejected: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := call(t, set, Failure); err != nil {
+			t.Fatalf("breaker did not close after successful probe: %v", err)
+		}
+	}
+	if statuses := set.Statuses(testSettings); statuses[0].State != Closed {
+		t.Errorf("state = %s", statuses[0].State)
+	}
+}
+
+func TestIgnoredOutcomeReleasesProbe(t *testing.T) {
+	set, now := newTestSet()
+	for i := 0; i < 3; i++ {
+		_ = call(t, set, Failure)
+	}
+	*now = now.Add(30 * time.Second)
+
+	done, err := set.Allow("endpoint:anthropic", testSettings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done(Ignored)
+	done(Failure) // 重复调用无效
+	if err := call(t, set, Success); err != nil {
+		t.Errorf("probe slot not released: %v", err)
+	}
+}
+
+func TestKeysAreIndependent(t *testing.T) {
+	set, _ := newTestSet()
+	for i := 0; i < 3; i++ {
+		_ = call(t, set, Failure)
+	}
+	if _, err := set.Allow("model:claude", testSettings); err != nil {
+		t.Errorf("unrelated key rejected: %v", err)
+	}
+	set.Reset()
+	if err := call(t, set, Success); err != nil {
+		t.Errorf("Reset did not clear breakers: %v", err)
+	}
+}
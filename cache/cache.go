@@ -0,0 +1,28 @@
+package cache
+
+import (
+	"time"
+)
+
+// Backend 响应缓存后端
+type Backend interface {
+	// Get 获取缓存内容，不存在或已过期时返回 false
+	Get(key string) ([]byte, bool)
+	// Set 写入缓存内容，ttl <= 0 表示永不过期
+	Set(key string, value []byte, ttl time.Duration)
+	// Delete 删除缓存内容
+	Delete(key string)
+}
+
+// expiresAt 根据 ttl 计算过期时间，零值表示永不过期
+func expiresAt(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+// isExpired 检查是否已过期
+func isExpired(expires time.Time) bool {
+	return !expires.IsZero() && time.Now().After(expires)
+}
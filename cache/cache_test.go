@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryLRUEviction(t *testing.T) {
+	c := NewMemoryLRU(2)
+	c.Set("a", []byte("1"), 0)
+	c.Set("b", []byte("2"), 0)
+	c.Get("a") // a 成为最近使用
+	c.Set("c", []byte("3"), 0)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("least recently used entry 'b' should be evicted")
+	}
+	if v, ok := c.Get("a"); !ok || string(v) != "1" {
+		t.Errorf("Get(a) = %q, %v", v, ok)
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", c.Len())
+	}
+}
+
+func TestBackendsTTL(t *testing.T) {
+	disk, err := NewDisk(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, backend := range map[string]Backend{"memory": NewMemoryLRU(10), "disk": disk} {
+		t.Run(name, func(t *testing.T) {
+			backend.Set("live", []byte("x"), time.Hour)
+			backend.Set("expired", []byte("y"), time.Nanosecond)
+			time.Sleep(time.Millisecond)
+
+			if v, ok := backend.Get("live"); !ok || string(v) != "x" {
+				t.Errorf("Get(live) = %q, %v", v, ok)
+			}
+			if _, ok := backend.Get("expired"); ok {
+				t.Error("expired entry should not be returned")
+			}
+			backend.Delete("live")
+			if _, ok := backend.Get("live"); ok {
+				t.Error("deleted entry should not be returned")
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// validKey 磁盘缓存的 key 会作为文件名，只允许安全字符
+var validKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// diskEntry 磁盘缓存文件内容
+type diskEntry struct {
+	ExpiresAt time.Time `json:"expires_at"`
+	Value     []byte    `json:"value"`
+}
+
+// Disk 基于文件的缓存，每个 key 一个文件，进程重启后仍然有效
+type Disk struct {
+	dir string
+}
+
+// NewDisk 创建磁盘缓存，目录不存在时自动创建
+func NewDisk(dir string) (*Disk, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建缓存目录失败: %w", err)
+	}
+	return &Disk{dir: dir}, nil
+}
+
+// Get 获取缓存内容
+func (d *Disk) Get(key string) ([]byte, bool) {
+	path, ok := d.path(key)
+	if !ok {
+		return nil, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	var entry diskEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false
+	}
+	if isExpired(entry.ExpiresAt) {
+		_ = os.Remove(path)
+		return nil, false
+	}
+	return entry.Value, true
+}
+
+// Set 写入缓存内容，先写临时文件再重命名，避免并发读到半个文件
+func (d *Disk) Set(key string, value []byte, ttl time.Duration) {
+	path, ok := d.path(key)
+	if !ok {
+		return
+	}
+	data, err := json.Marshal(diskEntry{ExpiresAt: expiresAt(ttl), Value: value})
+	if err != nil {
+		return
+	}
+
+	tmp, err := os.CreateTemp(d.dir, key+".*.tmp")
+	if err != nil {
+		return
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+}
+
+// Delete 删除缓存内容
+func (d *Disk) Delete(key string) {
+	if path, ok := d.path(key); ok {
+		_ = os.Remove(path)
+	}
+}
+
+func (d *Disk) path(key string) (string, bool) {
+	if !validKey.MatchString(key) {
+		return "", false
+	}
+	return filepath.Join(d.dir, key+".json"), true
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"factory-go-api/breaker"
+	"factory-go-api/config"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// circuitBreakers 上游熔断器，按端点（endpoint:<name>）和模型（model:<id>）分别统计
+var circuitBreakers = breaker.NewSet()
+
+// circuitBreakerSettings 将配置转换为熔断条件
+func circuitBreakerSettings(cfg config.CircuitBreakerConfig) breaker.Settings {
+	return breaker.Settings{
+		ConsecutiveFailures: cfg.ConsecutiveFailures,
+		FailureRate:         cfg.FailureRate,
+		MinRequests:         cfg.MinRequests,
+		Window:              time.Duration(cfg.WindowSeconds) * time.Second,
+		OpenDuration:        time.Duration(cfg.OpenSeconds) * time.Second,
+		HalfOpenRequests:    cfg.HalfOpenRequests,
+	}
+}
+
+// allowUpstream 检查端点和模型的熔断器，未启用熔断时总是放行
+// 放行时返回的 done 需要在拿到上游响应（或请求失败）后调用；熔断器打开时返回 *breaker.OpenError
+func allowUpstream(endpoint *config.Endpoint, model *config.Model) (done func(*http.Response, error), err error) {
+	cfg := config.GetCircuitBreakerConfig()
+	if !cfg.Enabled {
+		return func(*http.Response, error) {}, nil
+	}
+	settings := circuitBreakerSettings(cfg)
+
+	endpointDone, err := circuitBreakers.Allow("endpoint:"+endpoint.Name, settings)
+	if err != nil {
+		return nil, err
+	}
+	modelDone, err := circuitBreakers.Allow("model:"+model.ID, settings)
+	if err != nil {
+		endpointDone(breaker.Ignored)
+		return nil, err
+	}
+	return func(resp *http.Response, err error) {
+		outcome := upstreamOutcome(resp, err)
+		endpointDone(outcome)
+		modelDone(outcome)
+	}, nil
+}
+
+// upstreamOutcome 连接失败、超时和 5xx 计为失败
+// 4xx（包括 429）是请求本身或配额的问题，不触发熔断；客户端取消的请求不计入
+func upstreamOutcome(resp *http.Response, err error) breaker.Outcome {
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return breaker.Ignored
+		}
+		return breaker.Failure
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return breaker.Failure
+	}
+	return breaker.Success
+}
+
+// writeCircuitOpenError 熔断器打开时直接返回 503，不等待上游超时
+func writeCircuitOpenError(w http.ResponseWriter, err error) {
+	retryAfter := 1
+	var openErr *breaker.OpenError
+	if errors.As(err, &openErr) {
+		retryAfter = int(math.Ceil(openErr.RetryAfter.Seconds()))
+	}
+	log.Printf("⛔ 熔断: %v", err)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	w.WriteHeader(http.StatusServiceUnavailable)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": "Upstream is temporarily unavailable after repeated failures (" + err.Error() + ")",
+			"type":    "server_error",
+			"code":    "circuit_open",
+		},
+	}); err != nil {
+		log.Printf("错误: 编码响应失败: %v", err)
+	}
+}
+
+// circuitBreakerStatuses 返回所有熔断器的状态
+func circuitBreakerStatuses() []breaker.Status {
+	return circuitBreakers.Statuses(circuitBreakerSettings(config.GetCircuitBreakerConfig()))
+}
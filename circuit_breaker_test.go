@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"factory-go-api/breaker"
+	"factory-go-api/config"
+	"factory-go-api/mockupstream"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// withCircuitBreaker 启用熔断（连续失败 2 次打开）并使用独立的熔断器集合
+func withCircuitBreaker(t *testing.T) {
+	t.Helper()
+	cfg := *config.GetConfig()
+	cfg.CircuitBreaker = config.CircuitBreakerConfig{
+		Enabled:             true,
+		ConsecutiveFailures: 2,
+		FailureRate:         0.5,
+		MinRequests:         20,
+		WindowSeconds:       60,
+		OpenSeconds:         30,
+		HalfOpenRequests:    1,
+	}
+	config.SetConfig(&cfg)
+
+	previous := circuitBreakers
+	circuitBreakers = breaker.NewSet()
+	t.Cleanup(func() { circuitBreakers = previous })
+}
+
+func TestCircuitBreakerFailsFast(t *testing.T) {
+	upstream := newTestUpstream(t)
+	withCircuitBreaker(t)
+	upstream.Enqueue(
+		mockupstream.Reply{Status: http.StatusServiceUnavailable, ErrorType: "overloaded_error", ErrorMessage: "down"},
+		mockupstream.Reply{Status: http.StatusBadGateway, ErrorType: "api_error", ErrorMessage: "down"},
+	)
+
+	const body = `{"model":"claude-test","messages":[{"role":"user","content":"Hello"}]}`
+	for i := 0; i < 2; i++ {
+		if rr := postChat(t, body); rr.Code < http.StatusInternalServerError {
+			t.Fatalf("request %d status = %d", i, rr.Code)
+		}
+	}
+
+	rr := postChat(t, body)
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") != "30" || !strings.Contains(rr.Body.String(), `"circuit_open"`) {
+		t.Errorf("status = %d, Retry-After = %q, body = %s", rr.Code, rr.Header().Get("Retry-After"), rr.Body.String())
+	}
+	if n := len(upstream.Requests()); n != 2 {
+		t.Errorf("upstream received %d requests, want 2", n)
+	}
+
+	// 同一端点的其他模型也快速失败，其他端点不受影响
+	if rr := postChat(t, `{"model":"claude-thinking","messages":[{"role":"user","content":"Hello"}]}`); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("claude-thinking status = %d", rr.Code)
+	}
+	upstream.Enqueue(mockupstream.Reply{Text: "Hi"})
+	if rr := postChat(t, `{"model":"gpt-test","messages":[{"role":"user","content":"Hello"}]}`); rr.Code != http.StatusOK {
+		t.Errorf("gpt-test status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+
+	// token 计数退回本地估算
+	rr = postTokenCount(t, "/v1/token_count", body)
+	if rr.Code != http.StatusOK || rr.Header().Get("X-Token-Count-Source") != "estimate" {
+		t.Errorf("token count status = %d, source = %q", rr.Code, rr.Header().Get("X-Token-Count-Source"))
+	}
+}
+
+func TestCircuitBreakerIgnoresClientErrors(t *testing.T) {
+	upstream := newTestUpstream(t)
+	withCircuitBreaker(t)
+	for i := 0; i < 3; i++ {
+		upstream.Enqueue(mockupstream.Reply{Status: http.StatusTooManyRequests, ErrorType: "rate_limit_error", ErrorMessage: "slow down"})
+	}
+	for i := 0; i < 3; i++ {
+		if rr := postChat(t, `{"model":"claude-test","messages":[{"role":"user","content":"Hello"}]}`); rr.Code != http.StatusTooManyRequests {
+			t.Errorf("request %d status = %d", i, rr.Code)
+		}
+	}
+}
+
+func TestHealthReportsCircuitBreakers(t *testing.T) {
+	upstream := newTestUpstream(t)
+	withCircuitBreaker(t)
+
+	health := func() map[string]interface{} {
+		rr := httptest.NewRecorder()
+		healthHandler(rr, httptest.NewRequest(http.MethodGet, "/health", nil))
+		var resp map[string]interface{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	if resp := health(); resp["status"] != "healthy" {
+		t.Errorf("status = %v", resp["status"])
+	}
+
+	upstream.Enqueue(
+		mockupstream.Reply{Status: http.StatusServiceUnavailable, ErrorMessage: "down"},
+		mockupstream.Reply{Status: http.StatusServiceUnavailable, ErrorMessage: "down"},
+	)
+	for i := 0; i < 2; i++ {
+		postChat(t, `{"model":"claude-test","messages":[{"role":"user","content":"Hello"}]}`)
+	}
+
+	resp := health()
+	if resp["status"] != "degraded" {
+		t.Errorf("status = %v", resp["status"])
+	}
+	states := make(map[string]string)
+	for _, item := range resp["circuit_breakers"].([]interface{}) {
+		b := item.(map[string]interface{})
+		states[b["key"].(string)] = b["state"].(string)
+	}
+	if states["endpoint:anthropic"] != "open" || states["model:claude-test"] != "open" {
+		t.Errorf("circuit breakers = %v", states)
+	}
+}
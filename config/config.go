@@ -9,29 +9,217 @@ import (
 
 // Endpoint 端点配置
 type Endpoint struct {
-	Name    string `json:"name"`
-	BaseURL string `json:"base_url"`
+	Name      string           `json:"name"`
+	Type      string           `json:"type,omitempty"` // 端点类型（anthropic / openai），为空时与 name 相同；同一类型可配置多个端点
+	BaseURL   string           `json:"base_url"`
+	APIKey    string           `json:"api_key,omitempty"`   // 访问该端点的上游 Key，为空时使用 FACTORY_API_KEY
+	Disabled  bool             `json:"disabled,omitempty"`  // 停用后不再向该端点转发请求
+	Transport *TransportConfig `json:"transport,omitempty"` // 连接池、TLS 和代理设置，为空时使用默认值
+	Weight    int              `json:"weight,omitempty"`    // 同一优先级内的负载均衡权重，默认 1
+	Priority  int              `json:"priority,omitempty"`  // 数值小的优先，同一优先级的端点都不可用时才使用下一级
+	// HealthCheckURL 健康检查地址，为空时使用 base_url；返回 5xx 或连接失败视为异常
+	HealthCheckURL string `json:"health_check_url,omitempty"`
+}
+
+// EndpointType 端点类型，未配置 type 时使用 name
+func (e *Endpoint) EndpointType() string {
+	if e.Type != "" {
+		return e.Type
+	}
+	return e.Name
+}
+
+// 出站代理的特殊取值
+const (
+	ProxyFromEnvironment = ""       // 使用 HTTPS_PROXY / HTTP_PROXY / NO_PROXY 环境变量（默认）
+	ProxyDirect          = "direct" // 忽略环境变量，直接连接
+)
+
+// TransportConfig 端点的上游连接设置，同一端点的请求共享一个连接池
+type TransportConfig struct {
+	TimeoutSeconds         int    `json:"timeout_seconds,omitempty"`           // 单次请求的总超时，默认 120
+	MaxIdleConns           int    `json:"max_idle_conns,omitempty"`            // 默认 100
+	MaxIdleConnsPerHost    int    `json:"max_idle_conns_per_host,omitempty"`   // 默认 20
+	MaxConnsPerHost        int    `json:"max_conns_per_host,omitempty"`        // 0 表示不限制
+	IdleConnTimeoutSeconds int    `json:"idle_conn_timeout_seconds,omitempty"` // 默认 90
+	DisableHTTP2           bool   `json:"disable_http2,omitempty"`
+	TLSMinVersion          string `json:"tls_min_version,omitempty"`      // 1.0、1.1、1.2（默认）或 1.3
+	TLSServerName          string `json:"tls_server_name,omitempty"`      // 覆盖 SNI 和证书校验使用的主机名
+	CAFile                 string `json:"ca_file,omitempty"`              // 额外信任的 CA 证书（PEM），用于企业代理或自签名上游
+	InsecureSkipVerify     bool   `json:"insecure_skip_verify,omitempty"` // 跳过证书校验，仅用于调试
+	// Proxy 出站代理地址，支持 http://、https:// 和 socks5://，为空时读取环境变量，direct 表示不使用代理
+	Proxy string `json:"proxy,omitempty"`
+	// DNSOverrides 将主机名（或 主机:端口）解析到指定地址，类似 curl --resolve
+	DNSOverrides map[string]string `json:"dns_overrides,omitempty"`
 }
 
 // Model 模型配置
 type Model struct {
-	Name      string `json:"name"`
-	ID        string `json:"id"`
-	Type      string `json:"type"`
-	Reasoning string `json:"reasoning"`
+	Name          string              `json:"name"`
+	ID            string              `json:"id"`
+	Type          string              `json:"type"`
+	Reasoning     string              `json:"reasoning"`
+	SystemPrompt  *SystemPromptPolicy `json:"system_prompt,omitempty"`
+	ContextWindow int                 `json:"context_window,omitempty"` // 上下文窗口（输入 + 输出 token），0 表示不检查
+	MaxOutput     int                 `json:"max_output,omitempty"`     // 最大输出 token 数
+	Disabled      bool                `json:"disabled,omitempty"`       // 停用后不再出现在模型列表中，请求返回 404
+	InputPrice    float64             `json:"input_price,omitempty"`    // 输入价格（美元 / 百万 token），用于统计费用
+	OutputPrice   float64             `json:"output_price,omitempty"`   // 输出价格（美元 / 百万 token）
+	Endpoint      string              `json:"endpoint,omitempty"`       // 使用的端点类型，为空时与 type 相同
+	UpstreamModel string              `json:"upstream_model,omitempty"` // 发送给上游的模型名，为空时使用 id（openai-chat 和 gemini）
+}
+
+// EndpointType 模型使用的端点类型，未配置 endpoint 时使用 type
+func (m *Model) EndpointType() string {
+	if m.Endpoint != "" {
+		return m.Endpoint
+	}
+	return m.Type
+}
+
+// 系统提示词注入方式
+const (
+	SystemPromptPrepend  = "prepend"  // 放在客户端 system 消息之前（默认）
+	SystemPromptAppend   = "append"   // 放在客户端 system 消息之后
+	SystemPromptReplace  = "replace"  // 替换客户端 system 消息
+	SystemPromptDisabled = "disabled" // 不注入
+)
+
+// SystemPromptPolicy 系统提示词注入策略，可配置在全局、模型和客户端上
+// Prompt 支持模板变量 {{date}}、{{datetime}}、{{model}}、{{client}}
+type SystemPromptPolicy struct {
+	Mode   string `json:"mode"`
+	Prompt string `json:"prompt,omitempty"` // 为空时沿用上一级的提示词
+}
+
+// Client 客户端配置，每个客户端使用独立的 Key 访问代理
+type Client struct {
+	Name         string              `json:"name"`
+	Key          string              `json:"key"`
+	SystemPrompt *SystemPromptPolicy `json:"system_prompt,omitempty"`
+}
+
+// ImageFetchConfig 远程图片拉取配置
+// 启用后，远程图片 URL 会被代理下载并以 base64 内联发送给上游
+type ImageFetchConfig struct {
+	Enabled      bool     `json:"enabled"`
+	MaxBytes     int64    `json:"max_bytes"`
+	AllowedHosts []string `json:"allowed_hosts"`
+}
+
+// FileInputConfig 文件（PDF 等文档）输入配置
+type FileInputConfig struct {
+	MaxBytes int64 `json:"max_bytes"`
+}
+
+// StructuredOutputConfig 结构化输出配置
+type StructuredOutputConfig struct {
+	// Validate 为 true 时在服务端按 response_format 的 JSON schema 校验非流式响应
+	Validate bool `json:"validate"`
+}
+
+// PromptCacheConfig Anthropic prompt caching 自动断点配置
+type PromptCacheConfig struct {
+	Enabled bool `json:"enabled"`
+	// CacheSystem 缓存 system 块（包含注入的全局系统提示词）
+	CacheSystem bool `json:"cache_system"`
+	// CacheLastTurns 缓存最近 N 条 user 消息
+	CacheLastTurns int `json:"cache_last_turns"`
+}
+
+// ResponseCacheConfig 响应缓存配置
+type ResponseCacheConfig struct {
+	Enabled    bool   `json:"enabled"`
+	Backend    string `json:"backend"`     // memory（默认）或 disk
+	MaxEntries int    `json:"max_entries"` // memory 后端的最大条目数
+	Dir        string `json:"dir"`         // disk 后端的缓存目录
+	TTLSeconds int    `json:"ttl_seconds"`
+	// CacheNondeterministic 为 true 时缓存所有请求，默认只缓存 temperature 为 0 或指定了 seed 的请求
+	CacheNondeterministic bool `json:"cache_nondeterministic"`
+}
+
+// RecordingConfig 上游请求录制/回放配置，用于离线测试
+type RecordingConfig struct {
+	Mode     string `json:"mode"`     // off（默认）、record 或 replay
+	Dir      string `json:"dir"`      // 录制目录
+	Match    string `json:"match"`    // 回放匹配策略：exact（默认）、body 或 sequence
+	Strict   bool   `json:"strict"`   // 为 true 时未匹配的请求直接失败，否则转发到真实上游
+	Realtime bool   `json:"realtime"` // 为 true 时按录制的时间间隔回放 SSE
+}
+
+// 上下文超限时的处理策略
+const (
+	ContextStrategyNone       = "none"        // 不处理，超限时返回 400（默认）
+	ContextStrategyDropOldest = "drop_oldest" // 从最早的对话消息开始丢弃
+	ContextStrategyKeepLast   = "keep_last"   // 只保留 system 消息和最近 N 条消息
+	ContextStrategySummarize  = "summarize"   // 将早期消息摘要后替换
+)
+
+// ContextManagementConfig 上下文窗口管理配置，仅对配置了 context_window 的模型生效
+type ContextManagementConfig struct {
+	Strategy         string `json:"strategy"`
+	KeepLast         int    `json:"keep_last"`          // keep_last / summarize 保留的最近消息数
+	SafetyMargin     int    `json:"safety_margin"`      // 为 token 估算误差预留的余量
+	SummaryMaxTokens int    `json:"summary_max_tokens"` // summarize 生成摘要的最大 token 数
+}
+
+// CircuitBreakerConfig 上游熔断配置，熔断器按端点和模型分别统计
+type CircuitBreakerConfig struct {
+	Enabled             bool    `json:"enabled"`
+	ConsecutiveFailures int     `json:"consecutive_failures"` // 连续失败达到该次数后打开
+	FailureRate         float64 `json:"failure_rate"`         // 统计窗口内失败率达到该值后打开（0-1）
+	MinRequests         int     `json:"min_requests"`         // 按失败率判断所需的最少请求数
+	WindowSeconds       int     `json:"window_seconds"`       // 失败率统计窗口
+	OpenSeconds         int     `json:"open_seconds"`         // 打开后经过该时间进入半开状态
+	HalfOpenRequests    int     `json:"half_open_requests"`   // 半开状态允许同时进行的探测请求数
+}
+
+// 负载均衡策略
+const (
+	LoadBalancingWeighted = "weighted" // 同一优先级内按权重随机选择（默认）
+	LoadBalancingLatency  = "latency"  // 权重再按平均延迟调整，优先选择更快的端点
+)
+
+// LoadBalancingConfig 同一类型多个端点之间的负载均衡和健康检查配置
+type LoadBalancingConfig struct {
+	Strategy                   string `json:"strategy"`
+	HealthCheck                bool   `json:"health_check"`                  // 定期检查端点，异常端点排在健康端点之后
+	HealthCheckIntervalSeconds int    `json:"health_check_interval_seconds"` // 检查间隔
+	HealthCheckTimeoutSeconds  int    `json:"health_check_timeout_seconds"`  // 单次检查超时
+	UnhealthyThreshold         int    `json:"unhealthy_threshold"`           // 连续失败达到该次数后标记为异常
 }
 
 // Config 全局配置
 type Config struct {
-	Port         int        `json:"port"`
-	Endpoints    []Endpoint `json:"endpoints"`
-	Models       []Model    `json:"models"`
-	SystemPrompt string     `json:"system_prompt"`
-	UserAgent    string     `json:"user_agent"`
+	Port              int                     `json:"port"`
+	Endpoints         []Endpoint              `json:"endpoints"`
+	Models            []Model                 `json:"models"`
+	SystemPrompt      string                  `json:"system_prompt"`
+	SystemPromptMode  string                  `json:"system_prompt_mode"`
+	Clients           []Client                `json:"clients"`
+	UserAgent         string                  `json:"user_agent"`
+	ImageFetch        ImageFetchConfig        `json:"image_fetch"`
+	FileInput         FileInputConfig         `json:"file_input"`
+	StructuredOutput  StructuredOutputConfig  `json:"structured_output"`
+	StrictParams      bool                    `json:"strict_params"` // 为 true 时无法映射的参数返回 400 而不是忽略
+	PromptCache       PromptCacheConfig       `json:"prompt_cache"`
+	ResponseCache     ResponseCacheConfig     `json:"response_cache"`
+	Recording         RecordingConfig         `json:"recording"`
+	ContextManagement ContextManagementConfig `json:"context_management"`
+	CircuitBreaker    CircuitBreakerConfig    `json:"circuit_breaker"`
+	LoadBalancing     LoadBalancingConfig     `json:"load_balancing"`
 }
 
+// defaultImageMaxBytes 单张图片默认大小上限 (Anthropic 限制为 5MB)
+const defaultImageMaxBytes = 5 * 1024 * 1024
+
+// defaultFileMaxBytes 单个文档默认大小上限 (Anthropic PDF 限制为 32MB)
+const defaultFileMaxBytes = 32 * 1024 * 1024
+
 var (
 	globalConfig *Config
+	globalPath   string // LoadConfig 加载的配置文件路径，UpdateConfig 写回该文件
+	globalRaw    []byte // 配置文件的原始内容，UpdateConfig 在其上合并修改
 	configMutex  sync.RWMutex
 )
 
@@ -46,20 +234,119 @@ func LoadConfig(configPath string) (*Config, error) {
 	if err := json.Unmarshal(data, &cfg); err != nil {
 		return nil, fmt.Errorf("解析配置文件失败: %w", err)
 	}
+	if err := applyDefaults(&cfg); err != nil {
+		return nil, err
+	}
+
+	configMutex.Lock()
+	globalConfig = &cfg
+	globalPath = configPath
+	globalRaw = data
+	configMutex.Unlock()
 
-	// 设置默认值
+	return &cfg, nil
+}
+
+// applyDefaults 设置默认值并校验配置
+func applyDefaults(cfg *Config) error {
 	if cfg.Port == 0 {
 		cfg.Port = 8000
 	}
 	if cfg.UserAgent == "" {
 		cfg.UserAgent = "factory-cli/0.19.3"
 	}
+	if cfg.SystemPromptMode == "" {
+		cfg.SystemPromptMode = SystemPromptPrepend
+	}
+	if cfg.ResponseCache.MaxEntries <= 0 {
+		cfg.ResponseCache.MaxEntries = 1000
+	}
+	if cfg.ResponseCache.Dir == "" {
+		cfg.ResponseCache.Dir = "data/cache"
+	}
+	if cfg.ResponseCache.TTLSeconds <= 0 {
+		cfg.ResponseCache.TTLSeconds = 3600
+	}
+	if cfg.Recording.Mode == "" {
+		cfg.Recording.Mode = "off"
+	}
+	if cfg.Recording.Dir == "" {
+		cfg.Recording.Dir = "recordings"
+	}
+	if cfg.ContextManagement.Strategy == "" {
+		cfg.ContextManagement.Strategy = ContextStrategyNone
+	}
+	if cfg.ContextManagement.KeepLast <= 0 {
+		cfg.ContextManagement.KeepLast = 20
+	}
+	if cfg.ContextManagement.SafetyMargin <= 0 {
+		cfg.ContextManagement.SafetyMargin = 1024
+	}
+	if cfg.ContextManagement.SummaryMaxTokens <= 0 {
+		cfg.ContextManagement.SummaryMaxTokens = 1024
+	}
+	switch cfg.ContextManagement.Strategy {
+	case ContextStrategyNone, ContextStrategyDropOldest, ContextStrategyKeepLast, ContextStrategySummarize:
+	default:
+		return fmt.Errorf("context_management.strategy 无效: %s", cfg.ContextManagement.Strategy)
+	}
+	if err := validateSystemPromptModes(cfg); err != nil {
+		return err
+	}
+	if cfg.CircuitBreaker.ConsecutiveFailures <= 0 {
+		cfg.CircuitBreaker.ConsecutiveFailures = 5
+	}
+	if cfg.CircuitBreaker.FailureRate <= 0 {
+		cfg.CircuitBreaker.FailureRate = 0.5
+	}
+	if cfg.CircuitBreaker.MinRequests <= 0 {
+		cfg.CircuitBreaker.MinRequests = 20
+	}
+	if cfg.CircuitBreaker.WindowSeconds <= 0 {
+		cfg.CircuitBreaker.WindowSeconds = 60
+	}
+	if cfg.CircuitBreaker.OpenSeconds <= 0 {
+		cfg.CircuitBreaker.OpenSeconds = 30
+	}
+	if cfg.CircuitBreaker.HalfOpenRequests <= 0 {
+		cfg.CircuitBreaker.HalfOpenRequests = 1
+	}
+	if cfg.CircuitBreaker.FailureRate > 1 {
+		return fmt.Errorf("circuit_breaker.failure_rate 必须在 0 到 1 之间: %v", cfg.CircuitBreaker.FailureRate)
+	}
+	if cfg.LoadBalancing.Strategy == "" {
+		cfg.LoadBalancing.Strategy = LoadBalancingWeighted
+	}
+	if cfg.LoadBalancing.HealthCheckIntervalSeconds <= 0 {
+		cfg.LoadBalancing.HealthCheckIntervalSeconds = 30
+	}
+	if cfg.LoadBalancing.HealthCheckTimeoutSeconds <= 0 {
+		cfg.LoadBalancing.HealthCheckTimeoutSeconds = 5
+	}
+	if cfg.LoadBalancing.UnhealthyThreshold <= 0 {
+		cfg.LoadBalancing.UnhealthyThreshold = 2
+	}
+	switch cfg.LoadBalancing.Strategy {
+	case LoadBalancingWeighted, LoadBalancingLatency:
+	default:
+		return fmt.Errorf("load_balancing.strategy 无效: %s", cfg.LoadBalancing.Strategy)
+	}
+	if cfg.ImageFetch.MaxBytes <= 0 {
+		cfg.ImageFetch.MaxBytes = defaultImageMaxBytes
+	}
+	if cfg.FileInput.MaxBytes <= 0 {
+		cfg.FileInput.MaxBytes = defaultFileMaxBytes
+	}
+	return validateEntries(cfg)
+}
 
+// SetConfig 替换全局配置，替换后的配置不再与配置文件关联（UpdateConfig 不会写回文件）
+func SetConfig(cfg *Config) {
 	configMutex.Lock()
-	globalConfig = &cfg
+	globalConfig = cfg
+	globalPath = ""
+	globalRaw = nil
 	configMutex.Unlock()
-
-	return &cfg, nil
 }
 
 // GetConfig 获取全局配置
@@ -77,26 +364,35 @@ func GetModelByID(modelID string) *Model {
 	}
 
 	for _, model := range cfg.Models {
-		if model.ID == modelID {
+		if model.ID == modelID && !model.Disabled {
 			return &model
 		}
 	}
 	return nil
 }
 
-// GetEndpointByType 根据类型获取端点配置
+// GetEndpointByType 根据类型获取第一个启用的端点配置
 func GetEndpointByType(endpointType string) *Endpoint {
+	if endpoints := GetEndpointsByType(endpointType); len(endpoints) > 0 {
+		return &endpoints[0]
+	}
+	return nil
+}
+
+// GetEndpointsByType 获取指定类型的所有启用端点，按配置顺序排列
+func GetEndpointsByType(endpointType string) []Endpoint {
 	cfg := GetConfig()
 	if cfg == nil {
 		return nil
 	}
 
+	var endpoints []Endpoint
 	for _, endpoint := range cfg.Endpoints {
-		if endpoint.Name == endpointType {
-			return &endpoint
+		if endpoint.EndpointType() == endpointType && !endpoint.Disabled {
+			endpoints = append(endpoints, endpoint)
 		}
 	}
-	return nil
+	return endpoints
 }
 
 // GetSystemPrompt 获取系统提示词
@@ -108,6 +404,102 @@ func GetSystemPrompt() string {
 	return cfg.SystemPrompt
 }
 
+// ResolveSystemPromptPolicy 解析最终生效的系统提示词注入策略
+// 优先级：客户端 > 模型 > 全局；上级未设置 prompt 时沿用下级的提示词
+func ResolveSystemPromptPolicy(modelID, clientName string) SystemPromptPolicy {
+	cfg := GetConfig()
+	if cfg == nil {
+		return SystemPromptPolicy{Mode: SystemPromptDisabled}
+	}
+
+	policy := SystemPromptPolicy{Mode: cfg.SystemPromptMode, Prompt: cfg.SystemPrompt}
+	override := func(p *SystemPromptPolicy) {
+		if p == nil {
+			return
+		}
+		if p.Mode != "" {
+			policy.Mode = p.Mode
+		}
+		if p.Prompt != "" {
+			policy.Prompt = p.Prompt
+		}
+	}
+
+	if model := GetModelByID(modelID); model != nil {
+		override(model.SystemPrompt)
+	}
+	if client := GetClientByName(clientName); client != nil {
+		override(client.SystemPrompt)
+	}
+	return policy
+}
+
+// GetClientByKey 根据 Key 获取客户端配置
+func GetClientByKey(key string) *Client {
+	cfg := GetConfig()
+	if cfg == nil || key == "" {
+		return nil
+	}
+
+	for _, client := range cfg.Clients {
+		if client.Key == key {
+			return &client
+		}
+	}
+	return nil
+}
+
+// GetClientByName 根据名称获取客户端配置
+func GetClientByName(name string) *Client {
+	cfg := GetConfig()
+	if cfg == nil || name == "" {
+		return nil
+	}
+
+	for _, client := range cfg.Clients {
+		if client.Name == name {
+			return &client
+		}
+	}
+	return nil
+}
+
+// HasClients 是否配置了客户端 Key
+func HasClients() bool {
+	cfg := GetConfig()
+	return cfg != nil && len(cfg.Clients) > 0
+}
+
+// validateSystemPromptModes 校验所有系统提示词注入方式
+func validateSystemPromptModes(cfg *Config) error {
+	check := func(owner, mode string) error {
+		switch mode {
+		case "", SystemPromptPrepend, SystemPromptAppend, SystemPromptReplace, SystemPromptDisabled:
+			return nil
+		}
+		return fmt.Errorf("%s 的 system_prompt mode 无效: %s", owner, mode)
+	}
+
+	if err := check("全局配置", cfg.SystemPromptMode); err != nil {
+		return err
+	}
+	for _, model := range cfg.Models {
+		if model.SystemPrompt != nil {
+			if err := check("模型 "+model.ID, model.SystemPrompt.Mode); err != nil {
+				return err
+			}
+		}
+	}
+	for _, client := range cfg.Clients {
+		if client.SystemPrompt != nil {
+			if err := check("客户端 "+client.Name, client.SystemPrompt.Mode); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // GetUserAgent 获取 User-Agent
 func GetUserAgent() string {
 	cfg := GetConfig()
@@ -117,6 +509,78 @@ func GetUserAgent() string {
 	return cfg.UserAgent
 }
 
+// GetImageFetchConfig 获取远程图片拉取配置
+func GetImageFetchConfig() ImageFetchConfig {
+	cfg := GetConfig()
+	if cfg == nil {
+		return ImageFetchConfig{MaxBytes: defaultImageMaxBytes}
+	}
+	return cfg.ImageFetch
+}
+
+// GetFileInputConfig 获取文件输入配置
+func GetFileInputConfig() FileInputConfig {
+	cfg := GetConfig()
+	if cfg == nil {
+		return FileInputConfig{MaxBytes: defaultFileMaxBytes}
+	}
+	return cfg.FileInput
+}
+
+// GetStructuredOutputConfig 获取结构化输出配置
+func GetStructuredOutputConfig() StructuredOutputConfig {
+	cfg := GetConfig()
+	if cfg == nil {
+		return StructuredOutputConfig{}
+	}
+	return cfg.StructuredOutput
+}
+
+// GetStrictParams 是否启用严格参数模式
+func GetStrictParams() bool {
+	cfg := GetConfig()
+	if cfg == nil {
+		return false
+	}
+	return cfg.StrictParams
+}
+
+// GetPromptCacheConfig 获取 prompt caching 配置
+func GetPromptCacheConfig() PromptCacheConfig {
+	cfg := GetConfig()
+	if cfg == nil {
+		return PromptCacheConfig{}
+	}
+	return cfg.PromptCache
+}
+
+// GetContextManagementConfig 获取上下文窗口管理配置
+func GetContextManagementConfig() ContextManagementConfig {
+	cfg := GetConfig()
+	if cfg == nil {
+		return ContextManagementConfig{Strategy: ContextStrategyNone}
+	}
+	return cfg.ContextManagement
+}
+
+// GetCircuitBreakerConfig 获取熔断配置
+func GetCircuitBreakerConfig() CircuitBreakerConfig {
+	cfg := GetConfig()
+	if cfg == nil {
+		return CircuitBreakerConfig{}
+	}
+	return cfg.CircuitBreaker
+}
+
+// GetLoadBalancingConfig 获取负载均衡配置
+func GetLoadBalancingConfig() LoadBalancingConfig {
+	cfg := GetConfig()
+	if cfg == nil {
+		return LoadBalancingConfig{Strategy: LoadBalancingWeighted}
+	}
+	return cfg.LoadBalancing
+}
+
 // GetModelReasoning 获取模型的推理等级
 func GetModelReasoning(modelID string) string {
 	model := GetModelByID(modelID)
@@ -132,16 +596,31 @@ func GetModelReasoning(modelID string) string {
 	return ""
 }
 
+// GetModelMaxOutput 获取模型的最大输出 token 数，0 表示未配置
+func GetModelMaxOutput(modelID string) int {
+	model := GetModelByID(modelID)
+	if model == nil {
+		return 0
+	}
+	return model.MaxOutput
+}
+
 // IsModelSupported 检查模型是否支持
 func IsModelSupported(modelID string) bool {
 	return GetModelByID(modelID) != nil
 }
 
-// GetAllModels 获取所有模型列表
+// GetAllModels 获取所有启用的模型列表
 func GetAllModels() []Model {
 	cfg := GetConfig()
 	if cfg == nil {
 		return []Model{}
 	}
-	return cfg.Models
-}
\ No newline at end of file
+	models := make([]Model, 0, len(cfg.Models))
+	for _, model := range cfg.Models {
+		if !model.Disabled {
+			models = append(models, model)
+		}
+	}
+	return models
+}
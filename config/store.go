@@ -0,0 +1,298 @@
+package config
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+)
+
+// ErrInvalidConfig 修改后的配置未通过校验
+var ErrInvalidConfig = errors.New("invalid config")
+
+// updateMutex 串行化配置修改，避免并发修改互相覆盖
+var updateMutex sync.Mutex
+
+// GetConfigPath 获取 LoadConfig 加载的配置文件路径，未从文件加载时为空
+func GetConfigPath() string {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	return globalPath
+}
+
+// UpdateConfig 在当前配置的副本上执行修改，校验通过后原子写回配置文件并替换全局配置
+// 已在处理中的请求继续使用旧配置，新请求使用新配置，无需重启
+// 修改作用在未填充默认值的配置上，配置文件只写入修改的字段，默认值只用于内存中的配置
+// update 返回的错误原样返回；校验失败时返回包装了 ErrInvalidConfig 的错误
+func UpdateConfig(update func(cfg *Config) error) (*Config, error) {
+	updateMutex.Lock()
+	defer updateMutex.Unlock()
+
+	configMutex.RLock()
+	current, path, raw := globalConfig, globalPath, globalRaw
+	configMutex.RUnlock()
+	if current == nil {
+		return nil, errors.New("配置未加载")
+	}
+
+	// 从文件加载的配置在文件原始内容上修改，SetConfig 设置的配置没有对应文件
+	base := current
+	if path != "" {
+		base = &Config{}
+		if err := json.Unmarshal(raw, base); err != nil {
+			return nil, fmt.Errorf("解析配置文件失败: %w", err)
+		}
+	}
+	next, err := cloneConfig(base)
+	if err != nil {
+		return nil, err
+	}
+	if err := update(next); err != nil {
+		return nil, err
+	}
+	effective, err := cloneConfig(next)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyDefaults(effective); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	if path != "" {
+		data, err := mergeConfigFile(raw, base, next)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeConfigFile(path, data); err != nil {
+			return nil, err
+		}
+		raw = data
+	}
+	configMutex.Lock()
+	globalConfig = effective
+	globalRaw = raw
+	configMutex.Unlock()
+	return effective, nil
+}
+
+// ReloadConfig 重新读取配置文件并替换全局配置
+func ReloadConfig() (*Config, error) {
+	updateMutex.Lock()
+	defer updateMutex.Unlock()
+
+	path := GetConfigPath()
+	if path == "" {
+		return nil, errors.New("配置未从文件加载")
+	}
+	return LoadConfig(path)
+}
+
+// cloneConfig 深拷贝配置，修改副本不会影响正在使用旧配置的请求
+func cloneConfig(cfg *Config) (*Config, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("复制配置失败: %w", err)
+	}
+	var clone Config
+	if err := json.Unmarshal(data, &clone); err != nil {
+		return nil, fmt.Errorf("复制配置失败: %w", err)
+	}
+	return &clone, nil
+}
+
+// mergeConfigFile 将 before 到 after 的变化合并到配置文件原始内容中，未修改的字段保持原样
+func mergeConfigFile(raw []byte, before, after *Config) ([]byte, error) {
+	var doc map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("解析配置文件失败: %w", err)
+	}
+	if doc == nil {
+		doc = map[string]interface{}{}
+	}
+	beforeFields, err := configFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := configFields(after)
+	if err != nil {
+		return nil, err
+	}
+	mergeChangedFields(doc, beforeFields, afterFields)
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("序列化配置失败: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// configFields 将配置转换为 JSON 对象，便于按字段比较
+func configFields(cfg *Config) (map[string]interface{}, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("序列化配置失败: %w", err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("序列化配置失败: %w", err)
+	}
+	return fields, nil
+}
+
+// mergeChangedFields 只把 before 与 after 不同的字段写入 doc，对象逐字段合并，数组和其他值整体替换
+func mergeChangedFields(doc, before, after map[string]interface{}) {
+	for key, value := range after {
+		old, existed := before[key]
+		if existed && reflect.DeepEqual(old, value) {
+			continue
+		}
+		oldObject, oldOK := old.(map[string]interface{})
+		newObject, newOK := value.(map[string]interface{})
+		if oldOK && newOK {
+			docObject, ok := doc[key].(map[string]interface{})
+			if !ok {
+				docObject = map[string]interface{}{}
+				doc[key] = docObject
+			}
+			mergeChangedFields(docObject, oldObject, newObject)
+			continue
+		}
+		doc[key] = value
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			delete(doc, key)
+		}
+	}
+}
+
+// writeConfigFile 先写入同目录下的临时文件再重命名，保证配置文件不会处于写了一半的状态
+func writeConfigFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("写入配置文件失败: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // 重命名成功后删除失败无影响
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入配置文件失败: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入配置文件失败: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("写入配置文件失败: %w", err)
+	}
+	// 保留原文件的权限
+	if info, err := os.Stat(path); err == nil {
+		if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+			return fmt.Errorf("写入配置文件失败: %w", err)
+		}
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("写入配置文件失败: %w", err)
+	}
+	return nil
+}
+
+// validateEntries 校验模型、端点和客户端的必填字段及唯一性
+func validateEntries(cfg *Config) error {
+	modelIDs := make(map[string]bool)
+	for _, model := range cfg.Models {
+		if model.ID == "" {
+			return errors.New("模型 id 不能为空")
+		}
+		if modelIDs[model.ID] {
+			return fmt.Errorf("模型 id 重复: %s", model.ID)
+		}
+		modelIDs[model.ID] = true
+		if model.ContextWindow < 0 || model.MaxOutput < 0 {
+			return fmt.Errorf("模型 %s 的 context_window / max_output 不能为负数", model.ID)
+		}
+	}
+
+	endpointNames := make(map[string]bool)
+	for _, endpoint := range cfg.Endpoints {
+		if endpoint.Name == "" || endpoint.BaseURL == "" {
+			return errors.New("端点 name 和 base_url 不能为空")
+		}
+		if endpointNames[endpoint.Name] {
+			return fmt.Errorf("端点名称重复: %s", endpoint.Name)
+		}
+		endpointNames[endpoint.Name] = true
+		if endpoint.Weight < 0 || endpoint.Priority < 0 {
+			return fmt.Errorf("端点 %s 的 weight / priority 不能为负数", endpoint.Name)
+		}
+		if err := validateTransport(endpoint.Transport); err != nil {
+			return fmt.Errorf("端点 %s 的 transport 无效: %w", endpoint.Name, err)
+		}
+	}
+
+	clientNames := make(map[string]bool)
+	clientKeys := make(map[string]bool)
+	for _, client := range cfg.Clients {
+		if client.Name == "" || client.Key == "" {
+			return errors.New("客户端 name 和 key 不能为空")
+		}
+		if clientNames[client.Name] {
+			return fmt.Errorf("客户端名称重复: %s", client.Name)
+		}
+		if clientKeys[client.Key] {
+			return fmt.Errorf("客户端 %s 的 key 与其他客户端重复", client.Name)
+		}
+		clientNames[client.Name] = true
+		clientKeys[client.Key] = true
+	}
+	return nil
+}
+
+// TLSVersions tls_min_version 可用的取值
+var TLSVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// validateTransport 校验端点的连接设置，CA 文件在创建连接池时读取
+func validateTransport(t *TransportConfig) error {
+	if t == nil {
+		return nil
+	}
+	if t.TimeoutSeconds < 0 || t.MaxIdleConns < 0 || t.MaxIdleConnsPerHost < 0 || t.MaxConnsPerHost < 0 || t.IdleConnTimeoutSeconds < 0 {
+		return errors.New("超时和连接数不能为负数")
+	}
+	if _, ok := TLSVersions[t.TLSMinVersion]; t.TLSMinVersion != "" && !ok {
+		return fmt.Errorf("tls_min_version 无效: %s", t.TLSMinVersion)
+	}
+	if t.Proxy != ProxyFromEnvironment && t.Proxy != ProxyDirect {
+		proxyURL, err := url.Parse(t.Proxy)
+		if err != nil {
+			return fmt.Errorf("proxy 无效: %w", err)
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return fmt.Errorf("proxy 不支持的协议: %q", proxyURL.Scheme)
+		}
+		if proxyURL.Host == "" {
+			return errors.New("proxy 缺少主机地址")
+		}
+	}
+	for host, addr := range t.DNSOverrides {
+		if host == "" || addr == "" {
+			return errors.New("dns_overrides 的主机名和地址不能为空")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"factory-go-api/config"
+	"factory-go-api/transformers"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// 上下文管理动作，通过 X-Context-Action 响应头返回
+const (
+	contextActionTruncated  = "truncated"
+	contextActionSummarized = "summarized"
+)
+
+// summaryInstruction 生成早期对话摘要使用的提示词
+const summaryInstruction = "Summarize the following conversation so that it can replace the original messages. " +
+	"Keep facts, decisions, open tasks, file names and code identifiers. Be concise and do not add commentary."
+
+// reservedOutputTokens 为输出预留的 token 数
+// Anthropic 模型按转换时实际发送的 max_tokens 预留，包括默认值和启用 extended thinking 时提高的部分
+func reservedOutputTokens(openaiReq *transformers.OpenAIRequest, model *config.Model) int {
+	if model.Type == "anthropic" {
+		return transformers.AnthropicMaxTokens(openaiReq.MaxTokens, model.MaxOutput, model.Reasoning)
+	}
+	if openaiReq.MaxTokens > 0 {
+		return openaiReq.MaxTokens
+	}
+	return model.MaxOutput
+}
+
+// contextBudget 计算可用于输入消息的 token 预算，扣除输出预留、注入的系统提示词和安全余量
+func contextBudget(openaiReq *transformers.OpenAIRequest, model *config.Model, cfg config.ContextManagementConfig) int {
+	budget := model.ContextWindow - reservedOutputTokens(openaiReq, model) - cfg.SafetyMargin
+	policy := config.ResolveSystemPromptPolicy(model.ID, openaiReq.ClientName)
+	if policy.Mode != config.SystemPromptDisabled && policy.Prompt != "" {
+		budget -= transformers.EstimateOpenAIMessageTokens(transformers.OpenAIMessage{Role: "system", Content: policy.Prompt})
+	}
+	return budget
+}
+
+// manageContextWindow 在转换前检查上下文窗口，超限时按 context_management 策略截断或摘要
+// 返回 false 表示请求无法放入上下文窗口，已写入错误响应
+func manageContextWindow(w http.ResponseWriter, r *http.Request, openaiReq *transformers.OpenAIRequest, model *config.Model, authHeader string) bool {
+	if model.ContextWindow <= 0 {
+		return true
+	}
+
+	cfg := config.GetContextManagementConfig()
+	budget := contextBudget(openaiReq, model, cfg)
+	estimated := transformers.EstimateOpenAIRequestTokens(openaiReq)
+	if estimated <= budget {
+		w.Header().Set("X-Context-Estimated-Tokens", strconv.Itoa(estimated))
+		return true
+	}
+	if cfg.Strategy == config.ContextStrategyNone {
+		writeContextLengthError(w, model, estimated, budget)
+		return false
+	}
+
+	action := contextActionTruncated
+	var dropped []transformers.OpenAIMessage
+	switch cfg.Strategy {
+	case config.ContextStrategyDropOldest:
+		dropped = transformers.TruncateMessages(openaiReq, budget, 0)
+	case config.ContextStrategyKeepLast:
+		dropped = transformers.TruncateMessages(openaiReq, budget, cfg.KeepLast)
+	case config.ContextStrategySummarize:
+		dropped = transformers.TruncateMessages(openaiReq, budget, cfg.KeepLast)
+		if len(dropped) > 0 {
+			summary, err := summarizeMessages(r, model, openaiReq.ClientName, authHeader, dropped, budget, cfg.SummaryMaxTokens)
+			if err != nil {
+				log.Printf("⚠️ 生成上下文摘要失败，改为直接截断: %v", err)
+			} else {
+				transformers.InsertSummaryMessage(openaiReq, summary)
+				action = contextActionSummarized
+			}
+		}
+		// 摘要本身也占用预算，仍超限时继续丢弃最早的消息
+		dropped = append(dropped, transformers.TruncateMessages(openaiReq, budget, 0)...)
+	}
+
+	remaining := transformers.EstimateOpenAIRequestTokens(openaiReq)
+	if remaining > budget {
+		writeContextLengthError(w, model, remaining, budget)
+		return false
+	}
+
+	log.Printf("✂️ 上下文超限 (%d > %d)，%s: 丢弃 %d 条消息，剩余约 %d token", estimated, budget, action, len(dropped), remaining)
+	w.Header().Set("X-Context-Action", action)
+	w.Header().Set("X-Context-Dropped-Messages", strconv.Itoa(len(dropped)))
+	w.Header().Set("X-Context-Estimated-Tokens", strconv.Itoa(remaining))
+	return true
+}
+
+// summarizeMessages 使用同一模型生成被丢弃消息的摘要
+func summarizeMessages(r *http.Request, model *config.Model, clientName, authHeader string, messages []transformers.OpenAIMessage, budget, maxTokens int) (string, error) {
+	transcript := []rune(transformers.RenderTranscript(messages))
+	// 摘要请求本身也不能超出上下文窗口，过长时只保留最近的部分（按约 4 字符一个 token）
+	if maxChars := (budget - maxTokens) * 4; maxChars > 0 && len(transcript) > maxChars {
+		transcript = append([]rune("...\n"), transcript[len(transcript)-maxChars:]...)
+	}
+
+	summaryReq := &transformers.OpenAIRequest{
+		Model: model.ID,
+		Messages: []transformers.OpenAIMessage{
+			{Role: "system", Content: summaryInstruction},
+			{Role: "user", Content: string(transcript)},
+		},
+		MaxTokens:  maxTokens,
+		ClientName: clientName,
+	}
+
+	rw := newBufferedResponseWriter()
+	dispatchModelRequest(rw, r, summaryReq, model, authHeader)
+	if rw.statusCode != http.StatusOK {
+		return "", fmt.Errorf("upstream returned %d: %s", rw.statusCode, rw.body.String())
+	}
+
+	var resp transformers.OpenAIResponse
+	if err := json.Unmarshal(rw.body.Bytes(), &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 || resp.Choices[0].Message == nil || resp.Choices[0].Message.Content == "" {
+		return "", fmt.Errorf("empty summary")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+// writeContextLengthError 以 OpenAI 的 context_length_exceeded 格式返回错误
+func writeContextLengthError(w http.ResponseWriter, model *config.Model, estimated, budget int) {
+	message := fmt.Sprintf("This model's maximum context length is %d tokens. However, your messages resulted in approximately %d tokens, "+
+		"exceeding the %d tokens available for input. Please reduce the length of the messages or enable context_management.",
+		model.ContextWindow, estimated, budget)
+	log.Printf("❌ 上下文超限: %s 约 %d token > %d", model.ID, estimated, budget)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": message,
+			"type":    "invalid_request_error",
+			"param":   "messages",
+			"code":    "context_length_exceeded",
+		},
+	}); err != nil {
+		log.Printf("错误: 编码响应失败: %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	_ "embed"
+	"log"
+	"net/http"
+)
+
+// dashboardHTML 管理面板页面，编译进二进制，不依赖工作目录
+//
+//go:embed dashboard/index.html
+var dashboardHTML []byte
+
+// dashboardHandler 管理面板，使用 ADMIN_API_KEY 认证（浏览器中通过 Basic 认证输入）
+// 页面数据来自 /admin/metrics
+func dashboardHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	if !authorizeAdmin(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if _, err := w.Write(dashboardHTML); err != nil {
+		log.Printf("错误: 写入响应失败: %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"factory-go-api/config"
+	"factory-go-api/metrics"
+	"factory-go-api/mockupstream"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// resetMetrics 使用独立的统计收集器，避免其他测试的请求干扰断言
+func resetMetrics(t *testing.T) {
+	t.Helper()
+	previous := proxyMetrics
+	proxyMetrics = metrics.New()
+	t.Cleanup(func() { proxyMetrics = previous })
+}
+
+func TestDashboardRequiresAdminKey(t *testing.T) {
+	t.Setenv("ADMIN_API_KEY", "admin-key")
+
+	rr := httptest.NewRecorder()
+	dashboardHandler(rr, httptest.NewRequest(http.MethodGet, "/dashboard", nil))
+	if rr.Code != http.StatusUnauthorized || !strings.HasPrefix(rr.Header().Get("WWW-Authenticate"), "Basic") {
+		t.Errorf("anonymous status = %d, WWW-Authenticate = %q", rr.Code, rr.Header().Get("WWW-Authenticate"))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/dashboard", nil)
+	req.SetBasicAuth("admin", "admin-key")
+	rr = httptest.NewRecorder()
+	dashboardHandler(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "/admin/metrics") {
+		t.Errorf("status = %d, body does not look like the dashboard", rr.Code)
+	}
+}
+
+func TestMetricsRecordUsageAndUpstreamHealth(t *testing.T) {
+	upstream, _ := newAdminTestUpstream(t)
+	resetMetrics(t)
+	cfg := *config.GetConfig()
+	cfg.Models = append([]config.Model(nil), cfg.Models...)
+	cfg.Models[0].InputPrice = 3
+	cfg.Models[0].OutputPrice = 15
+	config.SetConfig(&cfg)
+
+	upstream.Enqueue(
+		mockupstream.Reply{Text: "Hello", InputTokens: 1000, OutputTokens: 100},
+		mockupstream.Reply{Text: "Streamed reply"}, // Anthropic 流式响应没有 usage，使用本地估算
+		mockupstream.Reply{Status: http.StatusServiceUnavailable, ErrorType: "overloaded_error", ErrorMessage: "overloaded"},
+	)
+	handler := withMetrics(chatCompletionsHandler)
+	for _, body := range []string{
+		`{"model":"claude-test","messages":[{"role":"user","content":"Hi"}]}`,
+		`{"model":"claude-test","stream":true,"messages":[{"role":"user","content":"Hi"}]}`,
+		`{"model":"claude-test","messages":[{"role":"user","content":"Hi"}]}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer client-key")
+		handler(httptest.NewRecorder(), req)
+	}
+
+	rr := adminRequest(t, http.MethodGet, "/admin/metrics", "")
+	var snapshot metrics.Snapshot
+	if err := json.Unmarshal(rr.Body.Bytes(), &snapshot); err != nil {
+		t.Fatalf("status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+	if snapshot.Requests != 3 || snapshot.Errors != 1 || len(snapshot.Models) != 1 {
+		t.Fatalf("snapshot = %+v", snapshot)
+	}
+	if model := snapshot.Models[0]; model.PromptTokens <= 1000 || model.CompletionTokens <= 100 {
+		t.Errorf("model usage = %+v, want upstream usage plus stream estimate", model)
+	}
+
+	if len(snapshot.Clients) != 1 || snapshot.Clients[0].Client != directClientName {
+		t.Fatalf("clients = %+v", snapshot.Clients)
+	}
+	// 1000 输入 × $3 + 100 输出 × $15（每百万 token），再加上流式请求的估算费用
+	if cost := snapshot.Clients[0].Cost; cost < 0.0045 || cost > 0.005 {
+		t.Errorf("cost = %v", cost)
+	}
+
+	if len(snapshot.Upstreams) != 1 || snapshot.Upstreams[0].Endpoint != "anthropic" || snapshot.Upstreams[0].Errors != 1 || snapshot.Upstreams[0].KeyHint != maskKey("factory-key") {
+		t.Errorf("upstreams = %+v", snapshot.Upstreams)
+	}
+	if len(snapshot.RecentFailures) != 2 {
+		t.Errorf("recent failures = %+v, want request and upstream failure", snapshot.RecentFailures)
+	}
+}
+
+func TestMetricsBucketUnknownModels(t *testing.T) {
+	newAdminTestUpstream(t)
+	resetMetrics(t)
+	t.Setenv("PROXY_API_KEY", "proxy-key")
+
+	handler := withMetrics(chatCompletionsHandler)
+	for i := 0; i < 5; i++ {
+		// 认证失败和不存在的模型都不能按客户端发送的模型名建立统计
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(fmt.Sprintf(`{"model":"random-%d","messages":[{"role":"user","content":"Hi"}]}`, i)))
+		req.Header.Set("Authorization", "Bearer wrong-key")
+		handler(httptest.NewRecorder(), req)
+	}
+
+	snapshot := proxyMetrics.Snapshot(time.Now())
+	if snapshot.Requests != 5 || len(snapshot.Models) != 1 || snapshot.Models[0].Model != metrics.UnknownModel {
+		t.Errorf("models = %+v", snapshot.Models)
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"factory-go-api/config"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// docsTemplateSource 文档页面模板，编译进二进制，不依赖工作目录
+//
+//go:embed docs.html
+var docsTemplateSource string
+
+var docsTemplate = template.Must(template.New("docs").Funcs(template.FuncMap{"lower": strings.ToLower}).Parse(docsTemplateSource))
+
+// docsPage 文档页面数据，由 OpenAPI 文档整理而来
+type docsPage struct {
+	Info         openAPIInfo
+	Version      string
+	ServerURL    string
+	ExampleModel string
+	Models       []config.Model
+	Sections     []docsSection
+}
+
+// docsSection 同一标签下的接口
+type docsSection struct {
+	Tag        openAPITag
+	Operations []docsOperation
+}
+
+type docsOperation struct {
+	Method      string
+	Path        string
+	Summary     string
+	Description string
+	Auth        string
+	Parameters  []openAPIParameter
+	Fields      []docsField
+	Responses   []docsResponse
+	Example     string
+}
+
+type docsField struct {
+	Name     string
+	Type     string
+	Required bool
+}
+
+type docsResponse struct {
+	Code        string
+	Description string
+	Type        string
+}
+
+// docsHandler 根据 OpenAPI 文档渲染 API 文档页面
+func docsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := docsTemplate.Execute(&buf, newDocsPage(buildOpenAPISpec(requestServerURL(r)))); err != nil {
+		log.Printf("错误: 渲染文档失败: %v", err)
+		http.Error(w, "Failed to render documentation", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		log.Printf("错误: 写入响应失败: %v", err)
+	}
+}
+
+// newDocsPage 按标签分组整理接口，同一路径内按 openAPIMethods 排序
+func newDocsPage(doc *openAPIDocument) docsPage {
+	page := docsPage{
+		Info:         doc.Info,
+		Version:      doc.OpenAPI,
+		ExampleModel: "gpt-5-2025-08-07",
+		Models:       config.GetAllModels(),
+	}
+	if len(doc.Servers) > 0 {
+		page.ServerURL = doc.Servers[0].URL
+	}
+	if len(page.Models) > 0 {
+		page.ExampleModel = page.Models[0].ID
+	}
+
+	sections := make(map[string]*docsSection)
+	for _, tag := range doc.Tags {
+		page.Sections = append(page.Sections, docsSection{Tag: tag})
+	}
+	for i := range page.Sections {
+		sections[page.Sections[i].Tag.Name] = &page.Sections[i]
+	}
+
+	for _, path := range doc.sortedPaths() {
+		for _, method := range openAPIMethods {
+			op := doc.Paths[path][method]
+			if op == nil {
+				continue
+			}
+			tag := ""
+			if len(op.Tags) > 0 {
+				tag = op.Tags[0]
+			}
+			section, ok := sections[tag]
+			if !ok {
+				continue
+			}
+			section.Operations = append(section.Operations, newDocsOperation(doc, page.ServerURL, path, method, op))
+		}
+	}
+	return page
+}
+
+func newDocsOperation(doc *openAPIDocument, serverURL, path, method string, op *openAPIOperation) docsOperation {
+	item := docsOperation{
+		Method:      strings.ToUpper(method),
+		Path:        path,
+		Summary:     op.Summary,
+		Description: op.Description,
+		Auth:        docsAuth(op.Security),
+		Parameters:  op.Parameters,
+	}
+
+	var example interface{}
+	if op.RequestBody != nil {
+		if media, ok := op.RequestBody.Content["application/json"]; ok {
+			item.Fields = docsFields(doc, media.Schema)
+			example = media.Example
+		}
+	}
+
+	codes := make([]string, 0, len(op.Responses))
+	for code := range op.Responses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		response := op.Responses[code]
+		resp := docsResponse{Code: code, Description: response.Description}
+		if media, ok := response.Content["application/json"]; ok {
+			resp.Type = schemaLabel(media.Schema)
+		}
+		item.Responses = append(item.Responses, resp)
+	}
+
+	// 只为无需路径参数的接口生成 curl 示例
+	if len(op.Parameters) == 0 && (op.RequestBody == nil || example != nil) {
+		item.Example = docsCurlExample(serverURL+path, item.Method, op.Security, example)
+	}
+	return item
+}
+
+// docsAuth 认证方式的说明文字
+func docsAuth(security []map[string][]string) string {
+	if len(security) == 0 {
+		return "无需认证"
+	}
+	if _, ok := security[0][securityProxyKey]; ok {
+		return "Bearer PROXY_API_KEY 或客户端 Key"
+	}
+	return "Bearer / Basic ADMIN_API_KEY"
+}
+
+// docsFields 列出请求体 Schema 的字段，必填字段在前
+func docsFields(doc *openAPIDocument, schema openAPISchema) []docsField {
+	if ref, ok := schema["$ref"].(string); ok {
+		schema = doc.Components.Schemas[strings.TrimPrefix(ref, "#/components/schemas/")]
+	}
+	properties, _ := schema["properties"].(map[string]interface{})
+	required := make(map[string]bool)
+	if names, ok := schema["required"].([]string); ok {
+		for _, name := range names {
+			required[name] = true
+		}
+	}
+
+	fields := make([]docsField, 0, len(properties))
+	for name, property := range properties {
+		propertySchema, _ := property.(openAPISchema)
+		fields = append(fields, docsField{Name: name, Type: schemaLabel(propertySchema), Required: required[name]})
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		if fields[i].Required != fields[j].Required {
+			return fields[i].Required
+		}
+		return fields[i].Name < fields[j].Name
+	})
+	return fields
+}
+
+// schemaLabel Schema 的简短类型描述
+func schemaLabel(schema openAPISchema) string {
+	if ref, ok := schema["$ref"].(string); ok {
+		return strings.TrimPrefix(ref, "#/components/schemas/")
+	}
+	if variants, ok := schema["oneOf"].([]openAPISchema); ok {
+		labels := make([]string, 0, len(variants))
+		for _, variant := range variants {
+			labels = append(labels, schemaLabel(variant))
+		}
+		return strings.Join(labels, " | ")
+	}
+	if enum, ok := schema["enum"].([]string); ok && len(enum) <= 4 {
+		return strings.Join(enum, " | ")
+	}
+	switch schema["type"] {
+	case nil:
+		return "any"
+	case "array":
+		items, _ := schema["items"].(openAPISchema)
+		return schemaLabel(items) + "[]"
+	case "object":
+		if values, ok := schema["additionalProperties"].(openAPISchema); ok {
+			return "map<string, " + schemaLabel(values) + ">"
+		}
+	}
+	return fmt.Sprint(schema["type"])
+}
+
+// docsCurlExample 生成 curl 调用示例
+func docsCurlExample(url, method string, security []map[string][]string, body interface{}) string {
+	var lines []string
+	if method == http.MethodGet {
+		lines = append(lines, "curl "+url)
+	} else {
+		lines = append(lines, "curl -X "+method+" "+url)
+	}
+	if len(security) > 0 {
+		key := "YOUR_PROXY_API_KEY"
+		if _, ok := security[0][securityProxyKey]; !ok {
+			key = "YOUR_ADMIN_API_KEY"
+		}
+		lines = append(lines, `-H "Authorization: Bearer `+key+`"`)
+	}
+	if body != nil {
+		data, err := json.MarshalIndent(body, "  ", "  ")
+		if err == nil {
+			lines = append(lines, `-H "Content-Type: application/json"`, "-d '"+string(data)+"'")
+		}
+	}
+	return strings.Join(lines, " \\\n  ")
+}
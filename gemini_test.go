@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"factory-go-api/config"
+	"factory-go-api/mockupstream"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// withGeminiModel 添加指向模拟上游 Gemini 端点的模型
+func withGeminiModel(t *testing.T, upstream *mockupstream.Server) {
+	t.Helper()
+	cfg := *config.GetConfig()
+	cfg.Endpoints = append(append([]config.Endpoint(nil), cfg.Endpoints...), config.Endpoint{Name: "gemini", BaseURL: upstream.GeminiBaseURL()})
+	cfg.Models = append(append([]config.Model(nil), cfg.Models...), config.Model{Name: "Gemini", ID: "gemini-test", Type: "gemini", Reasoning: "low"})
+	config.SetConfig(&cfg)
+}
+
+func TestGeminiNonStream(t *testing.T) {
+	upstream := newTestUpstream(t)
+	withGeminiModel(t, upstream)
+
+	upstream.Enqueue(mockupstream.Reply{
+		Text:         "Let me check.",
+		Thinking:     "The user wants weather",
+		ToolUse:      &mockupstream.ToolUse{Name: "get_weather", Input: map[string]interface{}{"city": "Paris"}},
+		InputTokens:  12,
+		OutputTokens: 6,
+	})
+	rr := postChat(t, `{"model":"gemini-test","messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"Weather in Paris?"}],
+		"tools":[{"type":"function","function":{"name":"get_weather","parameters":{"type":"object"}}}]}`)
+	resp := decodeChat(t, rr)
+	if resp.Model != "gemini-test" || resp.Choices[0].Message.Content != "Let me check." || resp.Usage["total_tokens"] != float64(18) {
+		t.Errorf("response = %s", rr.Body.String())
+	}
+	// 思考内容不返回给客户端，函数调用转换为 tool_calls
+	if strings.Contains(rr.Body.String(), "The user wants weather") || !strings.Contains(rr.Body.String(), `"arguments":"{\"city\":\"Paris\"}"`) {
+		t.Errorf("response = %s", rr.Body.String())
+	}
+
+	req, _ := upstream.LastRequest()
+	if req.Path != mockupstream.GeminiPath+"gemini-test:generateContent" || req.Header.Get("Authorization") != "Bearer factory-key" {
+		t.Errorf("path = %s, authorization = %q", req.Path, req.Header.Get("Authorization"))
+	}
+	data, _ := json.Marshal(req.Body)
+	for _, want := range []string{`"systemInstruction":{"parts":[{"text":"Be brief."}]}`, `"thinkingConfig":{"thinkingBudget":4096}`, `"functionDeclarations":[{"name":"get_weather"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("upstream request %s missing %s", data, want)
+		}
+	}
+}
+
+func TestGeminiStream(t *testing.T) {
+	upstream := newTestUpstream(t)
+	withGeminiModel(t, upstream)
+
+	upstream.Enqueue(mockupstream.Reply{Text: "Streamed from Gemini", Thinking: "Hmm", Truncated: true})
+	content, finishReason := collectStream(t, postChat(t, `{"model":"gemini-test","stream":true,"messages":[{"role":"user","content":"Hello"}]}`))
+	if content != "Streamed from Gemini" || finishReason != "length" {
+		t.Errorf("content = %q, finish_reason = %q", content, finishReason)
+	}
+	if req, _ := upstream.LastRequest(); req.Path != mockupstream.GeminiPath+"gemini-test:streamGenerateContent" {
+		t.Errorf("path = %s", req.Path)
+	}
+
+	// 上游错误原样转发
+	upstream.Enqueue(mockupstream.Reply{Status: http.StatusTooManyRequests, ErrorMessage: "quota exceeded"})
+	if rr := postChat(t, `{"model":"gemini-test","stream":true,"messages":[{"role":"user","content":"Hello"}]}`); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestGeminiTokenCountEstimate(t *testing.T) {
+	upstream := newTestUpstream(t)
+	withGeminiModel(t, upstream)
+
+	rr := postTokenCount(t, "/v1/token_count", `{"model":"gemini-test","messages":[{"role":"user","content":"Hello world"}]}`)
+	if rr.Code != http.StatusOK || rr.Header().Get("X-Token-Count-Source") != "estimate" {
+		t.Fatalf("status = %d, source = %q, body = %s", rr.Code, rr.Header().Get("X-Token-Count-Source"), rr.Body.String())
+	}
+	if n := len(upstream.Requests()); n != 0 {
+		t.Errorf("upstream received %d requests, want 0", n)
+	}
+}
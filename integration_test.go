@@ -0,0 +1,591 @@
+package main
+
+import (
+	"encoding/json"
+	"factory-go-api/config"
+	"factory-go-api/mockupstream"
+	"factory-go-api/transformers"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestUpstream 启动模拟上游，并将全局配置指向它
+func newTestUpstream(t *testing.T) *mockupstream.Server {
+	t.Helper()
+	upstream := mockupstream.New()
+	t.Cleanup(upstream.Close)
+
+	previous := config.GetConfig()
+	config.SetConfig(&config.Config{
+		Endpoints: []config.Endpoint{
+			{Name: "anthropic", BaseURL: upstream.AnthropicURL()},
+			{Name: "openai", BaseURL: upstream.ResponsesURL()},
+		},
+		Models: []config.Model{
+			{Name: "Claude", ID: "claude-test", Type: "anthropic"},
+			{Name: "Claude Thinking", ID: "claude-thinking", Type: "anthropic", Reasoning: "high"},
+			{Name: "GPT", ID: "gpt-test", Type: "openai", Reasoning: "medium"},
+		},
+		SystemPromptMode: config.SystemPromptPrepend,
+		UserAgent:        "factory-cli/test",
+	})
+	t.Cleanup(func() { config.SetConfig(previous) })
+
+	t.Setenv("FACTORY_API_KEY", "factory-key")
+	t.Setenv("PROXY_API_KEY", "")
+	return upstream
+}
+
+// postChat 通过 chatCompletionsHandler 发送请求
+func postChat(t *testing.T, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer client-key")
+	rr := httptest.NewRecorder()
+	chatCompletionsHandler(rr, req)
+	return rr
+}
+
+// decodeChat 解析非流式响应
+func decodeChat(t *testing.T, rr *httptest.ResponseRecorder) transformers.OpenAIResponse {
+	t.Helper()
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+	var resp transformers.OpenAIResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response %q: %v", rr.Body.String(), err)
+	}
+	if len(resp.Choices) != 1 || resp.Choices[0].Message == nil {
+		t.Fatalf("unexpected choices: %s", rr.Body.String())
+	}
+	return resp
+}
+
+// collectStream 拼接流式响应的内容并返回最后的 finish_reason
+func collectStream(t *testing.T, rr *httptest.ResponseRecorder) (content, finishReason string) {
+	t.Helper()
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+	body := rr.Body.String()
+	if !strings.HasSuffix(body, "data: [DONE]\n\n") {
+		t.Errorf("stream should end with [DONE], got %q", body)
+	}
+	for _, line := range strings.Split(body, "\n") {
+		dataStr := strings.TrimPrefix(line, "data: ")
+		if dataStr == line || dataStr == "[DONE]" {
+			continue
+		}
+		var chunk transformers.OpenAIResponse
+		if err := json.Unmarshal([]byte(dataStr), &chunk); err != nil {
+			t.Fatalf("invalid chunk %q: %v", dataStr, err)
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta != nil {
+				content += choice.Delta.Content
+			}
+			if choice.FinishReason != nil {
+				finishReason = *choice.FinishReason
+			}
+		}
+	}
+	return content, finishReason
+}
+
+func TestIntegrationAnthropicNonStream(t *testing.T) {
+	upstream := newTestUpstream(t)
+	upstream.Enqueue(mockupstream.Reply{Text: "Hi there", InputTokens: 12, OutputTokens: 3, CacheReadTokens: 4})
+
+	resp := decodeChat(t, postChat(t, `{"model":"claude-test","messages":[{"role":"system","content":"Be brief"},{"role":"user","content":"Hello"}]}`))
+	if resp.Choices[0].Message.Content != "Hi there" || *resp.Choices[0].FinishReason != "stop" {
+		t.Errorf("choice = %+v", resp.Choices[0])
+	}
+	if resp.Model != "claude-test" {
+		t.Errorf("model = %q", resp.Model)
+	}
+	if resp.Usage["prompt_tokens"].(float64) != 16 || resp.Usage["completion_tokens"].(float64) != 3 {
+		t.Errorf("usage = %v", resp.Usage)
+	}
+
+	upstreamReq, _ := upstream.LastRequest()
+	if upstreamReq.Path != mockupstream.AnthropicPath {
+		t.Errorf("upstream path = %q", upstreamReq.Path)
+	}
+	if got := upstreamReq.Header.Get("Authorization"); got != "Bearer factory-key" {
+		t.Errorf("upstream Authorization = %q, want the Factory key", got)
+	}
+	if upstreamReq.Body["model"] != "claude-test" || upstreamReq.Body["max_tokens"] == nil {
+		t.Errorf("upstream body = %v", upstreamReq.Body)
+	}
+	if system, _ := json.Marshal(upstreamReq.Body["system"]); !strings.Contains(string(system), "Be brief") {
+		t.Errorf("upstream system = %s", system)
+	}
+}
+
+func TestIntegrationAnthropicStream(t *testing.T) {
+	upstream := newTestUpstream(t)
+	upstream.Enqueue(mockupstream.Reply{Text: "one two three", OutputTokens: 3})
+
+	content, finishReason := collectStream(t, postChat(t, `{"model":"claude-test","stream":true,"messages":[{"role":"user","content":"Count"}]}`))
+	if content != "one two three" || finishReason != "stop" {
+		t.Errorf("content = %q, finish_reason = %q", content, finishReason)
+	}
+	if upstreamReq, _ := upstream.LastRequest(); upstreamReq.Header.Get("Accept") != "text/event-stream" {
+		t.Errorf("streaming request should accept text/event-stream, headers = %v", upstreamReq.Header)
+	}
+}
+
+// stream_options.include_usage 时在 [DONE] 之前返回 usage（含缓存命中），否则不返回
+func TestIntegrationAnthropicStreamUsage(t *testing.T) {
+	upstream := newTestUpstream(t)
+	upstream.Enqueue(
+		mockupstream.Reply{Text: "Hi", InputTokens: 12, OutputTokens: 3, CacheReadTokens: 4},
+		mockupstream.Reply{Text: "Hi", InputTokens: 12, OutputTokens: 3, CacheReadTokens: 4},
+	)
+
+	rr := postChat(t, `{"model":"claude-test","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"Hello"}]}`)
+	collectStream(t, rr)
+	chunks := strings.Split(strings.TrimSuffix(rr.Body.String(), "data: [DONE]\n\n"), "\n\n")
+	var last transformers.OpenAIResponse
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(chunks[len(chunks)-2], "data: ")), &last); err != nil {
+		t.Fatalf("last chunk: %v, body = %s", err, rr.Body.String())
+	}
+	details, _ := last.Usage["prompt_tokens_details"].(map[string]interface{})
+	if len(last.Choices) != 0 || last.Usage["prompt_tokens"] != float64(16) || last.Usage["completion_tokens"] != float64(3) || details["cached_tokens"] != float64(4) {
+		t.Errorf("usage chunk = %+v", last)
+	}
+
+	rr = postChat(t, `{"model":"claude-test","stream":true,"messages":[{"role":"user","content":"Hello"}]}`)
+	collectStream(t, rr)
+	if strings.Contains(rr.Body.String(), `"usage"`) {
+		t.Errorf("usage sent without stream_options.include_usage: %s", rr.Body.String())
+	}
+}
+
+func TestIntegrationAnthropicThinking(t *testing.T) {
+	upstream := newTestUpstream(t)
+	upstream.Enqueue(
+		mockupstream.Reply{Thinking: "secret reasoning", Text: "Answer"},
+		mockupstream.Reply{Thinking: "secret reasoning", Text: "Answer"},
+	)
+
+	resp := decodeChat(t, postChat(t, `{"model":"claude-thinking","messages":[{"role":"user","content":"Why?"}]}`))
+	if resp.Choices[0].Message.Content != "Answer" {
+		t.Errorf("content = %q, thinking must not leak into the answer", resp.Choices[0].Message.Content)
+	}
+	upstreamReq, _ := upstream.LastRequest()
+	if thinking, ok := upstreamReq.Body["thinking"].(map[string]interface{}); !ok || thinking["type"] != "enabled" {
+		t.Errorf("upstream thinking = %v", upstreamReq.Body["thinking"])
+	}
+
+	content, _ := collectStream(t, postChat(t, `{"model":"claude-thinking","stream":true,"messages":[{"role":"user","content":"Why?"}]}`))
+	if content != "Answer" {
+		t.Errorf("stream content = %q", content)
+	}
+}
+
+func TestIntegrationAnthropicStructuredOutput(t *testing.T) {
+	upstream := newTestUpstream(t)
+	toolUse := &mockupstream.ToolUse{ID: "toolu_1", Name: transformers.StructuredOutputToolName, Input: map[string]interface{}{"city": "Paris"}}
+	upstream.Enqueue(mockupstream.Reply{ToolUse: toolUse}, mockupstream.Reply{ToolUse: toolUse})
+
+	body := `{"model":"claude-test","messages":[{"role":"user","content":"Capital of France?"}],"response_format":{"type":"json_schema","json_schema":{"name":"answer","schema":{"type":"object","properties":{"city":{"type":"string"}}}}}}`
+	resp := decodeChat(t, postChat(t, body))
+	if resp.Choices[0].Message.Content != `{"city":"Paris"}` {
+		t.Errorf("content = %q", resp.Choices[0].Message.Content)
+	}
+	upstreamReq, _ := upstream.LastRequest()
+	if choice, _ := upstreamReq.Body["tool_choice"].(map[string]interface{}); choice["name"] != transformers.StructuredOutputToolName {
+		t.Errorf("upstream tool_choice = %v", upstreamReq.Body["tool_choice"])
+	}
+
+	content, _ := collectStream(t, postChat(t, strings.Replace(body, `"model"`, `"stream":true,"model"`, 1)))
+	if content != `{"city":"Paris"}` {
+		t.Errorf("stream content = %q", content)
+	}
+}
+
+func TestIntegrationAnthropicMaxTokens(t *testing.T) {
+	upstream := newTestUpstream(t)
+	upstream.Enqueue(mockupstream.Reply{Text: "cut", Truncated: true})
+
+	resp := decodeChat(t, postChat(t, `{"model":"claude-test","max_tokens":5,"messages":[{"role":"user","content":"Long story"}]}`))
+	if *resp.Choices[0].FinishReason != "length" {
+		t.Errorf("finish_reason = %q, want length", *resp.Choices[0].FinishReason)
+	}
+}
+
+func TestIntegrationUpstreamError(t *testing.T) {
+	upstream := newTestUpstream(t)
+	upstream.Enqueue(mockupstream.Reply{Status: http.StatusTooManyRequests, ErrorType: "rate_limit_error", ErrorMessage: "slow down"})
+
+	rr := postChat(t, `{"model":"claude-test","messages":[{"role":"user","content":"Hello"}]}`)
+	if rr.Code != http.StatusTooManyRequests || !strings.Contains(rr.Body.String(), "slow down") {
+		t.Errorf("status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestIntegrationEndpointTransport(t *testing.T) {
+	upstream := newTestUpstream(t)
+	cfg := *config.GetConfig()
+	cfg.Endpoints = append([]config.Endpoint(nil), cfg.Endpoints...)
+	baseURL, err := url.Parse(cfg.Endpoints[0].BaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseURL.Host = "anthropic.upstream.invalid:" + baseURL.Port()
+	cfg.Endpoints[0].BaseURL = baseURL.String()
+	cfg.Endpoints[0].Transport = &config.TransportConfig{
+		Proxy:        config.ProxyDirect,
+		DNSOverrides: map[string]string{"anthropic.upstream.invalid": "127.0.0.1"},
+	}
+	config.SetConfig(&cfg)
+
+	upstream.Enqueue(mockupstream.Reply{Text: "Resolved"})
+	resp := decodeChat(t, postChat(t, `{"model":"claude-test","messages":[{"role":"user","content":"Hello"}]}`))
+	if resp.Choices[0].Message.Content != "Resolved" {
+		t.Errorf("content = %q", resp.Choices[0].Message.Content)
+	}
+
+	// 连接设置无效时请求失败，不会退回默认连接
+	cfg.Endpoints[0].Transport = &config.TransportConfig{CAFile: filepath.Join(t.TempDir(), "missing.pem")}
+	config.SetConfig(&cfg)
+	rr := postChat(t, `{"model":"claude-test","messages":[{"role":"user","content":"Hello"}]}`)
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, want 502", rr.Code)
+	}
+}
+
+func TestIntegrationStreamInterrupted(t *testing.T) {
+	upstream := newTestUpstream(t)
+	upstream.Enqueue(mockupstream.Reply{Text: "partial", StreamError: "Overloaded"})
+
+	content, finishReason := collectStream(t, postChat(t, `{"model":"claude-test","stream":true,"messages":[{"role":"user","content":"Hello"}]}`))
+	if content != "partial" || finishReason != "" {
+		t.Errorf("content = %q, finish_reason = %q", content, finishReason)
+	}
+}
+
+func TestIntegrationResponsesNonStream(t *testing.T) {
+	upstream := newTestUpstream(t)
+	upstream.Enqueue(mockupstream.Reply{Thinking: "hmm", Text: "Hello from GPT", InputTokens: 7, OutputTokens: 4, CacheReadTokens: 2})
+
+	resp := decodeChat(t, postChat(t, `{"model":"gpt-test","messages":[{"role":"system","content":"Be brief"},{"role":"user","content":"Hello"}]}`))
+	if resp.Choices[0].Message.Content != "Hello from GPT" || *resp.Choices[0].FinishReason != "stop" {
+		t.Errorf("choice = %+v", resp.Choices[0])
+	}
+	if details, _ := resp.Usage["prompt_tokens_details"].(map[string]interface{}); details["cached_tokens"] != float64(2) {
+		t.Errorf("usage = %v", resp.Usage)
+	}
+
+	upstreamReq, _ := upstream.LastRequest()
+	if upstreamReq.Path != mockupstream.ResponsesPath {
+		t.Errorf("upstream path = %q", upstreamReq.Path)
+	}
+	if instructions, _ := upstreamReq.Body["instructions"].(string); !strings.Contains(instructions, "Be brief") {
+		t.Errorf("upstream instructions = %q", instructions)
+	}
+	if upstreamReq.Body["model"] != "gpt-test" {
+		t.Errorf("upstream model = %v", upstreamReq.Body["model"])
+	}
+}
+
+func TestIntegrationResponsesStream(t *testing.T) {
+	upstream := newTestUpstream(t)
+	upstream.Enqueue(
+		mockupstream.Reply{Thinking: "hmm", Text: "streamed reply"},
+		mockupstream.Reply{Text: "cut", Truncated: true},
+	)
+
+	content, finishReason := collectStream(t, postChat(t, `{"model":"gpt-test","stream":true,"messages":[{"role":"user","content":"Hello"}]}`))
+	if content != "streamed reply" || finishReason != "stop" {
+		t.Errorf("content = %q, finish_reason = %q", content, finishReason)
+	}
+
+	_, finishReason = collectStream(t, postChat(t, `{"model":"gpt-test","stream":true,"messages":[{"role":"user","content":"Hello"}]}`))
+	if finishReason != "length" {
+		t.Errorf("truncated finish_reason = %q, want length", finishReason)
+	}
+}
+
+func TestIntegrationRejectsBeforeUpstream(t *testing.T) {
+	upstream := newTestUpstream(t)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"未知模型", `{"model":"missing","messages":[{"role":"user","content":"Hi"}]}`, http.StatusNotFound},
+		{"无效 JSON", `{"model":`, http.StatusBadRequest},
+		{"未知角色", `{"model":"claude-test","messages":[{"role":"robot","content":"Hi"}]}`, http.StatusBadRequest},
+		{"n 超出范围", `{"model":"claude-test","n":99,"messages":[{"role":"user","content":"Hi"}]}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rr := postChat(t, tt.body); rr.Code != tt.status {
+				t.Errorf("status = %d, want %d, body = %s", rr.Code, tt.status, rr.Body.String())
+			}
+		})
+	}
+	if n := len(upstream.Requests()); n != 0 {
+		t.Errorf("upstream received %d requests, want 0", n)
+	}
+}
+
+func TestIntegrationMultipleChoices(t *testing.T) {
+	upstream := newTestUpstream(t)
+	upstream.Enqueue(mockupstream.Reply{Text: "a", OutputTokens: 1}, mockupstream.Reply{Text: "b", OutputTokens: 1})
+
+	rr := postChat(t, `{"model":"claude-test","n":2,"messages":[{"role":"user","content":"Hi"}]}`)
+	var resp transformers.OpenAIResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || len(resp.Choices) != 2 {
+		t.Fatalf("status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+	if n := len(upstream.Requests()); n != 2 {
+		t.Errorf("upstream received %d requests, want 2", n)
+	}
+}
+
+func postTokenCount(t *testing.T, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer client-key")
+	rr := httptest.NewRecorder()
+	handleTokenCount(rr, req, path == "/v1/messages/count_tokens")
+	return rr
+}
+
+func TestIntegrationTokenCountAnthropic(t *testing.T) {
+	upstream := newTestUpstream(t)
+	upstream.Enqueue(mockupstream.Reply{InputTokens: 42})
+
+	rr := postTokenCount(t, "/v1/token_count", `{"model":"claude-test","max_tokens":100,"stream":true,"messages":[{"role":"user","content":"Hello"}]}`)
+	if rr.Code != http.StatusOK || rr.Header().Get("X-Token-Count-Source") != "anthropic" {
+		t.Fatalf("status = %d, source = %q, body = %s", rr.Code, rr.Header().Get("X-Token-Count-Source"), rr.Body.String())
+	}
+	var resp map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || resp["input_tokens"] != float64(42) {
+		t.Errorf("response = %s", rr.Body.String())
+	}
+
+	upstreamReq, _ := upstream.LastRequest()
+	if upstreamReq.Path != mockupstream.AnthropicCountTokensPath {
+		t.Errorf("upstream path = %q", upstreamReq.Path)
+	}
+	for _, field := range []string{"max_tokens", "stream"} {
+		if _, ok := upstreamReq.Body[field]; ok {
+			t.Errorf("count_tokens request should not contain %s: %v", field, upstreamReq.Body)
+		}
+	}
+}
+
+func TestIntegrationTokenCountFallback(t *testing.T) {
+	upstream := newTestUpstream(t)
+	upstream.Enqueue(mockupstream.Reply{Status: http.StatusNotFound, ErrorMessage: "not found"})
+
+	rr := postTokenCount(t, "/v1/messages/count_tokens", `{"model":"claude-test","system":"Be brief","messages":[{"role":"user","content":"Hello"}]}`)
+	if rr.Code != http.StatusOK || rr.Header().Get("X-Token-Count-Source") != "estimate" {
+		t.Fatalf("status = %d, source = %q, body = %s", rr.Code, rr.Header().Get("X-Token-Count-Source"), rr.Body.String())
+	}
+	var resp map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || len(resp) != 1 || resp["input_tokens"].(float64) <= 0 {
+		t.Errorf("Anthropic-compatible response = %s", rr.Body.String())
+	}
+	// 顶层 system 字段参与计数
+	if upstreamReq, _ := upstream.LastRequest(); !strings.Contains(fmt.Sprint(upstreamReq.Body["system"]), "Be brief") {
+		t.Errorf("count_tokens request system = %v", upstreamReq.Body["system"])
+	}
+}
+
+// /v1/messages/count_tokens 接受 Anthropic 原生的内容块、tools 和 tool_choice
+func TestIntegrationTokenCountAnthropicNative(t *testing.T) {
+	upstream := newTestUpstream(t)
+	upstream.Enqueue(mockupstream.Reply{InputTokens: 42})
+
+	rr := postTokenCount(t, "/v1/messages/count_tokens", `{"model":"claude-test","messages":[`+
+		`{"role":"user","content":[{"type":"text","text":"Weather?"},{"type":"image","source":{"type":"base64","media_type":"image/png","data":"iVBORw0KGgo="}}]},`+
+		`{"role":"assistant","content":[{"type":"text","text":"Checking"},{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{"city":"Paris"}}]},`+
+		`{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"Sunny"},{"type":"text","text":"Thanks"}]}],`+
+		`"tools":[{"name":"get_weather","description":"Get weather","input_schema":{"type":"object"}}],"tool_choice":{"type":"any"}}`)
+	if rr.Code != http.StatusOK || rr.Header().Get("X-Token-Count-Source") != "anthropic" {
+		t.Fatalf("status = %d, source = %q, body = %s", rr.Code, rr.Header().Get("X-Token-Count-Source"), rr.Body.String())
+	}
+
+	upstreamReq, _ := upstream.LastRequest()
+	messages, _ := upstreamReq.Body["messages"].([]interface{})
+	if len(messages) != 3 {
+		t.Fatalf("messages = %v", upstreamReq.Body["messages"])
+	}
+	blockTypes := func(i int) []interface{} {
+		var types []interface{}
+		for _, block := range messages[i].(map[string]interface{})["content"].([]interface{}) {
+			types = append(types, block.(map[string]interface{})["type"])
+		}
+		return types
+	}
+	for i, want := range [][]interface{}{{"text", "image"}, {"text", "tool_use"}, {"tool_result", "text"}} {
+		if got := blockTypes(i); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("messages[%d] block types = %v, want %v", i, got, want)
+		}
+	}
+	tools, _ := upstreamReq.Body["tools"].([]interface{})
+	if len(tools) != 1 || tools[0].(map[string]interface{})["input_schema"] == nil {
+		t.Errorf("tools = %v", upstreamReq.Body["tools"])
+	}
+	if choice, _ := upstreamReq.Body["tool_choice"].(map[string]interface{}); choice["type"] != "any" {
+		t.Errorf("tool_choice = %v", upstreamReq.Body["tool_choice"])
+	}
+
+	if rr := postTokenCount(t, "/v1/messages/count_tokens", `{"model":"claude-test","messages":[{"role":"user","content":[{"type":"tool_use","id":"x","name":"f","input":{}}]}]}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("tool_use in user message status = %d, want 400", rr.Code)
+	}
+}
+
+func TestIntegrationTokenCountOpenAI(t *testing.T) {
+	upstream := newTestUpstream(t)
+
+	rr := postTokenCount(t, "/v1/token_count", `{"model":"gpt-test","messages":[{"role":"user","content":"Hello"}],"tools":[{"type":"function","function":{"name":"get_weather","parameters":{"type":"object"}}}]}`)
+	if rr.Code != http.StatusOK || rr.Header().Get("X-Token-Count-Source") != "estimate" {
+		t.Fatalf("status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+	if n := len(upstream.Requests()); n != 0 {
+		t.Errorf("OpenAI-typed models should be counted locally, upstream received %d requests", n)
+	}
+
+	if rr := postTokenCount(t, "/v1/token_count", `{"model":"gpt-test","messages":[{"role":"robot","content":"Hi"}],"temperature":5}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("invalid request status = %d, want 400", rr.Code)
+	}
+}
+
+// withContextWindow 为 claude-test 设置上下文窗口并启用指定的上下文管理策略
+func withContextWindow(t *testing.T, strategy string) {
+	t.Helper()
+	cfg := *config.GetConfig()
+	cfg.Models = append([]config.Model(nil), cfg.Models...)
+	cfg.Models[0].ContextWindow = 300
+	cfg.Models[0].MaxOutput = 100
+	cfg.ContextManagement = config.ContextManagementConfig{Strategy: strategy, KeepLast: 2, SummaryMaxTokens: 50}
+	config.SetConfig(&cfg)
+}
+
+// longConversation 估算约 270 token 的对话，超出 withContextWindow 的 200 token 预算
+func longConversation() string {
+	long := strings.Repeat("lorem ipsum dolor sit amet ", 10)
+	return `{"model":"claude-test","messages":[` +
+		`{"role":"system","content":"Be brief"},` +
+		`{"role":"user","content":"first ` + long + `"},` +
+		`{"role":"assistant","content":"second ` + long + `"},` +
+		`{"role":"user","content":"third ` + long + `"},` +
+		`{"role":"assistant","content":"fourth ` + long + `"},` +
+		`{"role":"user","content":"fifth ` + long + `"}]}`
+}
+
+// Anthropic 模型按转换时实际发送的 max_tokens 预留输出空间（默认值或为 thinking 提高后的值）
+func TestReservedOutputTokens(t *testing.T) {
+	for _, tc := range []struct {
+		model     config.Model
+		maxTokens int
+		want      int
+	}{
+		{config.Model{Type: "anthropic"}, 0, transformers.DefaultAnthropicMaxTokens(0)},
+		{config.Model{Type: "anthropic", MaxOutput: 8192}, 0, 8192},
+		{config.Model{Type: "anthropic", MaxOutput: 8192}, 500, 500},
+		{config.Model{Type: "anthropic", Reasoning: "high"}, 500, 24576 + 4000},
+		{config.Model{Type: "anthropic", Reasoning: "high", MaxOutput: 16000}, 500, 16000},
+		{config.Model{Type: "anthropic", Reasoning: "low"}, 8000, 8000},
+		{config.Model{Type: "openai", MaxOutput: 4096}, 0, 4096},
+	} {
+		req := &transformers.OpenAIRequest{MaxTokens: tc.maxTokens}
+		if got := reservedOutputTokens(req, &tc.model); got != tc.want {
+			t.Errorf("reservedOutputTokens(%+v, max_tokens=%d) = %d, want %d", tc.model, tc.maxTokens, got, tc.want)
+		}
+	}
+	if transformers.DefaultAnthropicMaxTokens(0) <= 0 {
+		t.Error("default Anthropic max_tokens must be positive")
+	}
+}
+
+func TestIntegrationContextLengthExceeded(t *testing.T) {
+	upstream := newTestUpstream(t)
+	withContextWindow(t, config.ContextStrategyNone)
+
+	rr := postChat(t, longConversation())
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "context_length_exceeded") {
+		t.Fatalf("status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+	if n := len(upstream.Requests()); n != 0 {
+		t.Errorf("upstream received %d requests, want 0", n)
+	}
+}
+
+func TestIntegrationContextDropOldest(t *testing.T) {
+	upstream := newTestUpstream(t)
+	withContextWindow(t, config.ContextStrategyDropOldest)
+
+	rr := postChat(t, longConversation())
+	decodeChat(t, rr)
+	if rr.Header().Get("X-Context-Action") != "truncated" || rr.Header().Get("X-Context-Dropped-Messages") != "2" {
+		t.Errorf("context headers = %v", rr.Header())
+	}
+
+	upstreamReq, _ := upstream.LastRequest()
+	messages, _ := upstreamReq.Body["messages"].([]interface{})
+	if len(messages) != 3 {
+		t.Fatalf("upstream messages = %v", messages)
+	}
+	if system := fmt.Sprint(upstreamReq.Body["system"]); !strings.Contains(system, "Be brief") {
+		t.Errorf("system message was dropped: %s", system)
+	}
+}
+
+func TestIntegrationContextSummarize(t *testing.T) {
+	upstream := newTestUpstream(t)
+	withContextWindow(t, config.ContextStrategySummarize)
+	upstream.Enqueue(mockupstream.Reply{Text: "The user said first, second and third."}, mockupstream.Reply{Text: "Done"})
+
+	rr := postChat(t, longConversation())
+	if resp := decodeChat(t, rr); resp.Choices[0].Message.Content != "Done" {
+		t.Errorf("content = %v", resp.Choices[0].Message.Content)
+	}
+	if rr.Header().Get("X-Context-Action") != "summarized" || rr.Header().Get("X-Context-Dropped-Messages") != "3" {
+		t.Errorf("context headers = %v", rr.Header())
+	}
+
+	requests := upstream.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("upstream received %d requests, want summary and completion", len(requests))
+	}
+	if summaryReq := fmt.Sprint(requests[0].Body["messages"]); !strings.Contains(summaryReq, "third") || strings.Contains(summaryReq, "fifth") {
+		t.Errorf("summary request should contain only dropped messages: %s", summaryReq)
+	}
+	if system := fmt.Sprint(requests[1].Body["system"]); !strings.Contains(system, "The user said first, second and third.") {
+		t.Errorf("summary not inserted into system: %s", system)
+	}
+}
+
+func TestIntegrationMaxCompletionTokens(t *testing.T) {
+	upstream := newTestUpstream(t)
+	cfg := *config.GetConfig()
+	cfg.Models = append([]config.Model(nil), cfg.Models...)
+	cfg.Models[0].MaxOutput = 1000
+	config.SetConfig(&cfg)
+
+	decodeChat(t, postChat(t, `{"model":"claude-test","max_completion_tokens":5000,"messages":[{"role":"user","content":"Hi"}]}`))
+	upstreamReq, _ := upstream.LastRequest()
+	if upstreamReq.Body["max_tokens"] != float64(1000) {
+		t.Errorf("upstream max_tokens = %v, want clamped 1000", upstreamReq.Body["max_tokens"])
+	}
+
+	cfg.StrictParams = true
+	config.SetConfig(&cfg)
+	if rr := postChat(t, `{"model":"claude-test","max_tokens":5000,"messages":[{"role":"user","content":"Hi"}]}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("strict mode status = %d, want 400", rr.Code)
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"factory-go-api/balancer"
+	"factory-go-api/breaker"
+	"factory-go-api/config"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// endpointBalancer 同一类型多个端点之间的负载均衡状态
+var endpointBalancer = balancer.New()
+
+// errNoEndpoint 没有启用的端点可用于该类型
+var errNoEndpoint = errors.New("no endpoint configured")
+
+// orderedEndpoints 返回某类型端点的尝试顺序
+func orderedEndpoints(endpointType string) []config.Endpoint {
+	endpoints := config.GetEndpointsByType(endpointType)
+	if len(endpoints) <= 1 {
+		return endpoints
+	}
+
+	byName := make(map[string]config.Endpoint, len(endpoints))
+	candidates := make([]balancer.Candidate, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		byName[endpoint.Name] = endpoint
+		candidates = append(candidates, balancer.Candidate{Name: endpoint.Name, Weight: endpoint.Weight, Priority: endpoint.Priority})
+	}
+	latencyAware := config.GetLoadBalancingConfig().Strategy == config.LoadBalancingLatency
+
+	ordered := make([]config.Endpoint, 0, len(endpoints))
+	for _, c := range endpointBalancer.Order(candidates, latencyAware) {
+		ordered = append(ordered, byName[c.Name])
+	}
+	return ordered
+}
+
+// doUpstream 按负载均衡顺序向某类型的端点发送请求
+// 端点熔断或建立连接失败时切换到下一个端点；模型熔断时直接返回 *breaker.OpenError
+// 连接建立后的错误（如等待响应超时）直接返回，上游可能已经开始处理，重发会重复计费
+// 所有端点都不可用时返回最后一个错误，没有启用的端点时返回 errNoEndpoint
+func doUpstream(endpointType string, model *config.Model, newRequest func(endpoint *config.Endpoint) (*http.Request, error)) (*http.Response, *config.Endpoint, error) {
+	endpoints := orderedEndpoints(endpointType)
+	if len(endpoints) == 0 {
+		return nil, nil, errNoEndpoint
+	}
+
+	var lastErr error
+	for i := range endpoints {
+		endpoint := &endpoints[i]
+		proxyReq, err := newRequest(endpoint)
+		if err != nil {
+			return nil, endpoint, err
+		}
+		client, err := newUpstreamClient(endpoint)
+		if err != nil {
+			log.Printf("⚠️ %v", err)
+			lastErr = err
+			continue
+		}
+
+		// 熔断器打开时快速失败，端点熔断时尝试下一个端点
+		circuitDone, err := allowUpstream(endpoint, model)
+		if err != nil {
+			var openErr *breaker.OpenError
+			if errors.As(err, &openErr) && openErr.Key != "endpoint:"+endpoint.Name {
+				return nil, endpoint, err
+			}
+			lastErr = err
+			continue
+		}
+
+		start := time.Now()
+		resp, err := client.Do(proxyReq)
+		circuitDone(resp, err)
+		if err == nil {
+			if resp.StatusCode < http.StatusInternalServerError {
+				endpointBalancer.ObserveLatency(endpoint.Name, time.Since(start))
+			}
+			return resp, endpoint, nil
+		}
+		if errors.Is(err, context.Canceled) || !isConnectError(err) {
+			return nil, endpoint, err
+		}
+		if i < len(endpoints)-1 {
+			log.Printf("⚠️ 端点 %s 请求失败，切换到下一个端点: %v", endpoint.Name, err)
+		}
+		lastErr = err
+	}
+	return nil, nil, lastErr
+}
+
+// isConnectError 判断错误是否发生在建立连接阶段（DNS、拨号、代理连接、TLS 握手），此时请求还未发出
+func isConnectError(err error) bool {
+	var opErr *net.OpError
+	for e := err; errors.As(e, &opErr); e = opErr.Err {
+		if opErr.Op == "dial" || opErr.Op == "proxyconnect" {
+			return true
+		}
+	}
+	var dnsErr *net.DNSError
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	return errors.As(err, &dnsErr) || errors.As(err, &certErr) || errors.As(err, &recordErr)
+}
+
+// writeUpstreamError 根据 doUpstream 的错误写入响应
+func writeUpstreamError(w http.ResponseWriter, endpointType string, err error) {
+	var openErr *breaker.OpenError
+	switch {
+	case errors.As(err, &openErr):
+		writeCircuitOpenError(w, err)
+	case errors.Is(err, errNoEndpoint):
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("No %s endpoint configured", endpointType), "configuration_error")
+	default:
+		log.Printf("错误: 请求失败: %v", err)
+		http.Error(w, `{"error": {"message": "Request to upstream failed", "type": "upstream_error"}}`, http.StatusBadGateway)
+	}
+}
+
+// endpointStatuses 返回所有端点的健康检查和延迟状态
+func endpointStatuses() []balancer.Status {
+	cfg := config.GetConfig()
+	if cfg == nil {
+		return []balancer.Status{}
+	}
+	names := make([]string, 0, len(cfg.Endpoints))
+	for _, endpoint := range cfg.Endpoints {
+		names = append(names, endpoint.Name)
+	}
+	return endpointBalancer.Statuses(names)
+}
+
+// runHealthChecks 按配置的间隔检查所有启用的端点，直到 ctx 结束
+// 每轮读取最新配置，通过管理 API 开启或关闭健康检查后无需重启
+func runHealthChecks(ctx context.Context) {
+	for {
+		cfg := config.GetLoadBalancingConfig()
+		if cfg.HealthCheck {
+			checkEndpoints(ctx, cfg)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(max(cfg.HealthCheckIntervalSeconds, 1)) * time.Second):
+		}
+	}
+}
+
+// checkEndpoints 并发检查所有启用的端点一次
+func checkEndpoints(ctx context.Context, cfg config.LoadBalancingConfig) {
+	all := config.GetConfig()
+	if all == nil {
+		return
+	}
+	var wg sync.WaitGroup
+	for _, endpoint := range all.Endpoints {
+		if endpoint.Disabled {
+			continue
+		}
+		wg.Add(1)
+		go func(endpoint config.Endpoint) {
+			defer wg.Done()
+			start := time.Now()
+			err := checkEndpoint(ctx, &endpoint, time.Duration(cfg.HealthCheckTimeoutSeconds)*time.Second)
+			if err == nil {
+				endpointBalancer.ObserveLatency(endpoint.Name, time.Since(start))
+			} else if ctx.Err() == nil {
+				log.Printf("⚠️ 端点 %s 健康检查失败: %v", endpoint.Name, err)
+			}
+			if ctx.Err() == nil {
+				endpointBalancer.ReportHealth(endpoint.Name, err, cfg.UnhealthyThreshold, time.Now())
+			}
+		}(endpoint)
+	}
+	wg.Wait()
+}
+
+// checkEndpoint 向端点发送 GET 请求，能连接且未返回 5xx 即视为健康（上游接口通常对 GET 返回 404/405）
+// 健康检查不计入请求统计，也不经过录制/回放
+func checkEndpoint(ctx context.Context, endpoint *config.Endpoint, timeout time.Duration) error {
+	url := endpoint.HealthCheckURL
+	if url == "" {
+		url = endpoint.BaseURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	t, err := upstreamTransports.Get(endpoint)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: timeout, Transport: t}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("health check returned %d", resp.StatusCode)
+	}
+	return nil
+}
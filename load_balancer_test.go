@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"factory-go-api/balancer"
+	"factory-go-api/config"
+	"factory-go-api/metrics"
+	"factory-go-api/mockupstream"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withEndpoints 在测试配置中追加端点，并使用独立的负载均衡状态
+func withEndpoints(t *testing.T, endpoints ...config.Endpoint) {
+	t.Helper()
+	cfg := *config.GetConfig()
+	cfg.Endpoints = append(append([]config.Endpoint(nil), cfg.Endpoints...), endpoints...)
+	config.SetConfig(&cfg)
+
+	previous := endpointBalancer
+	endpointBalancer = balancer.New()
+	t.Cleanup(func() { endpointBalancer = previous })
+}
+
+// closedURL 返回一个已关闭的本地地址，连接会被拒绝
+func closedURL(t *testing.T) string {
+	t.Helper()
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	return server.URL + "/v1/messages"
+}
+
+func TestFailoverOnConnectionError(t *testing.T) {
+	upstream := newTestUpstream(t)
+	withEndpoints(t, config.Endpoint{Name: "anthropic-down", Type: "anthropic", BaseURL: closedURL(t)})
+	// 不可达的端点优先级更高，先被尝试
+	cfg := *config.GetConfig()
+	cfg.Endpoints[0].Priority = 1
+	config.SetConfig(&cfg)
+
+	upstream.Enqueue(mockupstream.Reply{Text: "Recovered"}, mockupstream.Reply{Text: "Streamed"})
+	resp := decodeChat(t, postChat(t, `{"model":"claude-test","messages":[{"role":"user","content":"Hello"}]}`))
+	if resp.Choices[0].Message.Content != "Recovered" {
+		t.Errorf("content = %q", resp.Choices[0].Message.Content)
+	}
+	if content, _ := collectStream(t, postChat(t, `{"model":"claude-test","stream":true,"messages":[{"role":"user","content":"Hello"}]}`)); content != "Streamed" {
+		t.Errorf("stream content = %q", content)
+	}
+	if n := len(upstream.Requests()); n != 2 {
+		t.Errorf("upstream received %d requests, want 2", n)
+	}
+}
+
+// 共享 base_url 的端点使用各自的代理设置，统计也记在实际选择的端点下
+func TestEndpointsSharingBaseURL(t *testing.T) {
+	upstream := newTestUpstream(t)
+	resetMetrics(t)
+	cfg := *config.GetConfig()
+	cfg.Endpoints[0].Priority = 1
+	config.SetConfig(&cfg)
+	withEndpoints(t, config.Endpoint{
+		Name:      "anthropic-proxied",
+		Type:      "anthropic",
+		BaseURL:   cfg.Endpoints[0].BaseURL,
+		Transport: &config.TransportConfig{Proxy: strings.TrimSuffix(closedURL(t), "/v1/messages")},
+	})
+
+	upstream.Enqueue(mockupstream.Reply{Text: "Direct"})
+	resp := decodeChat(t, postChat(t, `{"model":"claude-test","messages":[{"role":"user","content":"Hello"}]}`))
+	if resp.Choices[0].Message.Content != "Direct" {
+		t.Errorf("content = %q", resp.Choices[0].Message.Content)
+	}
+
+	calls := map[string]metrics.UpstreamStats{}
+	for _, stats := range proxyMetrics.Snapshot(time.Now()).Upstreams {
+		calls[stats.Endpoint] = stats
+	}
+	if proxied := calls["anthropic-proxied"]; proxied.Requests != 1 || proxied.Errors != 1 {
+		t.Errorf("anthropic-proxied stats = %+v", proxied)
+	}
+	if direct := calls["anthropic"]; direct.Requests != 1 || direct.Errors != 0 {
+		t.Errorf("anthropic stats = %+v", direct)
+	}
+}
+
+func TestFailoverAllEndpointsDown(t *testing.T) {
+	newTestUpstream(t)
+	cfg := *config.GetConfig()
+	cfg.Endpoints = []config.Endpoint{{Name: "anthropic", BaseURL: closedURL(t)}, {Name: "anthropic-2", Type: "anthropic", BaseURL: closedURL(t)}}
+	config.SetConfig(&cfg)
+
+	rr := postChat(t, `{"model":"claude-test","messages":[{"role":"user","content":"Hello"}]}`)
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+}
+
+// 上游已接收请求后断开连接时不切换端点，避免同一请求被处理两次
+func TestNoFailoverAfterRequestSent(t *testing.T) {
+	upstream := newTestUpstream(t)
+	dropped := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	t.Cleanup(dropped.Close)
+	withEndpoints(t, config.Endpoint{Name: "anthropic-dropped", Type: "anthropic", BaseURL: dropped.URL + "/v1/messages"})
+	cfg := *config.GetConfig()
+	cfg.Endpoints[0].Priority = 1
+	config.SetConfig(&cfg)
+
+	rr := postChat(t, `{"model":"claude-test","messages":[{"role":"user","content":"Hello"}]}`)
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+	if n := len(upstream.Requests()); n != 0 {
+		t.Errorf("upstream received %d requests, want 0", n)
+	}
+}
+
+// 客户端断开时取消上游请求
+func TestClientDisconnectCancelsUpstream(t *testing.T) {
+	newTestUpstream(t)
+	started, cancelled := make(chan struct{}), make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 读完请求体后服务端才能感知连接关闭
+		_, _ = io.Copy(io.Discard, r.Body)
+		close(started)
+		select {
+		case <-r.Context().Done():
+			close(cancelled)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	t.Cleanup(slow.Close)
+	cfg := *config.GetConfig()
+	cfg.Endpoints = []config.Endpoint{{Name: "anthropic", Type: "anthropic", BaseURL: slow.URL + "/v1/messages"}}
+	config.SetConfig(&cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"claude-test","messages":[{"role":"user","content":"Hello"}]}`))
+	req.Header.Set("Authorization", "Bearer client-key")
+	chatCompletionsHandler(httptest.NewRecorder(), req.WithContext(ctx))
+
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("upstream request was not cancelled")
+	}
+}
+
+func TestFailoverSkipsOpenEndpoint(t *testing.T) {
+	upstream := newTestUpstream(t)
+	withCircuitBreaker(t)
+	withEndpoints(t, config.Endpoint{Name: "anthropic-backup", Type: "anthropic", BaseURL: upstream.AnthropicURL(), Priority: 1})
+
+	// 主端点连续失败后熔断
+	upstream.Enqueue(
+		mockupstream.Reply{Status: http.StatusServiceUnavailable, ErrorMessage: "down"},
+		mockupstream.Reply{Status: http.StatusServiceUnavailable, ErrorMessage: "down"},
+	)
+	for i := 0; i < 2; i++ {
+		postChat(t, `{"model":"claude-test","messages":[{"role":"user","content":"Hello"}]}`)
+	}
+
+	// 同类型的其他模型切换到备用端点
+	upstream.Enqueue(mockupstream.Reply{Text: "From backup"})
+	resp := decodeChat(t, postChat(t, `{"model":"claude-thinking","messages":[{"role":"user","content":"Hello"}]}`))
+	if resp.Choices[0].Message.Content != "From backup" {
+		t.Errorf("content = %q", resp.Choices[0].Message.Content)
+	}
+
+	// 模型本身熔断时不切换端点
+	if rr := postChat(t, `{"model":"claude-test","messages":[{"role":"user","content":"Hello"}]}`); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("claude-test status = %d", rr.Code)
+	}
+	if n := len(upstream.Requests()); n != 3 {
+		t.Errorf("upstream received %d requests, want 3", n)
+	}
+}
+
+func TestHealthCheckMarksEndpointUnhealthy(t *testing.T) {
+	newTestUpstream(t)
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	withEndpoints(t, config.Endpoint{Name: "anthropic-eu", Type: "anthropic", BaseURL: closedURL(t), HealthCheckURL: failing.URL})
+
+	lb := config.LoadBalancingConfig{HealthCheck: true, HealthCheckTimeoutSeconds: 5, UnhealthyThreshold: 1}
+	checkEndpoints(context.Background(), lb)
+
+	healthy := make(map[string]bool)
+	for _, status := range endpointStatuses() {
+		healthy[status.Name] = status.Healthy
+	}
+	// 模拟上游对 GET 返回 405，视为健康
+	if !healthy["anthropic"] || !healthy["openai"] || healthy["anthropic-eu"] {
+		t.Errorf("healthy = %v", healthy)
+	}
+
+	rr := httptest.NewRecorder()
+	healthHandler(rr, httptest.NewRequest(http.MethodGet, "/health", nil))
+	var resp struct {
+		Status    string            `json:"status"`
+		Endpoints []balancer.Status `json:"endpoints"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != "degraded" || len(resp.Endpoints) != 3 {
+		t.Errorf("health = %+v", resp)
+	}
+}
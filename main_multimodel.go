@@ -2,8 +2,12 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"factory-go-api/breaker"
 	"factory-go-api/config"
+	"factory-go-api/provider"
 	"factory-go-api/transformers"
 	"fmt"
 	"io"
@@ -43,13 +47,106 @@ func (r *responseRecorder) WriteHeader(code int) {
 	r.ResponseWriter.WriteHeader(code)
 }
 
-// 健康检查端点
+// writeJSONError 以 OpenAI 错误格式返回包含动态内容的错误信息
+func writeJSONError(w http.ResponseWriter, statusCode int, message, errType string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": message,
+			"type":    errType,
+		},
+	}); err != nil {
+		log.Printf("错误: 编码响应失败: %v", err)
+	}
+}
+
+// defaultClientName 使用 PROXY_API_KEY 访问时的客户端名称
+const defaultClientName = "default"
+
+var (
+	errInvalidAuthFormat = errors.New("invalid authorization header format")
+	errInvalidAPIKey     = errors.New("invalid API key")
+)
+
+// authenticateClient 验证客户端 Key 并返回客户端名称
+// 未配置 PROXY_API_KEY 和 clients 时为直连模式，不校验 Key
+func authenticateClient(authHeader string) (string, error) {
+	proxyAPIKey := getEnv("PROXY_API_KEY", "")
+	if proxyAPIKey == "" && !config.HasClients() {
+		return "", nil
+	}
+
+	// 提取客户端 API Key
+	parts := strings.SplitN(authHeader, " ", 2)
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return "", errInvalidAuthFormat
+	}
+	clientAPIKey := parts[1]
+
+	if proxyAPIKey != "" && clientAPIKey == proxyAPIKey {
+		return defaultClientName, nil
+	}
+	if client := config.GetClientByKey(clientAPIKey); client != nil {
+		return client.Name, nil
+	}
+	return "", errInvalidAPIKey
+}
+
+// authorizeRequest 验证客户端并返回客户端名称和访问上游使用的 Authorization 头
+// 验证失败时已写入错误响应，返回 ok=false
+func authorizeRequest(w http.ResponseWriter, r *http.Request) (clientName, upstreamAuth string, ok bool) {
+	// 获取客户端 Authorization 头
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		http.Error(w, `{"error": {"message": "Authorization header is required", "type": "invalid_request_error"}}`, http.StatusUnauthorized)
+		return "", "", false
+	}
+
+	// 验证 PROXY_API_KEY 或客户端 Key（如果配置了）
+	clientName, err := authenticateClient(authHeader)
+	if err == errInvalidAuthFormat {
+		http.Error(w, `{"error": {"message": "Invalid authorization header format", "type": "invalid_request_error"}}`, http.StatusUnauthorized)
+		return "", "", false
+	} else if err != nil {
+		log.Printf("❌ API Key 验证失败")
+		http.Error(w, `{"error": {"message": "Invalid API key", "type": "authentication_error"}}`, http.StatusUnauthorized)
+		return "", "", false
+	}
+
+	// 使用源头 FACTORY_API_KEY 替换 Authorization 头
+	factoryAPIKey := getEnv("FACTORY_API_KEY", "")
+	if factoryAPIKey == "" {
+		log.Printf("❌ FACTORY_API_KEY 未配置")
+		http.Error(w, `{"error": {"message": "Server configuration error", "type": "server_error"}}`, http.StatusInternalServerError)
+		return "", "", false
+	}
+	return clientName, "Bearer " + factoryAPIKey, true
+}
+
+// 健康检查端点，有熔断器处于打开状态或端点健康检查失败时 status 为 degraded
 func healthHandler(w http.ResponseWriter, r *http.Request) {
+	breakers := circuitBreakerStatuses()
+	endpoints := endpointStatuses()
+	status := "healthy"
+	for _, b := range breakers {
+		if b.State == breaker.Open {
+			status = "degraded"
+		}
+	}
+	for _, e := range endpoints {
+		if !e.Healthy {
+			status = "degraded"
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":    "healthy",
-		"timestamp": time.Now().UTC().Format(time.RFC3339),
-		"uptime":    time.Since(startTime).Seconds(),
+		"status":           status,
+		"timestamp":        time.Now().UTC().Format(time.RFC3339),
+		"uptime":           time.Since(startTime).Seconds(),
+		"circuit_breakers": breakers,
+		"endpoints":        endpoints,
 	}); err != nil {
 		log.Printf("错误: 编码响应失败: %v", err)
 	}
@@ -63,11 +160,16 @@ func modelsHandler(w http.ResponseWriter, r *http.Request) {
 	openaiModels := make([]map[string]interface{}, 0, len(models))
 	
 	for _, model := range models {
+		// 自建服务的模型以端点类型作为 owned_by
+		ownedBy := "factory"
+		if model.Type == "openai-chat" {
+			ownedBy = model.EndpointType()
+		}
 		openaiModels = append(openaiModels, map[string]interface{}{
 			"id":      model.ID,
 			"object":  "model",
 			"created": time.Now().Unix(),
-			"owned_by": "factory",
+			"owned_by": ownedBy,
 		})
 	}
 	
@@ -79,19 +181,6 @@ func modelsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// API 文档端点
-func docsHandler(w http.ResponseWriter, r *http.Request) {
-	htmlContent, err := os.ReadFile("docs.html")
-	if err != nil {
-		http.Error(w, "Documentation not found", http.StatusNotFound)
-		return
-	}
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if _, err := w.Write(htmlContent); err != nil {
-		log.Printf("错误: 写入响应失败: %v", err)
-	}
-}
-
 // OpenAI 兼容的聊天端点
 func chatCompletionsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -99,40 +188,10 @@ func chatCompletionsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 获取客户端 Authorization 头
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		http.Error(w, `{"error": {"message": "Authorization header is required", "type": "invalid_request_error"}}`, http.StatusUnauthorized)
-		return
-	}
-
-	// 验证 PROXY_API_KEY（如果配置了）
-	proxyAPIKey := getEnv("PROXY_API_KEY", "")
-	if proxyAPIKey != "" {
-		// 提取客户端 API Key
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			http.Error(w, `{"error": {"message": "Invalid authorization header format", "type": "invalid_request_error"}}`, http.StatusUnauthorized)
-			return
-		}
-		clientAPIKey := parts[1]
-
-		// 验证客户端 Key 是否匹配代理 Key
-		if clientAPIKey != proxyAPIKey {
-			log.Printf("❌ API Key 验证失败")
-			http.Error(w, `{"error": {"message": "Invalid API key", "type": "authentication_error"}}`, http.StatusUnauthorized)
-			return
-		}
-	}
-
-	// 使用源头 FACTORY_API_KEY 替换 Authorization 头
-	factoryAPIKey := getEnv("FACTORY_API_KEY", "")
-	if factoryAPIKey == "" {
-		log.Printf("❌ FACTORY_API_KEY 未配置")
-		http.Error(w, `{"error": {"message": "Server configuration error", "type": "server_error"}}`, http.StatusInternalServerError)
+	clientName, authHeader, ok := authorizeRequest(w, r)
+	if !ok {
 		return
 	}
-	authHeader = "Bearer " + factoryAPIKey
 
 	// 读取请求体
 	bodyBytes, err := io.ReadAll(r.Body)
@@ -154,6 +213,9 @@ func chatCompletionsHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, `{"error": {"message": "Invalid JSON", "type": "invalid_request_error"}}`, http.StatusBadRequest)
 		return
 	}
+	openaiReq.ClientName = clientName
+	openaiReq.Extra = transformers.ExtraFields(bodyBytes)
+	openaiReq.Context = r.Context()
 
 	// 检查模型是否支持
 	model := config.GetModelByID(openaiReq.Model)
@@ -165,143 +227,129 @@ func chatCompletionsHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("✅ %s [%s] stream=%v", openaiReq.Model, model.Type, openaiReq.Stream)
 
-	// 根据模型类型路由请求
-	switch model.Type {
-	case "anthropic":
-		handleAnthropicRequest(w, r, &openaiReq, model, authHeader)
-	case "openai":
-		handleFactoryOpenAIRequest(w, r, &openaiReq, model, authHeader)
-	default:
-		http.Error(w, `{"error": {"message": "Unsupported model type", "type": "invalid_request_error"}}`, http.StatusBadRequest)
+	// 检查目标模型无法映射的参数
+	if unsupported := transformers.UnsupportedParams(&openaiReq, model.Type); len(unsupported) > 0 {
+		if config.GetStrictParams() {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported parameters for model '%s': %s", openaiReq.Model, strings.Join(unsupported, ", ")), "invalid_request_error")
+			return
+		}
+		log.Printf("⚠️ 忽略不支持的参数: %s", strings.Join(unsupported, ", "))
 	}
-}
 
-// 处理 Anthropic 类型请求
-func handleAnthropicRequest(w http.ResponseWriter, r *http.Request, openaiReq *transformers.OpenAIRequest, model *config.Model, authHeader string) {
-	// 转换请求
-	anthropicReq := transformers.TransformToAnthropic(openaiReq)
-	
-	// 获取端点
-	endpoint := config.GetEndpointByType("anthropic")
-	if endpoint == nil {
-		http.Error(w, `{"error": {"message": "Anthropic endpoint not configured", "type": "configuration_error"}}`, http.StatusInternalServerError)
+	// 合并 max_completion_tokens 并按模型输出上限校验 max_tokens
+	if err := transformers.NormalizeMaxTokens(&openaiReq, model.MaxOutput, config.GetStrictParams()); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error(), "invalid_request_error")
 		return
 	}
 
-	// 序列化请求
-	reqBody, err := json.Marshal(anthropicReq)
-	if err != nil {
-		log.Printf("错误: 序列化请求失败: %v", err)
-		http.Error(w, `{"error": {"message": "Failed to serialize request", "type": "server_error"}}`, http.StatusInternalServerError)
+	// 检查 n 参数
+	if openaiReq.N < 0 || openaiReq.N > maxChoices {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("n must be between 1 and %d", maxChoices), "invalid_request_error")
 		return
 	}
 
-
-	// 创建 HTTP 请求
-	proxyReq, err := http.NewRequest(http.MethodPost, endpoint.BaseURL, bytes.NewBuffer(reqBody))
-	if err != nil {
-		log.Printf("错误: 创建请求失败: %v", err)
-		http.Error(w, `{"error": {"message": "Failed to create request", "type": "server_error"}}`, http.StatusInternalServerError)
+	// 上下文窗口管理：超限时按策略截断或摘要，无法处理时返回 400
+	if !manageContextWindow(w, r, &openaiReq, model, authHeader) {
 		return
 	}
 
-	// 设置请求头
-	clientHeaders := extractClientHeaders(r)
-	headers := transformers.GetAnthropicHeaders(authHeader, clientHeaders, openaiReq.Stream, model.ID)
-	for key, value := range headers {
-		proxyReq.Header.Set(key, value)
+	handle := func(w http.ResponseWriter, r *http.Request, openaiReq *transformers.OpenAIRequest) {
+		dispatchModelRequest(w, r, openaiReq, model, authHeader)
 	}
-
-	// 发送请求
-	client := &http.Client{Timeout: 120 * time.Second}
-	resp, err := client.Do(proxyReq)
-	if err != nil {
-		log.Printf("错误: 请求失败: %v", err)
-		http.Error(w, `{"error": {"message": "Request to upstream failed", "type": "upstream_error"}}`, http.StatusBadGateway)
+	if openaiReq.N > 1 {
+		// 每个 choice 都需要独立的上游结果，不能使用响应缓存
+		handleMultipleChoices(w, withoutResponseCache(r), &openaiReq, handle)
 		return
 	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			log.Printf("警告: 关闭响应体失败: %v", err)
-		}
-	}()
-
-	log.Printf("📥 Anthropic 响应: %d", resp.StatusCode)
+	handle(w, r, &openaiReq)
+}
 
-	// 处理响应
-	if openaiReq.Stream {
-		// 流式响应
-		handleAnthropicStreamResponse(w, resp, model.ID)
-	} else {
-		// 非流式响应
-		handleAnthropicNonStreamResponse(w, resp, model.ID)
+// dispatchModelRequest 按模型类型选择 Provider 转换请求，经过负载均衡、熔断和响应缓存访问上游
+func dispatchModelRequest(w http.ResponseWriter, r *http.Request, openaiReq *transformers.OpenAIRequest, model *config.Model, authHeader string) {
+	p := provider.Get(model.Type)
+	if p == nil {
+		http.Error(w, `{"error": {"message": "Unsupported model type", "type": "invalid_request_error"}}`, http.StatusBadRequest)
+		return
 	}
-}
+	req := &provider.Request{OpenAI: openaiReq, Model: model, AuthHeader: authHeader, ClientHeaders: extractClientHeaders(r)}
 
-// 处理 Factory OpenAI 类型请求
-func handleFactoryOpenAIRequest(w http.ResponseWriter, r *http.Request, openaiReq *transformers.OpenAIRequest, model *config.Model, authHeader string) {
 	// 转换请求
-	factoryReq := transformers.TransformToFactoryOpenAI(openaiReq)
-	
-	// 获取端点
-	endpoint := config.GetEndpointByType("openai")
-	if endpoint == nil {
-		http.Error(w, `{"error": {"message": "OpenAI endpoint not configured", "type": "configuration_error"}}`, http.StatusInternalServerError)
+	upstreamReq, err := p.BuildRequest(req)
+	if err != nil {
+		log.Printf("❌ 请求转换失败: %v", err)
+		writeJSONError(w, http.StatusBadRequest, err.Error(), "invalid_request_error")
+		return
+	}
+
+	// 检查端点
+	if config.GetEndpointByType(model.EndpointType()) == nil {
+		writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("No %s endpoint configured", model.EndpointType()), "configuration_error")
 		return
 	}
 
 	// 序列化请求
-	reqBody, err := json.Marshal(factoryReq)
+	reqBody, err := json.Marshal(upstreamReq)
 	if err != nil {
 		log.Printf("错误: 序列化请求失败: %v", err)
 		http.Error(w, `{"error": {"message": "Failed to serialize request", "type": "server_error"}}`, http.StatusInternalServerError)
 		return
 	}
 
+	// 响应缓存命中时直接回放，否则请求上游
+	serveWithResponseCache(w, r, openaiReq, model.EndpointType(), reqBody, func(w http.ResponseWriter) {
+		// 按负载均衡顺序选择端点发送请求，连接失败时切换到下一个端点
+		resp, endpoint, err := doUpstream(model.EndpointType(), model, func(endpoint *config.Endpoint) (*http.Request, error) {
+			proxyReq, err := http.NewRequestWithContext(r.Context(), http.MethodPost, p.URL(endpoint, req), bytes.NewReader(reqBody))
+			if err != nil {
+				return nil, err
+			}
+			for key, value := range p.Headers(endpoint, req) {
+				proxyReq.Header.Set(key, value)
+			}
+			return proxyReq, nil
+		})
+		if err != nil {
+			writeUpstreamError(w, model.EndpointType(), err)
+			return
+		}
+		defer func() {
+			if err := resp.Body.Close(); err != nil {
+				log.Printf("警告: 关闭响应体失败: %v", err)
+			}
+		}()
 
-	// 创建 HTTP 请求
-	proxyReq, err := http.NewRequest(http.MethodPost, endpoint.BaseURL, bytes.NewBuffer(reqBody))
-	if err != nil {
-		log.Printf("错误: 创建请求失败: %v", err)
-		http.Error(w, `{"error": {"message": "Failed to create request", "type": "server_error"}}`, http.StatusInternalServerError)
-		return
-	}
-
-	// 设置请求头
-	clientHeaders := extractClientHeaders(r)
-	headers := transformers.GetFactoryOpenAIHeaders(authHeader, clientHeaders)
-	for key, value := range headers {
-		proxyReq.Header.Set(key, value)
-	}
+		log.Printf("📥 %s 响应: %d (%s)", model.Type, resp.StatusCode, endpoint.Name)
 
-	// 发送请求
-	client := &http.Client{Timeout: 120 * time.Second}
-	resp, err := client.Do(proxyReq)
-	if err != nil {
-		log.Printf("错误: 请求失败: %v", err)
-		http.Error(w, `{"error": {"message": "Request to upstream failed", "type": "upstream_error"}}`, http.StatusBadGateway)
-		return
-	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			log.Printf("警告: 关闭响应体失败: %v", err)
+		// 错误响应直接转发
+		if resp.StatusCode != http.StatusOK {
+			forwardUpstreamError(w, resp)
+			return
 		}
-	}()
 
-	log.Printf("📥 Factory OpenAI 响应: %d", resp.StatusCode)
+		// 处理响应
+		if openaiReq.Stream {
+			handleStreamResponse(w, p.DecodeStream(resp.Body, req))
+		} else {
+			handleNonStreamResponse(w, resp, p, req)
+		}
+	})
+}
 
-	// 处理响应
-	if openaiReq.Stream {
-		// 流式响应
-		handleFactoryOpenAIStreamResponse(w, resp, model.ID)
-	} else {
-		// 非流式响应
-		handleFactoryOpenAINonStreamResponse(w, resp, model.ID)
+// forwardUpstreamError 把上游的错误响应原样转发给客户端
+func forwardUpstreamError(w http.ResponseWriter, resp *http.Response) {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Printf("错误: 读取响应失败: %v", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.StatusCode)
+	if _, err := w.Write(body); err != nil {
+		log.Printf("错误: 写入错误响应失败: %v", err)
 	}
 }
 
-// 处理 Anthropic 非流式响应
-func handleAnthropicNonStreamResponse(w http.ResponseWriter, resp *http.Response, modelID string) {
+// 处理非流式响应
+func handleNonStreamResponse(w http.ResponseWriter, resp *http.Response, p provider.Provider, req *provider.Request) {
 	// 读取响应体
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -310,33 +358,18 @@ func handleAnthropicNonStreamResponse(w http.ResponseWriter, resp *http.Response
 		return
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		// 错误响应直接转发
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(resp.StatusCode)
-		if _, err := w.Write(body); err != nil {
-			log.Printf("错误: 写入错误响应失败: %v", err)
-		}
-		return
-	}
-
-	// 解析 Anthropic 响应
-	var anthropicResp map[string]interface{}
-	if err := json.Unmarshal(body, &anthropicResp); err != nil {
-		log.Printf("错误: 解析响应失败: %v", err)
-		http.Error(w, `{"error": {"message": "Failed to parse response", "type": "server_error"}}`, http.StatusInternalServerError)
-		return
-	}
-
 	// 转换为 OpenAI 格式
-	transformer := transformers.NewAnthropicResponseTransformer(modelID, "")
-	openaiResp, err := transformer.TransformNonStreamResponse(anthropicResp)
+	openaiResp, err := p.DecodeResponse(body, req)
 	if err != nil {
 		log.Printf("错误: 转换响应失败: %v", err)
 		http.Error(w, `{"error": {"message": "Failed to transform response", "type": "server_error"}}`, http.StatusInternalServerError)
 		return
 	}
 
+	if !validateStructuredResponse(w, req.OpenAI, openaiResp) {
+		return
+	}
+
 	// 返回 OpenAI 格式响应
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(openaiResp); err != nil {
@@ -344,8 +377,8 @@ func handleAnthropicNonStreamResponse(w http.ResponseWriter, resp *http.Response
 	}
 }
 
-// 处理 Anthropic 流式响应
-func handleAnthropicStreamResponse(w http.ResponseWriter, resp *http.Response, modelID string) {
+// 处理流式响应
+func handleStreamResponse(w http.ResponseWriter, chunks <-chan string) {
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
@@ -356,13 +389,7 @@ func handleAnthropicStreamResponse(w http.ResponseWriter, resp *http.Response, m
 		return
 	}
 
-	// 创建转换器
-	transformer := transformers.NewAnthropicResponseTransformer(modelID, "")
-	
-	// 转换流式响应
-	outputChan := transformer.TransformStream(resp.Body)
-	
-	for chunk := range outputChan {
+	for chunk := range chunks {
 		if _, err := fmt.Fprint(w, chunk); err != nil {
 			log.Printf("错误: 写入流式响应失败: %v", err)
 			return
@@ -371,75 +398,32 @@ func handleAnthropicStreamResponse(w http.ResponseWriter, resp *http.Response, m
 	}
 }
 
-// 处理 Factory OpenAI 非流式响应
-func handleFactoryOpenAINonStreamResponse(w http.ResponseWriter, resp *http.Response, modelID string) {
-	// 读取响应体
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("错误: 读取响应失败: %v", err)
-		http.Error(w, `{"error": {"message": "Failed to read response", "type": "server_error"}}`, http.StatusInternalServerError)
-		return
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		// 错误响应直接转发
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(resp.StatusCode)
-		if _, err := w.Write(body); err != nil {
-			log.Printf("错误: 写入错误响应失败: %v", err)
-		}
-		return
-	}
-
-	// 解析 Factory OpenAI 响应
-	var factoryResp map[string]interface{}
-	if err := json.Unmarshal(body, &factoryResp); err != nil {
-		log.Printf("错误: 解析响应失败: %v", err)
-		http.Error(w, `{"error": {"message": "Failed to parse response", "type": "server_error"}}`, http.StatusInternalServerError)
-		return
+// validateStructuredResponse 启用 structured_output.validate 时校验非流式响应内容
+// 校验失败时写入 502 错误并返回 false
+// Provider 返回的响应不是 OpenAIResponse 时按 JSON 重新解析后校验
+func validateStructuredResponse(w http.ResponseWriter, openaiReq *transformers.OpenAIRequest, decoded interface{}) bool {
+	if !config.GetStructuredOutputConfig().Validate || !openaiReq.ResponseFormat.IsStructured() {
+		return true
 	}
-
-	// 转换为 OpenAI 格式
-	transformer := transformers.NewFactoryOpenAIResponseTransformer(modelID, "")
-	openaiResp, err := transformer.TransformNonStreamResponse(factoryResp)
-	if err != nil {
-		log.Printf("错误: 转换响应失败: %v", err)
-		http.Error(w, `{"error": {"message": "Failed to transform response", "type": "server_error"}}`, http.StatusInternalServerError)
-		return
-	}
-
-	// 返回 OpenAI 格式响应
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(openaiResp); err != nil {
-		log.Printf("错误: 编码响应失败: %v", err)
-	}
-}
-
-// 处理 Factory OpenAI 流式响应
-func handleFactoryOpenAIStreamResponse(w http.ResponseWriter, resp *http.Response, modelID string) {
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-
-	flusher, ok := w.(http.Flusher)
+	openaiResp, ok := decoded.(*transformers.OpenAIResponse)
 	if !ok {
-		http.Error(w, `{"error": {"message": "Streaming not supported", "type": "server_error"}}`, http.StatusInternalServerError)
-		return
+		openaiResp = &transformers.OpenAIResponse{}
+		data, err := json.Marshal(decoded)
+		if err != nil || json.Unmarshal(data, openaiResp) != nil {
+			return true
+		}
 	}
-
-	// 创建转换器
-	transformer := transformers.NewFactoryOpenAIResponseTransformer(modelID, "")
-	
-	// 转换流式响应
-	outputChan := transformer.TransformStream(resp.Body)
-	
-	for chunk := range outputChan {
-		if _, err := fmt.Fprint(w, chunk); err != nil {
-			log.Printf("错误: 写入流式响应失败: %v", err)
-			return
+	for _, choice := range openaiResp.Choices {
+		if choice.Message == nil {
+			continue
+		}
+		if err := transformers.ValidateStructuredOutput(openaiReq.ResponseFormat, choice.Message.Content); err != nil {
+			log.Printf("❌ 结构化输出校验失败: %v", err)
+			writeJSONError(w, http.StatusBadGateway, "Model output failed response_format validation: "+err.Error(), "upstream_error")
+			return false
 		}
-		flusher.Flush()
 	}
+	return true
 }
 
 // 提取客户端请求头
@@ -469,6 +453,30 @@ func extractClientHeaders(r *http.Request) map[string]string {
 	return headers
 }
 
+// route 服务注册的路由
+type route struct {
+	pattern string
+	handler http.HandlerFunc
+}
+
+// routes 返回根路径以外的全部路由，新增路由时需要同步更新 buildOpenAPISpec
+func routes() []route {
+	return []route{
+		{"/health", healthHandler},
+		{"/v1/models", modelsHandler},
+		{"/v1/chat/completions", withMetrics(chatCompletionsHandler)},
+		{"/v1/token_count", tokenCountHandler},
+		{"/v1/messages/count_tokens", anthropicCountTokensHandler},
+		{"/api/tags", ollamaTagsHandler},
+		{"/api/chat", ollamaChatHandler},
+		{"/api/generate", ollamaGenerateHandler},
+		{"/openapi.json", openapiHandler},
+		{"/docs", docsHandler},
+		{"/admin/", adminHandler},
+		{"/dashboard", dashboardHandler},
+	}
+}
+
 func main() {
 	// 验证必需的环境变量
 	factoryAPIKey := getEnv("FACTORY_API_KEY", "")
@@ -499,12 +507,31 @@ func main() {
 	for _, model := range cfg.Models {
 		log.Printf("   • %s [%s]", model.ID, model.Type)
 	}
+	if len(cfg.Clients) > 0 {
+		log.Printf("👥 客户端 Key (%d):", len(cfg.Clients))
+		for _, client := range cfg.Clients {
+			log.Printf("   • %s", client.Name)
+		}
+	}
+
+	if err := initResponseCache(cfg.ResponseCache); err != nil {
+		log.Fatalf("❌ 初始化响应缓存失败: %v", err)
+	}
+	if cfg.ResponseCache.Enabled {
+		log.Printf("💾 响应缓存: 已启用 (%s, TTL %ds)", cfg.ResponseCache.Backend, cfg.ResponseCache.TTLSeconds)
+	}
+
+	if err := initRecording(recordingConfig(cfg)); err != nil {
+		log.Fatalf("❌ 初始化录制/回放失败: %v", err)
+	}
+
+	// 端点健康检查在后台运行，是否启用在每轮检查时读取配置
+	go runHealthChecks(context.Background())
 
 	// 设置路由
-	http.HandleFunc("/health", healthHandler)
-	http.HandleFunc("/v1/models", modelsHandler)
-	http.HandleFunc("/v1/chat/completions", chatCompletionsHandler)
-	http.HandleFunc("/docs", docsHandler)
+	for _, route := range routes() {
+		http.HandleFunc(route.pattern, route.handler)
+	}
 	
 	// 根路径
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -521,6 +548,13 @@ func main() {
 				"/health",
 				"/v1/models",
 				"/v1/chat/completions",
+				"/v1/token_count",
+				"/v1/messages/count_tokens",
+				"/api/tags",
+				"/api/chat",
+				"/api/generate",
+				"/openapi.json",
+				"/docs",
 			},
 		}); err != nil {
 			log.Printf("错误: 编码响应失败: %v", err)
@@ -536,8 +570,12 @@ func main() {
 		IdleTimeout:  120 * time.Second,
 	}
 
+	if getEnv("ADMIN_API_KEY", "") != "" {
+		log.Printf("🛠️ 管理 API: 已启用 (/admin/*)，管理面板: http://localhost%s/dashboard", port)
+	}
+
 	log.Printf("🚀 服务启动于 http://localhost%s", port)
-	log.Printf("📖 文档: http://localhost%s/docs", port)
+	log.Printf("📖 文档: http://localhost%s/docs (OpenAPI: /openapi.json)", port)
 	
 	if err := server.ListenAndServe(); err != nil {
 		log.Fatalf("❌ 服务器启动失败: %v", err)
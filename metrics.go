@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"factory-go-api/config"
+	"factory-go-api/metrics"
+	"factory-go-api/transformers"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// proxyMetrics 全局请求统计，供管理面板展示
+var proxyMetrics = metrics.New()
+
+// 无法识别客户端时使用的名称
+const (
+	directClientName          = "direct"          // 直连模式，未校验 Key
+	unauthenticatedClientName = "unauthenticated" // Key 校验失败
+)
+
+// withMetrics 统计聊天请求的状态、延迟、用量和费用
+func withMetrics(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			next(w, r)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		var openaiReq transformers.OpenAIRequest
+		_ = json.Unmarshal(body, &openaiReq) // 解析失败时由 next 返回 400，这里只用于统计
+
+		clientName, err := authenticateClient(r.Header.Get("Authorization"))
+		if err != nil {
+			clientName = unauthenticatedClientName
+		} else if clientName == "" {
+			clientName = directClientName
+		}
+
+		capture := &captureResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next(capture, r)
+		proxyMetrics.RecordRequest(requestMetrics(&openaiReq, clientName, capture, start))
+	}
+}
+
+// requestMetrics 从响应中提取状态、用量和错误信息
+// 上游未返回 usage（如 Anthropic 流式响应）时使用本地估算
+func requestMetrics(openaiReq *transformers.OpenAIRequest, clientName string, capture *captureResponseWriter, start time.Time) metrics.Request {
+	// 只按已配置的模型统计，客户端可以发送任意模型名
+	model := config.GetModelByID(openaiReq.Model)
+	event := metrics.Request{
+		Time:    start,
+		Model:   metrics.UnknownModel,
+		Client:  clientName,
+		Status:  capture.statusCode,
+		Latency: time.Since(start),
+	}
+	if model != nil {
+		event.Model = model.ID
+	}
+
+	if capture.statusCode >= http.StatusBadRequest {
+		var errResp struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(capture.body.Bytes(), &errResp); err == nil && errResp.Error.Message != "" {
+			event.Error = errResp.Error.Message
+		} else {
+			event.Error = strings.TrimSpace(capture.body.String())
+		}
+		return event
+	}
+
+	var resp *transformers.OpenAIResponse
+	if strings.HasPrefix(capture.Header().Get("Content-Type"), "text/event-stream") {
+		resp = assembleStreamResponse(capture.body.Bytes())
+	} else {
+		resp = &transformers.OpenAIResponse{}
+		if err := json.Unmarshal(capture.body.Bytes(), resp); err != nil {
+			resp = nil
+		}
+	}
+	if resp == nil {
+		return event
+	}
+
+	if prompt, ok := resp.Usage["prompt_tokens"].(float64); ok {
+		event.PromptTokens = int(prompt)
+		completion, _ := resp.Usage["completion_tokens"].(float64)
+		event.CompletionTokens = int(completion)
+	} else {
+		event.PromptTokens = transformers.EstimateOpenAIRequestTokens(openaiReq)
+		for _, choice := range resp.Choices {
+			if choice.Message != nil {
+				event.CompletionTokens += transformers.EstimateTextTokens(choice.Message.Content)
+				for _, call := range choice.Message.ToolCalls {
+					event.CompletionTokens += transformers.EstimateTextTokens(call.Function.Name + call.Function.Arguments)
+				}
+			}
+		}
+	}
+
+	if model != nil {
+		event.Cost = (float64(event.PromptTokens)*model.InputPrice + float64(event.CompletionTokens)*model.OutputPrice) / 1e6
+	}
+	return event
+}
+
+// metricsTransport 统计每次上游调用的状态和延迟，用于判断上游端点和 Key 的健康状况
+type metricsTransport struct {
+	endpoint string
+	next     http.RoundTripper
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+
+	call := metrics.Upstream{
+		Time:     start,
+		Endpoint: t.endpoint,
+		KeyHint:  maskKey(strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")),
+		Latency:  time.Since(start),
+	}
+	if err != nil {
+		call.Error = err.Error()
+	} else {
+		call.Status = resp.StatusCode
+		if resp.StatusCode >= http.StatusBadRequest {
+			call.Error = http.StatusText(resp.StatusCode)
+		}
+	}
+	proxyMetrics.RecordUpstream(call)
+	return resp, err
+}
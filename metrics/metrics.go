@@ -0,0 +1,331 @@
+// Package metrics 统计代理自身的请求速率、延迟、错误、用量和上游健康状况，供管理面板展示
+//
+// 所有数据只保存在内存中，进程重启后清零。
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	rateWindow         = 60  // 请求速率统计窗口（秒）
+	latencySamples     = 512 // 每个模型保留的最近延迟样本数
+	maxRecentFailures  = 50  // 保留的最近失败记录数
+	unhealthyThreshold = 3   // 上游连续失败达到该次数视为不健康
+)
+
+// UnknownModel 请求的模型不在配置中时统计使用的模型名，避免任意模型名使统计无限增长
+const UnknownModel = "unknown"
+
+// Request 一次客户端请求的统计数据
+type Request struct {
+	Time             time.Time
+	Model            string // 已配置的模型 ID 或 UnknownModel
+	Client           string
+	Status           int
+	Latency          time.Duration
+	PromptTokens     int
+	CompletionTokens int
+	Cost             float64 // 美元
+	Error            string
+}
+
+// Upstream 一次上游调用的统计数据
+type Upstream struct {
+	Time     time.Time
+	Endpoint string
+	KeyHint  string // 脱敏后的上游 Key，用于区分同一端点的不同 Key
+	Status   int    // 0 表示网络错误
+	Latency  time.Duration
+	Error    string
+}
+
+// Failure 最近的失败记录
+type Failure struct {
+	Time   time.Time `json:"time"`
+	Kind   string    `json:"kind"`   // request 或 upstream
+	Source string    `json:"source"` // 模型 ID 或端点名称
+	Client string    `json:"client,omitempty"`
+	Status int       `json:"status"`
+	Error  string    `json:"error"`
+}
+
+// RatePoint 每秒的请求数
+type RatePoint struct {
+	Time     int64 `json:"time"` // Unix 秒
+	Requests int   `json:"requests"`
+	Errors   int   `json:"errors"`
+}
+
+// ModelStats 单个模型的请求统计
+type ModelStats struct {
+	Model            string  `json:"model"`
+	Requests         int     `json:"requests"`
+	Errors           int     `json:"errors"`
+	ErrorRate        float64 `json:"error_rate"`
+	AvgLatencyMS     float64 `json:"avg_latency_ms"`
+	P50LatencyMS     float64 `json:"p50_latency_ms"`
+	P95LatencyMS     float64 `json:"p95_latency_ms"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+}
+
+// ClientStats 单个客户端 Key 的用量统计
+type ClientStats struct {
+	Client           string  `json:"client"`
+	Requests         int     `json:"requests"`
+	Errors           int     `json:"errors"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// UpstreamStats 单个上游端点 + Key 的健康状况
+type UpstreamStats struct {
+	Endpoint            string     `json:"endpoint"`
+	KeyHint             string     `json:"key_hint"`
+	Requests            int        `json:"requests"`
+	Errors              int        `json:"errors"`
+	AvgLatencyMS        float64    `json:"avg_latency_ms"`
+	LastStatus          int        `json:"last_status"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+	LastFailure         *time.Time `json:"last_failure,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	Healthy             bool       `json:"healthy"`
+}
+
+// Snapshot 某一时刻的统计快照
+type Snapshot struct {
+	StartedAt         time.Time       `json:"started_at"`
+	Requests          int             `json:"requests"`
+	Errors            int             `json:"errors"`
+	RequestsPerSecond float64         `json:"requests_per_second"` // 最近 60 秒的平均值
+	Rate              []RatePoint     `json:"rate"`
+	Models            []ModelStats    `json:"models"`
+	Clients           []ClientStats   `json:"clients"`
+	Upstreams         []UpstreamStats `json:"upstreams"`
+	RecentFailures    []Failure       `json:"recent_failures"`
+}
+
+type modelEntry struct {
+	stats        ModelStats
+	totalLatency time.Duration
+	samples      []time.Duration // 环形缓冲
+	next         int
+}
+
+type upstreamEntry struct {
+	stats        UpstreamStats
+	totalLatency time.Duration
+}
+
+// Collector 线程安全的统计收集器
+type Collector struct {
+	mu        sync.Mutex
+	startedAt time.Time
+	requests  int
+	errors    int
+	rate      [rateWindow]RatePoint // 按 Unix 秒取模存放
+	models    map[string]*modelEntry
+	clients   map[string]*ClientStats
+	upstreams map[string]*upstreamEntry
+	failures  []Failure
+}
+
+// New 创建统计收集器
+func New() *Collector {
+	return &Collector{
+		startedAt: time.Now(),
+		models:    make(map[string]*modelEntry),
+		clients:   make(map[string]*ClientStats),
+		upstreams: make(map[string]*upstreamEntry),
+	}
+}
+
+// IsUpstreamFailure 上游状态码是否说明端点或 Key 不可用（客户端参数错误不计入）
+func IsUpstreamFailure(status int) bool {
+	return status == 0 || status == 401 || status == 403 || status == 429 || status >= 500
+}
+
+// RecordRequest 记录一次客户端请求
+func (c *Collector) RecordRequest(req Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	failed := req.Status >= 400
+	c.requests++
+	if failed {
+		c.errors++
+	}
+	c.addRate(req.Time, failed)
+
+	model, ok := c.models[req.Model]
+	if !ok {
+		model = &modelEntry{stats: ModelStats{Model: req.Model}}
+		c.models[req.Model] = model
+	}
+	model.stats.Requests++
+	model.stats.PromptTokens += req.PromptTokens
+	model.stats.CompletionTokens += req.CompletionTokens
+	model.totalLatency += req.Latency
+	if len(model.samples) < latencySamples {
+		model.samples = append(model.samples, req.Latency)
+	} else {
+		model.samples[model.next] = req.Latency
+		model.next = (model.next + 1) % latencySamples
+	}
+	if failed {
+		model.stats.Errors++
+	}
+
+	client, ok := c.clients[req.Client]
+	if !ok {
+		client = &ClientStats{Client: req.Client}
+		c.clients[req.Client] = client
+	}
+	client.Requests++
+	client.PromptTokens += req.PromptTokens
+	client.CompletionTokens += req.CompletionTokens
+	client.Cost += req.Cost
+	if failed {
+		client.Errors++
+		c.addFailure(Failure{Time: req.Time, Kind: "request", Source: req.Model, Client: req.Client, Status: req.Status, Error: req.Error})
+	}
+}
+
+// RecordUpstream 记录一次上游调用
+func (c *Collector) RecordUpstream(call Upstream) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := call.Endpoint + "|" + call.KeyHint
+	entry, ok := c.upstreams[key]
+	if !ok {
+		entry = &upstreamEntry{stats: UpstreamStats{Endpoint: call.Endpoint, KeyHint: call.KeyHint}}
+		c.upstreams[key] = entry
+	}
+	stats := &entry.stats
+	stats.Requests++
+	stats.LastStatus = call.Status
+	entry.totalLatency += call.Latency
+
+	t := call.Time
+	if IsUpstreamFailure(call.Status) {
+		stats.Errors++
+		stats.ConsecutiveFailures++
+		stats.LastError = call.Error
+		stats.LastFailure = &t
+		c.addFailure(Failure{Time: call.Time, Kind: "upstream", Source: call.Endpoint, Status: call.Status, Error: call.Error})
+	} else {
+		stats.ConsecutiveFailures = 0
+		stats.LastSuccess = &t
+	}
+}
+
+// addRate 累加所在秒的请求数，调用方需持有锁
+func (c *Collector) addRate(t time.Time, failed bool) {
+	second := t.Unix()
+	point := &c.rate[second%rateWindow]
+	if point.Time != second {
+		*point = RatePoint{Time: second}
+	}
+	point.Requests++
+	if failed {
+		point.Errors++
+	}
+}
+
+// addFailure 追加失败记录，只保留最近 maxRecentFailures 条，调用方需持有锁
+func (c *Collector) addFailure(failure Failure) {
+	c.failures = append(c.failures, failure)
+	if len(c.failures) > maxRecentFailures {
+		c.failures = c.failures[len(c.failures)-maxRecentFailures:]
+	}
+}
+
+// Snapshot 返回当前统计快照，now 用于计算最近 60 秒的请求速率
+func (c *Collector) Snapshot(now time.Time) Snapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	snapshot := Snapshot{
+		StartedAt:      c.startedAt,
+		Requests:       c.requests,
+		Errors:         c.errors,
+		Rate:           make([]RatePoint, 0, rateWindow),
+		Models:         make([]ModelStats, 0, len(c.models)),
+		Clients:        make([]ClientStats, 0, len(c.clients)),
+		Upstreams:      make([]UpstreamStats, 0, len(c.upstreams)),
+		RecentFailures: make([]Failure, 0, len(c.failures)),
+	}
+
+	// 按时间顺序输出最近 60 秒，没有请求的秒补 0
+	total := 0
+	for second := now.Unix() - rateWindow + 1; second <= now.Unix(); second++ {
+		point := RatePoint{Time: second}
+		if stored := c.rate[second%rateWindow]; stored.Time == second {
+			point = stored
+		}
+		total += point.Requests
+		snapshot.Rate = append(snapshot.Rate, point)
+	}
+	snapshot.RequestsPerSecond = float64(total) / rateWindow
+
+	for _, model := range c.models {
+		stats := model.stats
+		if stats.Requests > 0 {
+			stats.ErrorRate = float64(stats.Errors) / float64(stats.Requests)
+			stats.AvgLatencyMS = milliseconds(model.totalLatency) / float64(stats.Requests)
+		}
+		stats.P50LatencyMS, stats.P95LatencyMS = percentiles(model.samples)
+		snapshot.Models = append(snapshot.Models, stats)
+	}
+	sort.Slice(snapshot.Models, func(i, j int) bool { return snapshot.Models[i].Model < snapshot.Models[j].Model })
+
+	for _, client := range c.clients {
+		snapshot.Clients = append(snapshot.Clients, *client)
+	}
+	sort.Slice(snapshot.Clients, func(i, j int) bool { return snapshot.Clients[i].Client < snapshot.Clients[j].Client })
+
+	for _, upstream := range c.upstreams {
+		stats := upstream.stats
+		if stats.Requests > 0 {
+			stats.AvgLatencyMS = milliseconds(upstream.totalLatency) / float64(stats.Requests)
+		}
+		stats.Healthy = stats.ConsecutiveFailures < unhealthyThreshold
+		snapshot.Upstreams = append(snapshot.Upstreams, stats)
+	}
+	sort.Slice(snapshot.Upstreams, func(i, j int) bool {
+		a, b := snapshot.Upstreams[i], snapshot.Upstreams[j]
+		if a.Endpoint != b.Endpoint {
+			return a.Endpoint < b.Endpoint
+		}
+		return a.KeyHint < b.KeyHint
+	})
+
+	// 最近的失败排在前面
+	for i := len(c.failures) - 1; i >= 0; i-- {
+		snapshot.RecentFailures = append(snapshot.RecentFailures, c.failures[i])
+	}
+	return snapshot
+}
+
+// percentiles 计算 P50 和 P95 延迟（毫秒）
+func percentiles(samples []time.Duration) (float64, float64) {
+	if len(samples) == 0 {
+		return 0, 0
+	}
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	at := func(p float64) float64 {
+		return milliseconds(sorted[int(p*float64(len(sorted)-1))])
+	}
+	return at(0.50), at(0.95)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCollectorRequests(t *testing.T) {
+	c := New()
+	now := time.Unix(1_700_000_000, 0)
+
+	for i := 1; i <= 10; i++ {
+		c.RecordRequest(Request{Time: now, Model: "claude", Client: "ci", Status: 200, Latency: time.Duration(i) * 100 * time.Millisecond, PromptTokens: 10, CompletionTokens: 5, Cost: 0.01})
+	}
+	c.RecordRequest(Request{Time: now.Add(-time.Second), Model: "gpt", Client: "web", Status: 502, Latency: time.Second, Error: "Request to upstream failed"})
+
+	s := c.Snapshot(now)
+	if s.Requests != 11 || s.Errors != 1 {
+		t.Errorf("requests = %d, errors = %d", s.Requests, s.Errors)
+	}
+	if last := s.Rate[len(s.Rate)-1]; len(s.Rate) != rateWindow || last.Requests != 10 || s.Rate[len(s.Rate)-2].Errors != 1 {
+		t.Errorf("rate = %v", s.Rate[len(s.Rate)-2:])
+	}
+	if s.RequestsPerSecond != 11.0/rateWindow {
+		t.Errorf("requests_per_second = %v", s.RequestsPerSecond)
+	}
+
+	if len(s.Models) != 2 || s.Models[0].Model != "claude" {
+		t.Fatalf("models = %+v", s.Models)
+	}
+	claude := s.Models[0]
+	if claude.AvgLatencyMS != 550 || claude.P50LatencyMS != 500 || claude.P95LatencyMS != 900 || claude.PromptTokens != 100 {
+		t.Errorf("claude stats = %+v", claude)
+	}
+	if s.Models[1].ErrorRate != 1 {
+		t.Errorf("gpt error rate = %v", s.Models[1].ErrorRate)
+	}
+
+	if len(s.Clients) != 2 || s.Clients[0].Client != "ci" || s.Clients[0].CompletionTokens != 50 || s.Clients[0].Cost < 0.0999 {
+		t.Errorf("clients = %+v", s.Clients)
+	}
+	if len(s.RecentFailures) != 1 || s.RecentFailures[0].Source != "gpt" || s.RecentFailures[0].Client != "web" {
+		t.Errorf("recent failures = %+v", s.RecentFailures)
+	}
+
+	// 超过 60 秒的请求不再计入速率
+	if s := c.Snapshot(now.Add(2 * time.Minute)); s.RequestsPerSecond != 0 {
+		t.Errorf("stale requests_per_second = %v", s.RequestsPerSecond)
+	}
+}
+
+func TestCollectorUpstreamHealth(t *testing.T) {
+	c := New()
+	now := time.Now()
+	record := func(status int) {
+		c.RecordUpstream(Upstream{Time: now, Endpoint: "anthropic", KeyHint: "fk-1***", Status: status, Latency: 10 * time.Millisecond, Error: "boom"})
+	}
+
+	record(200)
+	record(400) // 客户端参数错误不影响健康状态
+	for i := 0; i < unhealthyThreshold; i++ {
+		record(503)
+	}
+	upstream := c.Snapshot(now).Upstreams[0]
+	if upstream.Healthy || upstream.Errors != unhealthyThreshold || upstream.LastStatus != 503 || upstream.LastFailure == nil {
+		t.Errorf("unhealthy upstream = %+v", upstream)
+	}
+
+	record(200)
+	if upstream := c.Snapshot(now).Upstreams[0]; !upstream.Healthy || upstream.ConsecutiveFailures != 0 {
+		t.Errorf("recovered upstream = %+v", upstream)
+	}
+}
+
+func TestCollectorKeepsRecentFailures(t *testing.T) {
+	c := New()
+	now := time.Now()
+	for i := 0; i < maxRecentFailures+10; i++ {
+		c.RecordRequest(Request{Time: now, Model: "m", Status: 500, Error: "boom"})
+	}
+	if n := len(c.Snapshot(now).RecentFailures); n != maxRecentFailures {
+		t.Errorf("recent failures = %d, want %d", n, maxRecentFailures)
+	}
+}
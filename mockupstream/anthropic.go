@@ -0,0 +1,162 @@
+package mockupstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// anthropicContent 构造 Anthropic 响应的 content 块
+func anthropicContent(reply Reply) []map[string]interface{} {
+	var content []map[string]interface{}
+	if reply.Thinking != "" {
+		content = append(content, map[string]interface{}{"type": "thinking", "thinking": reply.Thinking, "signature": "mock-signature"})
+	}
+	if reply.Text != "" {
+		content = append(content, map[string]interface{}{"type": "text", "text": reply.Text})
+	}
+	if reply.ToolUse != nil {
+		content = append(content, map[string]interface{}{
+			"type":  "tool_use",
+			"id":    reply.ToolUse.ID,
+			"name":  reply.ToolUse.Name,
+			"input": reply.ToolUse.Input,
+		})
+	}
+	return content
+}
+
+// anthropicStopReason 返回 stop_reason
+func anthropicStopReason(reply Reply) string {
+	switch {
+	case reply.Truncated:
+		return "max_tokens"
+	case reply.ToolUse != nil:
+		return "tool_use"
+	default:
+		return "end_turn"
+	}
+}
+
+// anthropicUsage 返回 usage
+func anthropicUsage(reply Reply) map[string]interface{} {
+	return map[string]interface{}{
+		"input_tokens":            reply.InputTokens,
+		"output_tokens":           reply.OutputTokens,
+		"cache_read_input_tokens": reply.CacheReadTokens,
+	}
+}
+
+// writeAnthropic 写出 Anthropic Messages 响应
+func writeAnthropic(w http.ResponseWriter, reply Reply, stream bool) {
+	if !stream {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"id":          "msg_mock",
+			"type":        "message",
+			"role":        "assistant",
+			"model":       "mock",
+			"content":     anthropicContent(reply),
+			"stop_reason": anthropicStopReason(reply),
+			"usage":       anthropicUsage(reply),
+		})
+		return
+	}
+
+	sse := newSSEWriter(w)
+	sse.event("message_start", map[string]interface{}{
+		"type": "message_start",
+		"message": map[string]interface{}{
+			"id": "msg_mock", "type": "message", "role": "assistant", "model": "mock",
+			"content": []interface{}{}, "usage": map[string]interface{}{"input_tokens": reply.InputTokens, "output_tokens": 0, "cache_read_input_tokens": reply.CacheReadTokens},
+		},
+	})
+
+	index := 0
+	block := func(start map[string]interface{}, deltas []map[string]interface{}) {
+		sse.event("content_block_start", map[string]interface{}{"type": "content_block_start", "index": index, "content_block": start})
+		for _, delta := range deltas {
+			sse.event("content_block_delta", map[string]interface{}{"type": "content_block_delta", "index": index, "delta": delta})
+		}
+		sse.event("content_block_stop", map[string]interface{}{"type": "content_block_stop", "index": index})
+		index++
+	}
+
+	if reply.Thinking != "" {
+		var deltas []map[string]interface{}
+		for _, part := range splitText(reply.Thinking) {
+			deltas = append(deltas, map[string]interface{}{"type": "thinking_delta", "thinking": part})
+		}
+		deltas = append(deltas, map[string]interface{}{"type": "signature_delta", "signature": "mock-signature"})
+		block(map[string]interface{}{"type": "thinking", "thinking": ""}, deltas)
+	}
+	if reply.Text != "" {
+		var deltas []map[string]interface{}
+		for _, part := range splitText(reply.Text) {
+			deltas = append(deltas, map[string]interface{}{"type": "text_delta", "text": part})
+		}
+		block(map[string]interface{}{"type": "text", "text": ""}, deltas)
+	}
+	if reply.StreamError != "" {
+		sse.event("error", map[string]interface{}{"type": "error", "error": map[string]interface{}{"type": "overloaded_error", "message": reply.StreamError}})
+		return
+	}
+	if reply.ToolUse != nil {
+		input, _ := json.Marshal(reply.ToolUse.Input)
+		var deltas []map[string]interface{}
+		for _, part := range splitJSON(string(input)) {
+			deltas = append(deltas, map[string]interface{}{"type": "input_json_delta", "partial_json": part})
+		}
+		block(map[string]interface{}{"type": "tool_use", "id": reply.ToolUse.ID, "name": reply.ToolUse.Name, "input": map[string]interface{}{}}, deltas)
+	}
+
+	sse.event("message_delta", map[string]interface{}{
+		"type":  "message_delta",
+		"delta": map[string]interface{}{"stop_reason": anthropicStopReason(reply)},
+		"usage": map[string]interface{}{"output_tokens": reply.OutputTokens},
+	})
+	sse.event("message_stop", map[string]interface{}{"type": "message_stop"})
+}
+
+// writeAnthropicCountTokens 写出 count_tokens 响应，token 数取自 Reply.InputTokens
+func writeAnthropicCountTokens(w http.ResponseWriter, reply Reply, stream bool) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"input_tokens": reply.InputTokens})
+}
+
+// sseWriter 写出带 event 行的 SSE 事件
+type sseWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func newSSEWriter(w http.ResponseWriter) *sseWriter {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	return &sseWriter{w: w, flusher: flusher}
+}
+
+func (s *sseWriter) event(name string, data interface{}) {
+	jsonData, _ := json.Marshal(data)
+	_, _ = fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", name, jsonData)
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+}
+
+// splitText 按单词拆分文本，模拟增量输出
+func splitText(text string) []string {
+	return strings.SplitAfter(text, " ")
+}
+
+// splitJSON 将 JSON 拆成固定长度的片段，模拟 partial_json 增量
+func splitJSON(s string) []string {
+	const size = 8
+	var parts []string
+	for len(s) > size {
+		parts = append(parts, s[:size])
+		s = s[size:]
+	}
+	return append(parts, s)
+}
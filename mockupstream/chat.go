@@ -0,0 +1,102 @@
+package mockupstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// chatFinishReason 返回 Chat Completions 的 finish_reason
+func chatFinishReason(reply Reply) string {
+	switch {
+	case reply.Truncated:
+		return "length"
+	case reply.ToolUse != nil:
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+// chatToolCalls 构造 Chat Completions 的 tool_calls
+func chatToolCalls(reply Reply) []map[string]interface{} {
+	arguments, _ := json.Marshal(reply.ToolUse.Input)
+	return []map[string]interface{}{{
+		"index":    0,
+		"id":       reply.ToolUse.ID,
+		"type":     "function",
+		"function": map[string]interface{}{"name": reply.ToolUse.Name, "arguments": string(arguments)},
+	}}
+}
+
+// chatUsage 构造 Chat Completions 的 usage
+func chatUsage(reply Reply) map[string]interface{} {
+	return map[string]interface{}{
+		"prompt_tokens":     reply.InputTokens,
+		"completion_tokens": reply.OutputTokens,
+		"total_tokens":      reply.InputTokens + reply.OutputTokens,
+	}
+}
+
+// writeChatCompletions 写出 OpenAI Chat Completions 响应（vLLM / llama.cpp 风格，推理内容在 reasoning_content 中）
+func writeChatCompletions(w http.ResponseWriter, reply Reply, stream bool) {
+	if !stream {
+		message := map[string]interface{}{"role": "assistant", "content": reply.Text}
+		if reply.Thinking != "" {
+			message["reasoning_content"] = reply.Thinking
+		}
+		if reply.ToolUse != nil {
+			message["tool_calls"] = chatToolCalls(reply)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"id":      "chatcmpl-mock",
+			"object":  "chat.completion",
+			"created": 1700000000,
+			"model":   "mock",
+			"choices": []map[string]interface{}{{"index": 0, "message": message, "finish_reason": chatFinishReason(reply)}},
+			"usage":   chatUsage(reply),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	chunk := func(delta map[string]interface{}, finishReason interface{}) {
+		jsonData, _ := json.Marshal(map[string]interface{}{
+			"id":      "chatcmpl-mock",
+			"object":  "chat.completion.chunk",
+			"created": 1700000000,
+			"model":   "mock",
+			"choices": []map[string]interface{}{{"index": 0, "delta": delta, "finish_reason": finishReason}},
+		})
+		_, _ = fmt.Fprintf(w, "data: %s\n\n", jsonData)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	chunk(map[string]interface{}{"role": "assistant", "content": ""}, nil)
+	if reply.Thinking != "" {
+		chunk(map[string]interface{}{"reasoning_content": reply.Thinking}, nil)
+	}
+	for _, part := range splitText(reply.Text) {
+		if part != "" {
+			chunk(map[string]interface{}{"content": part}, nil)
+		}
+	}
+	if reply.ToolUse != nil {
+		chunk(map[string]interface{}{"tool_calls": chatToolCalls(reply)}, nil)
+	}
+	if reply.StreamError != "" {
+		_, _ = fmt.Fprintf(w, "data: %s\n\n", mustJSON(errorBody(ChatCompletionsPath, "api_error", reply.StreamError)))
+		return
+	}
+	chunk(map[string]interface{}{}, chatFinishReason(reply))
+	_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func mustJSON(v interface{}) []byte {
+	data, _ := json.Marshal(v)
+	return data
+}
@@ -0,0 +1,96 @@
+package mockupstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// geminiCandidate 构造 Gemini 响应的候选结果，finish 为 true 时带 finishReason
+func geminiCandidate(parts []map[string]interface{}, reply Reply, finish bool) map[string]interface{} {
+	candidate := map[string]interface{}{
+		"index":   0,
+		"content": map[string]interface{}{"role": "model", "parts": parts},
+	}
+	if finish {
+		candidate["finishReason"] = "STOP"
+		if reply.Truncated {
+			candidate["finishReason"] = "MAX_TOKENS"
+		}
+	}
+	return candidate
+}
+
+// geminiUsage 返回 usageMetadata
+func geminiUsage(reply Reply) map[string]interface{} {
+	return map[string]interface{}{
+		"promptTokenCount":        reply.InputTokens,
+		"candidatesTokenCount":    reply.OutputTokens,
+		"totalTokenCount":         reply.InputTokens + reply.OutputTokens,
+		"cachedContentTokenCount": reply.CacheReadTokens,
+	}
+}
+
+// writeGemini 写出 Gemini generateContent 响应，思考内容以 thought 标记的 part 返回
+func writeGemini(w http.ResponseWriter, reply Reply, stream bool) {
+	var thought, functionCall map[string]interface{}
+	if reply.Thinking != "" {
+		thought = map[string]interface{}{"text": reply.Thinking, "thought": true}
+	}
+	if reply.ToolUse != nil {
+		functionCall = map[string]interface{}{"functionCall": map[string]interface{}{"name": reply.ToolUse.Name, "args": reply.ToolUse.Input}}
+	}
+
+	if !stream {
+		var parts []map[string]interface{}
+		if thought != nil {
+			parts = append(parts, thought)
+		}
+		if reply.Text != "" {
+			parts = append(parts, map[string]interface{}{"text": reply.Text})
+		}
+		if functionCall != nil {
+			parts = append(parts, functionCall)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"candidates":    []map[string]interface{}{geminiCandidate(parts, reply, true)},
+			"usageMetadata": geminiUsage(reply),
+			"modelVersion":  "mock",
+			"responseId":    "gemini-mock",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	chunk := func(v map[string]interface{}) {
+		jsonData, _ := json.Marshal(v)
+		_, _ = fmt.Fprintf(w, "data: %s\r\n\r\n", jsonData)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	if thought != nil {
+		chunk(map[string]interface{}{"candidates": []map[string]interface{}{geminiCandidate([]map[string]interface{}{thought}, reply, false)}})
+	}
+	for _, part := range splitText(reply.Text) {
+		if part != "" {
+			chunk(map[string]interface{}{"candidates": []map[string]interface{}{geminiCandidate([]map[string]interface{}{{"text": part}}, reply, false)}})
+		}
+	}
+	if reply.StreamError != "" {
+		chunk(errorBody("", "api_error", reply.StreamError))
+		return
+	}
+	var last []map[string]interface{}
+	if functionCall != nil {
+		last = append(last, functionCall)
+	}
+	chunk(map[string]interface{}{
+		"candidates":    []map[string]interface{}{geminiCandidate(last, reply, true)},
+		"usageMetadata": geminiUsage(reply),
+	})
+}
@@ -0,0 +1,197 @@
+// Package mockupstream 提供模拟 Factory 上游的 HTTP 服务，用于在不访问 Factory 的情况下测试代理
+//
+// 服务同时实现 Anthropic Messages、OpenAI Responses、Gemini generateContent 和 OpenAI Chat Completions 端点，支持流式与非流式、
+// 错误响应、Extended Thinking / 推理摘要以及工具调用。
+package mockupstream
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// 与 Factory 一致的上游路径
+const (
+	AnthropicPath            = "/api/llm/a/v1/messages"
+	AnthropicCountTokensPath = AnthropicPath + "/count_tokens"
+	ResponsesPath            = "/api/llm/o/v1/responses"
+	GeminiPath               = "/api/llm/g/v1beta/models/" // 后接 {model}:generateContent 或 {model}:streamGenerateContent
+	ChatCompletionsPath      = "/v1/chat/completions"      // 自建 OpenAI 兼容服务（vLLM、llama.cpp）
+)
+
+// ToolUse 模拟的工具调用
+type ToolUse struct {
+	ID    string
+	Name  string
+	Input map[string]interface{}
+}
+
+// Reply 一次上游响应的内容
+type Reply struct {
+	Text     string
+	Thinking string   // Anthropic thinking 块 / Responses 推理摘要
+	ToolUse  *ToolUse // 在文本之后返回的工具调用
+	// Truncated 为 true 时模拟达到 max_tokens（Anthropic stop_reason=max_tokens，Responses status=incomplete）
+	Truncated bool
+
+	// Status 非 0 且不为 200 时返回上游错误
+	Status       int
+	ErrorType    string
+	ErrorMessage string
+	// StreamError 非空时流式响应在输出文本后以 error 事件中断
+	StreamError string
+
+	InputTokens     int
+	OutputTokens    int
+	CacheReadTokens int
+}
+
+// DefaultReply 回复队列为空时使用的响应
+var DefaultReply = Reply{Text: "Hello from mock upstream", InputTokens: 10, OutputTokens: 5}
+
+// Request 上游收到的请求
+type Request struct {
+	Path   string
+	Header http.Header
+	Body   map[string]interface{}
+}
+
+// Server 模拟上游服务
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	replies  []Reply
+	requests []Request
+}
+
+// New 启动模拟上游服务，使用完毕后需要调用 Close
+func New() *Server {
+	s := &Server{}
+	mux := http.NewServeMux()
+	mux.HandleFunc(AnthropicPath, s.handle(writeAnthropic))
+	mux.HandleFunc(AnthropicCountTokensPath, s.handle(writeAnthropicCountTokens))
+	mux.HandleFunc(ResponsesPath, s.handle(writeResponses))
+	mux.HandleFunc(GeminiPath, s.handle(writeGemini))
+	mux.HandleFunc(ChatCompletionsPath, s.handle(writeChatCompletions))
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// AnthropicURL Anthropic Messages 端点地址
+func (s *Server) AnthropicURL() string {
+	return s.URL + AnthropicPath
+}
+
+// ResponsesURL OpenAI Responses 端点地址
+func (s *Server) ResponsesURL() string {
+	return s.URL + ResponsesPath
+}
+
+// GeminiBaseURL Gemini 端点的 API 版本前缀地址
+func (s *Server) GeminiBaseURL() string {
+	return s.URL + strings.TrimSuffix(GeminiPath, "/models/")
+}
+
+// OpenAIChatBaseURL OpenAI Chat Completions 兼容服务的 /v1 前缀地址
+func (s *Server) OpenAIChatBaseURL() string {
+	return s.URL + "/v1"
+}
+
+// Enqueue 追加后续请求的响应，按顺序各使用一次
+func (s *Server) Enqueue(replies ...Reply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replies = append(s.replies, replies...)
+}
+
+// Requests 返回已收到的所有请求
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// LastRequest 返回最近一次收到的请求
+func (s *Server) LastRequest() (Request, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.requests) == 0 {
+		return Request{}, false
+	}
+	return s.requests[len(s.requests)-1], true
+}
+
+// next 记录请求并取出下一个响应
+func (s *Server) next(req Request) Reply {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, req)
+	if len(s.replies) == 0 {
+		return DefaultReply
+	}
+	reply := s.replies[0]
+	s.replies = s.replies[1:]
+	return reply
+}
+
+// replyWriter 按上游格式写出响应
+type replyWriter func(w http.ResponseWriter, reply Reply, stream bool)
+
+func (s *Server) handle(write replyWriter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var body map[string]interface{}
+		if err := json.Unmarshal(data, &body); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorBody(r.URL.Path, "invalid_request_error", "invalid JSON body"))
+			return
+		}
+
+		reply := s.next(Request{Path: r.URL.Path, Header: r.Header.Clone(), Body: body})
+		if r.Header.Get("Authorization") == "" {
+			writeJSON(w, http.StatusUnauthorized, errorBody(r.URL.Path, "authentication_error", "missing authorization"))
+			return
+		}
+		if reply.Status != 0 && reply.Status != http.StatusOK {
+			writeJSON(w, reply.Status, errorBody(r.URL.Path, reply.ErrorType, reply.ErrorMessage))
+			return
+		}
+
+		// Gemini 通过请求地址区分流式请求
+		stream, _ := body["stream"].(bool)
+		if strings.HasSuffix(r.URL.Path, ":streamGenerateContent") {
+			stream = true
+		}
+		write(w, reply, stream)
+	}
+}
+
+// errorBody 按端点格式构造错误响应
+func errorBody(path, errType, message string) map[string]interface{} {
+	if errType == "" {
+		errType = "api_error"
+	}
+	detail := map[string]interface{}{"type": errType, "message": message}
+	if strings.HasPrefix(path, AnthropicPath) {
+		return map[string]interface{}{"type": "error", "error": detail}
+	}
+	return map[string]interface{}{"error": detail}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,109 @@
+package mockupstream
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// responsesStatus 返回 Responses API 的 status
+func responsesStatus(reply Reply) string {
+	if reply.Truncated {
+		return "incomplete"
+	}
+	return "completed"
+}
+
+// responsesOutput 构造 Responses API 的 output 数组
+func responsesOutput(reply Reply) []map[string]interface{} {
+	var output []map[string]interface{}
+	if reply.Thinking != "" {
+		output = append(output, map[string]interface{}{
+			"type":    "reasoning",
+			"id":      "rs_mock",
+			"summary": []map[string]interface{}{{"type": "summary_text", "text": reply.Thinking}},
+		})
+	}
+	if reply.Text != "" {
+		output = append(output, map[string]interface{}{
+			"type":    "message",
+			"id":      "msg_mock",
+			"role":    "assistant",
+			"status":  "completed",
+			"content": []map[string]interface{}{{"type": "output_text", "text": reply.Text, "annotations": []interface{}{}}},
+		})
+	}
+	if reply.ToolUse != nil {
+		arguments, _ := json.Marshal(reply.ToolUse.Input)
+		output = append(output, map[string]interface{}{
+			"type":      "function_call",
+			"id":        "fc_mock",
+			"call_id":   reply.ToolUse.ID,
+			"name":      reply.ToolUse.Name,
+			"arguments": string(arguments),
+		})
+	}
+	return output
+}
+
+// responsesBody 构造完整的 Responses API 响应
+func responsesBody(reply Reply) map[string]interface{} {
+	body := map[string]interface{}{
+		"id":     "resp_mock",
+		"object": "response",
+		"model":  "mock",
+		"status": responsesStatus(reply),
+		"output": responsesOutput(reply),
+		"usage": map[string]interface{}{
+			"input_tokens":         reply.InputTokens,
+			"output_tokens":        reply.OutputTokens,
+			"total_tokens":         reply.InputTokens + reply.OutputTokens,
+			"input_tokens_details": map[string]interface{}{"cached_tokens": reply.CacheReadTokens},
+		},
+	}
+	if reply.Truncated {
+		body["incomplete_details"] = map[string]interface{}{"reason": "max_output_tokens"}
+	}
+	return body
+}
+
+// writeResponses 写出 OpenAI Responses API 响应
+func writeResponses(w http.ResponseWriter, reply Reply, stream bool) {
+	if !stream {
+		writeJSON(w, http.StatusOK, responsesBody(reply))
+		return
+	}
+
+	sse := newSSEWriter(w)
+	inProgress := map[string]interface{}{"id": "resp_mock", "object": "response", "status": "in_progress", "output": []interface{}{}}
+	sse.event("response.created", map[string]interface{}{"type": "response.created", "response": inProgress})
+	sse.event("response.in_progress", map[string]interface{}{"type": "response.in_progress", "response": inProgress})
+
+	if reply.Thinking != "" {
+		for _, part := range splitText(reply.Thinking) {
+			sse.event("response.reasoning_summary_text.delta", map[string]interface{}{"type": "response.reasoning_summary_text.delta", "delta": part})
+		}
+		sse.event("response.reasoning_summary_text.done", map[string]interface{}{"type": "response.reasoning_summary_text.done", "text": reply.Thinking})
+	}
+	if reply.Text != "" {
+		sse.event("response.output_item.added", map[string]interface{}{"type": "response.output_item.added", "item": map[string]interface{}{"type": "message", "role": "assistant"}})
+		for _, part := range splitText(reply.Text) {
+			sse.event("response.output_text.delta", map[string]interface{}{"type": "response.output_text.delta", "delta": part})
+		}
+		sse.event("response.output_text.done", map[string]interface{}{"type": "response.output_text.done", "text": reply.Text})
+		sse.event("response.output_item.done", map[string]interface{}{"type": "response.output_item.done"})
+	}
+	if reply.StreamError != "" {
+		sse.event("error", map[string]interface{}{"type": "error", "message": reply.StreamError})
+		return
+	}
+	if reply.ToolUse != nil {
+		arguments, _ := json.Marshal(reply.ToolUse.Input)
+		for _, part := range splitJSON(string(arguments)) {
+			sse.event("response.function_call_arguments.delta", map[string]interface{}{"type": "response.function_call_arguments.delta", "delta": part})
+		}
+		sse.event("response.function_call_arguments.done", map[string]interface{}{"type": "response.function_call_arguments.done", "arguments": string(arguments)})
+	}
+
+	// Factory 的 Responses 端点以 response.done 结束流
+	sse.event("response.done", map[string]interface{}{"type": "response.done", "response": responsesBody(reply)})
+}
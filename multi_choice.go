@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"factory-go-api/transformers"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxChoices n 参数允许的最大值，避免单个请求放大为过多的上游调用
+const maxChoices = 8
+
+// singleChoiceHandler 处理单个 choice 请求的函数
+type singleChoiceHandler func(w http.ResponseWriter, r *http.Request, openaiReq *transformers.OpenAIRequest)
+
+// bufferedResponseWriter 缓存完整响应的 ResponseWriter，用于非流式 n>1 合并
+type bufferedResponseWriter struct {
+	header     http.Header
+	statusCode int
+	body       bytes.Buffer
+}
+
+func newBufferedResponseWriter() *bufferedResponseWriter {
+	return &bufferedResponseWriter{header: make(http.Header), statusCode: http.StatusOK}
+}
+
+func (b *bufferedResponseWriter) Header() http.Header         { return b.header }
+func (b *bufferedResponseWriter) Write(p []byte) (int, error) { return b.body.Write(p) }
+func (b *bufferedResponseWriter) WriteHeader(code int)        { b.statusCode = code }
+
+// streamChoiceWriter 将单个 choice 的 SSE 流改写 index 和 id 后写入共享的客户端连接
+// 该 choice 的请求失败（状态码 >= 400）时缓存错误响应，由 finish 以 SSE error 块写出
+type streamChoiceWriter struct {
+	header     http.Header
+	index      int
+	id         string
+	mu         *sync.Mutex
+	w          http.ResponseWriter
+	flusher    http.Flusher
+	statusCode int
+	pending    bytes.Buffer           // 不完整的 SSE 行，或完整的错误响应体
+	usage      map[string]interface{} // stream_options.include_usage 的 usage 块，所有流结束后合并写出
+}
+
+func (s *streamChoiceWriter) Header() http.Header  { return s.header }
+func (s *streamChoiceWriter) WriteHeader(code int) { s.statusCode = code }
+func (s *streamChoiceWriter) Flush()               {}
+
+// Write 改写 SSE 块中的 choice index，[DONE] 由调用方在所有 choice 完成后统一发送
+// 跨两次 Write 的行保留在 pending 中，等收到换行后再处理
+func (s *streamChoiceWriter) Write(p []byte) (int, error) {
+	s.pending.Write(p)
+	if s.statusCode >= http.StatusBadRequest {
+		return len(p), nil
+	}
+
+	var out strings.Builder
+	for {
+		line, err := s.pending.ReadString('\n')
+		if err != nil {
+			rest := line
+			s.pending.Reset()
+			s.pending.WriteString(rest)
+			break
+		}
+		s.rewriteLine(strings.TrimRight(line, "\r\n"), &out)
+	}
+	if err := s.send(out.String()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// rewriteLine 改写一行 SSE data 的 id 和 choice index
+func (s *streamChoiceWriter) rewriteLine(line string, out *strings.Builder) {
+	if !strings.HasPrefix(line, "data: ") {
+		return
+	}
+	dataStr := strings.TrimPrefix(line, "data: ")
+	if strings.TrimSpace(dataStr) == "[DONE]" {
+		return
+	}
+
+	var chunk map[string]interface{}
+	if err := json.Unmarshal([]byte(dataStr), &chunk); err != nil {
+		return
+	}
+	chunk["id"] = s.id
+	if usage, ok := chunk["usage"].(map[string]interface{}); ok {
+		if choices, _ := chunk["choices"].([]interface{}); len(choices) == 0 {
+			s.usage = usage
+			return
+		}
+	}
+	if choices, ok := chunk["choices"].([]interface{}); ok {
+		for _, choice := range choices {
+			if choiceMap, ok := choice.(map[string]interface{}); ok {
+				choiceMap["index"] = s.index
+			}
+		}
+	}
+	if jsonData, err := json.Marshal(chunk); err == nil {
+		out.WriteString(fmt.Sprintf("data: %s\n\n", string(jsonData)))
+	}
+}
+
+// send 写入共享的客户端连接
+func (s *streamChoiceWriter) send(data string) error {
+	if data == "" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := fmt.Fprint(s.w, data)
+	s.flusher.Flush()
+	return err
+}
+
+// finish 处理最后一行没有换行的数据；请求失败时写出带 choice_index 的 SSE error 块
+// 其他 choice 可能已经开始输出，无法再改变响应状态码
+func (s *streamChoiceWriter) finish() {
+	if s.statusCode < http.StatusBadRequest {
+		var out strings.Builder
+		s.rewriteLine(strings.TrimSpace(s.pending.String()), &out)
+		if err := s.send(out.String()); err != nil {
+			log.Printf("错误: 写入流式响应失败: %v", err)
+		}
+		return
+	}
+
+	var errResp struct {
+		Error map[string]interface{} `json:"error"`
+	}
+	if err := json.Unmarshal(s.pending.Bytes(), &errResp); err != nil || errResp.Error == nil {
+		errResp.Error = map[string]interface{}{"message": strings.TrimSpace(s.pending.String()), "type": "upstream_error"}
+	}
+	errResp.Error["choice_index"] = s.index
+	errResp.Error["status"] = s.statusCode
+	log.Printf("❌ choice %d 请求失败: %d", s.index, s.statusCode)
+	if jsonData, err := json.Marshal(errResp); err == nil {
+		if err := s.send(fmt.Sprintf("data: %s\n\n", jsonData)); err != nil {
+			log.Printf("错误: 写入流式响应失败: %v", err)
+		}
+	}
+}
+
+// handleMultipleChoices 通过并发发起 n 次上游请求模拟 n>1，并将结果合并为多个 choices
+func handleMultipleChoices(w http.ResponseWriter, r *http.Request, openaiReq *transformers.OpenAIRequest, handle singleChoiceHandler) {
+	n := openaiReq.N
+	log.Printf("🔀 n=%d，并发发起 %d 次上游请求", n, n)
+
+	if openaiReq.Stream {
+		handleMultipleChoicesStream(w, r, openaiReq, n, handle)
+		return
+	}
+
+	writers := make([]*bufferedResponseWriter, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		writers[i] = newBufferedResponseWriter()
+		singleReq := *openaiReq
+		singleReq.N = 1
+		wg.Add(1)
+		go func(rw *bufferedResponseWriter, req *transformers.OpenAIRequest) {
+			defer wg.Done()
+			handle(rw, r, req)
+		}(writers[i], &singleReq)
+	}
+	wg.Wait()
+
+	merged := &transformers.OpenAIResponse{
+		ID:      fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano()),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   openaiReq.Model,
+		Choices: []transformers.OpenAIChoice{},
+	}
+	promptTokens, completionTokens := 0, 0
+
+	for i, rw := range writers {
+		if rw.statusCode != http.StatusOK {
+			// 任意一次调用失败时直接转发该错误
+			for key, values := range rw.header {
+				w.Header()[key] = values
+			}
+			w.WriteHeader(rw.statusCode)
+			if _, err := w.Write(rw.body.Bytes()); err != nil {
+				log.Printf("错误: 写入错误响应失败: %v", err)
+			}
+			return
+		}
+
+		var single transformers.OpenAIResponse
+		if err := json.Unmarshal(rw.body.Bytes(), &single); err != nil || len(single.Choices) == 0 {
+			log.Printf("错误: 解析第 %d 个 choice 失败: %v", i, err)
+			http.Error(w, `{"error": {"message": "Failed to merge choices", "type": "server_error"}}`, http.StatusInternalServerError)
+			return
+		}
+
+		choice := single.Choices[0]
+		choice.Index = i
+		merged.Choices = append(merged.Choices, choice)
+
+		// prompt 只计一次，completion 累加
+		if pt, ok := single.Usage["prompt_tokens"].(float64); ok && i == 0 {
+			promptTokens = int(pt)
+		}
+		if ct, ok := single.Usage["completion_tokens"].(float64); ok {
+			completionTokens += int(ct)
+		}
+	}
+
+	merged.Usage = map[string]interface{}{
+		"prompt_tokens":     promptTokens,
+		"completion_tokens": completionTokens,
+		"total_tokens":      promptTokens + completionTokens,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(merged); err != nil {
+		log.Printf("错误: 编码响应失败: %v", err)
+	}
+}
+
+// handleMultipleChoicesStream 并发转发 n 个流，按到达顺序交错写出各 choice 的增量
+func handleMultipleChoicesStream(w http.ResponseWriter, r *http.Request, openaiReq *transformers.OpenAIRequest, n int, handle singleChoiceHandler) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, `{"error": {"message": "Streaming not supported", "type": "server_error"}}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	id := fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano())
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	writers := make([]*streamChoiceWriter, n)
+	for i := 0; i < n; i++ {
+		singleReq := *openaiReq
+		singleReq.N = 1
+		writers[i] = &streamChoiceWriter{
+			header:     make(http.Header),
+			index:      i,
+			id:         id,
+			mu:         &mu,
+			w:          w,
+			flusher:    flusher,
+			statusCode: http.StatusOK,
+		}
+		wg.Add(1)
+		go func(sw *streamChoiceWriter, req *transformers.OpenAIRequest) {
+			defer wg.Done()
+			handle(sw, r, req)
+			sw.finish()
+		}(writers[i], &singleReq)
+	}
+	wg.Wait()
+
+	// 各 choice 的 usage 合并为一个块：prompt 只计一次，completion 累加；上游没有返回 usage 时不发送
+	if openaiReq.StreamIncludeUsage() && writers[0].usage != nil {
+		promptTokens, completionTokens := 0, 0
+		for i, sw := range writers {
+			if pt, ok := sw.usage["prompt_tokens"].(float64); ok && i == 0 {
+				promptTokens = int(pt)
+			}
+			if ct, ok := sw.usage["completion_tokens"].(float64); ok {
+				completionTokens += int(ct)
+			}
+		}
+		usageChunk, _ := json.Marshal(transformers.OpenAIResponse{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: time.Now().Unix(),
+			Model:   openaiReq.Model,
+			Choices: []transformers.OpenAIChoice{},
+			Usage: map[string]interface{}{
+				"prompt_tokens":     promptTokens,
+				"completion_tokens": completionTokens,
+				"total_tokens":      promptTokens + completionTokens,
+			},
+		})
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", usageChunk); err != nil {
+			log.Printf("错误: 写入流式响应失败: %v", err)
+			return
+		}
+	}
+
+	if _, err := fmt.Fprint(w, "data: [DONE]\n\n"); err != nil {
+		log.Printf("错误: 写入流式响应失败: %v", err)
+		return
+	}
+	flusher.Flush()
+}
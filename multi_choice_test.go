@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"factory-go-api/transformers"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHandleMultipleChoices(t *testing.T) {
+	stub := func(w http.ResponseWriter, r *http.Request, req *transformers.OpenAIRequest) {
+		if req.N != 1 {
+			t.Errorf("upstream request n = %d, want 1", req.N)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"x","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12}}`)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	handleMultipleChoices(rr, req, &transformers.OpenAIRequest{Model: "m", N: 3}, stub)
+
+	var resp transformers.OpenAIResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if len(resp.Choices) != 3 {
+		t.Fatalf("len(choices) = %d, want 3", len(resp.Choices))
+	}
+	for i, choice := range resp.Choices {
+		if choice.Index != i {
+			t.Errorf("choices[%d].index = %d", i, choice.Index)
+		}
+	}
+	if resp.Usage["prompt_tokens"].(float64) != 10 || resp.Usage["completion_tokens"].(float64) != 6 {
+		t.Errorf("usage = %v, want prompt 10 completion 6", resp.Usage)
+	}
+}
+
+func TestHandleMultipleChoicesStream(t *testing.T) {
+	stub := func(w http.ResponseWriter, r *http.Request, req *transformers.OpenAIRequest) {
+		fmt.Fprint(w, "data: {\"id\":\"a\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"x\"}}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	handleMultipleChoices(rr, req, &transformers.OpenAIRequest{Model: "m", N: 2, Stream: true}, stub)
+
+	body := rr.Body.String()
+	if strings.Count(body, "[DONE]") != 1 {
+		t.Errorf("expected exactly one [DONE], got body %q", body)
+	}
+	if !strings.Contains(body, `"index":0`) || !strings.Contains(body, `"index":1`) {
+		t.Errorf("expected chunks for both choice indexes, got %q", body)
+	}
+}
+
+// include_usage 时各 choice 的 usage 块合并为一个
+func TestHandleMultipleChoicesStreamUsage(t *testing.T) {
+	stub := func(w http.ResponseWriter, r *http.Request, req *transformers.OpenAIRequest) {
+		fmt.Fprint(w, "data: {\"id\":\"a\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"x\"},\"finish_reason\":\"stop\"}]}\n\n")
+		fmt.Fprint(w, "data: {\"id\":\"a\",\"choices\":[],\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":2,\"total_tokens\":12}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	handleMultipleChoices(rr, req, &transformers.OpenAIRequest{Model: "m", N: 3, Stream: true, StreamOptions: &transformers.StreamOptions{IncludeUsage: true}}, stub)
+
+	body := rr.Body.String()
+	if strings.Count(body, `"usage"`) != 1 {
+		t.Fatalf("expected exactly one usage chunk, got %q", body)
+	}
+	var chunk transformers.OpenAIResponse
+	for _, line := range strings.Split(body, "\n") {
+		if strings.Contains(line, `"usage"`) {
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &chunk); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if chunk.Usage["prompt_tokens"] != float64(10) || chunk.Usage["completion_tokens"] != float64(6) {
+		t.Errorf("usage = %v, want prompt 10 completion 6", chunk.Usage)
+	}
+}
+
+func TestHandleMultipleChoicesStreamErrorsAndSplitLines(t *testing.T) {
+	var calls int32
+	stub := func(w http.ResponseWriter, r *http.Request, req *transformers.OpenAIRequest) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			// 一行 SSE 分两次写入
+			fmt.Fprint(w, "data: {\"id\":\"a\",\"choices\":[{\"index\":0,")
+			fmt.Fprint(w, "\"delta\":{\"content\":\"x\"}}]}\n\ndata: [DONE]\n\n")
+			return
+		}
+		writeJSONError(w, http.StatusTooManyRequests, "rate limited", "rate_limit_error")
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	handleMultipleChoices(rr, req, &transformers.OpenAIRequest{Model: "m", N: 2, Stream: true}, stub)
+
+	body := rr.Body.String()
+	if !strings.Contains(body, `"content":"x"`) {
+		t.Errorf("split chunk was dropped: %q", body)
+	}
+	var errChunk struct {
+		Error map[string]interface{} `json:"error"`
+	}
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, "data: {\"error\"") {
+			_ = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &errChunk)
+		}
+	}
+	if errChunk.Error["message"] != "rate limited" || errChunk.Error["status"] != float64(http.StatusTooManyRequests) || errChunk.Error["choice_index"] == nil {
+		t.Errorf("error chunk = %v, body = %q", errChunk.Error, body)
+	}
+	if !strings.HasSuffix(body, "data: [DONE]\n\n") {
+		t.Errorf("stream should end with [DONE]: %q", body)
+	}
+}
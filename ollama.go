@@ -0,0 +1,634 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"factory-go-api/config"
+	"factory-go-api/transformers"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Ollama 兼容接口：请求转换为 OpenAI Chat Completions 后交给 chatCompletionsHandler 处理，
+// 认证、统计、参数校验、上下文管理和响应缓存与 /v1/chat/completions 完全一致，
+// 响应再从 OpenAI JSON / SSE 转换为 Ollama 的 JSON / NDJSON
+
+// ollamaMessage Ollama 消息，images 为不带 data URI 前缀的 base64 图片
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Thinking  string           `json:"thinking,omitempty"`
+	Images    []string         `json:"images,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+}
+
+// ollamaToolCall Ollama 工具调用，arguments 是 JSON 对象而不是字符串
+type ollamaToolCall struct {
+	Function ollamaToolFunction `json:"function"`
+}
+
+type ollamaToolFunction struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// ollamaOptions Ollama 的 options 中能映射到 OpenAI 参数的部分
+// num_ctx、repeat_penalty 等本地推理参数对远程模型没有意义，忽略
+type ollamaOptions struct {
+	Temperature      *float64 `json:"temperature,omitempty"`
+	TopP             *float64 `json:"top_p,omitempty"`
+	TopK             *int     `json:"top_k,omitempty"`       // 只转发给 openai-chat 类型
+	NumPredict       *int     `json:"num_predict,omitempty"` // 小于等于 0 表示不限制
+	Stop             []string `json:"stop,omitempty"`
+	Seed             *int64   `json:"seed,omitempty"`
+	PresencePenalty  *float64 `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float64 `json:"frequency_penalty,omitempty"`
+}
+
+// ollamaChatRequest /api/chat 请求
+type ollamaChatRequest struct {
+	Model     string          `json:"model"`
+	Messages  []ollamaMessage `json:"messages"`
+	Tools     []interface{}   `json:"tools,omitempty"`  // 与 OpenAI tools 格式相同
+	Format    json.RawMessage `json:"format,omitempty"` // "json" 或 JSON Schema 对象
+	Options   ollamaOptions   `json:"options,omitempty"`
+	Stream    *bool           `json:"stream,omitempty"` // 未设置时为 true
+	KeepAlive json.RawMessage `json:"keep_alive,omitempty"`
+}
+
+// ollamaGenerateRequest /api/generate 请求
+type ollamaGenerateRequest struct {
+	Model     string          `json:"model"`
+	Prompt    string          `json:"prompt"`
+	System    string          `json:"system,omitempty"`
+	Images    []string        `json:"images,omitempty"`
+	Format    json.RawMessage `json:"format,omitempty"`
+	Options   ollamaOptions   `json:"options,omitempty"`
+	Stream    *bool           `json:"stream,omitempty"`
+	KeepAlive json.RawMessage `json:"keep_alive,omitempty"`
+}
+
+// ollamaResponse /api/chat 和 /api/generate 的响应，流式时每行一个
+// /api/chat 使用 message，/api/generate 使用 response 和 thinking
+type ollamaResponse struct {
+	Model           string         `json:"model"`
+	CreatedAt       time.Time      `json:"created_at"`
+	Message         *ollamaMessage `json:"message,omitempty"`
+	Response        *string        `json:"response,omitempty"`
+	Thinking        string         `json:"thinking,omitempty"`
+	Done            bool           `json:"done"`
+	DoneReason      string         `json:"done_reason,omitempty"`
+	TotalDuration   int64          `json:"total_duration,omitempty"` // 纳秒
+	PromptEvalCount int            `json:"prompt_eval_count,omitempty"`
+	EvalCount       int            `json:"eval_count,omitempty"`
+}
+
+// ollamaModel /api/tags 中的模型
+type ollamaModel struct {
+	Name       string             `json:"name"`
+	Model      string             `json:"model"`
+	ModifiedAt time.Time          `json:"modified_at"`
+	Size       int64              `json:"size"`
+	Digest     string             `json:"digest"`
+	Details    ollamaModelDetails `json:"details"`
+}
+
+type ollamaModelDetails struct {
+	Format            string   `json:"format"`
+	Family            string   `json:"family"`
+	Families          []string `json:"families"`
+	ParameterSize     string   `json:"parameter_size"`
+	QuantizationLevel string   `json:"quantization_level"`
+}
+
+// ollamaTagsHandler 以 Ollama 格式列出已启用的模型
+func ollamaTagsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeOllamaError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	models := config.GetAllModels()
+	list := make([]ollamaModel, 0, len(models))
+	for _, model := range models {
+		list = append(list, ollamaModel{
+			Name:       model.ID,
+			Model:      model.ID,
+			ModifiedAt: startTime.UTC(),
+			Details:    ollamaModelDetails{Format: model.Type, Family: model.EndpointType(), Families: []string{model.EndpointType()}},
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"models": list}); err != nil {
+		log.Printf("错误: 编码响应失败: %v", err)
+	}
+}
+
+// ollamaChatHandler Ollama /api/chat
+func ollamaChatHandler(w http.ResponseWriter, r *http.Request) {
+	var req ollamaChatRequest
+	if !decodeOllamaRequest(w, r, &req) {
+		return
+	}
+
+	messages := make([]transformers.OpenAIMessage, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		converted, err := ollamaToOpenAIMessage(msg)
+		if err != nil {
+			writeOllamaError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		messages = append(messages, converted)
+	}
+	openaiReq := &transformers.OpenAIRequest{Model: req.Model, Messages: messages, Tools: req.Tools}
+	serveOllama(w, r, openaiReq, req.Format, req.Options, req.Stream, false)
+}
+
+// ollamaGenerateHandler Ollama /api/generate，system 和 prompt 转换为 system / user 消息
+func ollamaGenerateHandler(w http.ResponseWriter, r *http.Request) {
+	var req ollamaGenerateRequest
+	if !decodeOllamaRequest(w, r, &req) {
+		return
+	}
+
+	var messages []transformers.OpenAIMessage
+	if req.System != "" {
+		messages = append(messages, transformers.OpenAIMessage{Role: "system", Content: req.System})
+	}
+	if req.Prompt != "" || len(req.Images) > 0 {
+		user, err := ollamaToOpenAIMessage(ollamaMessage{Role: "user", Content: req.Prompt, Images: req.Images})
+		if err != nil {
+			writeOllamaError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		messages = append(messages, user)
+	}
+	openaiReq := &transformers.OpenAIRequest{Model: req.Model, Messages: messages}
+	serveOllama(w, r, openaiReq, req.Format, req.Options, req.Stream, true)
+}
+
+// decodeOllamaRequest 检查请求方法并解析请求体，失败时写入 Ollama 格式的错误
+func decodeOllamaRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		writeOllamaError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return false
+	}
+	defer func() {
+		if err := r.Body.Close(); err != nil {
+			log.Printf("警告: 关闭请求体失败: %v", err)
+		}
+	}()
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		log.Printf("错误: 解析请求体失败: %v", err)
+		writeOllamaError(w, http.StatusBadRequest, "Invalid JSON")
+		return false
+	}
+	return true
+}
+
+// serveOllama 补全 OpenAI 请求参数后交给 chatCompletionsHandler，并把响应转换为 Ollama 格式
+// 没有消息时按 Ollama 的语义视为加载模型，直接返回 done_reason 为 load 的响应
+func serveOllama(w http.ResponseWriter, r *http.Request, openaiReq *transformers.OpenAIRequest, format json.RawMessage, options ollamaOptions, stream *bool, generate bool) {
+	openaiReq.Model = ollamaModelID(openaiReq.Model)
+	openaiReq.Stream = stream == nil || *stream
+	if err := applyOllamaOptions(openaiReq, options, format); err != nil {
+		writeOllamaError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(openaiReq.Messages) == 0 {
+		rejected := newBufferedResponseWriter()
+		if _, _, ok := authorizeRequest(rejected, r); !ok {
+			writeOllamaError(w, rejected.statusCode, openAIErrorMessage(rejected.body.Bytes()))
+			return
+		}
+		if config.GetModelByID(openaiReq.Model) == nil {
+			writeOllamaError(w, http.StatusNotFound, fmt.Sprintf("model '%s' not found", openaiReq.Model))
+			return
+		}
+		turn := newOllamaTurn(openaiReq, generate)
+		turn.doneReason = "load"
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(turn.done()); err != nil {
+			log.Printf("错误: 编码响应失败: %v", err)
+		}
+		return
+	}
+
+	body, err := json.Marshal(openaiReq)
+	if err != nil {
+		writeOllamaError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// top_k 不在 OpenAIRequest 中，作为未识别字段由 openai-chat 类型转发
+	if options.TopK != nil {
+		var fields map[string]interface{}
+		_ = json.Unmarshal(body, &fields)
+		fields["top_k"] = *options.TopK
+		if body, err = json.Marshal(fields); err != nil {
+			writeOllamaError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	chatReq := r.Clone(r.Context())
+	chatReq.Body = io.NopCloser(bytes.NewReader(body))
+	chatReq.ContentLength = int64(len(body))
+	chatReq.Header.Set("Content-Type", "application/json")
+
+	turn := newOllamaTurn(openaiReq, generate)
+	if !openaiReq.Stream {
+		buffered := newBufferedResponseWriter()
+		withMetrics(chatCompletionsHandler)(buffered, chatReq)
+		copyResponseHeaders(w.Header(), buffered.Header())
+		if buffered.statusCode >= http.StatusBadRequest {
+			writeOllamaError(w, buffered.statusCode, openAIErrorMessage(buffered.body.Bytes()))
+			return
+		}
+		var chunk ollamaOpenAIChunk
+		if err := json.Unmarshal(buffered.body.Bytes(), &chunk); err != nil {
+			writeOllamaError(w, http.StatusBadGateway, "Invalid upstream response")
+			return
+		}
+		turn.add(&chunk)
+		resp := turn.done()
+		if generate {
+			text := turn.content.String()
+			resp.Response = &text
+			resp.Thinking = turn.thinking.String()
+		} else {
+			resp.Message = &ollamaMessage{Role: "assistant", Content: turn.content.String(), Thinking: turn.thinking.String(), ToolCalls: turn.toolCalls()}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Printf("错误: 编码响应失败: %v", err)
+		}
+		return
+	}
+
+	sw := &ollamaStreamWriter{w: w, header: make(http.Header), statusCode: http.StatusOK, turn: turn}
+	sw.flusher, _ = w.(http.Flusher)
+	withMetrics(chatCompletionsHandler)(sw, chatReq)
+	sw.finish()
+}
+
+// ollamaModelID Ollama 客户端会给没有标签的模型名补上 :latest，找不到模型时去掉后重试
+func ollamaModelID(name string) string {
+	if config.GetModelByID(name) == nil && strings.HasSuffix(name, ":latest") {
+		return strings.TrimSuffix(name, ":latest")
+	}
+	return name
+}
+
+// applyOllamaOptions 把 Ollama 的 options 和 format 映射到 OpenAI 参数
+func applyOllamaOptions(openaiReq *transformers.OpenAIRequest, options ollamaOptions, format json.RawMessage) error {
+	openaiReq.Temperature = options.Temperature
+	openaiReq.TopP = options.TopP
+	openaiReq.Seed = options.Seed
+	openaiReq.PresencePenalty = options.PresencePenalty
+	openaiReq.FrequencyPenalty = options.FrequencyPenalty
+	openaiReq.Stop = options.Stop
+	if options.NumPredict != nil && *options.NumPredict > 0 {
+		openaiReq.MaxTokens = *options.NumPredict
+	}
+
+	// format 为 "json" 时要求输出 JSON 对象，为对象时作为 JSON Schema
+	switch trimmed := bytes.TrimSpace(format); {
+	case len(trimmed) == 0, string(trimmed) == "null", string(trimmed) == `""`:
+	case trimmed[0] == '"':
+		var name string
+		if err := json.Unmarshal(trimmed, &name); err != nil || name != "json" {
+			return fmt.Errorf("invalid format: expected \"json\" or a JSON schema object")
+		}
+		openaiReq.ResponseFormat = &transformers.ResponseFormat{Type: "json_object"}
+	default:
+		var schema map[string]interface{}
+		if err := json.Unmarshal(trimmed, &schema); err != nil {
+			return fmt.Errorf("invalid format: expected \"json\" or a JSON schema object")
+		}
+		openaiReq.ResponseFormat = &transformers.ResponseFormat{
+			Type:       "json_schema",
+			JSONSchema: &transformers.JSONSchemaFormat{Name: "response", Schema: schema},
+		}
+	}
+	return nil
+}
+
+// ollamaToOpenAIMessage 转换 Ollama 消息，images 转换为 data URI 形式的 image_url 内容块
+// 历史消息中的 tool_calls 在 OpenAIRequest 中没有对应字段，不转发
+func ollamaToOpenAIMessage(msg ollamaMessage) (transformers.OpenAIMessage, error) {
+	if len(msg.Images) == 0 {
+		return transformers.OpenAIMessage{Role: msg.Role, Content: msg.Content}, nil
+	}
+
+	var parts []transformers.ContentPart
+	if msg.Content != "" {
+		parts = append(parts, transformers.ContentPart{Type: "text", Text: msg.Content})
+	}
+	for _, image := range msg.Images {
+		url := image
+		if !strings.HasPrefix(image, "data:") {
+			mediaType, err := ollamaImageMediaType(image)
+			if err != nil {
+				return transformers.OpenAIMessage{}, err
+			}
+			url = fmt.Sprintf("data:%s;base64,%s", mediaType, image)
+		}
+		parts = append(parts, transformers.ContentPart{Type: "image_url", ImageURL: map[string]interface{}{"url": url}})
+	}
+	return transformers.OpenAIMessage{Role: msg.Role, Content: parts}, nil
+}
+
+// ollamaImageMediaType 根据 base64 图片的文件头识别 media type
+func ollamaImageMediaType(data string) (string, error) {
+	// 只解码开头的完整 base64 分组（每 4 个字符）即可识别文件头
+	head := data
+	if len(head) > 64 {
+		head = head[:64]
+	}
+	decoded, err := base64.StdEncoding.DecodeString(head[:len(head)/4*4])
+	if err != nil {
+		return "", fmt.Errorf("invalid base64 image data: %v", err)
+	}
+	mediaType := http.DetectContentType(decoded)
+	if !strings.HasPrefix(mediaType, "image/") {
+		return "", fmt.Errorf("unsupported image type '%s'", mediaType)
+	}
+	return mediaType, nil
+}
+
+// ollamaOpenAIChunk OpenAI 非流式响应或 SSE 块中 Ollama 响应需要的字段
+// 使用独立的结构以读取 openai-chat 上游的 reasoning_content
+type ollamaOpenAIChunk struct {
+	Choices []struct {
+		Message      *ollamaOpenAIDelta `json:"message"`
+		Delta        *ollamaOpenAIDelta `json:"delta"`
+		FinishReason *string            `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type ollamaOpenAIDelta struct {
+	Content          string                        `json:"content"`
+	ReasoningContent string                        `json:"reasoning_content"`
+	ToolCalls        []transformers.OpenAIToolCall `json:"tool_calls"`
+}
+
+// ollamaTurn 累积一次 OpenAI 响应，生成 Ollama 响应
+type ollamaTurn struct {
+	openaiReq  *transformers.OpenAIRequest
+	generate   bool
+	start      time.Time
+	content    strings.Builder
+	thinking   strings.Builder
+	calls      map[int]*transformers.OpenAIToolCall // 流式工具调用按 index 拼接 arguments
+	doneReason string
+	prompt     int
+	eval       int
+}
+
+func newOllamaTurn(openaiReq *transformers.OpenAIRequest, generate bool) *ollamaTurn {
+	return &ollamaTurn{openaiReq: openaiReq, generate: generate, start: time.Now(), calls: make(map[int]*transformers.OpenAIToolCall)}
+}
+
+// add 合并一个 OpenAI 响应或 SSE 块，返回本块新增的文本和推理内容
+func (t *ollamaTurn) add(chunk *ollamaOpenAIChunk) (content, thinking string) {
+	if chunk.Usage != nil {
+		t.prompt = chunk.Usage.PromptTokens
+		t.eval = chunk.Usage.CompletionTokens
+	}
+	for _, choice := range chunk.Choices {
+		delta := choice.Delta
+		if delta == nil {
+			delta = choice.Message
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			t.doneReason = "stop"
+			if *choice.FinishReason == "length" {
+				t.doneReason = "length"
+			}
+		}
+		if delta == nil {
+			continue
+		}
+		content += delta.Content
+		thinking += delta.ReasoningContent
+		for i, call := range delta.ToolCalls {
+			index := i
+			if call.Index != nil {
+				index = *call.Index
+			}
+			if existing, ok := t.calls[index]; ok {
+				existing.Function.Arguments += call.Function.Arguments
+				continue
+			}
+			call := call
+			t.calls[index] = &call
+		}
+	}
+	t.content.WriteString(content)
+	t.thinking.WriteString(thinking)
+	return content, thinking
+}
+
+// toolCalls 返回完整的工具调用，arguments 解析为 JSON 对象
+func (t *ollamaTurn) toolCalls() []ollamaToolCall {
+	indexes := make([]int, 0, len(t.calls))
+	for index := range t.calls {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	var calls []ollamaToolCall
+	for _, index := range indexes {
+		call := t.calls[index]
+		arguments := json.RawMessage(call.Function.Arguments)
+		if !json.Valid(arguments) {
+			arguments = json.RawMessage("{}")
+		}
+		calls = append(calls, ollamaToolCall{Function: ollamaToolFunction{Name: call.Function.Name, Arguments: arguments}})
+	}
+	return calls
+}
+
+// chunk 生成一行流式响应
+func (t *ollamaTurn) chunk(content, thinking string, toolCalls []ollamaToolCall) *ollamaResponse {
+	resp := &ollamaResponse{Model: t.openaiReq.Model, CreatedAt: time.Now().UTC()}
+	if t.generate {
+		resp.Response = &content
+		resp.Thinking = thinking
+	} else {
+		resp.Message = &ollamaMessage{Role: "assistant", Content: content, Thinking: thinking, ToolCalls: toolCalls}
+	}
+	return resp
+}
+
+// done 生成最后一行响应，上游未返回 usage 时使用本地估算
+func (t *ollamaTurn) done() *ollamaResponse {
+	resp := t.chunk("", "", nil)
+	resp.Done = true
+	resp.DoneReason = t.doneReason
+	if resp.DoneReason == "" {
+		resp.DoneReason = "stop"
+	}
+	resp.TotalDuration = time.Since(t.start).Nanoseconds()
+	resp.PromptEvalCount, resp.EvalCount = t.prompt, t.eval
+	if resp.PromptEvalCount == 0 && len(t.openaiReq.Messages) > 0 {
+		resp.PromptEvalCount = transformers.EstimateOpenAIRequestTokens(t.openaiReq)
+	}
+	if resp.EvalCount == 0 {
+		resp.EvalCount = transformers.EstimateTextTokens(t.content.String())
+	}
+	return resp
+}
+
+// ollamaStreamWriter 把 chatCompletionsHandler 写出的 OpenAI SSE 逐块转换为 Ollama NDJSON
+// 错误响应（状态码 >= 400）先缓存，结束后转换为 Ollama 格式的错误
+type ollamaStreamWriter struct {
+	w          http.ResponseWriter
+	flusher    http.Flusher
+	header     http.Header
+	statusCode int
+	started    bool
+	failed     bool
+	pending    bytes.Buffer // 不完整的 SSE 行，或完整的错误响应体
+	turn       *ollamaTurn
+}
+
+func (s *ollamaStreamWriter) Header() http.Header  { return s.header }
+func (s *ollamaStreamWriter) WriteHeader(code int) { s.statusCode = code }
+func (s *ollamaStreamWriter) Flush()               {}
+
+func (s *ollamaStreamWriter) Write(p []byte) (int, error) {
+	s.pending.Write(p)
+	if s.statusCode >= http.StatusBadRequest {
+		return len(p), nil
+	}
+	if !s.started {
+		copyResponseHeaders(s.w.Header(), s.header)
+		s.w.Header().Set("Content-Type", "application/x-ndjson")
+		s.w.WriteHeader(http.StatusOK)
+		s.started = true
+	}
+
+	for {
+		line, err := s.pending.ReadString('\n')
+		if err != nil {
+			// 保留不完整的行，等待后续数据
+			rest := line
+			s.pending.Reset()
+			s.pending.WriteString(rest)
+			break
+		}
+		if err := s.writeEvent(strings.TrimSpace(line)); err != nil {
+			return len(p), err
+		}
+	}
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+	return len(p), nil
+}
+
+// writeEvent 转换一行 SSE，只输出有新内容的块；结束行由 finish 统一写出
+func (s *ollamaStreamWriter) writeEvent(line string) error {
+	if s.failed || !strings.HasPrefix(line, "data:") {
+		return nil
+	}
+	data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+	if data == "[DONE]" {
+		return nil
+	}
+	var chunk ollamaOpenAIChunk
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		return nil
+	}
+	if chunk.Error != nil {
+		s.failed = true
+		return s.writeLine(map[string]string{"error": chunk.Error.Message})
+	}
+	content, thinking := s.turn.add(&chunk)
+	if content == "" && thinking == "" {
+		return nil
+	}
+	return s.writeLine(s.turn.chunk(content, thinking, nil))
+}
+
+func (s *ollamaStreamWriter) writeLine(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = s.w.Write(append(data, '\n'))
+	return err
+}
+
+// finish 写出工具调用和结束行；响应是错误时以 Ollama 格式返回
+func (s *ollamaStreamWriter) finish() {
+	if s.statusCode >= http.StatusBadRequest {
+		copyResponseHeaders(s.w.Header(), s.header)
+		writeOllamaError(s.w, s.statusCode, openAIErrorMessage(s.pending.Bytes()))
+		return
+	}
+	if s.failed || !s.started {
+		return
+	}
+	if calls := s.turn.toolCalls(); len(calls) > 0 && !s.turn.generate {
+		if err := s.writeLine(s.turn.chunk("", "", calls)); err != nil {
+			log.Printf("错误: 写入流式响应失败: %v", err)
+			return
+		}
+	}
+	if err := s.writeLine(s.turn.done()); err != nil {
+		log.Printf("错误: 写入流式响应失败: %v", err)
+		return
+	}
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+}
+
+// copyResponseHeaders 复制 X-Cache、X-Context-* 等响应头，Content-Type 和 Content-Length 由调用方设置
+func copyResponseHeaders(dst, src http.Header) {
+	for key, values := range src {
+		if key == "Content-Type" || key == "Content-Length" || key == "X-Content-Type-Options" {
+			continue
+		}
+		dst[key] = values
+	}
+}
+
+// openAIErrorMessage 从 OpenAI 格式的错误响应中提取错误信息
+func openAIErrorMessage(body []byte) string {
+	var errResp struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error.Message != "" {
+		return errResp.Error.Message
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// writeOllamaError 写入 Ollama 格式的错误：{"error": "..."}
+func writeOllamaError(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(map[string]string{"error": message}); err != nil {
+		log.Printf("错误: 编码响应失败: %v", err)
+	}
+}
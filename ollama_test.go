@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"factory-go-api/mockupstream"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// 1x1 PNG
+const testPNGBase64 = "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNkYPhfDwAChwGA60e6kgAAAABJRU5ErkJggg=="
+
+// postOllama 通过 Ollama 兼容接口发送请求
+func postOllama(t *testing.T, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer client-key")
+	rr := httptest.NewRecorder()
+	switch path {
+	case "/api/chat":
+		ollamaChatHandler(rr, req)
+	case "/api/generate":
+		ollamaGenerateHandler(rr, req)
+	default:
+		t.Fatalf("unknown path %s", path)
+	}
+	return rr
+}
+
+// decodeOllamaLines 解析 NDJSON 流式响应
+func decodeOllamaLines(t *testing.T, rr *httptest.ResponseRecorder) []ollamaResponse {
+	t.Helper()
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("status = %d, content-type = %q, body = %s", rr.Code, rr.Header().Get("Content-Type"), rr.Body.String())
+	}
+	var lines []ollamaResponse
+	for _, line := range strings.Split(strings.TrimSpace(rr.Body.String()), "\n") {
+		var resp ollamaResponse
+		if err := json.Unmarshal([]byte(line), &resp); err != nil {
+			t.Fatalf("invalid line %q: %v", line, err)
+		}
+		lines = append(lines, resp)
+	}
+	return lines
+}
+
+func TestOllamaTags(t *testing.T) {
+	newTestUpstream(t)
+
+	rr := httptest.NewRecorder()
+	ollamaTagsHandler(rr, httptest.NewRequest(http.MethodGet, "/api/tags", nil))
+	var resp struct {
+		Models []ollamaModel `json:"models"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response %q: %v", rr.Body.String(), err)
+	}
+	var names []string
+	for _, model := range resp.Models {
+		names = append(names, model.Name)
+	}
+	if strings.Join(names, ",") != "claude-test,claude-thinking,gpt-test" || resp.Models[0].Details.Family != "anthropic" {
+		t.Errorf("models = %s", rr.Body.String())
+	}
+}
+
+func TestOllamaChatNonStream(t *testing.T) {
+	upstream := newTestUpstream(t)
+
+	upstream.Enqueue(mockupstream.Reply{Text: "A red pixel.", InputTokens: 20, OutputTokens: 4})
+	rr := postOllama(t, "/api/chat", `{"model":"claude-test:latest","stream":false,
+		"messages":[{"role":"user","content":"What is this?","images":["`+testPNGBase64+`"]}],
+		"options":{"temperature":0.2,"num_predict":50,"stop":["END"],"num_ctx":8192}}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+	var resp ollamaResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Model != "claude-test" || resp.Message == nil || resp.Message.Content != "A red pixel." || !resp.Done ||
+		resp.DoneReason != "stop" || resp.PromptEvalCount != 20 || resp.EvalCount != 4 {
+		t.Errorf("response = %s", rr.Body.String())
+	}
+
+	// options 映射为采样参数，images 转换为图片内容块
+	req, _ := upstream.LastRequest()
+	data, _ := json.Marshal(req.Body)
+	for _, want := range []string{`"max_tokens":50`, `"temperature":0.2`, `"stop_sequences":["END"]`, `"media_type":"image/png"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("upstream request %s missing %s", data, want)
+		}
+	}
+}
+
+func TestOllamaChatStream(t *testing.T) {
+	upstream := newTestUpstream(t)
+	withOpenAIChatModel(t, upstream, "vllm-key")
+
+	upstream.Enqueue(mockupstream.Reply{
+		Text:     "Checking the weather.",
+		Thinking: "Need a tool",
+		ToolUse:  &mockupstream.ToolUse{ID: "call_1", Name: "get_weather", Input: map[string]interface{}{"city": "Paris"}},
+	})
+	// 未设置 stream 时默认流式
+	lines := decodeOllamaLines(t, postOllama(t, "/api/chat", `{"model":"local-qwen","messages":[{"role":"user","content":"Weather?"}],
+		"tools":[{"type":"function","function":{"name":"get_weather","parameters":{"type":"object"}}}],"options":{"top_k":20}}`))
+
+	var content, thinking string
+	var calls []ollamaToolCall
+	for _, line := range lines[:len(lines)-1] {
+		if line.Done || line.Message == nil {
+			t.Fatalf("unexpected line %+v", line)
+		}
+		content += line.Message.Content
+		thinking += line.Message.Thinking
+		calls = append(calls, line.Message.ToolCalls...)
+	}
+	if content != "Checking the weather." || thinking != "Need a tool" {
+		t.Errorf("content = %q, thinking = %q", content, thinking)
+	}
+	if len(calls) != 1 || calls[0].Function.Name != "get_weather" || string(calls[0].Function.Arguments) != `{"city":"Paris"}` {
+		t.Errorf("tool_calls = %+v", calls)
+	}
+	if last := lines[len(lines)-1]; !last.Done || last.DoneReason != "stop" || last.EvalCount == 0 {
+		t.Errorf("last line = %+v", last)
+	}
+
+	// top_k 作为未识别字段转发给 openai-chat 上游
+	if req, _ := upstream.LastRequest(); req.Body["top_k"] != float64(20) || req.Body["stream"] != true {
+		t.Errorf("upstream request = %v", req.Body)
+	}
+}
+
+func TestOllamaGenerate(t *testing.T) {
+	upstream := newTestUpstream(t)
+
+	upstream.Enqueue(mockupstream.Reply{Text: `{"answer":4}`, Truncated: true})
+	rr := postOllama(t, "/api/generate", `{"model":"gpt-test","system":"Reply in JSON.","prompt":"2+2?","stream":false,"format":"json"}`)
+	var resp ollamaResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+	if resp.Response == nil || *resp.Response != `{"answer":4}` || resp.Message != nil || resp.DoneReason != "length" {
+		t.Errorf("response = %s", rr.Body.String())
+	}
+	req, _ := upstream.LastRequest()
+	data, _ := json.Marshal(req.Body)
+	for _, want := range []string{`Reply in JSON.`, `2+2?`, `"json_object"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("upstream request %s missing %s", data, want)
+		}
+	}
+
+	// 没有 prompt 时视为加载模型，不访问上游
+	requests := len(upstream.Requests())
+	rr = postOllama(t, "/api/generate", `{"model":"gpt-test"}`)
+	resp = ollamaResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || !resp.Done || resp.DoneReason != "load" || len(upstream.Requests()) != requests {
+		t.Errorf("status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestOllamaErrors(t *testing.T) {
+	upstream := newTestUpstream(t)
+
+	rr := postOllama(t, "/api/chat", `{"model":"missing","messages":[{"role":"user","content":"Hi"}]}`)
+	if rr.Code != http.StatusNotFound || !strings.Contains(rr.Body.String(), `{"error":"Model 'missing' not found"}`) {
+		t.Errorf("status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+
+	rr = postOllama(t, "/api/chat", `{"model":"claude-test","messages":[{"role":"user","content":"Hi"}],"format":"yaml"}`)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "invalid format") {
+		t.Errorf("status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+
+	// 流式请求的上游错误以原状态码和 Ollama 格式返回
+	upstream.Enqueue(mockupstream.Reply{Status: http.StatusTooManyRequests, ErrorMessage: "rate limited"})
+	rr = postOllama(t, "/api/chat", `{"model":"claude-test","messages":[{"role":"user","content":"Hi"}]}`)
+	var errResp map[string]string
+	if err := json.Unmarshal(rr.Body.Bytes(), &errResp); err != nil || rr.Code != http.StatusTooManyRequests || !strings.Contains(errResp["error"], "rate limited") {
+		t.Errorf("status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"factory-go-api/config"
+	"factory-go-api/mockupstream"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// withOpenAIChatModel 添加指向模拟上游 Chat Completions 端点的自建模型
+func withOpenAIChatModel(t *testing.T, upstream *mockupstream.Server, apiKey string) {
+	t.Helper()
+	cfg := *config.GetConfig()
+	cfg.Endpoints = append(append([]config.Endpoint(nil), cfg.Endpoints...), config.Endpoint{Name: "vllm", BaseURL: upstream.OpenAIChatBaseURL(), APIKey: apiKey})
+	cfg.Models = append(append([]config.Model(nil), cfg.Models...), config.Model{Name: "Qwen", ID: "local-qwen", Type: "openai-chat", Endpoint: "vllm", UpstreamModel: "Qwen/Qwen2.5-Coder"})
+	config.SetConfig(&cfg)
+}
+
+func TestOpenAIChatPassthrough(t *testing.T) {
+	upstream := newTestUpstream(t)
+	withOpenAIChatModel(t, upstream, "vllm-key")
+
+	upstream.Enqueue(mockupstream.Reply{Text: "Local answer", Thinking: "Let me think", InputTokens: 7, OutputTokens: 3})
+	rr := postChat(t, `{"model":"local-qwen","messages":[{"role":"user","content":"Hello"}],"top_k":20}`)
+	resp := decodeChat(t, rr)
+	if resp.Model != "local-qwen" || resp.Choices[0].Message.Content != "Local answer" || resp.Usage["total_tokens"] != float64(10) {
+		t.Errorf("response = %s", rr.Body.String())
+	}
+	// 上游特有的字段原样返回
+	if !strings.Contains(rr.Body.String(), `"reasoning_content":"Let me think"`) {
+		t.Errorf("reasoning_content not preserved: %s", rr.Body.String())
+	}
+
+	req, _ := upstream.LastRequest()
+	if req.Path != mockupstream.ChatCompletionsPath || req.Header.Get("Authorization") != "Bearer vllm-key" {
+		t.Errorf("path = %s, authorization = %q", req.Path, req.Header.Get("Authorization"))
+	}
+	if req.Body["model"] != "Qwen/Qwen2.5-Coder" || req.Body["top_k"] != float64(20) || req.Header.Get("X-Factory-Client") != "" {
+		t.Errorf("upstream request = %v, headers = %v", req.Body, req.Header)
+	}
+
+	upstream.Enqueue(mockupstream.Reply{Text: "Streamed locally"})
+	content, finishReason := collectStream(t, postChat(t, `{"model":"local-qwen","stream":true,"messages":[{"role":"user","content":"Hello"}]}`))
+	if content != "Streamed locally" || finishReason != "stop" {
+		t.Errorf("content = %q, finish_reason = %q", content, finishReason)
+	}
+}
+
+func TestOpenAIChatDoesNotLeakFactoryKey(t *testing.T) {
+	upstream := newTestUpstream(t)
+	withOpenAIChatModel(t, upstream, "")
+
+	// 模拟上游要求认证，错误原样返回
+	rr := postChat(t, `{"model":"local-qwen","messages":[{"role":"user","content":"Hello"}]}`)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+	if req, _ := upstream.LastRequest(); req.Header.Get("Authorization") != "" {
+		t.Errorf("authorization = %q, FACTORY_API_KEY must not be sent to self-hosted servers", req.Header.Get("Authorization"))
+	}
+}
+
+func TestModelsListIncludesOpenAIChat(t *testing.T) {
+	upstream := newTestUpstream(t)
+	withOpenAIChatModel(t, upstream, "vllm-key")
+
+	rr := httptest.NewRecorder()
+	modelsHandler(rr, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+	var list struct {
+		Data []struct {
+			ID      string `json:"id"`
+			OwnedBy string `json:"owned_by"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	owners := make(map[string]string)
+	for _, model := range list.Data {
+		owners[model.ID] = model.OwnedBy
+	}
+	if owners["claude-test"] != "factory" || owners["local-qwen"] != "vllm" {
+		t.Errorf("owners = %v", owners)
+	}
+}
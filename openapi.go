@@ -0,0 +1,782 @@
+package main
+
+import (
+	"encoding/json"
+	"factory-go-api/balancer"
+	"factory-go-api/breaker"
+	"factory-go-api/config"
+	"factory-go-api/transformers"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// openAPIVersion 生成的文档遵循的 OpenAPI 版本
+const openAPIVersion = "3.0.3"
+
+// OpenAPI 文档中的安全方案
+const (
+	securityProxyKey    = "ProxyKey"
+	securityAdminBearer = "AdminBearer"
+	securityAdminBasic  = "AdminBasic"
+)
+
+// openAPIDocument OpenAPI 3 文档，只包含本服务用到的字段
+type openAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Servers    []openAPIServer                         `json:"servers,omitempty"`
+	Tags       []openAPITag                            `json:"tags"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"` // 路径 -> 小写方法名 -> 操作
+	Components openAPIComponents                       `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type openAPIServer struct {
+	URL string `json:"url"`
+}
+
+type openAPITag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+type openAPIOperation struct {
+	Tags        []string                   `json:"tags,omitempty"`
+	Summary     string                     `json:"summary"`
+	Description string                     `json:"description,omitempty"`
+	OperationID string                     `json:"operationId"`
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+	Security    []map[string][]string      `json:"security"` // 空数组表示无需认证
+}
+
+type openAPIParameter struct {
+	Name        string        `json:"name"`
+	In          string        `json:"in"`
+	Description string        `json:"description,omitempty"`
+	Required    bool          `json:"required"`
+	Schema      openAPISchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIMediaType struct {
+	Schema  openAPISchema `json:"schema"`
+	Example interface{}   `json:"example,omitempty"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Headers     map[string]openAPIHeader    `json:"headers,omitempty"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIHeader struct {
+	Description string        `json:"description,omitempty"`
+	Schema      openAPISchema `json:"schema"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]openAPISchema         `json:"schemas"`
+	SecuritySchemes map[string]openAPISecurityScheme `json:"securitySchemes"`
+}
+
+type openAPISecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme"`
+	Description string `json:"description,omitempty"`
+}
+
+// openAPISchema JSON Schema 对象，结构较自由，直接使用 map 表示
+type openAPISchema map[string]interface{}
+
+// schemaRef 引用 components.schemas 中的 Schema
+func schemaRef(name string) openAPISchema {
+	return openAPISchema{"$ref": "#/components/schemas/" + name}
+}
+
+// schemaNames Go 类型在文档中使用的 Schema 名称，未列出的结构体直接使用类型名
+var schemaNames = map[reflect.Type]string{
+	reflect.TypeOf(transformers.OpenAIRequest{}):         "ChatCompletionRequest",
+	reflect.TypeOf(transformers.OpenAIMessage{}):         "ChatMessage",
+	reflect.TypeOf(transformers.OpenAIResponse{}):        "ChatCompletionResponse",
+	reflect.TypeOf(transformers.OpenAIChoice{}):          "ChatCompletionChoice",
+	reflect.TypeOf(transformers.OpenAIMessageResponse{}): "ChatCompletionMessage",
+	reflect.TypeOf(tokenCountRequest{}):                  "TokenCountRequest",
+	reflect.TypeOf(ollamaChatRequest{}):                  "OllamaChatRequest",
+	reflect.TypeOf(ollamaGenerateRequest{}):              "OllamaGenerateRequest",
+	reflect.TypeOf(ollamaResponse{}):                     "OllamaResponse",
+	reflect.TypeOf(ollamaMessage{}):                      "OllamaMessage",
+	reflect.TypeOf(ollamaToolCall{}):                     "OllamaToolCall",
+	reflect.TypeOf(ollamaToolFunction{}):                 "OllamaToolFunction",
+	reflect.TypeOf(ollamaOptions{}):                      "OllamaOptions",
+	reflect.TypeOf(ollamaModel{}):                        "OllamaModel",
+	reflect.TypeOf(ollamaModelDetails{}):                 "OllamaModelDetails",
+	reflect.TypeOf(config.Model{}):                       "ModelConfig",
+	reflect.TypeOf(config.Endpoint{}):                    "EndpointConfig",
+	reflect.TypeOf(config.Client{}):                      "ClientConfig",
+	reflect.TypeOf(adminEndpointView{}):                  "AdminEndpoint",
+	reflect.TypeOf(adminClientView{}):                    "AdminClient",
+	reflect.TypeOf(adminMetricsView{}):                   "AdminMetrics",
+	reflect.TypeOf(breaker.Status{}):                     "CircuitBreakerStatus",
+	reflect.TypeOf(balancer.Status{}):                    "EndpointStatus",
+}
+
+// schemaRegistry 根据 Go 类型的 json 标签生成 Schema，结构体注册到 components 后以 $ref 引用
+type schemaRegistry struct {
+	schemas map[string]openAPISchema
+}
+
+func newSchemaRegistry() *schemaRegistry {
+	return &schemaRegistry{schemas: make(map[string]openAPISchema)}
+}
+
+// ref 注册结构体类型并返回对它的引用
+func (s *schemaRegistry) ref(t reflect.Type) openAPISchema {
+	name, ok := schemaNames[t]
+	if !ok {
+		name = t.Name()
+	}
+	if _, exists := s.schemas[name]; !exists {
+		s.schemas[name] = openAPISchema{} // 先占位，避免递归类型无限展开
+		s.schemas[name] = s.structSchema(t)
+	}
+	return schemaRef(name)
+}
+
+// schemaOf 生成任意类型的 Schema
+func (s *schemaRegistry) schemaOf(t reflect.Type) openAPISchema {
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return openAPISchema{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(transformers.StopSequences{}):
+		return openAPISchema{"oneOf": []openAPISchema{
+			{"type": "string"},
+			{"type": "array", "items": openAPISchema{"type": "string"}},
+		}}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return s.schemaOf(t.Elem())
+	case reflect.String:
+		return openAPISchema{"type": "string"}
+	case reflect.Bool:
+		return openAPISchema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return openAPISchema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return openAPISchema{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return openAPISchema{"type": "array", "items": s.schemaOf(t.Elem())}
+	case reflect.Map:
+		return openAPISchema{"type": "object", "additionalProperties": s.schemaOf(t.Elem())}
+	case reflect.Struct:
+		return s.ref(t)
+	}
+	// interface{} 等任意类型
+	return openAPISchema{}
+}
+
+// structSchema 按 encoding/json 的规则展开结构体字段
+// 没有 omitempty 的非指针字段视为必有字段；匿名嵌入的结构体字段提升到外层
+func (s *schemaRegistry) structSchema(t reflect.Type) openAPISchema {
+	properties := make(map[string]interface{})
+	var required []string
+	s.collectFields(t, properties, &required)
+
+	schema := openAPISchema{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (s *schemaRegistry) collectFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			s.collectFields(field.Type, properties, required)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = s.schemaOf(field.Type)
+		if !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Ptr {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// jsonContent 生成 application/json 内容
+func jsonContent(schema openAPISchema, example interface{}) map[string]openAPIMediaType {
+	return map[string]openAPIMediaType{"application/json": {Schema: schema, Example: example}}
+}
+
+// jsonResponse 生成 JSON 响应
+func jsonResponse(description string, schema openAPISchema) openAPIResponse {
+	return openAPIResponse{Description: description, Content: jsonContent(schema, nil)}
+}
+
+// errorResponse 生成错误响应
+func errorResponse(description string) openAPIResponse {
+	return jsonResponse(description, schemaRef("Error"))
+}
+
+// ollamaResponses Ollama 接口的响应，错误为 {"error": "..."}
+func ollamaResponses(resp openAPISchema) map[string]openAPIResponse {
+	ollamaError := func(description string) openAPIResponse {
+		return jsonResponse(description, schemaRef("OllamaError"))
+	}
+	return map[string]openAPIResponse{
+		"200": {
+			Description: "生成结果",
+			Content: map[string]openAPIMediaType{
+				"application/json":     {Schema: resp},
+				"application/x-ndjson": {Schema: openAPISchema{"type": "string", "description": "每行一个 OllamaResponse"}},
+			},
+		},
+		"400": ollamaError("请求参数错误或超出上下文窗口"),
+		"401": ollamaError("API Key 错误"),
+		"404": ollamaError("模型不存在"),
+		"502": ollamaError("上游请求失败"),
+		"503": ollamaError("熔断器打开，快速失败"),
+	}
+}
+
+// nameParameter 路径中的名称参数
+func nameParameter(name, description string) []openAPIParameter {
+	return []openAPIParameter{{Name: name, In: "path", Description: description, Required: true, Schema: openAPISchema{"type": "string"}}}
+}
+
+// requestServerURL 根据请求推断服务地址，反向代理后通过 X-Forwarded-Proto 识别 https
+func requestServerURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// buildOpenAPISpec 生成描述全部路由的 OpenAPI 文档，模型 ID 取自当前配置
+func buildOpenAPISpec(serverURL string) *openAPIDocument {
+	registry := newSchemaRegistry()
+	chatRequest := registry.ref(reflect.TypeOf(transformers.OpenAIRequest{}))
+	chatResponse := registry.ref(reflect.TypeOf(transformers.OpenAIResponse{}))
+	countRequest := registry.ref(reflect.TypeOf(tokenCountRequest{}))
+	ollamaChat := registry.ref(reflect.TypeOf(ollamaChatRequest{}))
+	ollamaGenerate := registry.ref(reflect.TypeOf(ollamaGenerateRequest{}))
+	ollamaResp := registry.ref(reflect.TypeOf(ollamaResponse{}))
+	ollamaModelSchema := registry.ref(reflect.TypeOf(ollamaModel{}))
+	modelConfig := registry.ref(reflect.TypeOf(config.Model{}))
+	endpointConfig := registry.ref(reflect.TypeOf(config.Endpoint{}))
+	clientConfig := registry.ref(reflect.TypeOf(config.Client{}))
+	adminEndpoint := registry.ref(reflect.TypeOf(adminEndpointView{}))
+	adminClient := registry.ref(reflect.TypeOf(adminClientView{}))
+	adminMetrics := registry.ref(reflect.TypeOf(adminMetricsView{}))
+	breakerStatus := registry.ref(reflect.TypeOf(breaker.Status{}))
+	endpointStatus := registry.ref(reflect.TypeOf(balancer.Status{}))
+
+	models := config.GetAllModels()
+	modelIDs := make([]string, 0, len(models))
+	for _, model := range models {
+		modelIDs = append(modelIDs, model.ID)
+	}
+	modelIDSchema := openAPISchema{"type": "string", "description": "已配置的模型 ID"}
+	if len(modelIDs) > 0 {
+		modelIDSchema["enum"] = modelIDs
+	}
+	for _, name := range []string{"ChatCompletionRequest", "TokenCountRequest", "OllamaChatRequest", "OllamaGenerateRequest"} {
+		registry.schemas[name]["properties"].(map[string]interface{})["model"] = modelIDSchema
+	}
+	registry.schemas["ChatMessage"]["properties"].(map[string]interface{})["content"] = openAPISchema{
+		"description": "字符串，或由 text / image_url / file 组成的内容数组",
+		"oneOf": []openAPISchema{
+			{"type": "string"},
+			{"type": "array", "items": registry.ref(reflect.TypeOf(transformers.ContentPart{}))},
+		},
+	}
+	registry.schemas["ChatCompletionResponse"]["description"] = "非流式响应；流式响应的每个 SSE data 块使用相同结构，choices 中为 delta"
+
+	// json.RawMessage 字段按实际取值描述
+	ollamaFormat := openAPISchema{
+		"description": "\"json\" 要求输出 JSON 对象，对象作为 JSON Schema 约束输出",
+		"oneOf":       []openAPISchema{{"type": "string", "enum": []string{"json"}}, {"type": "object"}},
+	}
+	ollamaKeepAlive := openAPISchema{"description": "兼容字段，忽略", "oneOf": []openAPISchema{{"type": "string"}, {"type": "number"}}}
+	for _, name := range []string{"OllamaChatRequest", "OllamaGenerateRequest"} {
+		properties := registry.schemas[name]["properties"].(map[string]interface{})
+		properties["format"] = ollamaFormat
+		properties["keep_alive"] = ollamaKeepAlive
+		properties["stream"] = openAPISchema{"type": "boolean", "default": true}
+	}
+	registry.schemas["OllamaToolFunction"]["properties"].(map[string]interface{})["arguments"] = openAPISchema{"type": "object"}
+	registry.schemas["OllamaResponse"]["description"] = "非流式响应；流式响应每行一个对象，最后一行 done 为 true 并包含 done_reason 和 token 统计"
+
+	registry.schemas["Error"] = openAPISchema{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"error": openAPISchema{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"message": openAPISchema{"type": "string"},
+					"type":    openAPISchema{"type": "string"},
+					"param":   openAPISchema{"type": "string"},
+					"code":    openAPISchema{"type": "string"},
+				},
+				"required": []string{"message", "type"},
+			},
+		},
+		"required": []string{"error"},
+	}
+	registry.schemas["OllamaError"] = openAPISchema{
+		"type":       "object",
+		"properties": map[string]interface{}{"error": openAPISchema{"type": "string"}},
+		"required":   []string{"error"},
+	}
+	registry.schemas["Health"] = openAPISchema{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"status":           openAPISchema{"type": "string", "enum": []string{"healthy", "degraded"}, "description": "有熔断器打开或端点健康检查失败时为 degraded"},
+			"timestamp":        openAPISchema{"type": "string", "format": "date-time"},
+			"uptime":           openAPISchema{"type": "number", "description": "运行时长（秒）"},
+			"circuit_breakers": openAPISchema{"type": "array", "items": breakerStatus},
+			"endpoints":        openAPISchema{"type": "array", "items": endpointStatus},
+		},
+	}
+	registry.schemas["ModelList"] = openAPISchema{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"object": openAPISchema{"type": "string", "enum": []string{"list"}},
+			"data": openAPISchema{"type": "array", "items": openAPISchema{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"id":       modelIDSchema,
+					"object":   openAPISchema{"type": "string", "enum": []string{"model"}},
+					"created":  openAPISchema{"type": "integer"},
+					"owned_by": openAPISchema{"type": "string"},
+				},
+			}},
+		},
+	}
+	registry.schemas["TokenCount"] = openAPISchema{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"object":       openAPISchema{"type": "string", "enum": []string{"token_count"}},
+			"model":        modelIDSchema,
+			"input_tokens": openAPISchema{"type": "integer"},
+			"source":       openAPISchema{"type": "string", "enum": []string{tokenCountSourceAnthropic, tokenCountSourceEstimate}},
+		},
+	}
+	registry.schemas["AnthropicTokenCount"] = openAPISchema{
+		"type":       "object",
+		"properties": map[string]interface{}{"input_tokens": openAPISchema{"type": "integer"}},
+	}
+	registry.schemas["AdminState"] = openAPISchema{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"started_at":     openAPISchema{"type": "string", "format": "date-time"},
+			"uptime":         openAPISchema{"type": "number"},
+			"go_version":     openAPISchema{"type": "string"},
+			"goroutines":     openAPISchema{"type": "integer"},
+			"config_path":    openAPISchema{"type": "string"},
+			"models":         openAPISchema{"type": "integer"},
+			"enabled_models": openAPISchema{"type": "integer"},
+			"endpoints":      openAPISchema{"type": "integer"},
+			"clients":        openAPISchema{"type": "integer"},
+			"response_cache": openAPISchema{"type": "object"},
+			"recording":      openAPISchema{"type": "object"},
+		},
+	}
+
+	exampleModel := "gpt-5-2025-08-07"
+	if len(modelIDs) > 0 {
+		exampleModel = modelIDs[0]
+	}
+	chatExample := map[string]interface{}{
+		"model":      exampleModel,
+		"messages":   []map[string]string{{"role": "user", "content": "Hello!"}},
+		"max_tokens": 100,
+		"stream":     false,
+	}
+
+	proxyAuth := []map[string][]string{{securityProxyKey: {}}}
+	adminAuth := []map[string][]string{{securityAdminBearer: {}}, {securityAdminBasic: {}}}
+	noAuth := []map[string][]string{}
+
+	listOf := func(item openAPISchema) openAPISchema {
+		return openAPISchema{
+			"type":       "object",
+			"properties": map[string]interface{}{"data": openAPISchema{"type": "array", "items": item}},
+		}
+	}
+	adminOp := func(id, summary string) *openAPIOperation {
+		return &openAPIOperation{
+			Tags:        []string{"admin"},
+			Summary:     summary,
+			OperationID: id,
+			Responses: map[string]openAPIResponse{
+				"401": errorResponse("ADMIN_API_KEY 错误"),
+				"403": errorResponse("未设置 ADMIN_API_KEY，管理 API 未启用"),
+			},
+			Security: adminAuth,
+		}
+	}
+	withResponses := func(op *openAPIOperation, responses map[string]openAPIResponse) *openAPIOperation {
+		for code, response := range responses {
+			op.Responses[code] = response
+		}
+		return op
+	}
+	withBody := func(op *openAPIOperation, schema openAPISchema) *openAPIOperation {
+		op.RequestBody = &openAPIRequestBody{Required: true, Content: jsonContent(schema, nil)}
+		return op
+	}
+	withParams := func(op *openAPIOperation, params []openAPIParameter) *openAPIOperation {
+		op.Parameters = params
+		return op
+	}
+	modelParam := nameParameter("id", "模型 ID")
+	endpointParam := nameParameter("name", "端点名称")
+	clientParam := nameParameter("name", "客户端名称")
+	deleted := map[string]openAPIResponse{"204": {Description: "已删除"}, "404": errorResponse("不存在")}
+
+	paths := map[string]map[string]*openAPIOperation{
+		"/health": {
+			"get": {
+				Tags:        []string{"system"},
+				Summary:     "健康检查",
+				OperationID: "getHealth",
+				Responses:   map[string]openAPIResponse{"200": jsonResponse("服务正常", schemaRef("Health"))},
+				Security:    noAuth,
+			},
+		},
+		"/v1/models": {
+			"get": {
+				Tags:        []string{"openai"},
+				Summary:     "获取可用模型列表",
+				OperationID: "listModels",
+				Responses:   map[string]openAPIResponse{"200": jsonResponse("已启用的模型", schemaRef("ModelList"))},
+				Security:    noAuth,
+			},
+		},
+		"/v1/chat/completions": {
+			"post": {
+				Tags:        []string{"openai"},
+				Summary:     "创建对话补全",
+				Description: "OpenAI Chat Completions 兼容接口，stream 为 true 时以 SSE 返回 chat.completion.chunk，以 data: [DONE] 结束。",
+				OperationID: "createChatCompletion",
+				RequestBody: &openAPIRequestBody{Required: true, Content: jsonContent(chatRequest, chatExample)},
+				Responses: map[string]openAPIResponse{
+					"200": {
+						Description: "对话补全结果",
+						Headers: map[string]openAPIHeader{
+							"X-Cache":                    {Description: "响应缓存：HIT、MISS 或 BYPASS", Schema: openAPISchema{"type": "string"}},
+							"X-Context-Action":           {Description: "上下文超限时执行的动作：truncated 或 summarized", Schema: openAPISchema{"type": "string"}},
+							"X-Context-Dropped-Messages": {Description: "上下文管理丢弃的消息数", Schema: openAPISchema{"type": "integer"}},
+							"X-Context-Estimated-Tokens": {Description: "估算的输入 token 数", Schema: openAPISchema{"type": "integer"}},
+						},
+						Content: map[string]openAPIMediaType{
+							"application/json":  {Schema: chatResponse},
+							"text/event-stream": {Schema: openAPISchema{"type": "string", "description": "data: ChatCompletionResponse（choices 中为 delta）"}},
+						},
+					},
+					"400": errorResponse("请求参数错误或超出上下文窗口"),
+					"401": errorResponse("API Key 错误"),
+					"404": errorResponse("模型不存在"),
+					"502": errorResponse("上游请求失败"),
+					"503": {
+						Description: "熔断器打开，快速失败（code 为 circuit_open）",
+						Headers:     map[string]openAPIHeader{"Retry-After": {Description: "建议的重试等待秒数", Schema: openAPISchema{"type": "integer"}}},
+						Content:     jsonContent(schemaRef("Error"), nil),
+					},
+				},
+				Security: proxyAuth,
+			},
+		},
+		"/v1/token_count": {
+			"post": {
+				Tags:        []string{"tokens"},
+				Summary:     "计算输入 token 数",
+				Description: "执行与正式请求相同的转换后计数；Anthropic 模型优先调用上游 count_tokens，其余模型使用本地估算。",
+				OperationID: "countTokens",
+				RequestBody: &openAPIRequestBody{Required: true, Content: jsonContent(countRequest, chatExample)},
+				Responses: map[string]openAPIResponse{
+					"200": {
+						Description: "token 计数",
+						Headers:     map[string]openAPIHeader{"X-Token-Count-Source": {Description: "计数来源：anthropic 或 estimate", Schema: openAPISchema{"type": "string"}}},
+						Content:     jsonContent(schemaRef("TokenCount"), nil),
+					},
+					"400": errorResponse("请求参数错误"),
+					"401": errorResponse("API Key 错误"),
+					"404": errorResponse("模型不存在"),
+				},
+				Security: proxyAuth,
+			},
+		},
+		"/v1/messages/count_tokens": {
+			"post": {
+				Tags:        []string{"tokens"},
+				Summary:     "计算输入 token 数（Anthropic 格式响应）",
+				Description: "请求体可以是 Chat Completions 格式，也可以使用 Anthropic 原生的 tool_use / tool_result / image / document 内容块、input_schema 形式的 tools 和 tool_choice。",
+				OperationID: "countTokensAnthropic",
+				RequestBody: &openAPIRequestBody{Required: true, Content: jsonContent(countRequest, chatExample)},
+				Responses: map[string]openAPIResponse{
+					"200": jsonResponse("token 计数", schemaRef("AnthropicTokenCount")),
+					"400": errorResponse("请求参数错误"),
+					"401": errorResponse("API Key 错误"),
+					"404": errorResponse("模型不存在"),
+				},
+				Security: proxyAuth,
+			},
+		},
+		"/api/tags": {
+			"get": {
+				Tags:        []string{"ollama"},
+				Summary:     "获取可用模型列表（Ollama 格式）",
+				OperationID: "listOllamaModels",
+				Responses: map[string]openAPIResponse{"200": jsonResponse("已启用的模型", openAPISchema{
+					"type":       "object",
+					"properties": map[string]interface{}{"models": openAPISchema{"type": "array", "items": ollamaModelSchema}},
+				})},
+				Security: noAuth,
+			},
+		},
+		"/api/chat": {
+			"post": {
+				Tags:        []string{"ollama"},
+				Summary:     "对话（Ollama 格式）",
+				Description: "转换为 Chat Completions 请求处理，stream 默认为 true，流式响应为 NDJSON；messages 为空时返回 done_reason 为 load 的响应。",
+				OperationID: "ollamaChat",
+				RequestBody: &openAPIRequestBody{Required: true, Content: jsonContent(ollamaChat, nil)},
+				Responses:   ollamaResponses(ollamaResp),
+				Security:    proxyAuth,
+			},
+		},
+		"/api/generate": {
+			"post": {
+				Tags:        []string{"ollama"},
+				Summary:     "文本生成（Ollama 格式）",
+				Description: "system 和 prompt 转换为 system / user 消息后按 /api/chat 处理，生成内容在 response 字段中。",
+				OperationID: "ollamaGenerate",
+				RequestBody: &openAPIRequestBody{Required: true, Content: jsonContent(ollamaGenerate, nil)},
+				Responses:   ollamaResponses(ollamaResp),
+				Security:    proxyAuth,
+			},
+		},
+		"/openapi.json": {
+			"get": {
+				Tags:        []string{"system"},
+				Summary:     "OpenAPI 文档",
+				OperationID: "getOpenAPISpec",
+				Responses:   map[string]openAPIResponse{"200": {Description: "本文档", Content: jsonContent(openAPISchema{"type": "object"}, nil)}},
+				Security:    noAuth,
+			},
+		},
+		"/docs": {
+			"get": {
+				Tags:        []string{"system"},
+				Summary:     "API 文档页面",
+				OperationID: "getDocs",
+				Responses: map[string]openAPIResponse{"200": {
+					Description: "根据本 OpenAPI 文档渲染的 HTML 页面",
+					Content:     map[string]openAPIMediaType{"text/html": {Schema: openAPISchema{"type": "string"}}},
+				}},
+				Security: noAuth,
+			},
+		},
+		"/dashboard": {
+			"get": {
+				Tags:        []string{"admin"},
+				Summary:     "管理面板",
+				OperationID: "getDashboard",
+				Responses: map[string]openAPIResponse{
+					"200": {Description: "HTML 页面，数据来自 /admin/metrics", Content: map[string]openAPIMediaType{"text/html": {Schema: openAPISchema{"type": "string"}}}},
+					"401": errorResponse("ADMIN_API_KEY 错误"),
+					"403": errorResponse("未设置 ADMIN_API_KEY"),
+				},
+				Security: adminAuth,
+			},
+		},
+		"/admin/state": {
+			"get": withResponses(adminOp("getAdminState", "运行时状态"), map[string]openAPIResponse{"200": jsonResponse("运行时状态", schemaRef("AdminState"))}),
+		},
+		"/admin/reload": {
+			"post": withResponses(adminOp("reloadConfig", "重新读取配置文件"), map[string]openAPIResponse{
+				"200": jsonResponse("重新加载完成", openAPISchema{"type": "object", "properties": map[string]interface{}{
+					"reloaded": openAPISchema{"type": "boolean"},
+					"models":   openAPISchema{"type": "integer"},
+				}}),
+				"400": errorResponse("配置文件无效"),
+			}),
+		},
+		"/admin/metrics": {
+			"get": withResponses(adminOp("getAdminMetrics", "请求统计"), map[string]openAPIResponse{"200": jsonResponse("统计快照、熔断器和端点健康状态", adminMetrics)}),
+		},
+		"/admin/models": {
+			"get": withResponses(adminOp("listAdminModels", "列出全部模型（包括已停用）"), map[string]openAPIResponse{"200": jsonResponse("模型列表", listOf(modelConfig))}),
+			"post": withBody(withResponses(adminOp("createModel", "添加模型"), map[string]openAPIResponse{
+				"201": jsonResponse("已创建", modelConfig),
+				"400": errorResponse("配置无效"),
+				"409": errorResponse("模型 ID 已存在"),
+			}), modelConfig),
+		},
+		"/admin/models/{id}": {
+			"get": withParams(withResponses(adminOp("getModel", "获取模型"), map[string]openAPIResponse{
+				"200": jsonResponse("模型", modelConfig),
+				"404": errorResponse("不存在"),
+			}), modelParam),
+			"patch": withParams(withBody(withResponses(adminOp("updateModel", "修改模型，只更新请求体中出现的字段"), map[string]openAPIResponse{
+				"200": jsonResponse("修改后的模型", modelConfig),
+				"400": errorResponse("配置无效"),
+				"404": errorResponse("不存在"),
+			}), modelConfig), modelParam),
+			"delete": withParams(withResponses(adminOp("deleteModel", "删除模型"), deleted), modelParam),
+		},
+		"/admin/endpoints": {
+			"get": withResponses(adminOp("listEndpoints", "列出端点"), map[string]openAPIResponse{"200": jsonResponse("端点列表", listOf(adminEndpoint))}),
+			"post": withBody(withResponses(adminOp("createEndpoint", "添加端点"), map[string]openAPIResponse{
+				"201": jsonResponse("已创建", adminEndpoint),
+				"400": errorResponse("配置无效"),
+				"409": errorResponse("端点名称已存在"),
+			}), endpointConfig),
+		},
+		"/admin/endpoints/{name}": {
+			"get": withParams(withResponses(adminOp("getEndpoint", "获取端点"), map[string]openAPIResponse{
+				"200": jsonResponse("端点", adminEndpoint),
+				"404": errorResponse("不存在"),
+			}), endpointParam),
+			"patch": withParams(withBody(withResponses(adminOp("updateEndpoint", "修改端点，只更新请求体中出现的字段"), map[string]openAPIResponse{
+				"200": jsonResponse("修改后的端点", adminEndpoint),
+				"400": errorResponse("配置无效"),
+				"404": errorResponse("不存在"),
+			}), endpointConfig), endpointParam),
+			"delete": withParams(withResponses(adminOp("deleteEndpoint", "删除端点"), deleted), endpointParam),
+		},
+		"/admin/endpoints/{name}/api_key": {
+			"put": withParams(withBody(withResponses(adminOp("setEndpointAPIKey", "设置端点的上游 Key"), map[string]openAPIResponse{
+				"200": jsonResponse("端点", adminEndpoint),
+				"400": errorResponse("缺少 api_key"),
+				"404": errorResponse("不存在"),
+			}), openAPISchema{
+				"type":       "object",
+				"properties": map[string]interface{}{"api_key": openAPISchema{"type": "string"}},
+				"required":   []string{"api_key"},
+			}), endpointParam),
+			"delete": withParams(withResponses(adminOp("clearEndpointAPIKey", "清除端点的上游 Key，改用 FACTORY_API_KEY"), map[string]openAPIResponse{
+				"200": jsonResponse("端点", adminEndpoint),
+				"404": errorResponse("不存在"),
+			}), endpointParam),
+		},
+		"/admin/clients": {
+			"get": withResponses(adminOp("listClients", "列出客户端"), map[string]openAPIResponse{"200": jsonResponse("客户端列表", listOf(adminClient))}),
+			"post": withBody(withResponses(adminOp("createClient", "添加客户端，未提供 key 时自动生成"), map[string]openAPIResponse{
+				"201": jsonResponse("已创建，完整 Key 只返回这一次", adminClient),
+				"400": errorResponse("配置无效"),
+				"409": errorResponse("客户端名称已存在"),
+			}), clientConfig),
+		},
+		"/admin/clients/{name}": {
+			"get": withParams(withResponses(adminOp("getClient", "获取客户端"), map[string]openAPIResponse{
+				"200": jsonResponse("客户端", adminClient),
+				"404": errorResponse("不存在"),
+			}), clientParam),
+			"patch": withParams(withBody(withResponses(adminOp("updateClient", "修改客户端，只更新请求体中出现的字段"), map[string]openAPIResponse{
+				"200": jsonResponse("修改后的客户端", adminClient),
+				"400": errorResponse("配置无效"),
+				"404": errorResponse("不存在"),
+			}), clientConfig), clientParam),
+			"delete": withParams(withResponses(adminOp("deleteClient", "删除客户端"), deleted), clientParam),
+		},
+		"/admin/clients/{name}/rotate": {
+			"post": withParams(withResponses(adminOp("rotateClientKey", "轮换客户端 Key"), map[string]openAPIResponse{
+				"200": jsonResponse("新 Key 只返回这一次", adminClient),
+				"404": errorResponse("不存在"),
+			}), clientParam),
+		},
+	}
+
+	doc := &openAPIDocument{
+		OpenAPI: openAPIVersion,
+		Info: openAPIInfo{
+			Title:       "Factory Go API",
+			Description: "OpenAI 兼容的多模型代理，支持 Claude、GPT 等模型的流式和非流式请求。",
+			Version:     "2.0",
+		},
+		Tags: []openAPITag{
+			{Name: "openai", Description: "OpenAI 兼容接口"},
+			{Name: "ollama", Description: "Ollama 兼容接口"},
+			{Name: "tokens", Description: "Token 计数"},
+			{Name: "system", Description: "健康检查与文档"},
+			{Name: "admin", Description: "管理 API，需要 ADMIN_API_KEY"},
+		},
+		Paths: paths,
+		Components: openAPIComponents{
+			Schemas: registry.schemas,
+			SecuritySchemes: map[string]openAPISecurityScheme{
+				securityProxyKey: {
+					Type:        "http",
+					Scheme:      "bearer",
+					Description: "PROXY_API_KEY 或 clients 中配置的客户端 Key；两者都未配置时无需认证",
+				},
+				securityAdminBearer: {Type: "http", Scheme: "bearer", Description: "ADMIN_API_KEY"},
+				securityAdminBasic:  {Type: "http", Scheme: "basic", Description: "用户名任意，密码为 ADMIN_API_KEY"},
+			},
+		},
+	}
+	if serverURL != "" {
+		doc.Servers = []openAPIServer{{URL: serverURL}}
+	}
+	return doc
+}
+
+// openAPIMethods 文档中操作的排列顺序
+var openAPIMethods = []string{"get", "post", "put", "patch", "delete"}
+
+// sortedPaths 按字母顺序返回文档中的路径
+func (d *openAPIDocument) sortedPaths() []string {
+	paths := make([]string, 0, len(d.Paths))
+	for path := range d.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// openapiHandler 返回 OpenAPI 文档
+func openapiHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(buildOpenAPISpec(requestServerURL(r))); err != nil {
+		log.Printf("错误: 编码响应失败: %v", err)
+	}
+}
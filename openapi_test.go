@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"factory-go-api/config"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// getOpenAPISpec 通过 openapiHandler 获取文档并解析为通用 JSON
+func getOpenAPISpec(t *testing.T) map[string]interface{} {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	openapiHandler(rr, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+	var spec map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	return spec
+}
+
+func TestOpenAPISpecCoversAllRoutes(t *testing.T) {
+	newTestUpstream(t)
+	spec := getOpenAPISpec(t)
+	if spec["openapi"] != openAPIVersion {
+		t.Errorf("openapi = %v", spec["openapi"])
+	}
+	if servers, _ := spec["servers"].([]interface{}); len(servers) != 1 || servers[0].(map[string]interface{})["url"] != "http://example.com" {
+		t.Errorf("servers = %v", spec["servers"])
+	}
+
+	paths := spec["paths"].(map[string]interface{})
+	for _, route := range routes() {
+		if strings.HasSuffix(route.pattern, "/") {
+			found := false
+			for path := range paths {
+				found = found || strings.HasPrefix(path, route.pattern)
+			}
+			if !found {
+				t.Errorf("no documented path under %s", route.pattern)
+			}
+		} else if paths[route.pattern] == nil {
+			t.Errorf("route %s is not documented", route.pattern)
+		}
+	}
+
+	// 所有 $ref 都必须指向已定义的 Schema
+	schemas := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	var checkRefs func(v interface{})
+	checkRefs = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if ref, ok := v["$ref"].(string); ok {
+				if schemas[strings.TrimPrefix(ref, "#/components/schemas/")] == nil {
+					t.Errorf("dangling $ref %s", ref)
+				}
+			}
+			for _, child := range v {
+				checkRefs(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				checkRefs(child)
+			}
+		}
+	}
+	checkRefs(spec)
+}
+
+func TestOpenAPISpecListsConfiguredModels(t *testing.T) {
+	newTestUpstream(t)
+	cfg := *config.GetConfig()
+	cfg.Models = append([]config.Model(nil), cfg.Models...)
+	cfg.Models[1].Disabled = true
+	config.SetConfig(&cfg)
+
+	schemas := getOpenAPISpec(t)["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	for _, name := range []string{"ChatCompletionRequest", "TokenCountRequest"} {
+		schema := schemas[name].(map[string]interface{})
+		model := schema["properties"].(map[string]interface{})["model"].(map[string]interface{})
+		enum, _ := json.Marshal(model["enum"])
+		if string(enum) != `["claude-test","gpt-test"]` {
+			t.Errorf("%s model enum = %s", name, enum)
+		}
+		required, _ := json.Marshal(schema["required"])
+		if string(required) != `["model","messages"]` {
+			t.Errorf("%s required = %s", name, required)
+		}
+	}
+	if schemas["ChatMessage"] == nil || schemas["ModelConfig"] == nil || schemas["AdminMetrics"] == nil || schemas["CircuitBreakerStatus"] == nil {
+		t.Error("referenced schemas were not generated")
+	}
+}
+
+func TestDocsRenderedFromSpecOutsideWorkingDirectory(t *testing.T) {
+	newTestUpstream(t)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	rr := httptest.NewRecorder()
+	docsHandler(rr, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+	body := rr.Body.String()
+	for _, want := range []string{
+		"<code>claude-test</code>",
+		"<code>/v1/chat/completions</code>",
+		"<code>/admin/clients/{name}/rotate</code>",
+		"curl -X POST http://example.com/v1/chat/completions",
+		`href="/openapi.json"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("docs page missing %q", want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package provider
+
+import (
+	"encoding/json"
+	"factory-go-api/config"
+	"factory-go-api/transformers"
+	"fmt"
+	"io"
+	"strings"
+)
+
+func init() {
+	Register("anthropic", anthropicProvider{})
+}
+
+// anthropicProvider Factory 的 Anthropic Messages 端点
+type anthropicProvider struct{}
+
+func (anthropicProvider) BuildRequest(req *Request) (interface{}, error) {
+	return transformers.TransformToAnthropic(req.OpenAI)
+}
+
+func (anthropicProvider) URL(endpoint *config.Endpoint, req *Request) string {
+	return endpoint.BaseURL
+}
+
+func (anthropicProvider) Headers(endpoint *config.Endpoint, req *Request) map[string]string {
+	return transformers.GetAnthropicHeaders(endpointAuth(endpoint, req.AuthHeader), req.ClientHeaders, req.OpenAI.Stream, req.Model.ID)
+}
+
+func (anthropicProvider) DecodeResponse(body []byte, req *Request) (interface{}, error) {
+	var anthropicResp map[string]interface{}
+	if err := json.Unmarshal(body, &anthropicResp); err != nil {
+		return nil, err
+	}
+	return newAnthropicTransformer(req).TransformNonStreamResponse(anthropicResp)
+}
+
+func (anthropicProvider) DecodeStream(body io.Reader, req *Request) <-chan string {
+	return newAnthropicTransformer(req).TransformStream(body)
+}
+
+func (anthropicProvider) EstimateTokens(req *Request, body interface{}) (int, error) {
+	anthropicReq, ok := body.(*transformers.AnthropicRequest)
+	if !ok {
+		return 0, errUnexpectedBody(body)
+	}
+	return transformers.EstimateAnthropicTokens(anthropicReq), nil
+}
+
+// CountTokensURL count_tokens 与 Messages 端点位于同一路径下
+func (anthropicProvider) CountTokensURL(endpoint *config.Endpoint) string {
+	return strings.TrimSuffix(endpoint.BaseURL, "/") + "/count_tokens"
+}
+
+func (anthropicProvider) BuildCountTokensRequest(req *Request, body interface{}) (interface{}, error) {
+	anthropicReq, ok := body.(*transformers.AnthropicRequest)
+	if !ok {
+		return nil, errUnexpectedBody(body)
+	}
+	return transformers.NewAnthropicCountTokensRequest(anthropicReq), nil
+}
+
+func (anthropicProvider) DecodeTokenCount(body []byte) (int, error) {
+	var result struct {
+		InputTokens *int `json:"input_tokens"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return 0, err
+	}
+	if result.InputTokens == nil {
+		return 0, fmt.Errorf("upstream response missing input_tokens")
+	}
+	return *result.InputTokens, nil
+}
+
+// newAnthropicTransformer 创建响应转换器，结构化输出时把工具调用还原为消息内容
+func newAnthropicTransformer(req *Request) *transformers.AnthropicResponseTransformer {
+	transformer := transformers.NewAnthropicResponseTransformer(req.Model.ID, "")
+	transformer.StructuredOutput = req.OpenAI.ResponseFormat.IsStructured()
+	transformer.IncludeUsage = req.OpenAI.StreamIncludeUsage()
+	return transformer
+}
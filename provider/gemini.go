@@ -0,0 +1,58 @@
+package provider
+
+import (
+	"encoding/json"
+	"factory-go-api/config"
+	"factory-go-api/transformers"
+	"io"
+	"net/url"
+	"strings"
+)
+
+func init() {
+	Register("gemini", geminiProvider{})
+}
+
+// geminiProvider Factory 的 Gemini generateContent 端点
+type geminiProvider struct{}
+
+func (geminiProvider) BuildRequest(req *Request) (interface{}, error) {
+	return transformers.TransformToGemini(req.OpenAI)
+}
+
+// URL base_url 为 API 版本前缀（如 .../v1beta），模型名和方法拼接在路径中，流式请求使用 SSE 格式
+func (geminiProvider) URL(endpoint *config.Endpoint, req *Request) string {
+	model := req.Model.UpstreamModel
+	if model == "" {
+		model = req.Model.ID
+	}
+	base := strings.TrimSuffix(endpoint.BaseURL, "/") + "/models/" + url.PathEscape(model)
+	if req.OpenAI.Stream {
+		return base + ":streamGenerateContent?alt=sse"
+	}
+	return base + ":generateContent"
+}
+
+func (geminiProvider) Headers(endpoint *config.Endpoint, req *Request) map[string]string {
+	return transformers.GetGeminiHeaders(endpointAuth(endpoint, req.AuthHeader), req.ClientHeaders, req.OpenAI.Stream)
+}
+
+func (geminiProvider) DecodeResponse(body []byte, req *Request) (interface{}, error) {
+	var geminiResp map[string]interface{}
+	if err := json.Unmarshal(body, &geminiResp); err != nil {
+		return nil, err
+	}
+	return transformers.NewGeminiResponseTransformer(req.Model.ID, "").TransformNonStreamResponse(geminiResp)
+}
+
+func (geminiProvider) DecodeStream(body io.Reader, req *Request) <-chan string {
+	return transformers.NewGeminiResponseTransformer(req.Model.ID, "").TransformStream(body)
+}
+
+func (geminiProvider) EstimateTokens(req *Request, body interface{}) (int, error) {
+	geminiReq, ok := body.(*transformers.GeminiRequest)
+	if !ok {
+		return 0, errUnexpectedBody(body)
+	}
+	return transformers.EstimateGeminiTokens(geminiReq), nil
+}
@@ -0,0 +1,47 @@
+package provider
+
+import (
+	"encoding/json"
+	"factory-go-api/config"
+	"factory-go-api/transformers"
+	"io"
+)
+
+func init() {
+	Register("openai", factoryOpenAIProvider{})
+}
+
+// factoryOpenAIProvider Factory 的 OpenAI Responses 端点
+type factoryOpenAIProvider struct{}
+
+func (factoryOpenAIProvider) BuildRequest(req *Request) (interface{}, error) {
+	return transformers.TransformToFactoryOpenAI(req.OpenAI)
+}
+
+func (factoryOpenAIProvider) URL(endpoint *config.Endpoint, req *Request) string {
+	return endpoint.BaseURL
+}
+
+func (factoryOpenAIProvider) Headers(endpoint *config.Endpoint, req *Request) map[string]string {
+	return transformers.GetFactoryOpenAIHeaders(endpointAuth(endpoint, req.AuthHeader), req.ClientHeaders)
+}
+
+func (factoryOpenAIProvider) DecodeResponse(body []byte, req *Request) (interface{}, error) {
+	var factoryResp map[string]interface{}
+	if err := json.Unmarshal(body, &factoryResp); err != nil {
+		return nil, err
+	}
+	return transformers.NewFactoryOpenAIResponseTransformer(req.Model.ID, "").TransformNonStreamResponse(factoryResp)
+}
+
+func (factoryOpenAIProvider) DecodeStream(body io.Reader, req *Request) <-chan string {
+	return transformers.NewFactoryOpenAIResponseTransformer(req.Model.ID, "").TransformStream(body)
+}
+
+func (factoryOpenAIProvider) EstimateTokens(req *Request, body interface{}) (int, error) {
+	factoryReq, ok := body.(*transformers.FactoryOpenAIRequest)
+	if !ok {
+		return 0, errUnexpectedBody(body)
+	}
+	return transformers.EstimateFactoryOpenAITokens(factoryReq), nil
+}
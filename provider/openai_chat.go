@@ -0,0 +1,55 @@
+package provider
+
+import (
+	"encoding/json"
+	"factory-go-api/config"
+	"factory-go-api/transformers"
+	"io"
+	"strings"
+)
+
+func init() {
+	Register("openai-chat", openAIChatProvider{})
+}
+
+// openAIChatProvider OpenAI Chat Completions 兼容的自建服务（vLLM、llama.cpp 等），请求和响应基本原样转发
+type openAIChatProvider struct{}
+
+func (openAIChatProvider) BuildRequest(req *Request) (interface{}, error) {
+	return transformers.TransformToOpenAIChat(req.OpenAI, req.Model.UpstreamModel)
+}
+
+// URL base_url 可以是完整的 /chat/completions 地址，也可以是 /v1 这样的前缀
+func (openAIChatProvider) URL(endpoint *config.Endpoint, req *Request) string {
+	if strings.HasSuffix(endpoint.BaseURL, "/chat/completions") {
+		return endpoint.BaseURL
+	}
+	return strings.TrimSuffix(endpoint.BaseURL, "/") + "/chat/completions"
+}
+
+// Headers 只使用端点自己的 api_key，不会把 FACTORY_API_KEY 发给第三方服务
+func (openAIChatProvider) Headers(endpoint *config.Endpoint, req *Request) map[string]string {
+	authHeader := ""
+	if endpoint.APIKey != "" {
+		authHeader = "Bearer " + endpoint.APIKey
+	}
+	return transformers.GetOpenAIChatHeaders(authHeader, req.OpenAI.Stream)
+}
+
+// DecodeResponse 保留上游的全部字段，只替换模型名
+func (openAIChatProvider) DecodeResponse(body []byte, req *Request) (interface{}, error) {
+	var chatResp map[string]interface{}
+	if err := json.Unmarshal(body, &chatResp); err != nil {
+		return nil, err
+	}
+	return transformers.NewOpenAIChatResponseTransformer(req.Model.ID).TransformNonStreamResponse(chatResp), nil
+}
+
+func (openAIChatProvider) DecodeStream(body io.Reader, req *Request) <-chan string {
+	return transformers.NewOpenAIChatResponseTransformer(req.Model.ID).TransformStream(body)
+}
+
+// EstimateTokens 上游请求体与客户端请求基本一致，直接按客户端请求估算
+func (openAIChatProvider) EstimateTokens(req *Request, body interface{}) (int, error) {
+	return transformers.EstimateOpenAIRequestTokens(req.OpenAI), nil
+}
@@ -0,0 +1,92 @@
+package provider
+
+import (
+	"factory-go-api/config"
+	"factory-go-api/transformers"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// Request 一次上游调用的上下文
+type Request struct {
+	OpenAI        *transformers.OpenAIRequest
+	Model         *config.Model
+	AuthHeader    string            // 客户端认证后使用的 Factory Authorization 头
+	ClientHeaders map[string]string // 需要转发给上游的客户端请求头
+}
+
+// Provider 一种上游类型的协议实现，HTTP 层只通过它转换请求和响应
+// 端点选择、重试、熔断、指标和响应缓存由调用方统一处理
+type Provider interface {
+	// BuildRequest 把 OpenAI 请求转换为上游请求体，返回的错误视为客户端请求错误
+	BuildRequest(req *Request) (interface{}, error)
+	// URL 返回端点接收请求的地址
+	URL(endpoint *config.Endpoint, req *Request) string
+	// Headers 返回发送到端点的请求头
+	Headers(endpoint *config.Endpoint, req *Request) map[string]string
+	// DecodeResponse 把上游非流式响应体转换为 OpenAI Chat Completions 响应
+	DecodeResponse(body []byte, req *Request) (interface{}, error)
+	// DecodeStream 把上游流式响应转换为 OpenAI SSE 块
+	DecodeStream(body io.Reader, req *Request) <-chan string
+	// EstimateTokens 本地估算 BuildRequest 返回的上游请求体 body 的输入 token 数
+	EstimateTokens(req *Request, body interface{}) (int, error)
+}
+
+// TokenCounter 上游提供 token 计数接口的 Provider 额外实现该接口
+type TokenCounter interface {
+	// CountTokensURL 返回端点的 token 计数地址
+	CountTokensURL(endpoint *config.Endpoint) string
+	// BuildCountTokensRequest 由 BuildRequest 返回的上游请求体 body 构造 token 计数请求体
+	BuildCountTokensRequest(req *Request, body interface{}) (interface{}, error)
+	// DecodeTokenCount 从计数响应中读取输入 token 数
+	DecodeTokenCount(body []byte) (int, error)
+}
+
+// errUnexpectedBody 传入的请求体不是该 Provider 的 BuildRequest 返回的类型
+func errUnexpectedBody(body interface{}) error {
+	return fmt.Errorf("provider: unexpected request body %T", body)
+}
+
+var (
+	mu        sync.RWMutex
+	providers = make(map[string]Provider)
+)
+
+// Register 注册模型类型对应的 Provider，重复注册同一类型会 panic
+func Register(modelType string, p Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, exists := providers[modelType]; exists {
+		panic(fmt.Sprintf("provider: 模型类型 %s 重复注册", modelType))
+	}
+	providers[modelType] = p
+}
+
+// Get 返回模型类型对应的 Provider，未注册时返回 nil
+func Get(modelType string) Provider {
+	mu.RLock()
+	defer mu.RUnlock()
+	return providers[modelType]
+}
+
+// Types 返回已注册的模型类型，按名称排序
+func Types() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	types := make([]string, 0, len(providers))
+	for modelType := range providers {
+		types = append(types, modelType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// endpointAuth 返回访问端点使用的 Authorization 头，端点配置了 api_key 时优先使用
+func endpointAuth(endpoint *config.Endpoint, authHeader string) string {
+	if endpoint.APIKey != "" {
+		return "Bearer " + endpoint.APIKey
+	}
+	return authHeader
+}
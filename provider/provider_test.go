@@ -0,0 +1,79 @@
+package provider
+
+import (
+	"factory-go-api/config"
+	"factory-go-api/transformers"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuiltinProvidersRegistered(t *testing.T) {
+	if types := Types(); !reflect.DeepEqual(types, []string{"anthropic", "gemini", "openai", "openai-chat"}) {
+		t.Errorf("Types() = %v", types)
+	}
+	if Get("unknown") != nil {
+		t.Error("Get(unknown) should be nil")
+	}
+}
+
+func TestRegisterDuplicatePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering anthropic twice should panic")
+		}
+	}()
+	Register("anthropic", anthropicProvider{})
+}
+
+func TestEndpointAuth(t *testing.T) {
+	req := &Request{
+		OpenAI:     &transformers.OpenAIRequest{Model: "m"},
+		Model:      &config.Model{ID: "m"},
+		AuthHeader: "Bearer factory-key",
+	}
+
+	// Factory 端点未配置 api_key 时使用客户端认证后的头
+	if auth := Get("anthropic").Headers(&config.Endpoint{}, req)["authorization"]; auth != "Bearer factory-key" {
+		t.Errorf("anthropic authorization = %q", auth)
+	}
+	if auth := Get("openai").Headers(&config.Endpoint{APIKey: "own"}, req)["authorization"]; auth != "Bearer own" {
+		t.Errorf("openai authorization = %q", auth)
+	}
+	// 自建服务从不使用 Factory 的认证头
+	if auth, ok := Get("openai-chat").Headers(&config.Endpoint{}, req)["authorization"]; ok {
+		t.Errorf("openai-chat authorization = %q", auth)
+	}
+}
+
+func TestOpenAIChatURL(t *testing.T) {
+	p := Get("openai-chat")
+	for baseURL, want := range map[string]string{
+		"http://localhost:8000/v1":                  "http://localhost:8000/v1/chat/completions",
+		"http://localhost:8000/v1/":                 "http://localhost:8000/v1/chat/completions",
+		"http://localhost:8000/v1/chat/completions": "http://localhost:8000/v1/chat/completions",
+	} {
+		if got := p.URL(&config.Endpoint{BaseURL: baseURL}, nil); got != want {
+			t.Errorf("URL(%s) = %s", baseURL, got)
+		}
+	}
+}
+
+func TestAnthropicTokenCounter(t *testing.T) {
+	counter, ok := Get("anthropic").(TokenCounter)
+	if !ok {
+		t.Fatal("anthropic provider should implement TokenCounter")
+	}
+	if _, ok := Get("openai").(TokenCounter); ok {
+		t.Error("openai provider should not implement TokenCounter")
+	}
+	if url := counter.CountTokensURL(&config.Endpoint{BaseURL: "https://api/v1/messages/"}); url != "https://api/v1/messages/count_tokens" {
+		t.Errorf("CountTokensURL = %s", url)
+	}
+	if n, err := counter.DecodeTokenCount([]byte(`{"input_tokens":42}`)); err != nil || n != 42 {
+		t.Errorf("DecodeTokenCount = %d, %v", n, err)
+	}
+	if _, err := counter.DecodeTokenCount([]byte(`{}`)); err == nil || !strings.Contains(err.Error(), "input_tokens") {
+		t.Errorf("missing input_tokens err = %v", err)
+	}
+}
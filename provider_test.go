@@ -0,0 +1,62 @@
+package main
+
+import (
+	"factory-go-api/config"
+	"factory-go-api/mockupstream"
+	"factory-go-api/provider"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// taggingProvider 在 openai-chat 的基础上给上游请求加一个请求头，用于验证新类型无需修改 HTTP 层
+type taggingProvider struct {
+	provider.Provider
+}
+
+func (p taggingProvider) Headers(endpoint *config.Endpoint, req *provider.Request) map[string]string {
+	headers := p.Provider.Headers(endpoint, req)
+	headers["x-test-provider"] = req.Model.ID
+	return headers
+}
+
+var registerTaggingProvider sync.Once
+
+func TestRegisteredProviderIsDispatched(t *testing.T) {
+	registerTaggingProvider.Do(func() {
+		provider.Register("tagging-test", taggingProvider{provider.Get("openai-chat")})
+	})
+	upstream := newTestUpstream(t)
+	withOpenAIChatModel(t, upstream, "vllm-key")
+	cfg := *config.GetConfig()
+	cfg.Models = append(append([]config.Model(nil), cfg.Models...), config.Model{ID: "tagged", Type: "tagging-test", Endpoint: "vllm"})
+	config.SetConfig(&cfg)
+
+	upstream.Enqueue(mockupstream.Reply{Text: "Tagged"})
+	resp := decodeChat(t, postChat(t, `{"model":"tagged","messages":[{"role":"user","content":"Hello"}]}`))
+	if resp.Model != "tagged" || resp.Choices[0].Message.Content != "Tagged" {
+		t.Errorf("response = %+v", resp)
+	}
+	if req, _ := upstream.LastRequest(); req.Header.Get("X-Test-Provider") != "tagged" {
+		t.Errorf("headers = %v", req.Header)
+	}
+	if err := validateModelType(&config.Model{Type: "tagging-test"}); err != nil {
+		t.Errorf("validateModelType: %v", err)
+	}
+}
+
+func TestStreamForwardsUpstreamError(t *testing.T) {
+	upstream := newTestUpstream(t)
+
+	// 所有类型的流式请求在上游返回错误时都原样转发，而不是返回空的 SSE 流
+	upstream.Enqueue(
+		mockupstream.Reply{Status: http.StatusTooManyRequests, ErrorMessage: "slow down"},
+		mockupstream.Reply{Status: http.StatusTooManyRequests, ErrorMessage: "slow down"},
+	)
+	for _, model := range []string{"claude-test", "gpt-test"} {
+		rr := postChat(t, `{"model":"`+model+`","stream":true,"messages":[{"role":"user","content":"Hello"}]}`)
+		if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("%s status = %d, content-type = %q, body = %s", model, rr.Code, rr.Header().Get("Content-Type"), rr.Body.String())
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package recorder
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Recording 一次上游请求/响应的录制内容，每条录制保存为一个 JSON 文件
+type Recording struct {
+	RecordedAt time.Time        `json:"recorded_at"`
+	Request    RecordedRequest  `json:"request"`
+	Response   RecordedResponse `json:"response"`
+}
+
+// RecordedRequest 录制的上游请求，敏感请求头不会被保存
+type RecordedRequest struct {
+	Method string          `json:"method"`
+	URL    string          `json:"url"`
+	Header http.Header     `json:"header"`
+	Body   json.RawMessage `json:"body"`
+}
+
+// RecordedResponse 录制的上游响应，响应体按读取到的原始分块保存
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Chunks     []Chunk     `json:"chunks"`
+}
+
+// Chunk 响应体分块，OffsetMS 为距离收到响应头的毫秒数，用于按原始节奏回放 SSE
+type Chunk struct {
+	OffsetMS int64  `json:"offset_ms"`
+	Data     string `json:"data"`
+}
+
+// redactedHeaders 录制时不保存的请求头
+var redactedHeaders = []string{"Authorization", "X-Api-Key", "Proxy-Authorization", "Cookie"}
+
+// redactHeader 复制请求头并移除认证信息
+func redactHeader(header http.Header) http.Header {
+	clone := header.Clone()
+	for _, name := range redactedHeaders {
+		clone.Del(name)
+	}
+	return clone
+}
+
+// rawBody 将请求体转换为可嵌入 JSON 的形式，非 JSON 请求体按字符串保存
+func rawBody(body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return json.RawMessage("null")
+	}
+	if json.Valid(body) {
+		return json.RawMessage(body)
+	}
+	quoted, _ := json.Marshal(string(body))
+	return quoted
+}
+
+// canonicalBody 规范化 JSON 请求体（按 key 排序），使字段顺序不影响匹配
+func canonicalBody(body []byte) []byte {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return body
+	}
+	canonical, err := json.Marshal(v)
+	if err != nil {
+		return body
+	}
+	return canonical
+}
+
+// matchKey 按匹配策略计算请求的 key
+func matchKey(match, method, url string, body []byte) string {
+	hash := sha256.New()
+	switch match {
+	case MatchSequence:
+		return ""
+	case MatchBody:
+		hash.Write(canonicalBody(body))
+	default:
+		hash.Write([]byte(method + "\n" + url + "\n"))
+		hash.Write(canonicalBody(body))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// body 返回录制请求体的原始字节
+func (r *RecordedRequest) body() []byte {
+	if string(r.Body) == "null" {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(r.Body, &s); err == nil {
+		return []byte(s)
+	}
+	return r.Body
+}
+
+// saveRecording 写入录制文件，先写临时文件再重命名，避免回放时读到半个文件
+func saveRecording(dir string, seq int64, rec *Recording) error {
+	key := matchKey(MatchExact, rec.Request.Method, rec.Request.URL, rec.Request.body())
+	name := fmt.Sprintf("%s-%04d-%s.json", rec.RecordedAt.Format("20060102T150405"), seq, key[:12])
+
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化录制失败: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, ".recording-*")
+	if err != nil {
+		return fmt.Errorf("创建录制文件失败: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("写入录制文件失败: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("写入录制文件失败: %w", err)
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, name))
+}
+
+// loadRecordings 读取目录下的所有录制，按录制时间排序
+func loadRecordings(dir string) ([]*Recording, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取录制目录失败: %w", err)
+	}
+
+	var recordings []*Recording
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("读取录制文件 %s 失败: %w", entry.Name(), err)
+		}
+		var rec Recording
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return nil, fmt.Errorf("解析录制文件 %s 失败: %w", entry.Name(), err)
+		}
+		recordings = append(recordings, &rec)
+	}
+
+	sort.SliceStable(recordings, func(i, j int) bool {
+		return recordings[i].RecordedAt.Before(recordings[j].RecordedAt)
+	})
+	return recordings, nil
+}
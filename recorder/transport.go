@@ -0,0 +1,273 @@
+package recorder
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 录制/回放模式
+const (
+	ModeOff    = "off"
+	ModeRecord = "record" // 转发到上游并保存请求/响应
+	ModeReplay = "replay" // 从录制目录回放，不访问上游
+)
+
+// 回放匹配策略
+const (
+	MatchExact    = "exact"    // 方法 + URL + 请求体（默认）
+	MatchBody     = "body"     // 只比较请求体，忽略上游地址
+	MatchSequence = "sequence" // 忽略请求内容，按录制顺序依次回放
+)
+
+// Options 录制/回放选项
+type Options struct {
+	Mode  string
+	Dir   string
+	Match string
+	// Strict 回放时未匹配的请求直接失败，否则转发到真实上游
+	Strict bool
+	// Realtime 回放时按录制的时间间隔输出响应体
+	Realtime bool
+}
+
+// Transport 包装上游 RoundTripper，实现请求录制与回放
+type Transport struct {
+	opts Options
+	next http.RoundTripper
+	seq  int64
+
+	mu         sync.Mutex
+	recordings map[string][]*Recording
+	cursors    map[string]int
+}
+
+// NewTransport 创建录制/回放 Transport，回放模式会在创建时加载录制目录
+// 只通过 Wrap 使用时 next 可以为 nil
+func NewTransport(opts Options, next http.RoundTripper) (*Transport, error) {
+	if opts.Match == "" {
+		opts.Match = MatchExact
+	}
+	switch opts.Match {
+	case MatchExact, MatchBody, MatchSequence:
+	default:
+		return nil, fmt.Errorf("未知的匹配策略: %s", opts.Match)
+	}
+
+	t := &Transport{opts: opts, next: next}
+	switch opts.Mode {
+	case ModeRecord:
+		if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+			return nil, fmt.Errorf("创建录制目录失败: %w", err)
+		}
+	case ModeReplay:
+		recordings, err := loadRecordings(opts.Dir)
+		if err != nil {
+			return nil, err
+		}
+		t.recordings = make(map[string][]*Recording)
+		t.cursors = make(map[string]int)
+		for _, rec := range recordings {
+			key := matchKey(opts.Match, rec.Request.Method, rec.Request.URL, rec.Request.body())
+			t.recordings[key] = append(t.recordings[key], rec)
+		}
+	default:
+		return nil, fmt.Errorf("未知的录制模式: %s", opts.Mode)
+	}
+	return t, nil
+}
+
+// Len 回放模式下已加载的录制数量
+func (t *Transport) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	count := 0
+	for _, list := range t.recordings {
+		count += len(list)
+	}
+	return count
+}
+
+// RoundTrip 实现 http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.roundTrip(req, t.next)
+}
+
+// Wrap 返回使用 next 访问上游的 RoundTripper，录制和回放状态与 t 共享
+// 用于每个端点使用各自连接池的场景
+func (t *Transport) Wrap(next http.RoundTripper) http.RoundTripper {
+	return wrappedTransport{t: t, next: next}
+}
+
+// wrappedTransport 使用指定 next 的录制/回放 Transport
+type wrappedTransport struct {
+	t    *Transport
+	next http.RoundTripper
+}
+
+func (w wrappedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return w.t.roundTrip(req, w.next)
+}
+
+// roundTrip 录制或回放一次请求，未回放的请求通过 next 发送
+func (t *Transport) roundTrip(req *http.Request, next http.RoundTripper) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	if t.opts.Mode == ModeReplay {
+		if rec := t.lookup(req.Method, req.URL.String(), body); rec != nil {
+			return t.replay(req, rec), nil
+		}
+		if t.opts.Strict {
+			return nil, fmt.Errorf("回放: 没有匹配的录制 (%s %s)", req.Method, req.URL)
+		}
+		log.Printf("⚠️  回放: 没有匹配的录制，转发到上游 %s", req.URL)
+		return next.RoundTrip(req)
+	}
+
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	rec := &Recording{
+		RecordedAt: time.Now().UTC(),
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: redactHeader(req.Header),
+			Body:   rawBody(body),
+		},
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header.Clone(),
+		},
+	}
+	resp.Body = &recordingBody{
+		ReadCloser: resp.Body,
+		start:      time.Now(),
+		rec:        rec,
+		save: func(rec *Recording) {
+			if err := saveRecording(t.opts.Dir, atomic.AddInt64(&t.seq, 1), rec); err != nil {
+				log.Printf("警告: 保存录制失败: %v", err)
+			}
+		},
+	}
+	return resp, nil
+}
+
+// lookup 查找匹配的录制；同一 key 有多条录制时按顺序回放，用完后重复最后一条
+func (t *Transport) lookup(method, url string, body []byte) *Recording {
+	key := matchKey(t.opts.Match, method, url, body)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	list := t.recordings[key]
+	if len(list) == 0 {
+		return nil
+	}
+	index := t.cursors[key]
+	if index >= len(list) {
+		index = len(list) - 1
+	} else {
+		t.cursors[key]++
+	}
+	return list[index]
+}
+
+// replay 根据录制构造响应
+func (t *Transport) replay(req *http.Request, rec *Recording) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", rec.Response.StatusCode, http.StatusText(rec.Response.StatusCode)),
+		StatusCode:    rec.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        rec.Response.Header.Clone(),
+		Body:          &replayBody{chunks: rec.Response.Chunks, realtime: t.opts.Realtime, start: time.Now(), done: req.Context().Done()},
+		ContentLength: -1,
+		Request:       req,
+	}
+}
+
+// recordingBody 在读取上游响应体的同时按分块记录，读完或关闭时保存录制
+type recordingBody struct {
+	io.ReadCloser
+	start time.Time
+	rec   *Recording
+	save  func(*Recording)
+	once  sync.Once
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.rec.Response.Chunks = append(b.rec.Response.Chunks, Chunk{
+			OffsetMS: time.Since(b.start).Milliseconds(),
+			Data:     string(p[:n]),
+		})
+	}
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.finish()
+	return err
+}
+
+func (b *recordingBody) finish() {
+	b.once.Do(func() { b.save(b.rec) })
+}
+
+// replayBody 按录制的分块回放响应体，Realtime 时按原始时间间隔输出
+type replayBody struct {
+	chunks   []Chunk
+	realtime bool
+	start    time.Time
+	done     <-chan struct{}
+	pending  strings.Reader
+	index    int
+}
+
+func (b *replayBody) Read(p []byte) (int, error) {
+	for b.pending.Len() == 0 {
+		if b.index >= len(b.chunks) {
+			return 0, io.EOF
+		}
+		chunk := b.chunks[b.index]
+		b.index++
+		if b.realtime {
+			if wait := time.Until(b.start.Add(time.Duration(chunk.OffsetMS) * time.Millisecond)); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+				case <-b.done:
+					timer.Stop()
+					return 0, io.ErrUnexpectedEOF
+				}
+			}
+		}
+		b.pending.Reset(chunk.Data)
+	}
+	return b.pending.Read(p)
+}
+
+func (b *replayBody) Close() error { return nil }
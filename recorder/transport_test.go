@@ -0,0 +1,140 @@
+package recorder
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func doPost(t *testing.T, client *http.Client, url, body string) (int, string, error) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(data), nil
+}
+
+func record(t *testing.T, dir string, bodies ...string) string {
+	t.Helper()
+	count := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "data: {\"n\":"+strconv.Itoa(count)+"}\n\n")
+		w.(http.Flusher).Flush()
+		_, _ = io.WriteString(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(upstream.Close)
+
+	transport, err := NewTransport(Options{Mode: ModeRecord, Dir: dir}, http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: transport}
+	for _, body := range bodies {
+		if _, _, err := doPost(t, client, upstream.URL, body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return upstream.URL
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	url := record(t, dir, `{"model":"m","a":1}`, `{"model":"m","a":2}`)
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 recordings, got %d", len(entries))
+	}
+	data, _ := os.ReadFile(dir + "/" + entries[0].Name())
+	if strings.Contains(string(data), "secret") {
+		t.Error("recording must not contain the Authorization header")
+	}
+
+	transport, err := NewTransport(Options{Mode: ModeReplay, Dir: dir, Strict: true}, http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: transport}
+
+	// 字段顺序不同也能匹配
+	status, body, err := doPost(t, client, url, `{"a":2,"model":"m"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != http.StatusOK || body != "data: {\"n\":2}\n\ndata: [DONE]\n\n" {
+		t.Errorf("replay = %d %q", status, body)
+	}
+
+	if _, _, err := doPost(t, client, url, `{"model":"other"}`); err == nil {
+		t.Error("strict replay should fail for unmatched requests")
+	}
+}
+
+func TestReplayMatchStrategies(t *testing.T) {
+	dir := t.TempDir()
+	record(t, dir, `{"q":"x"}`, `{"q":"y"}`)
+
+	transport, err := NewTransport(Options{Mode: ModeReplay, Dir: dir, Match: MatchBody, Strict: true}, http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: transport}
+	if _, body, err := doPost(t, client, "http://other.invalid/v1", `{"q":"x"}`); err != nil || !strings.Contains(body, `"n":1`) {
+		t.Errorf("body match ignoring URL = %q, %v", body, err)
+	}
+
+	transport, err = NewTransport(Options{Mode: ModeReplay, Dir: dir, Match: MatchSequence, Strict: true}, http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = &http.Client{Transport: transport}
+	for i, want := range []string{`"n":1`, `"n":2`, `"n":2`} {
+		if _, body, err := doPost(t, client, "http://other.invalid/v1", `{}`); err != nil || !strings.Contains(body, want) {
+			t.Errorf("sequence replay #%d = %q, %v; want %s", i, body, err, want)
+		}
+	}
+}
+
+func TestNewTransportRejectsUnknownOptions(t *testing.T) {
+	if _, err := NewTransport(Options{Mode: "tape", Dir: t.TempDir()}, http.DefaultTransport); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+	if _, err := NewTransport(Options{Mode: ModeRecord, Dir: t.TempDir(), Match: "fuzzy"}, http.DefaultTransport); err == nil {
+		t.Error("expected error for unknown match strategy")
+	}
+}
+
+func TestWrapSharesRecordings(t *testing.T) {
+	dir := t.TempDir()
+	url := record(t, dir, `{"model":"m"}`)
+
+	// 回放状态由所有 Wrap 出的 Transport 共享，未匹配的请求使用各自的 next
+	transport, err := NewTransport(Options{Mode: ModeReplay, Dir: dir, Match: MatchSequence}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: transport.Wrap(http.DefaultTransport)}
+	if _, body, err := doPost(t, client, url, `{"model":"m"}`); err != nil || !strings.Contains(body, `"n":1`) {
+		t.Errorf("wrapped replay = %q, %v", body, err)
+	}
+	if transport.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", transport.Len())
+	}
+}
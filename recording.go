@@ -0,0 +1,45 @@
+package main
+
+import (
+	"factory-go-api/config"
+	"factory-go-api/recorder"
+	"log"
+)
+
+// recordingConfig 返回生效的录制配置
+// 环境变量 RECORDING_MODE 可覆盖配置文件中的录制模式，便于在 CI 中切换到回放
+// 覆盖的是副本，通过管理 API 写回配置文件时不会写入环境变量的值
+func recordingConfig(cfg *config.Config) config.RecordingConfig {
+	recordingCfg := cfg.Recording
+	if mode := getEnv("RECORDING_MODE", ""); mode != "" {
+		recordingCfg.Mode = mode
+	}
+	return recordingCfg
+}
+
+// initRecording 根据配置启用上游请求录制或回放
+func initRecording(cfg config.RecordingConfig) error {
+	if cfg.Mode == "" || cfg.Mode == recorder.ModeOff {
+		setUpstreamRecorder(nil)
+		return nil
+	}
+
+	transport, err := recorder.NewTransport(recorder.Options{
+		Mode:     cfg.Mode,
+		Dir:      cfg.Dir,
+		Match:    cfg.Match,
+		Strict:   cfg.Strict,
+		Realtime: cfg.Realtime,
+	}, nil)
+	if err != nil {
+		return err
+	}
+	setUpstreamRecorder(transport)
+
+	if cfg.Mode == recorder.ModeReplay {
+		log.Printf("📼 回放模式: 从 %s 加载 %d 条录制 (匹配: %s, 严格: %v)", cfg.Dir, transport.Len(), cfg.Match, cfg.Strict)
+	} else {
+		log.Printf("📼 录制模式: 上游请求/响应保存到 %s", cfg.Dir)
+	}
+	return nil
+}
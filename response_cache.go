@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"factory-go-api/cache"
+	"factory-go-api/config"
+	"factory-go-api/transformers"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// responseCache 全局响应缓存，未启用时为 nil
+var responseCache cache.Backend
+
+// responseCacheTTL 缓存有效期
+var responseCacheTTL time.Duration
+
+// responseCacheNondeterministic 为 true 时缓存所有请求，否则只缓存确定性请求
+var responseCacheNondeterministic bool
+
+// responseCacheMutex 保护以上缓存状态，重新加载配置时会替换它们
+var responseCacheMutex sync.RWMutex
+
+// cacheBypassKey 请求上下文中禁用缓存的标记
+type cacheBypassKey struct{}
+
+// initResponseCache 根据配置初始化响应缓存
+func initResponseCache(cfg config.ResponseCacheConfig) error {
+	var backend cache.Backend
+	if cfg.Enabled {
+		switch cfg.Backend {
+		case "", "memory":
+			backend = cache.NewMemoryLRU(cfg.MaxEntries)
+		case "disk":
+			disk, err := cache.NewDisk(cfg.Dir)
+			if err != nil {
+				return err
+			}
+			backend = disk
+		default:
+			return fmt.Errorf("未知的 response_cache.backend: %s", cfg.Backend)
+		}
+	}
+
+	responseCacheMutex.Lock()
+	defer responseCacheMutex.Unlock()
+	responseCache = backend
+	responseCacheTTL = time.Duration(cfg.TTLSeconds) * time.Second
+	responseCacheNondeterministic = cfg.CacheNondeterministic
+	return nil
+}
+
+// currentResponseCache 返回当前的响应缓存、有效期及是否缓存非确定性请求
+func currentResponseCache() (cache.Backend, time.Duration, bool) {
+	responseCacheMutex.RLock()
+	defer responseCacheMutex.RUnlock()
+	return responseCache, responseCacheTTL, responseCacheNondeterministic
+}
+
+// isDeterministicRequest 判断请求的输出是否可复现：temperature 为 0 或指定了 seed
+// 其他请求每次采样结果不同，缓存后所有相同请求都会得到同一个结果
+func isDeterministicRequest(req *transformers.OpenAIRequest) bool {
+	return (req.Temperature != nil && *req.Temperature == 0) || req.Seed != nil
+}
+
+// withoutResponseCache 标记请求不使用响应缓存（如 n>1 时每次调用都需要真实结果）
+func withoutResponseCache(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), cacheBypassKey{}, true))
+}
+
+// responseCacheKey 计算缓存 key：上游（端点类型）+ 规范化后的上游请求体的 SHA-256
+// 使用端点类型而不是具体地址，同一类型的多个端点共享缓存
+// 去掉 stream 字段，使流式和非流式请求共享同一缓存条目
+func responseCacheKey(upstream string, reqBody []byte) (string, bool) {
+	var body map[string]interface{}
+	if err := json.Unmarshal(reqBody, &body); err != nil {
+		return "", false
+	}
+	delete(body, "stream")
+
+	// encoding/json 按 key 排序序列化 map，得到规范化的请求体
+	canonical, err := json.Marshal(body)
+	if err != nil {
+		return "", false
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(upstream))
+	hash.Write([]byte{'\n'})
+	hash.Write(canonical)
+	return hex.EncodeToString(hash.Sum(nil)), true
+}
+
+// cacheDirectives 解析客户端 Cache-Control 头
+// no-cache 跳过读取缓存但仍会写入新结果，no-store 既不读取也不写入
+func cacheDirectives(r *http.Request) (noCache, noStore bool) {
+	for _, directive := range strings.Split(strings.ToLower(r.Header.Get("Cache-Control")), ",") {
+		switch strings.TrimSpace(directive) {
+		case "no-cache":
+			noCache = true
+		case "no-store":
+			noCache = true
+			noStore = true
+		}
+	}
+	return noCache, noStore
+}
+
+// serveWithResponseCache 使用响应缓存包装上游请求
+// 命中时直接回放缓存结果；未命中时调用 fetch 并捕获最终输出写入缓存
+// 未开启 cache_nondeterministic 时，非确定性请求直接调用 fetch
+func serveWithResponseCache(w http.ResponseWriter, r *http.Request, openaiReq *transformers.OpenAIRequest, upstream string, reqBody []byte, fetch func(w http.ResponseWriter)) {
+	backend, ttl, nondeterministic := currentResponseCache()
+	if backend == nil || r.Context().Value(cacheBypassKey{}) != nil || !(nondeterministic || isDeterministicRequest(openaiReq)) {
+		fetch(w)
+		return
+	}
+
+	key, ok := responseCacheKey(upstream, reqBody)
+	if !ok {
+		fetch(w)
+		return
+	}
+
+	noCache, noStore := cacheDirectives(r)
+	if !noCache {
+		if data, hit := backend.Get(key); hit {
+			var cached transformers.OpenAIResponse
+			if err := json.Unmarshal(data, &cached); err == nil {
+				log.Printf("💾 响应缓存命中: %s", key[:12])
+				w.Header().Set("X-Cache", "HIT")
+				replayCachedResponse(w, &cached, openaiReq.Stream, openaiReq.StreamIncludeUsage())
+				return
+			}
+			backend.Delete(key)
+		}
+	}
+
+	if noCache {
+		w.Header().Set("X-Cache", "BYPASS")
+	} else {
+		w.Header().Set("X-Cache", "MISS")
+	}
+	if noStore {
+		fetch(w)
+		return
+	}
+
+	capture := &captureResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+	fetch(capture)
+
+	if capture.statusCode != http.StatusOK {
+		return
+	}
+	var resp *transformers.OpenAIResponse
+	if openaiReq.Stream {
+		resp = assembleStreamResponse(capture.body.Bytes())
+	} else {
+		resp = &transformers.OpenAIResponse{}
+		if err := json.Unmarshal(capture.body.Bytes(), resp); err != nil {
+			resp = nil
+		}
+	}
+	if resp == nil || len(resp.Choices) == 0 {
+		return
+	}
+	// 未正常结束的流（如上游中途出错）不写入缓存
+	for _, choice := range resp.Choices {
+		if choice.FinishReason == nil {
+			return
+		}
+	}
+	if data, err := json.Marshal(resp); err == nil {
+		backend.Set(key, data, ttl)
+	}
+}
+
+// captureResponseWriter 在写出响应的同时保留一份副本
+type captureResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (c *captureResponseWriter) WriteHeader(code int) {
+	c.statusCode = code
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *captureResponseWriter) Write(p []byte) (int, error) {
+	c.body.Write(p)
+	return c.ResponseWriter.Write(p)
+}
+
+func (c *captureResponseWriter) Flush() {
+	if flusher, ok := c.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// assembleStreamResponse 将转换后的 OpenAI SSE 流拼接为完整响应
+func assembleStreamResponse(stream []byte) *transformers.OpenAIResponse {
+	var resp *transformers.OpenAIResponse
+	choices := map[int]*transformers.OpenAIChoice{}
+	toolCalls := map[int]map[int]int{} // choice index -> tool_call index -> Message.ToolCalls 下标
+	var order []int
+
+	for _, line := range strings.Split(string(stream), "\n") {
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		dataStr := strings.TrimPrefix(line, "data: ")
+		if strings.TrimSpace(dataStr) == "[DONE]" {
+			continue
+		}
+
+		var chunk transformers.OpenAIResponse
+		if err := json.Unmarshal([]byte(dataStr), &chunk); err != nil {
+			continue
+		}
+		if resp == nil {
+			resp = &transformers.OpenAIResponse{
+				ID:      chunk.ID,
+				Object:  "chat.completion",
+				Created: chunk.Created,
+				Model:   chunk.Model,
+			}
+		}
+		if chunk.Usage != nil {
+			resp.Usage = chunk.Usage
+		}
+
+		for _, delta := range chunk.Choices {
+			choice, ok := choices[delta.Index]
+			if !ok {
+				choice = &transformers.OpenAIChoice{
+					Index:   delta.Index,
+					Message: &transformers.OpenAIMessageResponse{Role: "assistant"},
+				}
+				choices[delta.Index] = choice
+				order = append(order, delta.Index)
+			}
+			if delta.Delta != nil {
+				choice.Message.Content += delta.Delta.Content
+				if toolCalls[delta.Index] == nil {
+					toolCalls[delta.Index] = map[int]int{}
+				}
+				mergeToolCallDeltas(choice.Message, toolCalls[delta.Index], delta.Delta.ToolCalls)
+			}
+			if delta.FinishReason != nil {
+				choice.FinishReason = delta.FinishReason
+			}
+		}
+	}
+
+	if resp == nil {
+		return nil
+	}
+	for _, index := range order {
+		// 完整响应中的 tool_calls 不带 index
+		for i := range choices[index].Message.ToolCalls {
+			choices[index].Message.ToolCalls[i].Index = nil
+		}
+		resp.Choices = append(resp.Choices, *choices[index])
+	}
+	return resp
+}
+
+// mergeToolCallDeltas 按 index 合并流式 tool_calls 增量：首个增量带 id 和函数名，后续增量追加 arguments
+func mergeToolCallDeltas(message *transformers.OpenAIMessageResponse, positions map[int]int, deltas []transformers.OpenAIToolCall) {
+	for i, delta := range deltas {
+		index := i
+		if delta.Index != nil {
+			index = *delta.Index
+		}
+		pos, ok := positions[index]
+		if !ok {
+			positions[index] = len(message.ToolCalls)
+			message.ToolCalls = append(message.ToolCalls, delta)
+			continue
+		}
+		call := &message.ToolCalls[pos]
+		if delta.ID != "" {
+			call.ID = delta.ID
+		}
+		if delta.Type != "" {
+			call.Type = delta.Type
+		}
+		if delta.Function.Name != "" {
+			call.Function.Name = delta.Function.Name
+		}
+		call.Function.Arguments += delta.Function.Arguments
+	}
+}
+
+// replayCachedResponse 回放缓存结果：非流式直接返回 JSON，流式合成 SSE
+// includeUsage 为 true 时在流式结束前追加缓存的 usage
+func replayCachedResponse(w http.ResponseWriter, cached *transformers.OpenAIResponse, stream, includeUsage bool) {
+	if !stream {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(cached); err != nil {
+			log.Printf("错误: 编码响应失败: %v", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	chunks := synthesizeStreamChunks(cached)
+	if includeUsage && cached.Usage != nil {
+		usageChunk, _ := json.Marshal(transformers.OpenAIResponse{
+			ID:      cached.ID,
+			Object:  "chat.completion.chunk",
+			Created: cached.Created,
+			Model:   cached.Model,
+			Choices: []transformers.OpenAIChoice{},
+			Usage:   cached.Usage,
+		})
+		// usage 块位于 [DONE] 之前
+		done := chunks[len(chunks)-1]
+		chunks = append(chunks[:len(chunks)-1], fmt.Sprintf("data: %s\n\n", usageChunk), done)
+	}
+	for _, chunk := range chunks {
+		if _, err := fmt.Fprint(w, chunk); err != nil {
+			log.Printf("错误: 写入流式响应失败: %v", err)
+			return
+		}
+	}
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// synthesizeStreamChunks 根据完整响应合成 SSE 块：每个 choice 依次输出 role、content、tool_calls、finish_reason
+func synthesizeStreamChunks(resp *transformers.OpenAIResponse) []string {
+	newChunk := func(choice transformers.OpenAIChoice) string {
+		chunk := transformers.OpenAIResponse{
+			ID:      resp.ID,
+			Object:  "chat.completion.chunk",
+			Created: resp.Created,
+			Model:   resp.Model,
+			Choices: []transformers.OpenAIChoice{choice},
+		}
+		jsonData, _ := json.Marshal(chunk)
+		return fmt.Sprintf("data: %s\n\n", string(jsonData))
+	}
+
+	var chunks []string
+	for _, choice := range resp.Choices {
+		content := ""
+		var toolCalls []transformers.OpenAIToolCall
+		if choice.Message != nil {
+			content = choice.Message.Content
+			for i, call := range choice.Message.ToolCalls {
+				index := i
+				call.Index = &index
+				toolCalls = append(toolCalls, call)
+			}
+		}
+		chunks = append(chunks, newChunk(transformers.OpenAIChoice{
+			Index: choice.Index,
+			Delta: &transformers.OpenAIMessageResponse{Role: "assistant"},
+		}))
+		if content != "" {
+			chunks = append(chunks, newChunk(transformers.OpenAIChoice{
+				Index: choice.Index,
+				Delta: &transformers.OpenAIMessageResponse{Content: content},
+			}))
+		}
+		if len(toolCalls) > 0 {
+			chunks = append(chunks, newChunk(transformers.OpenAIChoice{
+				Index: choice.Index,
+				Delta: &transformers.OpenAIMessageResponse{ToolCalls: toolCalls},
+			}))
+		}
+		chunks = append(chunks, newChunk(transformers.OpenAIChoice{
+			Index:        choice.Index,
+			Delta:        &transformers.OpenAIMessageResponse{},
+			FinishReason: choice.FinishReason,
+		}))
+	}
+	return append(chunks, "data: [DONE]\n\n")
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"factory-go-api/config"
+	"factory-go-api/transformers"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setTestResponseCache(t *testing.T) {
+	t.Helper()
+	if err := initResponseCache(config.ResponseCacheConfig{Enabled: true, MaxEntries: 10, TTLSeconds: 60}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { responseCache = nil })
+}
+
+func TestResponseCacheKeyIgnoresStream(t *testing.T) {
+	a, ok := responseCacheKey("https://u", []byte(`{"model":"m","stream":true,"max_tokens":10}`))
+	if !ok {
+		t.Fatal("expected key")
+	}
+	b, _ := responseCacheKey("https://u", []byte(`{"max_tokens":10,"model":"m"}`))
+	if a != b {
+		t.Errorf("keys differ for equivalent requests: %s vs %s", a, b)
+	}
+	c, _ := responseCacheKey("https://other", []byte(`{"max_tokens":10,"model":"m"}`))
+	if a == c {
+		t.Error("keys should differ for different upstream URLs")
+	}
+}
+
+func TestServeWithResponseCache(t *testing.T) {
+	setTestResponseCache(t)
+
+	calls := 0
+	fetch := func(w http.ResponseWriter) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"x","object":"chat.completion","model":"m","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`)
+	}
+	reqBody := []byte(`{"model":"m","temperature":0}`)
+	temperature := 0.0
+	serve := func(stream bool, cacheControl string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		if cacheControl != "" {
+			r.Header.Set("Cache-Control", cacheControl)
+		}
+		serveWithResponseCache(rr, r, &transformers.OpenAIRequest{Model: "m", Stream: stream, Temperature: &temperature}, "https://u", reqBody, fetch)
+		return rr
+	}
+
+	if rr := serve(false, ""); rr.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("first request X-Cache = %q, want MISS", rr.Header().Get("X-Cache"))
+	}
+
+	rr := serve(false, "")
+	if rr.Header().Get("X-Cache") != "HIT" || calls != 1 {
+		t.Fatalf("second request X-Cache = %q, calls = %d; want HIT and 1 call", rr.Header().Get("X-Cache"), calls)
+	}
+	var resp transformers.OpenAIResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || resp.Choices[0].Message.Content != "hi" {
+		t.Errorf("cached JSON response = %s", rr.Body.String())
+	}
+
+	rr = serve(true, "")
+	body := rr.Body.String()
+	if rr.Header().Get("X-Cache") != "HIT" || !strings.Contains(body, `"content":"hi"`) || !strings.HasSuffix(body, "data: [DONE]\n\n") {
+		t.Errorf("cached stream replay = %q", body)
+	}
+
+	if rr := serve(false, "no-cache"); rr.Header().Get("X-Cache") != "BYPASS" || calls != 2 {
+		t.Errorf("no-cache X-Cache = %q, calls = %d; want BYPASS and 2 calls", rr.Header().Get("X-Cache"), calls)
+	}
+}
+
+func TestServeWithResponseCacheSkipsIncompleteStream(t *testing.T) {
+	setTestResponseCache(t)
+
+	calls := 0
+	fetch := func(w http.ResponseWriter) {
+		calls++
+		fmt.Fprint(w, "data: {\"id\":\"a\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"x\"}}]}\n\n")
+	}
+	seed := int64(1)
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		serveWithResponseCache(rr, r, &transformers.OpenAIRequest{Model: "m", Stream: true, Seed: &seed}, "https://u", []byte(`{"model":"m","seed":1}`), fetch)
+	}
+	if calls != 2 {
+		t.Errorf("calls = %d, want 2 (stream without finish_reason must not be cached)", calls)
+	}
+}
+
+// 默认只缓存确定性请求，cache_nondeterministic 开启后缓存所有请求
+func TestServeWithResponseCacheNondeterministic(t *testing.T) {
+	setTestResponseCache(t)
+
+	calls := 0
+	fetch := func(w http.ResponseWriter) {
+		calls++
+		fmt.Fprint(w, `{"id":"x","object":"chat.completion","model":"m","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`)
+	}
+	temperature := 0.7
+	serve := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		serveWithResponseCache(rr, r, &transformers.OpenAIRequest{Model: "m", Temperature: &temperature}, "https://u", []byte(`{"model":"m","temperature":0.7}`), fetch)
+		return rr
+	}
+
+	for i := 0; i < 2; i++ {
+		if rr := serve(); rr.Header().Get("X-Cache") != "" {
+			t.Errorf("nondeterministic request X-Cache = %q, want none", rr.Header().Get("X-Cache"))
+		}
+	}
+	if calls != 2 {
+		t.Errorf("calls = %d, want 2 (nondeterministic requests must not be cached)", calls)
+	}
+
+	if err := initResponseCache(config.ResponseCacheConfig{Enabled: true, MaxEntries: 10, TTLSeconds: 60, CacheNondeterministic: true}); err != nil {
+		t.Fatal(err)
+	}
+	serve()
+	if rr := serve(); rr.Header().Get("X-Cache") != "HIT" || calls != 3 {
+		t.Errorf("cache_nondeterministic X-Cache = %q, calls = %d; want HIT and 3 calls", rr.Header().Get("X-Cache"), calls)
+	}
+}
+
+func TestAssembleStreamResponse(t *testing.T) {
+	stop := "stop"
+	original := &transformers.OpenAIResponse{
+		ID:    "x",
+		Model: "m",
+		Choices: []transformers.OpenAIChoice{{
+			Message:      &transformers.OpenAIMessageResponse{Role: "assistant", Content: "hello"},
+			FinishReason: &stop,
+		}},
+	}
+	resp := assembleStreamResponse([]byte(strings.Join(synthesizeStreamChunks(original), "")))
+	if resp == nil || len(resp.Choices) != 1 {
+		t.Fatalf("assembled = %+v", resp)
+	}
+	if resp.Choices[0].Message.Content != "hello" || resp.Choices[0].FinishReason == nil || *resp.Choices[0].FinishReason != "stop" {
+		t.Errorf("assembled choice = %+v", resp.Choices[0])
+	}
+}
+
+func TestAssembleStreamResponseToolCalls(t *testing.T) {
+	// 工具调用按 index 分多个增量到达：首个带 id 和函数名，后续追加 arguments
+	stream := "data: {\"id\":\"x\",\"model\":\"m\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\"}}]}\n\n" +
+		"data: {\"id\":\"x\",\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"id\":\"call_1\",\"type\":\"function\",\"function\":{\"name\":\"get_weather\",\"arguments\":\"\"}}]}}]}\n\n" +
+		"data: {\"id\":\"x\",\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"{\\\"city\\\":\"}}]}}]}\n\n" +
+		"data: {\"id\":\"x\",\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"\\\"Paris\\\"}\"}},{\"index\":1,\"id\":\"call_2\",\"type\":\"function\",\"function\":{\"name\":\"get_time\",\"arguments\":\"{}\"}}]}}]}\n\n" +
+		"data: {\"id\":\"x\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"tool_calls\"}]}\n\n" +
+		"data: [DONE]\n\n"
+	resp := assembleStreamResponse([]byte(stream))
+	if resp == nil || len(resp.Choices) != 1 {
+		t.Fatalf("assembled = %+v", resp)
+	}
+	calls := resp.Choices[0].Message.ToolCalls
+	if len(calls) != 2 || calls[0].ID != "call_1" || calls[0].Function.Arguments != `{"city":"Paris"}` || calls[1].Function.Name != "get_time" || calls[0].Index != nil {
+		t.Fatalf("tool_calls = %+v", calls)
+	}
+
+	// 回放的流重新组装后与原响应一致
+	replayed := assembleStreamResponse([]byte(strings.Join(synthesizeStreamChunks(resp), "")))
+	got, _ := json.Marshal(replayed.Choices)
+	want, _ := json.Marshal(resp.Choices)
+	if string(got) != string(want) {
+		t.Errorf("replayed choices = %s, want %s", got, want)
+	}
+
+	// 上游没有返回 usage 时，输出 token 估算包含工具调用
+	capture := &captureResponseWriter{ResponseWriter: httptest.NewRecorder(), statusCode: http.StatusOK}
+	capture.Header().Set("Content-Type", "text/event-stream")
+	capture.body.WriteString(stream)
+	if event := requestMetrics(&transformers.OpenAIRequest{Model: "m"}, "c", capture, time.Now()); event.CompletionTokens == 0 {
+		t.Errorf("completion tokens = 0, want tool call estimate")
+	}
+}
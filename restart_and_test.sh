@@ -12,7 +12,7 @@ fi
 
 # 重新编译
 echo "🔨 重新编译..."
-go build -o factory-api main_multimodel.go
+go build -o factory-api .
 
 if [ $? -ne 0 ]; then
     echo "❌ 编译失败"
@@ -72,7 +72,7 @@ go mod tidy
 
 REM 构建多模型版本
 echo [INFO] 构建多模型支持版本...
-go build -o factory-api.exe main_multimodel.go
+go build -o factory-api.exe .
 
 if %errorlevel% equ 0 (
     echo [OK] 构建成功！
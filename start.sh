@@ -56,7 +56,7 @@ go mod tidy
 
 # 构建多模型版本
 echo "🔨 构建多模型支持版本..."
-go build -o factory-api main_multimodel.go
+go build -o factory-api .
 
 if [ $? -eq 0 ]; then
     echo "✅ 构建成功！"
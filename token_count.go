@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"factory-go-api/config"
+	"factory-go-api/provider"
+	"factory-go-api/transformers"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// token 计数来源
+const (
+	tokenCountSourceAnthropic = "anthropic" // Anthropic count_tokens 端点
+	tokenCountSourceEstimate  = "estimate"  // 本地近似估算
+)
+
+// tokenCountRequest 计数请求使用 Chat Completions 请求体，兼容 Anthropic 风格的顶层 system 字段
+// /v1/messages/count_tokens 还接受 Anthropic 原生的内容块、tools 和 tool_choice，解析后转换为 Chat 格式
+type tokenCountRequest struct {
+	transformers.OpenAIRequest
+	System interface{} `json:"system,omitempty"`
+}
+
+// tokenCountHandler 处理 /v1/token_count
+func tokenCountHandler(w http.ResponseWriter, r *http.Request) {
+	handleTokenCount(w, r, false)
+}
+
+// anthropicCountTokensHandler 处理 /v1/messages/count_tokens，响应格式与 Anthropic 一致
+func anthropicCountTokensHandler(w http.ResponseWriter, r *http.Request) {
+	handleTokenCount(w, r, true)
+}
+
+// handleTokenCount 执行与正式请求相同的转换后计算输入 token 数
+// Provider 支持上游计数（Anthropic count_tokens）时优先调用，失败时退回本地估算
+func handleTokenCount(w http.ResponseWriter, r *http.Request, anthropicFormat bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	clientName, authHeader, ok := authorizeRequest(w, r)
+	if !ok {
+		return
+	}
+
+	bodyBytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("错误: 读取请求体失败: %v", err)
+		http.Error(w, `{"error": {"message": "Failed to read request body", "type": "invalid_request_error"}}`, http.StatusBadRequest)
+		return
+	}
+
+	var countReq tokenCountRequest
+	if err := json.Unmarshal(bodyBytes, &countReq); err != nil {
+		log.Printf("错误: 解析请求体失败: %v", err)
+		http.Error(w, `{"error": {"message": "Invalid JSON", "type": "invalid_request_error"}}`, http.StatusBadRequest)
+		return
+	}
+	openaiReq := &countReq.OpenAIRequest
+	openaiReq.ClientName = clientName
+	openaiReq.Context = r.Context()
+	if anthropicFormat {
+		if err := anthropicInputToOpenAI(openaiReq); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error(), "invalid_request_error")
+			return
+		}
+	}
+	if system := systemText(countReq.System); system != "" {
+		openaiReq.Messages = append([]transformers.OpenAIMessage{{Role: "system", Content: system}}, openaiReq.Messages...)
+	}
+
+	model := config.GetModelByID(openaiReq.Model)
+	if model == nil {
+		http.Error(w, fmt.Sprintf(`{"error": {"message": "Model '%s' not found", "type": "invalid_request_error"}}`, openaiReq.Model), http.StatusNotFound)
+		return
+	}
+
+	p := provider.Get(model.Type)
+	if p == nil {
+		http.Error(w, `{"error": {"message": "Unsupported model type", "type": "invalid_request_error"}}`, http.StatusBadRequest)
+		return
+	}
+	// 计数请求与正式请求使用相同的转换，但不会以流式发送
+	openaiReq.Stream = false
+	req := &provider.Request{OpenAI: openaiReq, Model: model, AuthHeader: authHeader, ClientHeaders: extractClientHeaders(r)}
+
+	// 只转换一次，本地估算和上游计数共用转换结果（远程图片只拉取一次）
+	// 请求本身无法转换时直接返回 400，不再尝试上游计数
+	upstreamReq, err := p.BuildRequest(req)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error(), "invalid_request_error")
+		return
+	}
+	inputTokens, err := p.EstimateTokens(req, upstreamReq)
+	if err != nil {
+		log.Printf("错误: 估算 token 失败: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to estimate tokens", "server_error")
+		return
+	}
+	source := tokenCountSourceEstimate
+	if counter, ok := p.(provider.TokenCounter); ok {
+		if counted, err := countUpstreamTokens(r, p, counter, req, upstreamReq); err == nil {
+			inputTokens = counted
+			source = tokenCountSourceAnthropic
+		} else {
+			log.Printf("⚠️ count_tokens 失败，使用本地估算: %v", err)
+		}
+	}
+
+	log.Printf("🔢 %s 输入 token: %d (%s)", openaiReq.Model, inputTokens, source)
+
+	var resp interface{} = map[string]interface{}{"input_tokens": inputTokens}
+	if !anthropicFormat {
+		resp = map[string]interface{}{
+			"object":       "token_count",
+			"model":        openaiReq.Model,
+			"input_tokens": inputTokens,
+			"source":       source,
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Token-Count-Source", source)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("错误: 编码响应失败: %v", err)
+	}
+}
+
+// countUpstreamTokens 调用上游的 token 计数接口，客户端断开时取消请求
+func countUpstreamTokens(r *http.Request, p provider.Provider, counter provider.TokenCounter, req *provider.Request, upstreamReq interface{}) (int, error) {
+	countReq, err := counter.BuildCountTokensRequest(req, upstreamReq)
+	if err != nil {
+		return 0, err
+	}
+	reqBody, err := json.Marshal(countReq)
+	if err != nil {
+		return 0, err
+	}
+
+	// 熔断器打开时不访问上游，由调用方退回本地估算
+	resp, _, err := doUpstream(req.Model.EndpointType(), req.Model, func(endpoint *config.Endpoint) (*http.Request, error) {
+		proxyReq, err := http.NewRequestWithContext(r.Context(), http.MethodPost, counter.CountTokensURL(endpoint), bytes.NewReader(reqBody))
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range p.Headers(endpoint, req) {
+			proxyReq.Header.Set(key, value)
+		}
+		return proxyReq, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("upstream returned %d: %s", resp.StatusCode, body)
+	}
+	return counter.DecodeTokenCount(body)
+}
+
+// systemText 将 Anthropic 风格的 system（字符串或 text 块数组）转换为文本
+func systemText(system interface{}) string {
+	switch v := system.(type) {
+	case string:
+		return v
+	case []interface{}:
+		var texts []string
+		for _, block := range v {
+			if blockMap, ok := block.(map[string]interface{}); ok {
+				if text, ok := blockMap["text"].(string); ok {
+					texts = append(texts, text)
+				}
+			}
+		}
+		return strings.Join(texts, "\n\n")
+	}
+	return ""
+}
+
+// anthropicInputToOpenAI 将 Anthropic 原生格式的消息、tools 和 tool_choice 转换为 Chat 格式
+// tool_use 块转换为 assistant 的 tool_calls，tool_result 块转换为 tool 消息，image / document 块转换为 image_url / file 内容块
+// 转换后与正式请求走相同的转换流程，Anthropic 模型会还原为相同的内容块；已是 Chat 格式的内容保持不变
+func anthropicInputToOpenAI(req *transformers.OpenAIRequest) error {
+	var messages []transformers.OpenAIMessage
+	for i, msg := range req.Messages {
+		converted, err := anthropicToOpenAIMessages(msg)
+		if err != nil {
+			return fmt.Errorf("messages[%d]: %w", i, err)
+		}
+		messages = append(messages, converted...)
+	}
+	req.Messages = messages
+
+	for i, tool := range req.Tools {
+		req.Tools[i] = anthropicToolToOpenAI(tool)
+	}
+	if choice, ok := req.ToolChoice.(map[string]interface{}); ok {
+		if disable, _ := choice["disable_parallel_tool_use"].(bool); disable {
+			parallel := false
+			req.ParallelToolCalls = &parallel
+		}
+		switch choice["type"] {
+		case "auto", "none":
+			req.ToolChoice = choice["type"]
+		case "any":
+			req.ToolChoice = "required"
+		case "tool":
+			req.ToolChoice = map[string]interface{}{
+				"type":     "function",
+				"function": map[string]interface{}{"name": choice["name"]},
+			}
+		}
+	}
+	return nil
+}
+
+// anthropicToOpenAIMessages 转换一条消息；包含 tool_result 块的 user 消息拆分为 tool 消息，其余块保留在 user 消息中
+func anthropicToOpenAIMessages(msg transformers.OpenAIMessage) ([]transformers.OpenAIMessage, error) {
+	parts, ok := msg.Content.([]interface{})
+	if !ok {
+		return []transformers.OpenAIMessage{msg}, nil
+	}
+
+	var toolMessages []transformers.OpenAIMessage
+	content := make([]interface{}, 0, len(parts))
+	for j, part := range parts {
+		block, ok := part.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("content[%d] must be an object", j)
+		}
+		switch block["type"] {
+		case "tool_use":
+			if msg.Role != "assistant" {
+				return nil, fmt.Errorf("content[%d]: tool_use blocks are only allowed in assistant messages", j)
+			}
+			id, _ := block["id"].(string)
+			name, _ := block["name"].(string)
+			input := block["input"]
+			if input == nil {
+				input = map[string]interface{}{}
+			}
+			arguments, err := json.Marshal(input)
+			if err != nil {
+				return nil, fmt.Errorf("content[%d]: %w", j, err)
+			}
+			msg.ToolCalls = append(msg.ToolCalls, transformers.OpenAIToolCall{
+				ID:       id,
+				Type:     "function",
+				Function: transformers.OpenAIFunctionCall{Name: name, Arguments: string(arguments)},
+			})
+		case "tool_result":
+			if msg.Role != "user" {
+				return nil, fmt.Errorf("content[%d]: tool_result blocks are only allowed in user messages", j)
+			}
+			toolUseID, _ := block["tool_use_id"].(string)
+			result := block["content"]
+			if inner, ok := result.([]interface{}); ok {
+				converted := make([]interface{}, 0, len(inner))
+				for k, innerPart := range inner {
+					innerBlock, ok := innerPart.(map[string]interface{})
+					if !ok {
+						return nil, fmt.Errorf("content[%d].content[%d] must be an object", j, k)
+					}
+					part, err := anthropicBlockToOpenAI(innerBlock)
+					if err != nil {
+						return nil, fmt.Errorf("content[%d].content[%d]: %w", j, k, err)
+					}
+					converted = append(converted, part)
+				}
+				result = converted
+			}
+			toolMessage := transformers.OpenAIMessage{Role: "tool", ToolCallID: toolUseID, Content: result}
+			toolMessage.CacheControl, _ = block["cache_control"].(map[string]interface{})
+			toolMessages = append(toolMessages, toolMessage)
+		default:
+			part, err := anthropicBlockToOpenAI(block)
+			if err != nil {
+				return nil, fmt.Errorf("content[%d]: %w", j, err)
+			}
+			content = append(content, part)
+		}
+	}
+
+	if len(toolMessages) == 0 {
+		msg.Content = content
+		return []transformers.OpenAIMessage{msg}, nil
+	}
+	// tool_result 必须位于 user 消息开头，转换后 tool 消息在前，其余内容作为其后的 user 消息
+	if len(content) > 0 {
+		msg.Content = content
+		toolMessages = append(toolMessages, msg)
+	}
+	return toolMessages, nil
+}
+
+// anthropicBlockToOpenAI 将 image / document 块转换为 image_url / file 内容块，其他块原样保留
+func anthropicBlockToOpenAI(block map[string]interface{}) (interface{}, error) {
+	source, _ := block["source"].(map[string]interface{})
+	var part map[string]interface{}
+	switch block["type"] {
+	case "image":
+		var url string
+		switch source["type"] {
+		case "base64":
+			url = fmt.Sprintf("data:%v;base64,%v", source["media_type"], source["data"])
+		case "url":
+			url, _ = source["url"].(string)
+		default:
+			return nil, fmt.Errorf("image source type %v is not supported", source["type"])
+		}
+		part = map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": url}}
+	case "document":
+		var fileData string
+		switch source["type"] {
+		case "base64":
+			fileData = fmt.Sprintf("data:%v;base64,%v", source["media_type"], source["data"])
+		case "text":
+			text, _ := source["data"].(string)
+			fileData = "data:text/plain;base64," + base64.StdEncoding.EncodeToString([]byte(text))
+		default:
+			return nil, fmt.Errorf("document source type %v is not supported", source["type"])
+		}
+		file := map[string]interface{}{"file_data": fileData}
+		if title, ok := block["title"].(string); ok {
+			file["filename"] = title
+		}
+		part = map[string]interface{}{"type": "file", "file": file}
+	default:
+		return block, nil
+	}
+	if cacheControl, ok := block["cache_control"]; ok {
+		part["cache_control"] = cacheControl
+	}
+	return part, nil
+}
+
+// anthropicToolToOpenAI 将 Anthropic 的自定义工具（name / description / input_schema）转换为 function 工具
+func anthropicToolToOpenAI(tool interface{}) interface{} {
+	toolMap, ok := tool.(map[string]interface{})
+	if !ok || toolMap["function"] != nil || toolMap["name"] == nil {
+		return tool
+	}
+	if toolType, ok := toolMap["type"]; ok && toolType != "custom" {
+		return tool
+	}
+	function := map[string]interface{}{"name": toolMap["name"]}
+	if description, ok := toolMap["description"]; ok {
+		function["description"] = description
+	}
+	if schema, ok := toolMap["input_schema"]; ok {
+		function["parameters"] = schema
+	}
+	return map[string]interface{}{"type": "function", "function": function}
+}
@@ -0,0 +1,154 @@
+package transformers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EstimateOpenAIMessageTokens 在转换前估算单条 OpenAI 消息的 token 数
+func EstimateOpenAIMessageTokens(msg OpenAIMessage) int {
+	tokens := messageOverheadTokens + estimateTextTokens(msg.Name)
+	switch content := msg.Content.(type) {
+	case string:
+		tokens += estimateTextTokens(content)
+	case []interface{}:
+		for _, part := range content {
+			partMap, ok := part.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			switch partMap["type"] {
+			case "text":
+				text, _ := partMap["text"].(string)
+				tokens += estimateTextTokens(text)
+			case "image_url":
+				tokens += estimateResponsesPartTokens(map[string]interface{}{"type": "input_image", "image_url": partMap["image_url"]})
+			case "file":
+				file, _ := partMap["file"].(map[string]interface{})
+				fileData, _ := file["file_data"].(string)
+				tokens += estimateResponsesPartTokens(map[string]interface{}{"type": "input_file", "file_data": fileData})
+			default:
+				tokens += estimateJSONTokens(partMap)
+			}
+		}
+	case nil:
+	default:
+		tokens += estimateJSONTokens(content)
+	}
+	return tokens
+}
+
+// EstimateOpenAIRequestTokens 在转换前估算请求的输入 token 数（消息、工具和 response_format）
+func EstimateOpenAIRequestTokens(req *OpenAIRequest) int {
+	tokens := replyPrimingTokens
+	for _, msg := range req.Messages {
+		tokens += EstimateOpenAIMessageTokens(msg)
+	}
+	for _, tool := range req.Tools {
+		tokens += estimateJSONTokens(tool)
+	}
+	if req.ResponseFormat.IsStructured() {
+		tokens += estimateJSONTokens(req.ResponseFormat)
+	}
+	return tokens
+}
+
+// isSystemRole system 和 developer 消息在截断时始终保留
+func isSystemRole(role string) bool {
+	return role == "system" || role == "developer"
+}
+
+// TruncateMessages 按预算从最早的对话消息开始丢弃，system/developer 消息始终保留
+// keepLast > 0 时先只保留最近 keepLast 条对话消息；至少保留最后一条对话消息
+// 返回被丢弃的消息（按原顺序）
+func TruncateMessages(req *OpenAIRequest, budget, keepLast int) []OpenAIMessage {
+	var conversation []int
+	for i, msg := range req.Messages {
+		if !isSystemRole(msg.Role) {
+			conversation = append(conversation, i)
+		}
+	}
+
+	drop := make(map[int]bool)
+	total := EstimateOpenAIRequestTokens(req)
+	dropAt := func(i int) {
+		drop[i] = true
+		total -= EstimateOpenAIMessageTokens(req.Messages[i])
+	}
+
+	start := 0
+	if keepLast > 0 && len(conversation) > keepLast {
+		for ; start < len(conversation)-keepLast; start++ {
+			dropAt(conversation[start])
+		}
+	}
+	for ; start < len(conversation)-1 && total > budget; start++ {
+		dropAt(conversation[start])
+	}
+	// 不以孤立的工具结果开头
+	for ; start < len(conversation)-1; start++ {
+		role := req.Messages[conversation[start]].Role
+		if role != "tool" && role != "function" {
+			break
+		}
+		dropAt(conversation[start])
+	}
+
+	if len(drop) == 0 {
+		return nil
+	}
+	var kept, dropped []OpenAIMessage
+	for i, msg := range req.Messages {
+		if drop[i] {
+			dropped = append(dropped, msg)
+		} else {
+			kept = append(kept, msg)
+		}
+	}
+	req.Messages = kept
+	return dropped
+}
+
+// InsertSummaryMessage 将早期对话的摘要作为 system 消息插入到原有 system 消息之后
+func InsertSummaryMessage(req *OpenAIRequest, summary string) {
+	index := 0
+	for index < len(req.Messages) && isSystemRole(req.Messages[index].Role) {
+		index++
+	}
+	summaryMsg := OpenAIMessage{Role: "system", Content: "Summary of the earlier conversation:\n" + summary}
+	messages := make([]OpenAIMessage, 0, len(req.Messages)+1)
+	messages = append(messages, req.Messages[:index]...)
+	messages = append(messages, summaryMsg)
+	req.Messages = append(messages, req.Messages[index:]...)
+}
+
+// RenderTranscript 将消息渲染为纯文本对话记录，用于生成摘要
+func RenderTranscript(messages []OpenAIMessage) string {
+	var sb strings.Builder
+	for _, msg := range messages {
+		var texts []string
+		switch content := msg.Content.(type) {
+		case string:
+			texts = append(texts, content)
+		case []interface{}:
+			for _, part := range content {
+				partMap, _ := part.(map[string]interface{})
+				switch partMap["type"] {
+				case "text":
+					text, _ := partMap["text"].(string)
+					texts = append(texts, text)
+				case "image_url":
+					texts = append(texts, "[image]")
+				case "file":
+					texts = append(texts, "[file]")
+				}
+			}
+		}
+		role := msg.Role
+		if msg.Name != "" {
+			role = fmt.Sprintf("%s (%s)", role, msg.Name)
+		}
+		sb.WriteString(role + ": " + strings.Join(texts, "\n") + "\n\n")
+	}
+	return strings.TrimSpace(sb.String())
+}
@@ -0,0 +1,120 @@
+package transformers
+
+import (
+	"strings"
+	"testing"
+)
+
+func contextTestRequest() *OpenAIRequest {
+	long := strings.Repeat("lorem ipsum dolor sit amet ", 40)
+	return &OpenAIRequest{
+		Model: "claude-sonnet",
+		Messages: []OpenAIMessage{
+			{Role: "system", Content: "Be brief"},
+			{Role: "user", Content: "first " + long},
+			{Role: "assistant", Content: "second " + long},
+			{Role: "tool", Content: "orphan " + long, ToolCallID: "call_1"},
+			{Role: "user", Content: "third " + long},
+			{Role: "assistant", Content: "fourth"},
+			{Role: "user", Content: "fifth"},
+		},
+	}
+}
+
+func messageTexts(messages []OpenAIMessage) []string {
+	var texts []string
+	for _, msg := range messages {
+		text, _ := msg.Content.(string)
+		texts = append(texts, strings.Fields(text)[0])
+	}
+	return texts
+}
+
+func TestTruncateMessagesDropOldest(t *testing.T) {
+	req := contextTestRequest()
+	budget := EstimateOpenAIRequestTokens(req) - 1
+
+	dropped := TruncateMessages(req, budget, 0)
+	if got := strings.Join(messageTexts(dropped), ","); got != "first" {
+		t.Errorf("dropped = %s, want first", got)
+	}
+	if got := strings.Join(messageTexts(req.Messages), ","); got != "Be,second,orphan,third,fourth,fifth" {
+		t.Errorf("kept = %s", got)
+	}
+	if EstimateOpenAIRequestTokens(req) > budget {
+		t.Errorf("request still over budget")
+	}
+}
+
+func TestTruncateMessagesSkipsOrphanToolResults(t *testing.T) {
+	req := contextTestRequest()
+	// 丢弃前两条后开头是 tool 结果，应一并丢弃
+	budget := EstimateOpenAIRequestTokens(req) - EstimateOpenAIMessageTokens(req.Messages[1]) - 1
+
+	dropped := TruncateMessages(req, budget, 0)
+	if got := strings.Join(messageTexts(dropped), ","); got != "first,second,orphan" {
+		t.Errorf("dropped = %s", got)
+	}
+	if req.Messages[1].Role != "user" {
+		t.Errorf("first conversation message role = %s, want user", req.Messages[1].Role)
+	}
+}
+
+func TestTruncateMessagesKeepLast(t *testing.T) {
+	req := contextTestRequest()
+	dropped := TruncateMessages(req, 1<<20, 2)
+	if len(dropped) != 4 {
+		t.Errorf("dropped %d messages, want 4", len(dropped))
+	}
+	if got := strings.Join(messageTexts(req.Messages), ","); got != "Be,fourth,fifth" {
+		t.Errorf("kept = %s", got)
+	}
+}
+
+func TestTruncateMessagesKeepsLastMessage(t *testing.T) {
+	req := contextTestRequest()
+	TruncateMessages(req, 0, 0)
+	if got := strings.Join(messageTexts(req.Messages), ","); got != "Be,fifth" {
+		t.Errorf("kept = %s, want system and last message", got)
+	}
+}
+
+func TestTruncateMessagesWithinBudget(t *testing.T) {
+	req := contextTestRequest()
+	if dropped := TruncateMessages(req, EstimateOpenAIRequestTokens(req), 0); dropped != nil {
+		t.Errorf("dropped = %v, want nil", dropped)
+	}
+	if len(req.Messages) != 7 {
+		t.Errorf("messages = %d, want 7", len(req.Messages))
+	}
+}
+
+func TestInsertSummaryMessage(t *testing.T) {
+	req := &OpenAIRequest{Messages: []OpenAIMessage{
+		{Role: "system", Content: "Be brief"},
+		{Role: "developer", Content: "Use Go"},
+		{Role: "user", Content: "Hi"},
+	}}
+	InsertSummaryMessage(req, "User asked about Go.")
+
+	if len(req.Messages) != 4 || req.Messages[2].Role != "system" || req.Messages[3].Role != "user" {
+		t.Fatalf("messages = %+v", req.Messages)
+	}
+	if content, _ := req.Messages[2].Content.(string); !strings.HasSuffix(content, "User asked about Go.") {
+		t.Errorf("summary content = %q", content)
+	}
+}
+
+func TestRenderTranscript(t *testing.T) {
+	got := RenderTranscript([]OpenAIMessage{
+		{Role: "user", Content: []interface{}{
+			map[string]interface{}{"type": "text", "text": "Look"},
+			map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": "https://example.com/a.png"}},
+		}},
+		{Role: "tool", Name: "get_weather", Content: "sunny"},
+	})
+	want := "user: Look\n[image]\n\ntool (get_weather): sunny"
+	if got != want {
+		t.Errorf("transcript = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,152 @@
+package transformers
+
+import (
+	"encoding/base64"
+	"factory-go-api/config"
+	"fmt"
+	"strings"
+)
+
+// documentMediaTypes 支持的文档格式
+var documentMediaTypes = map[string]bool{
+	"application/pdf": true,
+	"text/plain":      true,
+}
+
+// openAIFile OpenAI file 内容块中的 file 字段
+type openAIFile struct {
+	FileID   string
+	FileData string
+	Filename string
+}
+
+// extractFilePart 从 OpenAI file 内容块中提取 file 字段
+func extractFilePart(part map[string]interface{}) (openAIFile, error) {
+	fileMap, ok := part["file"].(map[string]interface{})
+	if !ok {
+		return openAIFile{}, fmt.Errorf("file content part requires a 'file' object")
+	}
+
+	var file openAIFile
+	file.FileID, _ = fileMap["file_id"].(string)
+	file.FileData, _ = fileMap["file_data"].(string)
+	file.Filename, _ = fileMap["filename"].(string)
+
+	if file.FileID == "" && file.FileData == "" {
+		return openAIFile{}, fmt.Errorf("file content part requires either file.file_data or file.file_id")
+	}
+	return file, nil
+}
+
+// parseFileData 解析 file_data，返回 media type 和 base64 数据
+// file_data 通常是 data:application/pdf;base64,xxx 格式，裸 base64 时根据文件名推断类型
+func parseFileData(fileData, filename string, maxBytes int64) (string, string, error) {
+	mediaType := ""
+	data := fileData
+
+	if strings.HasPrefix(fileData, "data:") {
+		header, payload, found := strings.Cut(strings.TrimPrefix(fileData, "data:"), ",")
+		if !found || !strings.Contains(header, ";base64") {
+			return "", "", fmt.Errorf("file_data must be a base64 data URI")
+		}
+		mediaType = strings.ToLower(strings.TrimSpace(strings.Split(header, ";")[0]))
+		data = payload
+	} else {
+		lowerName := strings.ToLower(filename)
+		switch {
+		case strings.HasSuffix(lowerName, ".pdf"):
+			mediaType = "application/pdf"
+		case strings.HasSuffix(lowerName, ".txt"):
+			mediaType = "text/plain"
+		}
+	}
+
+	if !documentMediaTypes[mediaType] {
+		return "", "", fmt.Errorf("unsupported file media type '%s': only application/pdf and text/plain are supported", mediaType)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid base64 file data: %v", err)
+	}
+	if maxBytes > 0 && int64(len(decoded)) > maxBytes {
+		return "", "", fmt.Errorf("file exceeds maximum size of %d bytes", maxBytes)
+	}
+
+	return mediaType, data, nil
+}
+
+// transformFileToAnthropic 将 OpenAI file 内容块转换为 Anthropic document 块
+func transformFileToAnthropic(part map[string]interface{}) (map[string]interface{}, error) {
+	file, err := extractFilePart(part)
+	if err != nil {
+		return nil, err
+	}
+	if file.FileData == "" {
+		return nil, fmt.Errorf("file.file_id is not supported for Anthropic or Gemini models, send file.file_data instead")
+	}
+
+	mediaType, data, err := parseFileData(file.FileData, file.Filename, config.GetFileInputConfig().MaxBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	var source map[string]interface{}
+	if mediaType == "text/plain" {
+		// 纯文本文档使用 text source，直接传递解码后的内容
+		decoded, _ := base64.StdEncoding.DecodeString(data)
+		source = map[string]interface{}{
+			"type":       "text",
+			"media_type": mediaType,
+			"data":       string(decoded),
+		}
+	} else {
+		source = map[string]interface{}{
+			"type":       "base64",
+			"media_type": mediaType,
+			"data":       data,
+		}
+	}
+
+	document := map[string]interface{}{
+		"type":   "document",
+		"source": source,
+	}
+	if file.Filename != "" {
+		document["title"] = file.Filename
+	}
+	return document, nil
+}
+
+// transformFileToFactoryOpenAI 将 OpenAI file 内容块转换为 Responses API input_file 块
+func transformFileToFactoryOpenAI(part map[string]interface{}) (map[string]interface{}, error) {
+	file, err := extractFilePart(part)
+	if err != nil {
+		return nil, err
+	}
+
+	inputFile := map[string]interface{}{
+		"type": "input_file",
+	}
+	if file.FileID != "" {
+		inputFile["file_id"] = file.FileID
+		return inputFile, nil
+	}
+
+	mediaType, data, err := parseFileData(file.FileData, file.Filename, config.GetFileInputConfig().MaxBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	filename := file.Filename
+	if filename == "" {
+		// Responses API 要求内联文件提供文件名
+		filename = "document.pdf"
+		if mediaType == "text/plain" {
+			filename = "document.txt"
+		}
+	}
+	inputFile["filename"] = filename
+	inputFile["file_data"] = fmt.Sprintf("data:%s;base64,%s", mediaType, data)
+	return inputFile, nil
+}
@@ -0,0 +1,53 @@
+package transformers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTransformFileParts(t *testing.T) {
+	pdfPart := map[string]interface{}{
+		"type": "file",
+		"file": map[string]interface{}{
+			"filename":  "report.pdf",
+			"file_data": "data:application/pdf;base64,JVBERi0xLjQK",
+		},
+	}
+
+	document, err := transformFileToAnthropic(pdfPart)
+	if err != nil {
+		t.Fatalf("transformFileToAnthropic() unexpected error: %v", err)
+	}
+	source, _ := document["source"].(map[string]interface{})
+	if document["type"] != "document" || source["media_type"] != "application/pdf" || document["title"] != "report.pdf" {
+		t.Errorf("transformFileToAnthropic() = %v", document)
+	}
+
+	inputFile, err := transformFileToFactoryOpenAI(pdfPart)
+	if err != nil {
+		t.Fatalf("transformFileToFactoryOpenAI() unexpected error: %v", err)
+	}
+	if inputFile["type"] != "input_file" || inputFile["file_data"] != "data:application/pdf;base64,JVBERi0xLjQK" {
+		t.Errorf("transformFileToFactoryOpenAI() = %v", inputFile)
+	}
+
+	textPart := map[string]interface{}{
+		"type": "file",
+		"file": map[string]interface{}{"filename": "notes.txt", "file_data": "aGVsbG8="},
+	}
+	document, err = transformFileToAnthropic(textPart)
+	if err != nil {
+		t.Fatalf("transformFileToAnthropic() unexpected error: %v", err)
+	}
+	if source, _ := document["source"].(map[string]interface{}); source["type"] != "text" || source["data"] != "hello" {
+		t.Errorf("transformFileToAnthropic() text source = %v", source)
+	}
+
+	badPart := map[string]interface{}{
+		"type": "file",
+		"file": map[string]interface{}{"file_data": "data:application/zip;base64,UEsDBA=="},
+	}
+	if _, err := transformFileToAnthropic(badPart); err == nil || !strings.Contains(err.Error(), "unsupported file media type") {
+		t.Errorf("transformFileToAnthropic() error = %v, want unsupported media type", err)
+	}
+}
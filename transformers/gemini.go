@@ -0,0 +1,529 @@
+package transformers
+
+import (
+	"bufio"
+	"encoding/json"
+	"factory-go-api/config"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// geminiMaxStreamChunk Gemini 流式响应单个 data 行的最大长度，函数调用参数在同一块中整体返回
+const geminiMaxStreamChunk = 1 << 20
+
+// GeminiContent Gemini 格式的消息，role 为 user 或 model
+type GeminiContent struct {
+	Role  string                   `json:"role,omitempty"`
+	Parts []map[string]interface{} `json:"parts"`
+}
+
+// GeminiRequest Gemini generateContent 请求格式，模型名和是否流式由请求地址决定
+type GeminiRequest struct {
+	Contents          []GeminiContent         `json:"contents"`
+	SystemInstruction *GeminiContent          `json:"systemInstruction,omitempty"`
+	Tools             []GeminiTool            `json:"tools,omitempty"`
+	ToolConfig        *GeminiToolConfig       `json:"toolConfig,omitempty"`
+	GenerationConfig  *GeminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+// GeminiTool Gemini 工具定义
+type GeminiTool struct {
+	FunctionDeclarations []map[string]interface{} `json:"functionDeclarations"`
+}
+
+// GeminiToolConfig Gemini 工具调用配置
+type GeminiToolConfig struct {
+	FunctionCallingConfig GeminiFunctionCallingConfig `json:"functionCallingConfig"`
+}
+
+// GeminiFunctionCallingConfig mode 为 AUTO、ANY 或 NONE
+type GeminiFunctionCallingConfig struct {
+	Mode                 string   `json:"mode"`
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+}
+
+// GeminiGenerationConfig Gemini 生成参数
+type GeminiGenerationConfig struct {
+	MaxOutputTokens    int                    `json:"maxOutputTokens,omitempty"`
+	Temperature        *float64               `json:"temperature,omitempty"`
+	TopP               *float64               `json:"topP,omitempty"`
+	StopSequences      []string               `json:"stopSequences,omitempty"`
+	PresencePenalty    *float64               `json:"presencePenalty,omitempty"`
+	FrequencyPenalty   *float64               `json:"frequencyPenalty,omitempty"`
+	Seed               *int64                 `json:"seed,omitempty"`
+	ResponseMimeType   string                 `json:"responseMimeType,omitempty"`
+	ResponseJSONSchema map[string]interface{} `json:"responseJsonSchema,omitempty"`
+	ThinkingConfig     *GeminiThinkingConfig  `json:"thinkingConfig,omitempty"`
+}
+
+// GeminiThinkingConfig Gemini 的思考配置
+type GeminiThinkingConfig struct {
+	ThinkingBudget int `json:"thinkingBudget"`
+}
+
+// TransformToGemini 将 OpenAI 格式转换为 Gemini 格式
+// 消息规范化规则与 Anthropic 相同：system / developer 合并为 systemInstruction，工具结果以文本形式保留
+// 返回的错误均为客户端请求内容不合法，调用方应返回 400
+func TransformToGemini(req *OpenAIRequest) (*GeminiRequest, error) {
+	if err := validateResponseFormat(req.ResponseFormat); err != nil {
+		return nil, err
+	}
+	if err := validateSamplingParams(req); err != nil {
+		return nil, err
+	}
+
+	userSystemBlocks, messages, err := normalizeAnthropicMessages(req.requestContext(), req.Messages)
+	if err != nil {
+		return nil, err
+	}
+
+	geminiReq := &GeminiRequest{Contents: make([]GeminiContent, 0, len(messages))}
+	// toolNames tool_use id 到函数名的映射，functionResponse 按函数名与调用对应
+	toolNames := map[string]string{}
+	for _, msg := range messages {
+		parts, err := geminiParts(msg.Content, toolNames)
+		if err != nil {
+			return nil, err
+		}
+		role := msg.Role
+		if role == "assistant" {
+			role = "model"
+		}
+		geminiReq.Contents = append(geminiReq.Contents, GeminiContent{Role: role, Parts: parts})
+	}
+
+	// 按注入策略组合系统提示词
+	var injectedBlocks []map[string]interface{}
+	policy := resolveSystemPrompt(req)
+	if policy.Prompt != "" {
+		injectedBlocks = append(injectedBlocks, map[string]interface{}{"type": "text", "text": policy.Prompt})
+	}
+	if systemBlocks := arrangeSystemPrompt(policy.Mode, injectedBlocks, userSystemBlocks); len(systemBlocks) > 0 {
+		parts, err := geminiParts(systemBlocks, nil)
+		if err != nil {
+			return nil, err
+		}
+		geminiReq.SystemInstruction = &GeminiContent{Parts: parts}
+	}
+
+	// 采样参数，nil 表示未设置，0 是合法值；Gemini 的 temperature 范围与 OpenAI 相同
+	genConfig := &GeminiGenerationConfig{
+		MaxOutputTokens:  req.MaxTokens,
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		StopSequences:    req.Stop,
+		PresencePenalty:  req.PresencePenalty,
+		FrequencyPenalty: req.FrequencyPenalty,
+		Seed:             req.Seed,
+	}
+
+	// 处理 thinking 配置，未配置 reasoning 时使用模型默认行为
+	if reasoning := config.GetModelReasoning(req.Model); reasoning != "" {
+		budget := thinkingBudgets[reasoning]
+		if genConfig.MaxOutputTokens > 0 {
+			// maxOutputTokens 包含思考部分，确保为答案留出空间，但不超过模型输出上限
+			if genConfig.MaxOutputTokens <= budget {
+				genConfig.MaxOutputTokens = capMaxTokens(budget+thinkingAnswerTokens, config.GetModelMaxOutput(req.Model))
+			}
+			if budget >= genConfig.MaxOutputTokens {
+				budget = genConfig.MaxOutputTokens / 2
+			}
+		}
+		genConfig.ThinkingConfig = &GeminiThinkingConfig{ThinkingBudget: budget}
+	}
+
+	// 处理 response_format：Gemini 原生支持 JSON 输出和 JSON Schema
+	if req.ResponseFormat.IsStructured() {
+		genConfig.ResponseMimeType = "application/json"
+		if req.ResponseFormat.Type == "json_schema" {
+			genConfig.ResponseJSONSchema = req.ResponseFormat.schema()
+		}
+	}
+	geminiReq.GenerationConfig = genConfig
+
+	// 转换工具和工具选择
+	if len(req.Tools) > 0 {
+		declarations, err := geminiFunctionDeclarations(req.Tools)
+		if err != nil {
+			return nil, err
+		}
+		geminiReq.Tools = []GeminiTool{{FunctionDeclarations: declarations}}
+	}
+	if req.ToolChoice != nil {
+		toolConfig, err := geminiToolConfig(req.ToolChoice)
+		if err != nil {
+			return nil, err
+		}
+		geminiReq.ToolConfig = toolConfig
+	}
+
+	return geminiReq, nil
+}
+
+// geminiParts 将规范化后的 Anthropic 内容块转换为 Gemini parts，cache_control 等扩展字段不转发
+// tool_use 转换为 functionCall 并记录到 toolNames，tool_result 按 toolNames 中的函数名转换为 functionResponse
+func geminiParts(blocks []map[string]interface{}, toolNames map[string]string) ([]map[string]interface{}, error) {
+	parts := make([]map[string]interface{}, 0, len(blocks))
+	for _, block := range blocks {
+		source, _ := block["source"].(map[string]interface{})
+		switch blockType, _ := block["type"].(string); blockType {
+		case "text":
+			parts = append(parts, map[string]interface{}{"text": block["text"]})
+		case "image", "document":
+			switch source["type"] {
+			case "base64":
+				parts = append(parts, map[string]interface{}{
+					"inlineData": map[string]interface{}{"mimeType": source["media_type"], "data": source["data"]},
+				})
+			case "url":
+				// Gemini 的 fileData 只接受 Files API 上传的文件，远程地址需要代理拉取后以 inlineData 发送
+				return nil, fmt.Errorf("%s URLs are not supported for Gemini models unless image_fetch is enabled, use a base64 data URI instead", blockType)
+			case "text":
+				parts = append(parts, map[string]interface{}{"text": source["data"]})
+			}
+		case "tool_use":
+			id, _ := block["id"].(string)
+			name, _ := block["name"].(string)
+			if toolNames != nil {
+				toolNames[id] = name
+			}
+			parts = append(parts, map[string]interface{}{
+				"functionCall": map[string]interface{}{"name": name, "args": block["input"]},
+			})
+		case "tool_result":
+			id, _ := block["tool_use_id"].(string)
+			content, _ := block["content"].([]map[string]interface{})
+			var text []string
+			var extra []map[string]interface{}
+			for _, inner := range content {
+				if inner["type"] == "text" {
+					if t, ok := inner["text"].(string); ok {
+						text = append(text, t)
+					}
+					continue
+				}
+				extra = append(extra, inner)
+			}
+			parts = append(parts, map[string]interface{}{
+				"functionResponse": map[string]interface{}{
+					"name":     toolNames[id],
+					"response": map[string]interface{}{"content": strings.Join(text, "\n")},
+				},
+			})
+			// 工具结果中的图片等非文本内容作为普通 part 跟在 functionResponse 之后
+			extraParts, err := geminiParts(extra, toolNames)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, extraParts...)
+		default:
+			return nil, fmt.Errorf("content part type '%s' is not supported for Gemini models", blockType)
+		}
+	}
+	return parts, nil
+}
+
+// geminiFunctionDeclarations 将 OpenAI function 工具转换为 Gemini functionDeclarations
+// 参数使用 parametersJsonSchema，保留完整的 JSON Schema
+func geminiFunctionDeclarations(tools []interface{}) ([]map[string]interface{}, error) {
+	declarations := make([]map[string]interface{}, 0, len(tools))
+	for i, tool := range tools {
+		toolMap, _ := tool.(map[string]interface{})
+		function, _ := toolMap["function"].(map[string]interface{})
+		if toolMap["type"] != "function" || function == nil {
+			return nil, fmt.Errorf("tools[%d]: only function tools are supported for Gemini models", i)
+		}
+		name, _ := function["name"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("tools[%d]: function.name is required", i)
+		}
+		declaration := map[string]interface{}{"name": name}
+		if description, ok := function["description"].(string); ok && description != "" {
+			declaration["description"] = description
+		}
+		if parameters, ok := function["parameters"]; ok && parameters != nil {
+			declaration["parametersJsonSchema"] = parameters
+		}
+		declarations = append(declarations, declaration)
+	}
+	return declarations, nil
+}
+
+// geminiToolConfig 将 tool_choice 转换为 functionCallingConfig
+// none → NONE，auto → AUTO，required → ANY，指定函数时为 ANY 并限制可调用的函数
+func geminiToolConfig(toolChoice interface{}) (*GeminiToolConfig, error) {
+	mode := ""
+	var allowed []string
+	switch v := toolChoice.(type) {
+	case string:
+		mode = map[string]string{"none": "NONE", "auto": "AUTO", "required": "ANY"}[v]
+	case map[string]interface{}:
+		if function, ok := v["function"].(map[string]interface{}); ok {
+			if name, ok := function["name"].(string); ok && name != "" {
+				mode = "ANY"
+				allowed = []string{name}
+			}
+		}
+	}
+	if mode == "" {
+		return nil, fmt.Errorf("invalid tool_choice: expected none, auto, required or a function")
+	}
+	return &GeminiToolConfig{FunctionCallingConfig: GeminiFunctionCallingConfig{Mode: mode, AllowedFunctionNames: allowed}}, nil
+}
+
+// GetGeminiHeaders 获取 Gemini 请求头
+func GetGeminiHeaders(authHeader string, clientHeaders map[string]string, isStreaming bool) map[string]string {
+	headers := map[string]string{
+		"content-type":  "application/json",
+		"authorization": authHeader,
+		"user-agent":    config.GetUserAgent(),
+	}
+
+	if isStreaming {
+		headers["accept"] = "text/event-stream"
+	}
+
+	// 传递客户端头
+	if clientID, ok := clientHeaders["x-factory-client"]; ok {
+		headers["x-factory-client"] = clientID
+	} else {
+		headers["x-factory-client"] = "cli"
+	}
+	for _, key := range []string{"x-session-id", "x-assistant-message-id"} {
+		if value, ok := clientHeaders[key]; ok {
+			headers[key] = value
+		}
+	}
+
+	return headers
+}
+
+// GeminiResponseTransformer Gemini 响应转换器
+type GeminiResponseTransformer struct {
+	Model     string
+	RequestID string
+	Created   int64
+}
+
+// NewGeminiResponseTransformer 创建 Gemini 响应转换器
+func NewGeminiResponseTransformer(model, requestID string) *GeminiResponseTransformer {
+	if requestID == "" {
+		requestID = fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano())
+	}
+	return &GeminiResponseTransformer{
+		Model:     model,
+		RequestID: requestID,
+		Created:   time.Now().Unix(),
+	}
+}
+
+// TransformNonStreamResponse 转换非流式响应，只使用第一个候选结果
+func (t *GeminiResponseTransformer) TransformNonStreamResponse(geminiResp map[string]interface{}) (*OpenAIResponse, error) {
+	message := &OpenAIMessageResponse{Role: "assistant"}
+	finishReason := "stop"
+
+	candidates, _ := geminiResp["candidates"].([]interface{})
+	if len(candidates) > 0 {
+		candidate, _ := candidates[0].(map[string]interface{})
+		text, toolCalls := t.extractParts(candidate, 0)
+		for i := range toolCalls {
+			// index 只在流式响应中使用
+			toolCalls[i].Index = nil
+		}
+		message.Content = text
+		message.ToolCalls = toolCalls
+		finishReason = geminiFinishReason(candidate["finishReason"], len(toolCalls) > 0)
+	} else if feedback, ok := geminiResp["promptFeedback"].(map[string]interface{}); ok && feedback["blockReason"] != nil {
+		// 提示词被安全策略拦截时没有候选结果
+		finishReason = "content_filter"
+	}
+
+	id := t.RequestID
+	if responseID, ok := geminiResp["responseId"].(string); ok && responseID != "" {
+		id = responseID
+	}
+	openaiResp := &OpenAIResponse{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: t.Created,
+		Model:   t.Model,
+		Choices: []OpenAIChoice{{Index: 0, Message: message, FinishReason: &finishReason}},
+	}
+	if usage, ok := geminiResp["usageMetadata"].(map[string]interface{}); ok {
+		openaiResp.Usage = geminiUsage(usage)
+	}
+	return openaiResp, nil
+}
+
+// extractParts 提取候选结果中的文本和函数调用，跳过思考内容
+// toolIndex 为第一个函数调用在流中的序号
+func (t *GeminiResponseTransformer) extractParts(candidate map[string]interface{}, toolIndex int) (string, []OpenAIToolCall) {
+	var text strings.Builder
+	var toolCalls []OpenAIToolCall
+	content, _ := candidate["content"].(map[string]interface{})
+	parts, _ := content["parts"].([]interface{})
+	for _, item := range parts {
+		part, ok := item.(map[string]interface{})
+		if !ok || part["thought"] == true {
+			continue
+		}
+		if partText, ok := part["text"].(string); ok {
+			text.WriteString(partText)
+		}
+		if functionCall, ok := part["functionCall"].(map[string]interface{}); ok {
+			index := toolIndex + len(toolCalls)
+			toolCalls = append(toolCalls, newGeminiToolCall(functionCall, index))
+		}
+	}
+	return text.String(), toolCalls
+}
+
+// newGeminiToolCall 将 functionCall 转换为 OpenAI tool_call，上游未返回 id 时生成一个
+func newGeminiToolCall(functionCall map[string]interface{}, index int) OpenAIToolCall {
+	id, _ := functionCall["id"].(string)
+	if id == "" {
+		id = "call_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+	}
+	name, _ := functionCall["name"].(string)
+	arguments := "{}"
+	if args, ok := functionCall["args"]; ok && args != nil {
+		if data, err := json.Marshal(args); err == nil {
+			arguments = string(data)
+		}
+	}
+	return OpenAIToolCall{
+		Index:    &index,
+		ID:       id,
+		Type:     "function",
+		Function: OpenAIFunctionCall{Name: name, Arguments: arguments},
+	}
+}
+
+// geminiFinishReason 转换 finishReason，调用了函数时为 tool_calls
+func geminiFinishReason(reason interface{}, hasToolCalls bool) string {
+	switch reason {
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return "content_filter"
+	}
+	if hasToolCalls {
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+// geminiUsage 转换 usageMetadata，思考 token 计入 completion_tokens
+func geminiUsage(usage map[string]interface{}) map[string]interface{} {
+	count := func(key string) int {
+		value, _ := usage[key].(float64)
+		return int(value)
+	}
+	promptTokens := count("promptTokenCount")
+	completionTokens := count("candidatesTokenCount") + count("thoughtsTokenCount")
+	totalTokens := count("totalTokenCount")
+	if totalTokens == 0 {
+		totalTokens = promptTokens + completionTokens
+	}
+	result := map[string]interface{}{
+		"prompt_tokens":     promptTokens,
+		"completion_tokens": completionTokens,
+		"total_tokens":      totalTokens,
+	}
+	if cached := count("cachedContentTokenCount"); cached > 0 {
+		result["prompt_tokens_details"] = map[string]interface{}{"cached_tokens": cached}
+	}
+	if thoughts := count("thoughtsTokenCount"); thoughts > 0 {
+		result["completion_tokens_details"] = map[string]interface{}{"reasoning_tokens": thoughts}
+	}
+	return result
+}
+
+// createOpenAIChunk 创建 OpenAI 格式的流式块
+func (t *GeminiResponseTransformer) createOpenAIChunk(delta *OpenAIMessageResponse, finishReason string) string {
+	chunk := OpenAIResponse{
+		ID:      t.RequestID,
+		Object:  "chat.completion.chunk",
+		Created: t.Created,
+		Model:   t.Model,
+		Choices: []OpenAIChoice{{Index: 0, Delta: delta}},
+	}
+	if finishReason != "" {
+		chunk.Choices[0].FinishReason = &finishReason
+	}
+
+	jsonData, _ := json.Marshal(chunk)
+	return fmt.Sprintf("data: %s\n\n", string(jsonData))
+}
+
+// TransformStream 转换流式响应（alt=sse），每个 data 块都是一个完整的 generateContent 响应
+func (t *GeminiResponseTransformer) TransformStream(reader io.Reader) chan string {
+	output := make(chan string, 100)
+
+	go func() {
+		defer close(output)
+
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 0, 64*1024), geminiMaxStreamChunk)
+		started := false
+		toolCalls := 0
+
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !strings.HasPrefix(line, "data:") {
+				continue
+			}
+			dataStr := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			var eventData map[string]interface{}
+			if err := json.Unmarshal([]byte(dataStr), &eventData); err != nil {
+				continue
+			}
+
+			// 流中途的错误原样转发后结束
+			if errData, ok := eventData["error"]; ok {
+				if jsonData, err := json.Marshal(map[string]interface{}{"error": errData}); err == nil {
+					output <- fmt.Sprintf("data: %s\n\n", jsonData)
+				}
+				return
+			}
+
+			if !started {
+				output <- t.createOpenAIChunk(&OpenAIMessageResponse{Role: "assistant"}, "")
+				started = true
+			}
+
+			candidates, _ := eventData["candidates"].([]interface{})
+			if len(candidates) == 0 {
+				if feedback, ok := eventData["promptFeedback"].(map[string]interface{}); ok && feedback["blockReason"] != nil {
+					output <- t.createOpenAIChunk(&OpenAIMessageResponse{}, "content_filter")
+				}
+				continue
+			}
+			candidate, _ := candidates[0].(map[string]interface{})
+			text, calls := t.extractParts(candidate, toolCalls)
+			toolCalls += len(calls)
+			if text != "" {
+				output <- t.createOpenAIChunk(&OpenAIMessageResponse{Content: text}, "")
+			}
+			if len(calls) > 0 {
+				output <- t.createOpenAIChunk(&OpenAIMessageResponse{ToolCalls: calls}, "")
+			}
+			if reason, ok := candidate["finishReason"]; ok && reason != nil {
+				output <- t.createOpenAIChunk(&OpenAIMessageResponse{}, geminiFinishReason(reason, toolCalls > 0))
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			log.Printf("⚠️ 读取 Gemini 流式响应失败: %v", err)
+		}
+
+		// 发送结束标记
+		output <- "data: [DONE]\n\n"
+	}()
+
+	return output
+}
@@ -0,0 +1,205 @@
+package transformers
+
+import (
+	"encoding/json"
+	"factory-go-api/config"
+	"strings"
+	"testing"
+)
+
+// geminiBody 转换请求并以 JSON 形式返回，便于按 Gemini 字段名断言
+func geminiBody(t *testing.T, body string) map[string]interface{} {
+	t.Helper()
+	var req OpenAIRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+	geminiReq, err := TransformToGemini(&req)
+	if err != nil {
+		t.Fatalf("TransformToGemini() unexpected error: %v", err)
+	}
+	data, _ := json.Marshal(geminiReq)
+	var result map[string]interface{}
+	_ = json.Unmarshal(data, &result)
+	return result
+}
+
+func TestTransformToGemini(t *testing.T) {
+	setTestConfig(t, &config.Config{
+		SystemPrompt:     "You are Droid.",
+		SystemPromptMode: config.SystemPromptPrepend,
+		Models:           []config.Model{{ID: "gemini-pro", Type: "gemini", Reasoning: "low", MaxOutput: 65536}},
+	})
+
+	body := geminiBody(t, `{"model":"gemini-pro","max_tokens":1000,"temperature":0,"stop":"END","seed":7,
+		"messages":[
+			{"role":"system","content":"Be brief."},
+			{"role":"user","content":"Weather?"},
+			{"role":"assistant","content":"Checking."},
+			{"role":"tool","tool_call_id":"call_1","content":"Sunny"}
+		],
+		"tools":[{"type":"function","function":{"name":"get_weather","description":"Get weather","parameters":{"type":"object","additionalProperties":false}}}],
+		"tool_choice":{"type":"function","function":{"name":"get_weather"}},
+		"response_format":{"type":"json_schema","json_schema":{"name":"answer","schema":{"type":"object"}}}}`)
+
+	data, _ := json.Marshal(body)
+	got := string(data)
+	for _, want := range []string{
+		`"systemInstruction":{"parts":[{"text":"You are Droid."},{"text":"Be brief."}]}`,
+		`"contents":[{"parts":[{"text":"Weather?"}],"role":"user"},{"parts":[{"text":"Checking."}],"role":"model"},{"parts":[{"text":"Result of call_1:\nSunny"}],"role":"user"}]`,
+		`"functionDeclarations":[{"description":"Get weather","name":"get_weather","parametersJsonSchema":{"additionalProperties":false,"type":"object"}}]`,
+		`"toolConfig":{"functionCallingConfig":{"allowedFunctionNames":["get_weather"],"mode":"ANY"}}`,
+		`"stopSequences":["END"]`, `"temperature":0`, `"seed":7`,
+		`"responseMimeType":"application/json"`, `"responseJsonSchema":{"type":"object"}`,
+		// 输出上限不足以容纳思考预算时增加 maxOutputTokens
+		`"maxOutputTokens":8096`, `"thinkingConfig":{"thinkingBudget":4096}`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("request %s\nmissing %s", got, want)
+		}
+	}
+	if _, ok := body["model"]; ok {
+		t.Errorf("model belongs in the URL: %s", got)
+	}
+}
+
+// 响应中的 functionCall 转换为 tool_calls 后，客户端带着结果发回时还原为 functionCall / functionResponse
+func TestGeminiToolRoundTrip(t *testing.T) {
+	setTestConfig(t, &config.Config{})
+
+	body := geminiBody(t, `{"model":"gemini-pro","messages":[
+		{"role":"user","content":"Weather?"},
+		{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]},
+		{"role":"tool","tool_call_id":"call_1","content":"Sunny"}
+	]}`)
+	data, _ := json.Marshal(body["contents"])
+	want := `[{"parts":[{"text":"Weather?"}],"role":"user"},` +
+		`{"parts":[{"functionCall":{"args":{"city":"Paris"},"name":"get_weather"}}],"role":"model"},` +
+		`{"parts":[{"functionResponse":{"name":"get_weather","response":{"content":"Sunny"}}}],"role":"user"}]`
+	if string(data) != want {
+		t.Errorf("contents = %s\nwant %s", data, want)
+	}
+}
+
+func TestTransformToGeminiContentParts(t *testing.T) {
+	setTestConfig(t, &config.Config{})
+
+	body := geminiBody(t, `{"model":"gemini-pro","messages":[{"role":"user","content":[
+		{"type":"text","text":"Describe"},
+		{"type":"image_url","image_url":{"url":"data:image/png;base64,iVBORw0KGgo="}}
+	]}]}`)
+	parts := body["contents"].([]interface{})[0].(map[string]interface{})["parts"].([]interface{})
+	data, _ := json.Marshal(parts)
+	if want := `[{"text":"Describe"},{"inlineData":{"data":"iVBORw0KGgo=","mimeType":"image/png"}}]`; string(data) != want {
+		t.Errorf("parts = %s", data)
+	}
+	if _, ok := body["generationConfig"].(map[string]interface{})["thinkingConfig"]; ok {
+		t.Error("thinkingConfig should be omitted without reasoning")
+	}
+
+	for body, want := range map[string]string{
+		`{"model":"m","messages":[{"role":"user","content":"hi"}],"tools":[{"type":"web_search"}]}`: "only function tools",
+		`{"model":"m","messages":[{"role":"user","content":"hi"}],"tool_choice":"sometimes"}`:       "tool_choice",
+		// 未启用 image_fetch 时远程图片无法以 inlineData 发送
+		`{"model":"m","messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"https://example.com/cat.jpg"}}]}]}`: "image URLs are not supported",
+	} {
+		var req OpenAIRequest
+		_ = json.Unmarshal([]byte(body), &req)
+		if _, err := TransformToGemini(&req); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("TransformToGemini(%s) err = %v", body, err)
+		}
+	}
+}
+
+func TestGeminiNonStreamResponse(t *testing.T) {
+	var geminiResp map[string]interface{}
+	_ = json.Unmarshal([]byte(`{"responseId":"resp-1","candidates":[{"content":{"role":"model","parts":[
+		{"text":"Planning the call","thought":true},
+		{"text":"Let me check."},
+		{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}}
+	]},"finishReason":"STOP"}],
+	"usageMetadata":{"promptTokenCount":12,"candidatesTokenCount":5,"thoughtsTokenCount":3,"totalTokenCount":20,"cachedContentTokenCount":4}}`), &geminiResp)
+
+	resp, err := NewGeminiResponseTransformer("gemini-pro", "").TransformNonStreamResponse(geminiResp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	choice := resp.Choices[0]
+	if resp.ID != "resp-1" || resp.Model != "gemini-pro" || choice.Message.Content != "Let me check." || *choice.FinishReason != "tool_calls" {
+		t.Errorf("response = %+v, message = %+v", resp, choice.Message)
+	}
+	if len(choice.Message.ToolCalls) != 1 {
+		t.Fatalf("tool_calls = %+v", choice.Message.ToolCalls)
+	}
+	call := choice.Message.ToolCalls[0]
+	if call.Index != nil || call.Type != "function" || call.Function.Name != "get_weather" || call.Function.Arguments != `{"city":"Paris"}` || !strings.HasPrefix(call.ID, "call_") {
+		t.Errorf("tool call = %+v", call)
+	}
+	data, _ := json.Marshal(resp.Usage)
+	if want := `{"completion_tokens":8,"completion_tokens_details":{"reasoning_tokens":3},"prompt_tokens":12,"prompt_tokens_details":{"cached_tokens":4},"total_tokens":20}`; string(data) != want {
+		t.Errorf("usage = %s", data)
+	}
+
+	// 提示词被拦截时没有候选结果
+	var blocked map[string]interface{}
+	_ = json.Unmarshal([]byte(`{"promptFeedback":{"blockReason":"SAFETY"}}`), &blocked)
+	resp, _ = NewGeminiResponseTransformer("gemini-pro", "").TransformNonStreamResponse(blocked)
+	if *resp.Choices[0].FinishReason != "content_filter" {
+		t.Errorf("blocked finish_reason = %s", *resp.Choices[0].FinishReason)
+	}
+}
+
+func TestGeminiStream(t *testing.T) {
+	stream := "data: {\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"text\":\"Hmm\",\"thought\":true}]}}]}\r\n\r\n" +
+		"data: {\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"text\":\"Hello \"}]}}]}\r\n\r\n" +
+		"data: {\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"text\":\"world\"},{\"functionCall\":{\"name\":\"lookup\",\"args\":{}}}]},\"finishReason\":\"STOP\"}]}\r\n\r\n"
+
+	var content, finishReason string
+	var toolCalls []OpenAIToolCall
+	var chunks []string
+	for chunk := range NewGeminiResponseTransformer("gemini-pro", "req-1").TransformStream(strings.NewReader(stream)) {
+		chunks = append(chunks, chunk)
+		if chunk == "data: [DONE]\n\n" {
+			continue
+		}
+		var resp OpenAIResponse
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(chunk), "data: ")), &resp); err != nil {
+			t.Fatalf("invalid chunk %q: %v", chunk, err)
+		}
+		if resp.ID != "req-1" || resp.Object != "chat.completion.chunk" || resp.Model != "gemini-pro" {
+			t.Errorf("chunk = %s", chunk)
+		}
+		content += resp.Choices[0].Delta.Content
+		toolCalls = append(toolCalls, resp.Choices[0].Delta.ToolCalls...)
+		if resp.Choices[0].FinishReason != nil {
+			finishReason = *resp.Choices[0].FinishReason
+		}
+	}
+
+	if content != "Hello world" || finishReason != "tool_calls" || chunks[len(chunks)-1] != "data: [DONE]\n\n" {
+		t.Errorf("content = %q, finish_reason = %q, chunks = %q", content, finishReason, chunks)
+	}
+	if len(toolCalls) != 1 || toolCalls[0].Index == nil || *toolCalls[0].Index != 0 || toolCalls[0].Function.Arguments != "{}" {
+		t.Errorf("tool_calls = %+v", toolCalls)
+	}
+	if !strings.Contains(chunks[0], `"role":"assistant"`) {
+		t.Errorf("first chunk = %s", chunks[0])
+	}
+}
+
+func TestEstimateGeminiTokens(t *testing.T) {
+	req := &GeminiRequest{
+		SystemInstruction: &GeminiContent{Parts: []map[string]interface{}{{"text": "Be brief."}}},
+		Contents: []GeminiContent{{Role: "user", Parts: []map[string]interface{}{
+			{"text": "Hello world"},
+			{"fileData": map[string]interface{}{"fileUri": "https://example.com/cat.jpg"}},
+		}}},
+	}
+	// 3 + (3 + 3) + (3 + 2 + 258)
+	if got := EstimateGeminiTokens(req); got != 272 {
+		t.Errorf("EstimateGeminiTokens() = %d, want 272", got)
+	}
+	if got := geminiImageTokens(1000, 800); got != 4*geminiImageTileTokens {
+		t.Errorf("geminiImageTokens(1000, 800) = %d", got)
+	}
+}
@@ -0,0 +1,181 @@
+package transformers
+
+import (
+	"bytes"
+	"encoding/json"
+	"factory-go-api/config"
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// update 使用当前输出覆盖 golden 文件：go test ./transformers -run TestGolden -update
+var update = flag.Bool("update", false, "用当前输出覆盖 golden 文件")
+
+// goldenRequestID 固定的响应 ID，保证输出可重复
+const goldenRequestID = "chatcmpl-golden"
+
+// goldenOptions 用例目录下可选的 options.json
+type goldenOptions struct {
+	Model            string `json:"model"`
+	StructuredOutput bool   `json:"structured_output"`
+	IncludeUsage     bool   `json:"include_usage"`
+}
+
+// goldenFamily 一类 golden 用例：输入文件 → 转换 → 期望输出文件
+type goldenFamily struct {
+	input    string
+	expected string
+	run      func(t *testing.T, input []byte, opts goldenOptions) []byte
+}
+
+// goldenConfig golden 用例使用的固定配置
+func goldenConfig() *config.Config {
+	return &config.Config{
+		Models: []config.Model{
+			{Name: "Claude Sonnet", ID: "claude-sonnet", Type: "anthropic"},
+			{Name: "Claude Opus", ID: "claude-opus", Type: "anthropic", Reasoning: "high"},
+			{Name: "GPT-5", ID: "gpt-5", Type: "openai", Reasoning: "high"},
+		},
+		SystemPrompt:     "You are Droid, an AI software engineering agent.",
+		SystemPromptMode: config.SystemPromptPrepend,
+		PromptCache:      config.PromptCacheConfig{Enabled: true, CacheSystem: true, CacheLastTurns: 2},
+	}
+}
+
+var goldenFamilies = map[string]goldenFamily{
+	"anthropic_request": {"input.json", "expected.json", func(t *testing.T, input []byte, opts goldenOptions) []byte {
+		anthropicReq, err := TransformToAnthropic(decodeGoldenRequest(t, input))
+		return marshalGolden(t, anthropicReq, err)
+	}},
+	"responses_request": {"input.json", "expected.json", func(t *testing.T, input []byte, opts goldenOptions) []byte {
+		factoryReq, err := TransformToFactoryOpenAI(decodeGoldenRequest(t, input))
+		return marshalGolden(t, factoryReq, err)
+	}},
+	"anthropic_response": {"input.json", "expected.json", func(t *testing.T, input []byte, opts goldenOptions) []byte {
+		transformer := NewAnthropicResponseTransformer(opts.Model, goldenRequestID)
+		transformer.Created = 0
+		transformer.StructuredOutput = opts.StructuredOutput
+		resp, err := transformer.TransformNonStreamResponse(decodeGoldenMap(t, input))
+		return marshalGolden(t, resp, err)
+	}},
+	"responses_response": {"input.json", "expected.json", func(t *testing.T, input []byte, opts goldenOptions) []byte {
+		transformer := NewFactoryOpenAIResponseTransformer(opts.Model, goldenRequestID)
+		transformer.Created = 0
+		resp, err := transformer.TransformNonStreamResponse(decodeGoldenMap(t, input))
+		return marshalGolden(t, resp, err)
+	}},
+	"anthropic_stream": {"input.sse", "expected.sse", func(t *testing.T, input []byte, opts goldenOptions) []byte {
+		transformer := NewAnthropicResponseTransformer(opts.Model, goldenRequestID)
+		transformer.Created = 0
+		transformer.StructuredOutput = opts.StructuredOutput
+		transformer.IncludeUsage = opts.IncludeUsage
+		return drainGoldenStream(transformer.TransformStream(bytes.NewReader(input)))
+	}},
+	"responses_stream": {"input.sse", "expected.sse", func(t *testing.T, input []byte, opts goldenOptions) []byte {
+		transformer := NewFactoryOpenAIResponseTransformer(opts.Model, goldenRequestID)
+		transformer.Created = 0
+		return drainGoldenStream(transformer.TransformStream(bytes.NewReader(input)))
+	}},
+}
+
+// TestGolden 遍历 testdata/golden/<family>/<case>/，比较转换结果与期望输出
+func TestGolden(t *testing.T) {
+	setTestConfig(t, goldenConfig())
+
+	names := make([]string, 0, len(goldenFamilies))
+	for name := range goldenFamilies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		family := goldenFamilies[name]
+		dirs, err := filepath.Glob(filepath.Join("testdata", "golden", name, "*"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(dirs) == 0 {
+			t.Errorf("golden family %s has no cases", name)
+		}
+		for _, dir := range dirs {
+			dir := dir
+			t.Run(name+"/"+filepath.Base(dir), func(t *testing.T) {
+				runGoldenCase(t, dir, family)
+			})
+		}
+	}
+}
+
+func runGoldenCase(t *testing.T, dir string, family goldenFamily) {
+	input, err := os.ReadFile(filepath.Join(dir, family.input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := goldenOptions{Model: "golden-model"}
+	if data, err := os.ReadFile(filepath.Join(dir, "options.json")); err == nil {
+		if err := json.Unmarshal(data, &opts); err != nil {
+			t.Fatalf("invalid options.json: %v", err)
+		}
+	}
+
+	got := family.run(t, input, opts)
+	expectedPath := filepath.Join(dir, family.expected)
+	if *update {
+		if err := os.WriteFile(expectedPath, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(expectedPath)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s (run with -update to accept)\n--- got ---\n%s\n--- want ---\n%s", expectedPath, got, want)
+	}
+}
+
+func decodeGoldenRequest(t *testing.T, input []byte) *OpenAIRequest {
+	t.Helper()
+	var req OpenAIRequest
+	if err := json.Unmarshal(input, &req); err != nil {
+		t.Fatalf("invalid input.json: %v", err)
+	}
+	return &req
+}
+
+func decodeGoldenMap(t *testing.T, input []byte) map[string]interface{} {
+	t.Helper()
+	var v map[string]interface{}
+	if err := json.Unmarshal(input, &v); err != nil {
+		t.Fatalf("invalid input.json: %v", err)
+	}
+	return v
+}
+
+// marshalGolden 将转换结果格式化为 JSON，转换失败时记录错误信息
+func marshalGolden(t *testing.T, v interface{}, err error) []byte {
+	t.Helper()
+	if err != nil {
+		v = map[string]string{"error": err.Error()}
+	}
+	data, marshalErr := json.MarshalIndent(v, "", "  ")
+	if marshalErr != nil {
+		t.Fatal(marshalErr)
+	}
+	return append(data, '\n')
+}
+
+// drainGoldenStream 收集转换后的 SSE 输出
+func drainGoldenStream(output chan string) []byte {
+	var sb strings.Builder
+	for chunk := range output {
+		sb.WriteString(chunk)
+	}
+	return []byte(sb.String())
+}
@@ -0,0 +1,226 @@
+package transformers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"factory-go-api/config"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// anthropicImageMediaTypes Anthropic 支持的图片格式
+var anthropicImageMediaTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// errBlockedImageAddress 图片地址解析到内网、回环或链路本地地址
+var errBlockedImageAddress = errors.New("image host resolves to a private or loopback address")
+
+// imageFetchClient 拉取远程图片使用的 HTTP 客户端
+// 不使用环境变量中的代理，连接前检查解析后的 IP，重定向的每一跳都重新检查白名单
+var imageFetchClient = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || isBlockedImageIP(ip) {
+					return errBlockedImageAddress
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return errors.New("stopped after 5 redirects")
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return fmt.Errorf("redirect to unsupported scheme '%s'", req.URL.Scheme)
+		}
+		if !isHostAllowed(req.URL.Hostname(), config.GetImageFetchConfig().AllowedHosts) {
+			return fmt.Errorf("redirect to host '%s' which is not in the allowlist", req.URL.Hostname())
+		}
+		return nil
+	},
+}
+
+// isBlockedImageIP 回环、私有、链路本地、组播和未指定地址不允许作为图片来源（包括云厂商元数据地址）
+func isBlockedImageIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified()
+}
+
+// extractImageURL 从 OpenAI image_url 字段中提取 url 和 detail
+// image_url 可以是 {"url": "...", "detail": "..."} 对象，也兼容直接传字符串
+func extractImageURL(imageURL interface{}) (string, string) {
+	switch v := imageURL.(type) {
+	case string:
+		return v, ""
+	case map[string]interface{}:
+		urlStr, _ := v["url"].(string)
+		detail, _ := v["detail"].(string)
+		return urlStr, detail
+	}
+	return "", ""
+}
+
+// transformImageToAnthropic 将 OpenAI image_url 内容块转换为 Anthropic image 内容块
+// data URI 转换为 base64 source，远程 URL 转换为 url source（启用 image_fetch 时拉取后内联）
+// Anthropic 没有 detail 参数，只做合法性校验后丢弃
+func transformImageToAnthropic(ctx context.Context, part map[string]interface{}) (map[string]interface{}, error) {
+	urlStr, detail := extractImageURL(part["image_url"])
+	if urlStr == "" {
+		return nil, fmt.Errorf("image_url.url is required")
+	}
+	if detail != "" && detail != "auto" && detail != "low" && detail != "high" {
+		return nil, fmt.Errorf("invalid image_url.detail '%s': expected auto, low or high", detail)
+	}
+
+	fetchCfg := config.GetImageFetchConfig()
+
+	if strings.HasPrefix(urlStr, "data:") {
+		mediaType, data, err := parseImageDataURI(urlStr, fetchCfg.MaxBytes)
+		if err != nil {
+			return nil, err
+		}
+		return anthropicBase64Image(mediaType, data), nil
+	}
+
+	parsed, err := url.Parse(urlStr)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid image url: only http(s) URLs and base64 data URIs are supported")
+	}
+
+	if !fetchCfg.Enabled {
+		return map[string]interface{}{
+			"type": "image",
+			"source": map[string]interface{}{
+				"type": "url",
+				"url":  urlStr,
+			},
+		}, nil
+	}
+
+	if !isHostAllowed(parsed.Hostname(), fetchCfg.AllowedHosts) {
+		return nil, fmt.Errorf("image host '%s' is not in the allowlist", parsed.Hostname())
+	}
+
+	mediaType, data, err := fetchImage(ctx, urlStr, fetchCfg.MaxBytes)
+	if err != nil {
+		return nil, err
+	}
+	return anthropicBase64Image(mediaType, data), nil
+}
+
+// anthropicBase64Image 构造 Anthropic base64 图片块
+func anthropicBase64Image(mediaType, data string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "image",
+		"source": map[string]interface{}{
+			"type":       "base64",
+			"media_type": mediaType,
+			"data":       data,
+		},
+	}
+}
+
+// parseImageDataURI 解析 data:image/png;base64,xxx 格式的 data URI
+func parseImageDataURI(dataURI string, maxBytes int64) (string, string, error) {
+	header, data, found := strings.Cut(strings.TrimPrefix(dataURI, "data:"), ",")
+	if !found {
+		return "", "", fmt.Errorf("invalid image data URI")
+	}
+
+	params := strings.Split(header, ";")
+	mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+	isBase64 := false
+	for _, param := range params[1:] {
+		if strings.TrimSpace(param) == "base64" {
+			isBase64 = true
+		}
+	}
+	if !isBase64 {
+		return "", "", fmt.Errorf("image data URI must be base64 encoded")
+	}
+	if !anthropicImageMediaTypes[mediaType] {
+		return "", "", fmt.Errorf("unsupported image media type '%s'", mediaType)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid base64 image data: %v", err)
+	}
+	if maxBytes > 0 && int64(len(decoded)) > maxBytes {
+		return "", "", fmt.Errorf("image exceeds maximum size of %d bytes", maxBytes)
+	}
+
+	return mediaType, data, nil
+}
+
+// fetchImage 拉取远程图片并返回 media type 和 base64 数据，客户端断开时随 ctx 取消
+func fetchImage(ctx context.Context, urlStr string, maxBytes int64) (string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlStr, nil)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to fetch image: %v", err)
+	}
+	resp, err := imageFetchClient.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to fetch image: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("failed to fetch image: upstream returned %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to fetch image: %v", err)
+	}
+	if int64(len(body)) > maxBytes {
+		return "", "", fmt.Errorf("image exceeds maximum size of %d bytes", maxBytes)
+	}
+
+	// 优先使用实际内容嗅探的类型，避免服务器返回错误的 Content-Type
+	mediaType := http.DetectContentType(body)
+	if !anthropicImageMediaTypes[mediaType] {
+		mediaType = strings.ToLower(strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0]))
+	}
+	if !anthropicImageMediaTypes[mediaType] {
+		return "", "", fmt.Errorf("unsupported image media type '%s'", mediaType)
+	}
+
+	return mediaType, base64.StdEncoding.EncodeToString(body), nil
+}
+
+// isHostAllowed 检查主机是否在白名单中，支持 *.example.com 形式的通配
+// 白名单为空时拒绝所有主机，避免开放代理被用于访问内网地址
+func isHostAllowed(host string, allowedHosts []string) bool {
+	host = strings.ToLower(host)
+	for _, allowed := range allowedHosts {
+		allowed = strings.ToLower(allowed)
+		if allowed == host {
+			return true
+		}
+		if strings.HasPrefix(allowed, "*.") && strings.HasSuffix(host, allowed[1:]) {
+			return true
+		}
+	}
+	return false
+}
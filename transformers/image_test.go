@@ -0,0 +1,140 @@
+package transformers
+
+import (
+	"context"
+	"factory-go-api/config"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// setTestConfig 在测试期间替换全局配置，结束后恢复
+func setTestConfig(t *testing.T, cfg *config.Config) {
+	t.Helper()
+	previous := config.GetConfig()
+	config.SetConfig(cfg)
+	t.Cleanup(func() { config.SetConfig(previous) })
+}
+
+func TestTransformImageToAnthropic(t *testing.T) {
+	tests := []struct {
+		name       string
+		imageURL   interface{}
+		wantSource string
+		wantErr    string
+	}{
+		{
+			name:       "data URI 转换为 base64",
+			imageURL:   map[string]interface{}{"url": "data:image/png;base64,iVBORw0KGgo=", "detail": "high"},
+			wantSource: "base64",
+		},
+		{
+			name:       "远程 URL 转换为 url source",
+			imageURL:   map[string]interface{}{"url": "https://example.com/cat.jpg"},
+			wantSource: "url",
+		},
+		{
+			name:       "字符串形式的 image_url",
+			imageURL:   "https://example.com/cat.jpg",
+			wantSource: "url",
+		},
+		{
+			name:     "不支持的图片格式",
+			imageURL: map[string]interface{}{"url": "data:image/bmp;base64,Qk0="},
+			wantErr:  "unsupported image media type",
+		},
+		{
+			name:     "非法 detail",
+			imageURL: map[string]interface{}{"url": "https://example.com/cat.jpg", "detail": "ultra"},
+			wantErr:  "invalid image_url.detail",
+		},
+		{
+			name:     "非 http 协议",
+			imageURL: map[string]interface{}{"url": "file:///etc/passwd"},
+			wantErr:  "invalid image url",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block, err := transformImageToAnthropic(context.Background(), map[string]interface{}{
+				"type":      "image_url",
+				"image_url": tt.imageURL,
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("transformImageToAnthropic() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("transformImageToAnthropic() unexpected error: %v", err)
+			}
+			source, _ := block["source"].(map[string]interface{})
+			if block["type"] != "image" || source["type"] != tt.wantSource {
+				t.Errorf("transformImageToAnthropic() = %v, want source type %s", block, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestIsHostAllowed(t *testing.T) {
+	allowed := []string{"images.example.com", "*.cdn.example.net"}
+	cases := map[string]bool{
+		"images.example.com":   true,
+		"a.cdn.example.net":    true,
+		"cdn.example.net":      false,
+		"evil.com":             false,
+		"images.example.com.x": false,
+	}
+	for host, want := range cases {
+		if got := isHostAllowed(host, allowed); got != want {
+			t.Errorf("isHostAllowed(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
+
+func TestFetchImageBlocksInternalAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("internal address should not be reached")
+	}))
+	defer server.Close()
+	setTestConfig(t, &config.Config{ImageFetch: config.ImageFetchConfig{Enabled: true, MaxBytes: 1 << 20, AllowedHosts: []string{"127.0.0.1", "images.example.com"}}})
+
+	// 白名单中的主机解析到回环地址时拒绝连接
+	_, err := transformImageToAnthropic(context.Background(), map[string]interface{}{"image_url": server.URL + "/cat.png"})
+	if err == nil || !strings.Contains(err.Error(), "private or loopback") {
+		t.Errorf("error = %v, want blocked address", err)
+	}
+
+	// 重定向的每一跳都重新检查白名单
+	for target, wantErr := range map[string]bool{
+		"http://169.254.169.254/latest/meta-data": true,
+		"file:///etc/passwd":                      true,
+		"https://images.example.com/cat.png":      false,
+	} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if err := imageFetchClient.CheckRedirect(req, []*http.Request{req}); (err != nil) != wantErr {
+			t.Errorf("CheckRedirect(%s) = %v, want error %v", target, err, wantErr)
+		}
+	}
+
+	for _, ip := range []string{"10.0.0.1", "192.168.1.1", "169.254.169.254", "::1", "fe80::1", "0.0.0.0"} {
+		if !isBlockedImageIP(net.ParseIP(ip)) {
+			t.Errorf("isBlockedImageIP(%s) = false", ip)
+		}
+	}
+	if isBlockedImageIP(net.ParseIP("93.184.216.34")) {
+		t.Error("public address should not be blocked")
+	}
+}
+
+func TestFetchImageHonorsContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := fetchImage(ctx, "https://images.example.com/cat.png", 1<<20); err == nil || !strings.Contains(err.Error(), "context canceled") {
+		t.Errorf("error = %v, want context canceled", err)
+	}
+}
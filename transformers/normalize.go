@@ -0,0 +1,233 @@
+package transformers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// leadingUserPlaceholder 对话以 assistant 开头时插入的占位 user 消息
+// Anthropic 要求第一条消息必须是 user
+const leadingUserPlaceholder = "(continue)"
+
+// normalizeAnthropicMessages 将 OpenAI 消息列表规范化为 Anthropic 可接受的格式
+// 1. system / developer 消息提取为 system 块
+// 2. assistant 的 tool_calls 转换为 tool_use 块，tool 消息转换为 user 消息中的 tool_result 块（找不到对应调用时以文本保留）
+// 3. 过滤空文本块和空消息，合并相邻同角色消息
+// 4. 对话以 assistant 开头时插入占位 user 消息
+// 无法修复的历史（未知角色、非法内容、没有任何对话消息）返回带消息下标的错误
+func normalizeAnthropicMessages(ctx context.Context, messages []OpenAIMessage) ([]map[string]interface{}, []AnthropicMessage, error) {
+	var systemBlocks []map[string]interface{}
+	var result []AnthropicMessage
+	// toolUseIDs 已转换的 tool_use id，只有能配对的 tool 消息才转换为 tool_result
+	toolUseIDs := map[string]bool{}
+
+	for i, msg := range messages {
+		role := msg.Role
+		switch role {
+		case "system", "developer":
+			blocks, err := transformSystemContent(msg)
+			if err != nil {
+				return nil, nil, fmt.Errorf("messages[%d]: %w", i, err)
+			}
+			systemBlocks = append(systemBlocks, blocks...)
+			continue
+		case "tool", "function":
+			role = "user"
+		case "user", "assistant":
+		case "":
+			return nil, nil, fmt.Errorf("messages[%d]: role is required", i)
+		default:
+			return nil, nil, fmt.Errorf("messages[%d]: unsupported role '%s'", i, msg.Role)
+		}
+
+		blocks, err := transformContentToAnthropic(ctx, msg, toolUseIDs)
+		if err != nil {
+			return nil, nil, fmt.Errorf("messages[%d]: %w", i, err)
+		}
+		if len(blocks) == 0 {
+			// 空消息直接跳过
+			continue
+		}
+
+		// 合并相邻同角色消息
+		if len(result) > 0 && result[len(result)-1].Role == role {
+			result[len(result)-1].Content = append(result[len(result)-1].Content, blocks...)
+			continue
+		}
+		result = append(result, AnthropicMessage{Role: role, Content: blocks})
+	}
+
+	if len(result) == 0 {
+		return nil, nil, fmt.Errorf("messages: at least one non-empty user message is required")
+	}
+
+	if result[0].Role == "assistant" {
+		result = append([]AnthropicMessage{{
+			Role: "user",
+			Content: []map[string]interface{}{
+				{"type": "text", "text": leadingUserPlaceholder},
+			},
+		}}, result...)
+	}
+
+	return systemBlocks, result, nil
+}
+
+// transformSystemContent 将 system / developer 消息转换为 system 块
+func transformSystemContent(msg OpenAIMessage) ([]map[string]interface{}, error) {
+	var texts []string
+	switch content := msg.Content.(type) {
+	case string:
+		texts = append(texts, content)
+	case []interface{}:
+		for j, part := range content {
+			partMap, ok := part.(map[string]interface{})
+			if !ok || partMap["type"] != "text" {
+				return nil, fmt.Errorf("content[%d]: system messages only support text parts", j)
+			}
+			text, _ := partMap["text"].(string)
+			texts = append(texts, text)
+		}
+	case nil:
+	default:
+		return nil, fmt.Errorf("content must be a string or an array of content parts")
+	}
+
+	var blocks []map[string]interface{}
+	for _, text := range texts {
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		blocks = append(blocks, map[string]interface{}{
+			"type": "text",
+			"text": text,
+		})
+	}
+	if msg.CacheControl != nil && len(blocks) > 0 {
+		blocks[len(blocks)-1]["cache_control"] = msg.CacheControl
+	}
+	return blocks, nil
+}
+
+// transformContentToAnthropic 将单条 user / assistant / tool 消息的内容转换为 Anthropic 内容块
+// toolUseIDs 记录之前消息中的 tool_use id，assistant 消息的工具调用会加入其中
+func transformContentToAnthropic(ctx context.Context, msg OpenAIMessage, toolUseIDs map[string]bool) ([]map[string]interface{}, error) {
+	var blocks []map[string]interface{}
+
+	switch content := msg.Content.(type) {
+	case string:
+		if strings.TrimSpace(content) != "" {
+			blocks = append(blocks, map[string]interface{}{
+				"type": "text",
+				"text": content,
+			})
+		}
+	case []interface{}:
+		for j, part := range content {
+			partMap, ok := part.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("content[%d] must be an object", j)
+			}
+
+			switch partType, _ := partMap["type"].(string); partType {
+			case "image_url":
+				imageBlock, err := transformImageToAnthropic(ctx, partMap)
+				if err != nil {
+					return nil, fmt.Errorf("content[%d]: %w", j, err)
+				}
+				copyCacheControl(partMap, imageBlock)
+				blocks = append(blocks, imageBlock)
+			case "file":
+				documentBlock, err := transformFileToAnthropic(partMap)
+				if err != nil {
+					return nil, fmt.Errorf("content[%d]: %w", j, err)
+				}
+				copyCacheControl(partMap, documentBlock)
+				blocks = append(blocks, documentBlock)
+			case "text":
+				if text, _ := partMap["text"].(string); strings.TrimSpace(text) == "" {
+					continue
+				}
+				fallthrough
+			default:
+				// 复制一份，避免后续添加 cache_control 时修改客户端请求
+				block := make(map[string]interface{}, len(partMap))
+				for key, value := range partMap {
+					block[key] = value
+				}
+				blocks = append(blocks, block)
+			}
+		}
+	case nil:
+	default:
+		return nil, fmt.Errorf("content must be a string or an array of content parts")
+	}
+
+	// assistant 的工具调用转换为 tool_use 块，放在文本之后
+	if msg.Role == "assistant" {
+		for j, call := range msg.ToolCalls {
+			toolUse, err := toolCallToAnthropic(call)
+			if err != nil {
+				return nil, fmt.Errorf("tool_calls[%d]: %w", j, err)
+			}
+			blocks = append(blocks, toolUse)
+			toolUseIDs[call.ID] = true
+		}
+	}
+
+	// tool 消息转换为 tool_result 块，通过 tool_use_id 与对应的 tool_use 配对
+	if msg.Role == "tool" && toolUseIDs[msg.ToolCallID] {
+		toolResult := map[string]interface{}{
+			"type":        "tool_result",
+			"tool_use_id": msg.ToolCallID,
+		}
+		if len(blocks) > 0 {
+			toolResult["content"] = blocks
+		}
+		blocks = []map[string]interface{}{toolResult}
+	}
+
+	// 无法配对的 tool 消息和 function 消息的结果以文本形式保留，并标注来源
+	if (msg.Role == "tool" || msg.Role == "function") && len(blocks) > 0 && blocks[0]["type"] != "tool_result" {
+		label := msg.Name
+		if label == "" {
+			label = msg.ToolCallID
+		}
+		if label != "" && blocks[0]["type"] == "text" {
+			if text, ok := blocks[0]["text"].(string); ok {
+				blocks[0]["text"] = fmt.Sprintf("Result of %s:\n%s", label, text)
+			}
+		}
+	}
+
+	// 消息级 cache_control 作用于该消息的最后一个内容块
+	if msg.CacheControl != nil && len(blocks) > 0 {
+		blocks[len(blocks)-1]["cache_control"] = msg.CacheControl
+	}
+
+	return blocks, nil
+}
+
+// toolCallToAnthropic 将 assistant 消息中的工具调用转换为 tool_use 块
+func toolCallToAnthropic(call OpenAIToolCall) (map[string]interface{}, error) {
+	if call.ID == "" {
+		return nil, fmt.Errorf("id is required")
+	}
+	if call.Function.Name == "" {
+		return nil, fmt.Errorf("function.name is required")
+	}
+	input := map[string]interface{}{}
+	if strings.TrimSpace(call.Function.Arguments) != "" {
+		if err := json.Unmarshal([]byte(call.Function.Arguments), &input); err != nil || input == nil {
+			return nil, fmt.Errorf("function.arguments must be a JSON object")
+		}
+	}
+	return map[string]interface{}{
+		"type":  "tool_use",
+		"id":    call.ID,
+		"name":  call.Function.Name,
+		"input": input,
+	}, nil
+}
@@ -0,0 +1,140 @@
+package transformers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeAnthropicMessages(t *testing.T) {
+	system, messages, err := normalizeAnthropicMessages(context.Background(), []OpenAIMessage{
+		{Role: "developer", Content: "Be brief."},
+		{Role: "assistant", Content: "Hello!"},
+		{Role: "user", Content: "first"},
+		{Role: "user", Content: []interface{}{map[string]interface{}{"type": "text", "text": "second"}}},
+		{Role: "assistant", Content: nil},
+		{Role: "user", Content: ""},
+		{Role: "tool", Name: "get_weather", Content: "sunny"},
+	})
+	if err != nil {
+		t.Fatalf("normalizeAnthropicMessages() unexpected error: %v", err)
+	}
+
+	if len(system) != 1 || system[0]["text"] != "Be brief." {
+		t.Errorf("system = %v, want developer message", system)
+	}
+
+	wantRoles := []string{"user", "assistant", "user"}
+	if len(messages) != len(wantRoles) {
+		t.Fatalf("len(messages) = %d, want %d: %v", len(messages), len(wantRoles), messages)
+	}
+	for i, role := range wantRoles {
+		if messages[i].Role != role {
+			t.Errorf("messages[%d].role = %s, want %s", i, messages[i].Role, role)
+		}
+	}
+	if messages[0].Content[0]["text"] != leadingUserPlaceholder {
+		t.Errorf("leading assistant should be preceded by a placeholder user message")
+	}
+	if len(messages[2].Content) != 3 {
+		t.Errorf("adjacent user/tool messages should be merged into 3 blocks, got %v", messages[2].Content)
+	}
+	if text, _ := messages[2].Content[2]["text"].(string); !strings.HasPrefix(text, "Result of get_weather") {
+		t.Errorf("tool result text = %q", text)
+	}
+}
+
+func TestNormalizeAnthropicMessagesErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []OpenAIMessage
+		wantErr  string
+	}{
+		{
+			name:     "未知角色",
+			messages: []OpenAIMessage{{Role: "user", Content: "hi"}, {Role: "robot", Content: "beep"}},
+			wantErr:  "messages[1]: unsupported role 'robot'",
+		},
+		{
+			name:     "只有 system 消息",
+			messages: []OpenAIMessage{{Role: "system", Content: "You are helpful."}},
+			wantErr:  "at least one non-empty user message",
+		},
+		{
+			name:     "非法内容类型",
+			messages: []OpenAIMessage{{Role: "user", Content: 42.0}},
+			wantErr:  "messages[0]: content must be a string",
+		},
+		{
+			name: "非法工具参数",
+			messages: []OpenAIMessage{{Role: "user", Content: "hi"}, {Role: "assistant", ToolCalls: []OpenAIToolCall{
+				{ID: "call_1", Type: "function", Function: OpenAIFunctionCall{Name: "f", Arguments: "[1]"}},
+			}}},
+			wantErr: "messages[1]: tool_calls[0]: function.arguments must be a JSON object",
+		},
+		{
+			name: "非法图片",
+			messages: []OpenAIMessage{{Role: "user", Content: []interface{}{
+				map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": "ftp://x"}},
+			}}},
+			wantErr: "messages[0]: content[0]: invalid image url",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := normalizeAnthropicMessages(context.Background(), tt.messages)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("normalizeAnthropicMessages() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// Anthropic 返回的 tool_use 转换为 tool_calls 后，客户端带着结果发回时还原为配对的 tool_use / tool_result
+func TestAnthropicToolRoundTrip(t *testing.T) {
+	resp, err := NewAnthropicResponseTransformer("claude", "").TransformNonStreamResponse(map[string]interface{}{
+		"id":          "msg_1",
+		"stop_reason": "tool_use",
+		"content": []interface{}{
+			map[string]interface{}{"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": map[string]interface{}{"city": "Paris"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(resp.Choices[0].Message)
+	var assistant OpenAIMessage
+	if err := json.Unmarshal(data, &assistant); err != nil {
+		t.Fatal(err)
+	}
+
+	_, messages, err := normalizeAnthropicMessages(context.Background(), []OpenAIMessage{
+		{Role: "user", Content: "Weather in Paris?"},
+		assistant,
+		{Role: "tool", ToolCallID: "toolu_1", Content: "Sunny"},
+		// 找不到对应调用的结果以文本保留，避免 Anthropic 拒绝请求
+		{Role: "tool", ToolCallID: "toolu_unknown", Content: "Rainy"},
+	})
+	if err != nil {
+		t.Fatalf("normalizeAnthropicMessages() unexpected error: %v", err)
+	}
+	if len(messages) != 3 {
+		t.Fatalf("messages = %v", messages)
+	}
+	toolUse := messages[1].Content[0]
+	if toolUse["type"] != "tool_use" || toolUse["id"] != "toolu_1" || toolUse["name"] != "get_weather" {
+		t.Errorf("tool_use = %v", toolUse)
+	}
+	if input, _ := toolUse["input"].(map[string]interface{}); input["city"] != "Paris" {
+		t.Errorf("tool_use input = %v", toolUse["input"])
+	}
+	toolResult := messages[2].Content[0]
+	if toolResult["type"] != "tool_result" || toolResult["tool_use_id"] != "toolu_1" {
+		t.Errorf("tool_result = %v", toolResult)
+	}
+	if text, _ := messages[2].Content[1]["text"].(string); text != "Result of toolu_unknown:\nRainy" {
+		t.Errorf("unpaired tool result = %v", messages[2].Content[1])
+	}
+}
@@ -0,0 +1,159 @@
+package transformers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// openAIRequestFields OpenAIRequest 能识别的 JSON 字段名
+var openAIRequestFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeOf(OpenAIRequest{})
+	for i := 0; i < t.NumField(); i++ {
+		if name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}()
+
+// ExtraFields 返回请求体中 OpenAIRequest 未识别的字段，供 openai-chat 类型原样转发
+func ExtraFields(data []byte) map[string]json.RawMessage {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+	var extra map[string]json.RawMessage
+	for key, value := range fields {
+		if !openAIRequestFields[key] {
+			if extra == nil {
+				extra = make(map[string]json.RawMessage)
+			}
+			extra[key] = value
+		}
+	}
+	return extra
+}
+
+// TransformToOpenAIChat 转换为 OpenAI Chat Completions 兼容上游（vLLM、llama.cpp 等）的请求
+// 请求基本原样转发：保留未识别的字段，只替换模型名、注入系统提示词并去掉代理的扩展字段
+func TransformToOpenAIChat(req *OpenAIRequest, upstreamModel string) (map[string]interface{}, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var chatReq map[string]interface{}
+	if err := json.Unmarshal(data, &chatReq); err != nil {
+		return nil, err
+	}
+	for key, value := range req.Extra {
+		var v interface{}
+		if err := json.Unmarshal(value, &v); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", key, err)
+		}
+		chatReq[key] = v
+	}
+	if upstreamModel != "" {
+		chatReq["model"] = upstreamModel
+	}
+
+	// 注入系统提示词，cache_control 是 Anthropic 专用的扩展字段，不转发
+	var injected, clientSystem, conversation []OpenAIMessage
+	if policy := resolveSystemPrompt(req); policy.Prompt != "" {
+		injected = append(injected, OpenAIMessage{Role: "system", Content: policy.Prompt})
+		for _, msg := range req.Messages {
+			msg.CacheControl = nil
+			if isSystemRole(msg.Role) {
+				clientSystem = append(clientSystem, msg)
+			} else {
+				conversation = append(conversation, msg)
+			}
+		}
+		chatReq["messages"] = append(arrangeSystemPrompt(policy.Mode, injected, clientSystem), conversation...)
+	} else {
+		messages := make([]OpenAIMessage, 0, len(req.Messages))
+		for _, msg := range req.Messages {
+			msg.CacheControl = nil
+			messages = append(messages, msg)
+		}
+		chatReq["messages"] = messages
+	}
+	return chatReq, nil
+}
+
+// GetOpenAIChatHeaders 获取 OpenAI Chat 兼容上游的请求头，authHeader 为空时不发送 Authorization
+func GetOpenAIChatHeaders(authHeader string, isStreaming bool) map[string]string {
+	headers := map[string]string{
+		"content-type": "application/json",
+	}
+	if authHeader != "" {
+		headers["authorization"] = authHeader
+	}
+	if isStreaming {
+		headers["accept"] = "text/event-stream"
+	}
+	return headers
+}
+
+// OpenAIChatResponseTransformer OpenAI Chat 兼容上游的响应转换器，只把模型名替换为代理对外的模型 ID
+type OpenAIChatResponseTransformer struct {
+	Model string
+}
+
+// NewOpenAIChatResponseTransformer 创建 OpenAI Chat 兼容上游的响应转换器
+func NewOpenAIChatResponseTransformer(model string) *OpenAIChatResponseTransformer {
+	return &OpenAIChatResponseTransformer{Model: model}
+}
+
+// TransformNonStreamResponse 替换模型名，其余字段（包括上游特有的字段）原样保留
+func (t *OpenAIChatResponseTransformer) TransformNonStreamResponse(resp map[string]interface{}) map[string]interface{} {
+	resp["model"] = t.Model
+	return resp
+}
+
+// TransformStream 逐块转发 SSE，替换 data 块中的模型名
+func (t *OpenAIChatResponseTransformer) TransformStream(reader io.Reader) chan string {
+	output := make(chan string, 100)
+
+	go func() {
+		defer close(output)
+
+		scanner := bufio.NewScanner(reader)
+		doneSent := false
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !strings.HasPrefix(line, "data:") {
+				continue
+			}
+			dataStr := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			if dataStr == "[DONE]" {
+				if !doneSent {
+					output <- "data: [DONE]\n\n"
+					doneSent = true
+				}
+				continue
+			}
+
+			var chunk map[string]interface{}
+			if err := json.Unmarshal([]byte(dataStr), &chunk); err != nil {
+				continue
+			}
+			if _, ok := chunk["model"]; ok {
+				chunk["model"] = t.Model
+			}
+			if jsonData, err := json.Marshal(chunk); err == nil {
+				output <- fmt.Sprintf("data: %s\n\n", jsonData)
+			}
+		}
+
+		if !doneSent {
+			output <- "data: [DONE]\n\n"
+		}
+	}()
+
+	return output
+}
@@ -0,0 +1,75 @@
+package transformers
+
+import (
+	"encoding/json"
+	"factory-go-api/config"
+	"strings"
+	"testing"
+)
+
+func TestTransformToOpenAIChatForwardsUnknownFields(t *testing.T) {
+	setTestConfig(t, &config.Config{SystemPromptMode: config.SystemPromptPrepend})
+
+	var req OpenAIRequest
+	body := `{"model":"local","messages":[{"role":"user","content":"hi","cache_control":{"type":"ephemeral"}}],` +
+		`"temperature":0,"top_k":20,"chat_template_kwargs":{"enable_thinking":false}}`
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+	req.Extra = ExtraFields([]byte(body))
+	if len(req.Extra) != 2 || req.Temperature == nil {
+		t.Fatalf("Extra = %v, Temperature = %v", req.Extra, req.Temperature)
+	}
+
+	chatReq, err := TransformToOpenAIChat(&req, "Qwen/Qwen2.5-Coder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(chatReq)
+	got := string(data)
+	for _, want := range []string{`"model":"Qwen/Qwen2.5-Coder"`, `"top_k":20`, `"chat_template_kwargs":{"enable_thinking":false}`, `"temperature":0`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("request %s missing %s", got, want)
+		}
+	}
+	if strings.Contains(got, "cache_control") || strings.Contains(got, "system") {
+		t.Errorf("request should not contain proxy extensions or injected prompt: %s", got)
+	}
+}
+
+func TestTransformToOpenAIChatSystemPrompt(t *testing.T) {
+	setTestConfig(t, &config.Config{
+		SystemPrompt:     "You are Droid.",
+		SystemPromptMode: config.SystemPromptAppend,
+		Models:           []config.Model{{ID: "local", Type: "openai-chat"}},
+	})
+
+	req := &OpenAIRequest{Model: "local", Messages: []OpenAIMessage{
+		{Role: "user", Content: "hi"},
+		{Role: "system", Content: "Answer in French."},
+	}}
+	chatReq, err := TransformToOpenAIChat(req, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := chatReq["messages"].([]OpenAIMessage)
+	if len(messages) != 3 || messages[0].Content != "Answer in French." || messages[1].Content != "You are Droid." || messages[2].Role != "user" {
+		t.Errorf("messages = %+v", messages)
+	}
+	if chatReq["model"] != "local" {
+		t.Errorf("model = %v", chatReq["model"])
+	}
+}
+
+func TestOpenAIChatStreamRewritesModel(t *testing.T) {
+	stream := "data: {\"id\":\"c1\",\"model\":\"Qwen\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"}}]}\n\n" +
+		": keep-alive\n\n" +
+		"data: [DONE]\n\n"
+	var chunks []string
+	for chunk := range NewOpenAIChatResponseTransformer("local").TransformStream(strings.NewReader(stream)) {
+		chunks = append(chunks, chunk)
+	}
+	if len(chunks) != 2 || !strings.Contains(chunks[0], `"model":"local"`) || chunks[1] != "data: [DONE]\n\n" {
+		t.Errorf("chunks = %q", chunks)
+	}
+}
@@ -0,0 +1,264 @@
+package transformers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// StopSequences OpenAI stop 参数，可以是字符串或字符串数组
+type StopSequences []string
+
+// UnmarshalJSON 同时兼容 "stop": "x" 和 "stop": ["x", "y"]
+func (s *StopSequences) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		if single != "" {
+			*s = StopSequences{single}
+		}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return fmt.Errorf("stop must be a string or an array of strings")
+	}
+	*s = multiple
+	return nil
+}
+
+// UnsupportedParams 返回请求中设置了但目标模型类型无法映射的参数名
+// 非严格模式下这些参数会被忽略，严格模式下应返回 400
+func UnsupportedParams(req *OpenAIRequest, modelType string) []string {
+	var params []string
+	add := func(name string, isSet bool) {
+		if isSet {
+			params = append(params, name)
+		}
+	}
+
+	switch modelType {
+	case "anthropic":
+		add("seed", req.Seed != nil)
+		add("logit_bias", len(req.LogitBias) > 0)
+		add("logprobs", req.Logprobs)
+		add("top_logprobs", req.TopLogprobs > 0)
+		add("presence_penalty", req.PresencePenalty != nil)
+		add("frequency_penalty", req.FrequencyPenalty != nil)
+	case "openai":
+		add("stop", len(req.Stop) > 0)
+		add("seed", req.Seed != nil)
+		add("logit_bias", len(req.LogitBias) > 0)
+		add("logprobs", req.Logprobs)
+		add("top_logprobs", req.TopLogprobs > 0)
+	case "gemini":
+		add("logit_bias", len(req.LogitBias) > 0)
+		add("logprobs", req.Logprobs)
+		add("top_logprobs", req.TopLogprobs > 0)
+		add("parallel_tool_calls", req.ParallelToolCalls != nil)
+	}
+
+	return params
+}
+
+// validateSamplingParams 按 OpenAI 的取值范围校验采样参数
+func validateSamplingParams(req *OpenAIRequest) error {
+	checks := []struct {
+		name     string
+		value    *float64
+		min, max float64
+	}{
+		{"temperature", req.Temperature, 0, 2},
+		{"top_p", req.TopP, 0, 1},
+		{"presence_penalty", req.PresencePenalty, -2, 2},
+		{"frequency_penalty", req.FrequencyPenalty, -2, 2},
+	}
+	for _, check := range checks {
+		if check.value != nil && (*check.value < check.min || *check.value > check.max) {
+			return fmt.Errorf("%s must be between %v and %v", check.name, check.min, check.max)
+		}
+	}
+	return nil
+}
+
+// applyAnthropicSamplingConstraints 处理 Anthropic 对采样参数的限制
+// 1. 启用 extended thinking 时 temperature 只能为 1，top_p 不能低于 0.95
+// 2. 新一代 Claude 模型不允许同时指定 temperature 和 top_p，优先保留 temperature
+func applyAnthropicSamplingConstraints(req *AnthropicRequest) {
+	if req.Thinking != nil {
+		if req.Temperature != nil && *req.Temperature != 1 {
+			log.Printf("⚠️ extended thinking 不支持 temperature=%v，已忽略", *req.Temperature)
+			req.Temperature = nil
+		}
+		if req.TopP != nil && *req.TopP < 0.95 {
+			log.Printf("⚠️ extended thinking 不支持 top_p=%v，已忽略", *req.TopP)
+			req.TopP = nil
+		}
+	}
+	if req.Temperature != nil && req.TopP != nil {
+		log.Printf("⚠️ Anthropic 不支持同时指定 temperature 和 top_p，已忽略 top_p")
+		req.TopP = nil
+	}
+}
+
+// transformToolChoiceToResponses 将 Chat Completions 的 tool_choice 转换为 Responses API 格式
+// {"type": "function", "function": {"name": "x"}} 转换为 {"type": "function", "name": "x"}
+func transformToolChoiceToResponses(toolChoice interface{}) interface{} {
+	choiceMap, ok := toolChoice.(map[string]interface{})
+	if !ok {
+		return toolChoice
+	}
+	if function, ok := choiceMap["function"].(map[string]interface{}); ok {
+		return map[string]interface{}{
+			"type": "function",
+			"name": function["name"],
+		}
+	}
+	return choiceMap
+}
+
+// anthropicTools 将 OpenAI function 工具转换为 Anthropic 工具定义
+// Anthropic 要求 input_schema，未提供 parameters 时使用空对象 schema
+func anthropicTools(tools []interface{}) ([]map[string]interface{}, error) {
+	result := make([]map[string]interface{}, 0, len(tools))
+	for i, tool := range tools {
+		toolMap, _ := tool.(map[string]interface{})
+		function, _ := toolMap["function"].(map[string]interface{})
+		if toolMap["type"] != "function" || function == nil {
+			return nil, fmt.Errorf("tools[%d]: only function tools are supported for Anthropic models", i)
+		}
+		name, _ := function["name"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("tools[%d]: function.name is required", i)
+		}
+		if name == StructuredOutputToolName {
+			return nil, fmt.Errorf("tools[%d]: function name '%s' is reserved", i, name)
+		}
+		anthropicTool := map[string]interface{}{
+			"name":         name,
+			"input_schema": map[string]interface{}{"type": "object"},
+		}
+		if description, ok := function["description"].(string); ok && description != "" {
+			anthropicTool["description"] = description
+		}
+		if parameters, ok := function["parameters"]; ok && parameters != nil {
+			anthropicTool["input_schema"] = parameters
+		}
+		result = append(result, anthropicTool)
+	}
+	return result, nil
+}
+
+// anthropicToolChoice 将 tool_choice 和 parallel_tool_calls 转换为 Anthropic 的 tool_choice
+// none → none，auto → auto，required → any，指定函数时为 tool
+// parallel_tool_calls=false 转换为 disable_parallel_tool_use（none 不支持该字段）
+func anthropicToolChoice(toolChoice interface{}, parallelToolCalls *bool) (map[string]interface{}, error) {
+	if toolChoice == nil && (parallelToolCalls == nil || *parallelToolCalls) {
+		return nil, nil
+	}
+
+	choice := map[string]interface{}{"type": "auto"}
+	switch v := toolChoice.(type) {
+	case nil:
+	case string:
+		choiceType := map[string]string{"none": "none", "auto": "auto", "required": "any"}[v]
+		if choiceType == "" {
+			return nil, fmt.Errorf("invalid tool_choice: expected none, auto, required or a function")
+		}
+		choice["type"] = choiceType
+	case map[string]interface{}:
+		function, _ := v["function"].(map[string]interface{})
+		name, _ := function["name"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("invalid tool_choice: expected none, auto, required or a function")
+		}
+		choice["type"] = "tool"
+		choice["name"] = name
+	default:
+		return nil, fmt.Errorf("invalid tool_choice: expected none, auto, required or a function")
+	}
+
+	if parallelToolCalls != nil && !*parallelToolCalls && choice["type"] != "none" {
+		choice["disable_parallel_tool_use"] = true
+	}
+	return choice, nil
+}
+
+// max_tokens 相关的默认值
+const (
+	defaultAnthropicMaxTokens = 64000 // Anthropic 未指定 max_tokens 时的默认值
+	thinkingAnswerTokens      = 4000  // 启用 extended thinking 时在 budget_tokens 之外为答案预留的空间
+	minThinkingBudget         = 1024  // Anthropic 允许的最小 budget_tokens
+)
+
+// thinkingBudgets reasoning 等级对应的思考预算，Anthropic 的 budget_tokens 和 Gemini 的 thinkingBudget 共用
+var thinkingBudgets = map[string]int{
+	"low":    4096,
+	"medium": 12288,
+	"high":   24576,
+}
+
+// DefaultAnthropicMaxTokens 返回请求未指定 max_tokens 时发送给 Anthropic 的值，不超过模型输出上限 maxOutput
+func DefaultAnthropicMaxTokens(maxOutput int) int {
+	return capMaxTokens(defaultAnthropicMaxTokens, maxOutput)
+}
+
+// AnthropicMaxTokens 返回 TransformToAnthropic 实际发送的 max_tokens，包含启用 extended thinking 时提高的部分
+// 上下文窗口管理按同一值预留输出空间
+func AnthropicMaxTokens(maxTokens, maxOutput int, reasoning string) int {
+	maxTokens, _ = anthropicOutputTokens(maxTokens, maxOutput, reasoning)
+	return maxTokens
+}
+
+// anthropicOutputTokens 计算发送给 Anthropic 的 max_tokens 和 thinking 预算
+// max_tokens 未指定时使用默认值；reasoning 有效时确保 max_tokens 大于 budget_tokens，但不超过模型输出上限
+// 返回的预算小于 minThinkingBudget 时无法启用 thinking
+func anthropicOutputTokens(maxTokens, maxOutput int, reasoning string) (int, int) {
+	if maxTokens <= 0 {
+		maxTokens = DefaultAnthropicMaxTokens(maxOutput)
+	}
+	budget, ok := thinkingBudgets[reasoning]
+	if !ok {
+		return maxTokens, 0
+	}
+	if maxTokens <= budget {
+		maxTokens = capMaxTokens(budget+thinkingAnswerTokens, maxOutput)
+	}
+	// 模型输出上限容纳不下预算时，缩小 budget_tokens 为一半输出空间
+	if budget >= maxTokens {
+		budget = maxTokens / 2
+	}
+	return maxTokens, budget
+}
+
+// capMaxTokens 将 max_tokens 限制在模型输出上限内，limit 为 0 表示不限制
+func capMaxTokens(maxTokens, limit int) int {
+	if limit > 0 && maxTokens > limit {
+		return limit
+	}
+	return maxTokens
+}
+
+// NormalizeMaxTokens 将 max_completion_tokens 合并到 MaxTokens，并按模型输出上限 limit 校验
+// 超出上限时严格模式返回错误，否则截断到上限；limit 为 0 表示不限制
+func NormalizeMaxTokens(req *OpenAIRequest, limit int, strict bool) error {
+	if req.MaxTokens < 0 || req.MaxCompletionTokens < 0 {
+		return fmt.Errorf("max_tokens must be a positive integer")
+	}
+	if req.MaxCompletionTokens > 0 {
+		if req.MaxTokens > 0 && req.MaxTokens != req.MaxCompletionTokens {
+			return fmt.Errorf("max_tokens and max_completion_tokens must not be set to different values")
+		}
+		req.MaxTokens = req.MaxCompletionTokens
+		req.MaxCompletionTokens = 0
+	}
+
+	if limit > 0 && req.MaxTokens > limit {
+		if strict {
+			return fmt.Errorf("max_tokens is too large: %d. This model supports at most %d completion tokens", req.MaxTokens, limit)
+		}
+		log.Printf("⚠️ max_tokens=%d 超出模型输出上限，已截断为 %d", req.MaxTokens, limit)
+		req.MaxTokens = limit
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package transformers
+
+import (
+	"encoding/json"
+	"factory-go-api/config"
+	"strings"
+	"testing"
+)
+
+func TestZeroSamplingParamsArePreserved(t *testing.T) {
+	var req OpenAIRequest
+	body := `{"model":"m","messages":[{"role":"user","content":"hi"}],"temperature":0,"top_p":0,"presence_penalty":0}`
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+
+	anthropicReq, err := TransformToAnthropic(&req)
+	if err != nil {
+		t.Fatalf("TransformToAnthropic() unexpected error: %v", err)
+	}
+	data, _ := json.Marshal(anthropicReq)
+	var anthropicBody map[string]interface{}
+	_ = json.Unmarshal(data, &anthropicBody)
+	if v, ok := anthropicBody["temperature"]; !ok || v != float64(0) {
+		t.Errorf("anthropic temperature = %v, want 0", v)
+	}
+	if _, ok := anthropicBody["top_p"]; ok {
+		t.Errorf("anthropic top_p should be dropped when temperature is set")
+	}
+
+	factoryReq, err := TransformToFactoryOpenAI(&req)
+	if err != nil {
+		t.Fatalf("TransformToFactoryOpenAI() unexpected error: %v", err)
+	}
+	data, _ = json.Marshal(factoryReq)
+	var factoryBody map[string]interface{}
+	_ = json.Unmarshal(data, &factoryBody)
+	for _, key := range []string{"temperature", "top_p", "presence_penalty"} {
+		if v, ok := factoryBody[key]; !ok || v != float64(0) {
+			t.Errorf("factory %s = %v, want 0", key, v)
+		}
+	}
+}
+
+func TestAnthropicSamplingConstraintsWithThinking(t *testing.T) {
+	temperature, topP := 0.2, 0.5
+	req := &AnthropicRequest{
+		Temperature: &temperature,
+		TopP:        &topP,
+		Thinking:    &ThinkingConfig{Type: "enabled", BudgetTokens: 4096},
+	}
+	applyAnthropicSamplingConstraints(req)
+	if req.Temperature != nil || req.TopP != nil {
+		t.Errorf("thinking request kept temperature=%v top_p=%v", req.Temperature, req.TopP)
+	}
+}
+
+func TestAnthropicToolChoice(t *testing.T) {
+	setTestConfig(t, &config.Config{Models: []config.Model{{ID: "claude-thinking", Type: "anthropic", Reasoning: "low"}}})
+
+	// 强制调用工具时关闭 extended thinking
+	var req OpenAIRequest
+	body := `{"model":"claude-thinking","messages":[{"role":"user","content":"hi"}],
+		"tools":[{"type":"function","function":{"name":"get_time"}}],"tool_choice":{"type":"function","function":{"name":"get_time"}}}`
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+	anthropicReq, err := TransformToAnthropic(&req)
+	if err != nil {
+		t.Fatalf("TransformToAnthropic() unexpected error: %v", err)
+	}
+	if anthropicReq.ToolChoice["type"] != "tool" || anthropicReq.ToolChoice["name"] != "get_time" || anthropicReq.Thinking != nil {
+		t.Errorf("tool_choice = %v, thinking = %v", anthropicReq.ToolChoice, anthropicReq.Thinking)
+	}
+
+	for body, want := range map[string]string{
+		`{"model":"m","messages":[{"role":"user","content":"hi"}],"tools":[{"type":"web_search"}]}`:                                   "only function tools",
+		`{"model":"m","messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{"name":"json_response"}}]}`: "reserved",
+		`{"model":"m","messages":[{"role":"user","content":"hi"}],"tool_choice":"sometimes"}`:                                         "tool_choice",
+	} {
+		var req OpenAIRequest
+		_ = json.Unmarshal([]byte(body), &req)
+		if _, err := TransformToAnthropic(&req); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("TransformToAnthropic(%s) err = %v", body, err)
+		}
+	}
+}
+
+func TestValidateSamplingParams(t *testing.T) {
+	temperature := 2.5
+	if err := validateSamplingParams(&OpenAIRequest{Temperature: &temperature}); err == nil {
+		t.Error("validateSamplingParams() expected error for temperature 2.5")
+	}
+}
+
+func TestNormalizeMaxTokens(t *testing.T) {
+	tests := []struct {
+		name      string
+		req       OpenAIRequest
+		limit     int
+		strict    bool
+		want      int
+		wantError bool
+	}{
+		{"alias", OpenAIRequest{MaxCompletionTokens: 500}, 0, false, 500, false},
+		{"same values", OpenAIRequest{MaxTokens: 500, MaxCompletionTokens: 500}, 0, false, 500, false},
+		{"conflicting values", OpenAIRequest{MaxTokens: 500, MaxCompletionTokens: 600}, 0, false, 0, true},
+		{"negative", OpenAIRequest{MaxTokens: -1}, 0, false, 0, true},
+		{"clamped", OpenAIRequest{MaxCompletionTokens: 50000}, 32000, false, 32000, false},
+		{"strict rejects", OpenAIRequest{MaxTokens: 50000}, 32000, true, 0, true},
+		{"within limit", OpenAIRequest{MaxTokens: 1000}, 32000, true, 1000, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NormalizeMaxTokens(&tt.req, tt.limit, tt.strict)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("NormalizeMaxTokens() error = %v, wantError %v", err, tt.wantError)
+			}
+			if err == nil && (tt.req.MaxTokens != tt.want || tt.req.MaxCompletionTokens != 0) {
+				t.Errorf("max_tokens = %d, max_completion_tokens = %d, want %d", tt.req.MaxTokens, tt.req.MaxCompletionTokens, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnthropicMaxTokensRespectModelLimit(t *testing.T) {
+	setTestConfig(t, &config.Config{Models: []config.Model{
+		{ID: "claude-unlimited", Type: "anthropic", Reasoning: "high"},
+		{ID: "claude-small", Type: "anthropic", MaxOutput: 8192},
+		{ID: "claude-small-thinking", Type: "anthropic", Reasoning: "high", MaxOutput: 16000},
+		{ID: "claude-tiny-thinking", Type: "anthropic", Reasoning: "low", MaxOutput: 1500},
+	}})
+
+	tests := []struct {
+		model      string
+		maxTokens  int
+		wantMax    int
+		wantBudget int
+	}{
+		{"claude-unlimited", 100, 28576, 24576},
+		{"claude-small", 0, 8192, 0},
+		{"claude-small-thinking", 0, 16000, 8000},
+		{"claude-small-thinking", 100, 16000, 8000},
+		{"claude-tiny-thinking", 0, 1500, 0},
+	}
+	for _, tt := range tests {
+		req := &OpenAIRequest{Model: tt.model, MaxTokens: tt.maxTokens, Messages: []OpenAIMessage{{Role: "user", Content: "hi"}}}
+		anthropicReq, err := TransformToAnthropic(req)
+		if err != nil {
+			t.Fatalf("%s: TransformToAnthropic() unexpected error: %v", tt.model, err)
+		}
+		budget := 0
+		if anthropicReq.Thinking != nil {
+			budget = anthropicReq.Thinking.BudgetTokens
+		}
+		if anthropicReq.MaxTokens != tt.wantMax || budget != tt.wantBudget {
+			t.Errorf("%s max_tokens=%d: got max_tokens=%d budget=%d, want %d/%d", tt.model, tt.maxTokens, anthropicReq.MaxTokens, budget, tt.wantMax, tt.wantBudget)
+		}
+	}
+}
+
+func TestFactoryMaxOutputTokensRespectModelLimit(t *testing.T) {
+	setTestConfig(t, &config.Config{Models: []config.Model{
+		{ID: "gpt-small", Type: "openai", Reasoning: "high", MaxOutput: 3000},
+	}})
+
+	factoryReq, err := TransformToFactoryOpenAI(&OpenAIRequest{Model: "gpt-small", Messages: []OpenAIMessage{{Role: "user", Content: "hi"}}})
+	if err != nil {
+		t.Fatalf("TransformToFactoryOpenAI() unexpected error: %v", err)
+	}
+	if factoryReq.MaxOutputTokens != 3000 {
+		t.Errorf("max_output_tokens = %d, want 3000", factoryReq.MaxOutputTokens)
+	}
+}
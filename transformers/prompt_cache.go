@@ -0,0 +1,139 @@
+package transformers
+
+import (
+	"factory-go-api/config"
+)
+
+// maxCacheBreakpoints Anthropic 单个请求最多允许 4 个 cache_control 断点
+const maxCacheBreakpoints = 4
+
+// ephemeralCacheControl 默认的缓存控制
+func ephemeralCacheControl() map[string]interface{} {
+	return map[string]interface{}{"type": "ephemeral"}
+}
+
+// copyCacheControl 将 OpenAI 内容块上的 cache_control 扩展字段复制到转换后的块
+func copyCacheControl(from, to map[string]interface{}) {
+	if cacheControl, ok := from["cache_control"]; ok {
+		to["cache_control"] = cacheControl
+	}
+}
+
+// countCacheBreakpoints 统计请求中已有的 cache_control 断点数量
+func countCacheBreakpoints(req *AnthropicRequest) int {
+	count := 0
+	for _, block := range req.System {
+		if _, ok := block["cache_control"]; ok {
+			count++
+		}
+	}
+	for _, msg := range req.Messages {
+		for _, block := range msg.Content {
+			if _, ok := block["cache_control"]; ok {
+				count++
+			}
+		}
+	}
+	for _, tool := range req.Tools {
+		if _, ok := tool["cache_control"]; ok {
+			count++
+		}
+	}
+	return count
+}
+
+// applyPromptCaching 按 prompt_cache 配置自动添加缓存断点
+// 客户端指定的断点优先，自动断点只在不超过 4 个的前提下添加：
+// 先缓存 system（包含注入的全局系统提示词），再从最新的 user 消息向前缓存 N 轮
+func applyPromptCaching(req *AnthropicRequest) {
+	cacheCfg := config.GetPromptCacheConfig()
+	if !cacheCfg.Enabled {
+		return
+	}
+
+	remaining := maxCacheBreakpoints - countCacheBreakpoints(req)
+
+	if cacheCfg.CacheSystem && remaining > 0 && len(req.System) > 0 {
+		last := req.System[len(req.System)-1]
+		if _, ok := last["cache_control"]; !ok {
+			last["cache_control"] = ephemeralCacheControl()
+			remaining--
+		}
+	}
+
+	marked := 0
+	for i := len(req.Messages) - 1; i >= 0 && marked < cacheCfg.CacheLastTurns && remaining > 0; i-- {
+		msg := req.Messages[i]
+		if msg.Role != "user" || len(msg.Content) == 0 {
+			continue
+		}
+		marked++
+		last := msg.Content[len(msg.Content)-1]
+		if _, ok := last["cache_control"]; !ok {
+			last["cache_control"] = ephemeralCacheControl()
+			remaining--
+		}
+	}
+}
+
+// trimCacheBreakpoints 客户端指定的断点超过上限时，保留最前面的 4 个
+func trimCacheBreakpoints(req *AnthropicRequest) {
+	if countCacheBreakpoints(req) <= maxCacheBreakpoints {
+		return
+	}
+	kept := 0
+	trim := func(block map[string]interface{}) {
+		if _, ok := block["cache_control"]; !ok {
+			return
+		}
+		if kept < maxCacheBreakpoints {
+			kept++
+			return
+		}
+		delete(block, "cache_control")
+	}
+	// Anthropic 的缓存前缀顺序为 tools → system → messages
+	for _, tool := range req.Tools {
+		trim(tool)
+	}
+	for _, block := range req.System {
+		trim(block)
+	}
+	for _, msg := range req.Messages {
+		for _, block := range msg.Content {
+			trim(block)
+		}
+	}
+}
+
+// transformCachedTokensUsage 将 Anthropic 的缓存用量转换为 OpenAI usage
+// Anthropic 的 input_tokens 不包含缓存部分，OpenAI 的 prompt_tokens 包含
+func transformCachedTokensUsage(usage map[string]interface{}) map[string]interface{} {
+	inputTokens, outputTokens, cacheCreation, cacheRead := 0, 0, 0, 0
+	if it, ok := usage["input_tokens"].(float64); ok {
+		inputTokens = int(it)
+	}
+	if ot, ok := usage["output_tokens"].(float64); ok {
+		outputTokens = int(ot)
+	}
+	if cc, ok := usage["cache_creation_input_tokens"].(float64); ok {
+		cacheCreation = int(cc)
+	}
+	if cr, ok := usage["cache_read_input_tokens"].(float64); ok {
+		cacheRead = int(cr)
+	}
+
+	promptTokens := inputTokens + cacheCreation + cacheRead
+	result := map[string]interface{}{
+		"prompt_tokens":     promptTokens,
+		"completion_tokens": outputTokens,
+		"total_tokens":      promptTokens + outputTokens,
+		"prompt_tokens_details": map[string]interface{}{
+			"cached_tokens": cacheRead,
+		},
+	}
+	if cacheCreation > 0 {
+		result["cache_creation_input_tokens"] = cacheCreation
+	}
+	return result
+}
@@ -0,0 +1,69 @@
+package transformers
+
+import (
+	"factory-go-api/config"
+	"testing"
+)
+
+func TestApplyPromptCaching(t *testing.T) {
+	setTestConfig(t, &config.Config{
+		SystemPrompt: "You are Droid.",
+		PromptCache:  config.PromptCacheConfig{Enabled: true, CacheSystem: true, CacheLastTurns: 1},
+	})
+
+	req := &OpenAIRequest{
+		Model: "claude",
+		Messages: []OpenAIMessage{
+			{Role: "user", Content: "first"},
+			{Role: "assistant", Content: "ok"},
+			{Role: "user", Content: "second"},
+		},
+	}
+	anthropicReq, err := TransformToAnthropic(req)
+	if err != nil {
+		t.Fatalf("TransformToAnthropic() unexpected error: %v", err)
+	}
+
+	if _, ok := anthropicReq.System[len(anthropicReq.System)-1]["cache_control"]; !ok {
+		t.Error("system block should have cache_control")
+	}
+	if _, ok := anthropicReq.Messages[2].Content[0]["cache_control"]; !ok {
+		t.Error("last user message should have cache_control")
+	}
+	if _, ok := anthropicReq.Messages[0].Content[0]["cache_control"]; ok {
+		t.Error("older user message should not have cache_control with cache_last_turns=1")
+	}
+}
+
+func TestClientCacheBreakpointsAreLimited(t *testing.T) {
+	setTestConfig(t, &config.Config{})
+
+	cache := map[string]interface{}{"type": "ephemeral"}
+	var messages []OpenAIMessage
+	for i := 0; i < 6; i++ {
+		messages = append(messages, OpenAIMessage{Role: "user", Content: "turn", CacheControl: cache})
+	}
+	anthropicReq, err := TransformToAnthropic(&OpenAIRequest{Model: "claude", Messages: messages})
+	if err != nil {
+		t.Fatalf("TransformToAnthropic() unexpected error: %v", err)
+	}
+	if got := countCacheBreakpoints(anthropicReq); got != maxCacheBreakpoints {
+		t.Errorf("countCacheBreakpoints() = %d, want %d", got, maxCacheBreakpoints)
+	}
+}
+
+func TestTransformCachedTokensUsage(t *testing.T) {
+	usage := transformCachedTokensUsage(map[string]interface{}{
+		"input_tokens":                float64(10),
+		"output_tokens":               float64(5),
+		"cache_creation_input_tokens": float64(100),
+		"cache_read_input_tokens":     float64(1000),
+	})
+	if usage["prompt_tokens"] != 1110 || usage["total_tokens"] != 1115 {
+		t.Errorf("usage = %v, want prompt_tokens 1110 total 1115", usage)
+	}
+	details, _ := usage["prompt_tokens_details"].(map[string]interface{})
+	if details["cached_tokens"] != 1000 {
+		t.Errorf("cached_tokens = %v, want 1000", details["cached_tokens"])
+	}
+}
@@ -2,15 +2,26 @@
 package transformers
 
 import (
+	"context"
+	"encoding/json"
 	"factory-go-api/config"
+	"log"
+	"math"
+	"strings"
 
 	"github.com/google/uuid"
 )
 
 // OpenAIMessage OpenAI 格式的消息
 type OpenAIMessage struct {
-	Role    string      `json:"role"`
-	Content interface{} `json:"content"` // 可以是 string 或 []ContentPart
+	Role       string      `json:"role"`
+	Content    interface{} `json:"content"` // 可以是 string 或 []ContentPart
+	Name       string      `json:"name,omitempty"`
+	ToolCallID string      `json:"tool_call_id,omitempty"`
+	// ToolCalls assistant 消息中的工具调用，tool 消息通过 tool_call_id 对应
+	ToolCalls []OpenAIToolCall `json:"tool_calls,omitempty"`
+	// CacheControl 扩展字段：标记该消息可被 Anthropic prompt caching 缓存
+	CacheControl map[string]interface{} `json:"cache_control,omitempty"`
 }
 
 // ContentPart 消息内容部分
@@ -22,15 +33,54 @@ type ContentPart struct {
 
 // OpenAIRequest OpenAI 标准请求格式
 type OpenAIRequest struct {
-	Model            string          `json:"model"`
-	Messages         []OpenAIMessage `json:"messages"`
-	MaxTokens        int             `json:"max_tokens,omitempty"`
-	Temperature      float64         `json:"temperature,omitempty"`
-	TopP             float64         `json:"top_p,omitempty"`
-	Stream           bool            `json:"stream,omitempty"`
-	Tools            []interface{}   `json:"tools,omitempty"`
-	PresencePenalty  float64         `json:"presence_penalty,omitempty"`
-	FrequencyPenalty float64         `json:"frequency_penalty,omitempty"`
+	Model               string             `json:"model"`
+	Messages            []OpenAIMessage    `json:"messages"`
+	MaxTokens           int                `json:"max_tokens,omitempty"`
+	MaxCompletionTokens int                `json:"max_completion_tokens,omitempty"`
+	Temperature         *float64           `json:"temperature,omitempty"`
+	TopP                *float64           `json:"top_p,omitempty"`
+	Stream              bool               `json:"stream,omitempty"`
+	StreamOptions       *StreamOptions     `json:"stream_options,omitempty"`
+	Tools               []interface{}      `json:"tools,omitempty"`
+	PresencePenalty     *float64           `json:"presence_penalty,omitempty"`
+	FrequencyPenalty    *float64           `json:"frequency_penalty,omitempty"`
+	ResponseFormat      *ResponseFormat    `json:"response_format,omitempty"`
+	Stop                StopSequences      `json:"stop,omitempty"`
+	N                   int                `json:"n,omitempty"`
+	Seed                *int64             `json:"seed,omitempty"`
+	User                string             `json:"user,omitempty"`
+	LogitBias           map[string]float64 `json:"logit_bias,omitempty"`
+	Logprobs            bool               `json:"logprobs,omitempty"`
+	TopLogprobs         int                `json:"top_logprobs,omitempty"`
+	ToolChoice          interface{}        `json:"tool_choice,omitempty"`
+	ParallelToolCalls   *bool              `json:"parallel_tool_calls,omitempty"`
+	Metadata            map[string]string  `json:"metadata,omitempty"`
+
+	// ClientName 经过认证的客户端名称，由代理设置，不从请求体解析
+	ClientName string `json:"-"`
+	// Extra 请求体中未识别的字段（如 vLLM 的 top_k、chat_template_kwargs），仅 openai-chat 类型转发
+	Extra map[string]json.RawMessage `json:"-"`
+	// Context 客户端请求的 context，由代理设置，转换时拉取远程图片随客户端断开而取消
+	Context context.Context `json:"-"`
+}
+
+// StreamOptions 流式响应选项
+type StreamOptions struct {
+	// IncludeUsage 为 true 时在 [DONE] 之前额外发送一个 choices 为空、包含 usage 的块
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// StreamIncludeUsage 流式请求是否要求返回 usage
+func (req *OpenAIRequest) StreamIncludeUsage() bool {
+	return req.Stream && req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+}
+
+// requestContext 返回请求的 context，未设置时使用 context.Background
+func (req *OpenAIRequest) requestContext() context.Context {
+	if req.Context != nil {
+		return req.Context
+	}
+	return context.Background()
 }
 
 // AnthropicMessage Anthropic 格式的消息
@@ -41,13 +91,18 @@ type AnthropicMessage struct {
 
 // AnthropicRequest Anthropic 请求格式
 type AnthropicRequest struct {
-	Model       string                   `json:"model"`
-	Messages    []AnthropicMessage       `json:"messages"`
-	System      []map[string]interface{} `json:"system,omitempty"`
-	MaxTokens   int                      `json:"max_tokens"`
-	Temperature float64                  `json:"temperature,omitempty"`
-	Stream      bool                     `json:"stream,omitempty"`
-	Thinking    *ThinkingConfig          `json:"thinking,omitempty"`
+	Model         string                   `json:"model"`
+	Messages      []AnthropicMessage       `json:"messages"`
+	System        []map[string]interface{} `json:"system,omitempty"`
+	MaxTokens     int                      `json:"max_tokens"`
+	Temperature   *float64                 `json:"temperature,omitempty"`
+	TopP          *float64                 `json:"top_p,omitempty"`
+	Stream        bool                     `json:"stream,omitempty"`
+	Thinking      *ThinkingConfig          `json:"thinking,omitempty"`
+	Tools         []map[string]interface{} `json:"tools,omitempty"`
+	ToolChoice    map[string]interface{}   `json:"tool_choice,omitempty"`
+	StopSequences []string                 `json:"stop_sequences,omitempty"`
+	Metadata      map[string]interface{}   `json:"metadata,omitempty"`
 }
 
 // ThinkingConfig Anthropic 的思考配置
@@ -68,15 +123,24 @@ type FactoryOpenAIRequest struct {
 	Input              []FactoryOpenAIMessage `json:"input"`
 	Instructions       string                 `json:"instructions,omitempty"`
 	MaxOutputTokens    int                    `json:"max_output_tokens,omitempty"`
-	Temperature        float64                `json:"temperature,omitempty"`
-	TopP               float64                `json:"top_p,omitempty"`
+	Temperature        *float64               `json:"temperature,omitempty"`
+	TopP               *float64               `json:"top_p,omitempty"`
 	Stream             bool                   `json:"stream,omitempty"`
 	Store              bool                   `json:"store"`
 	Tools              []interface{}          `json:"tools,omitempty"`
 	Reasoning          *ReasoningConfig       `json:"reasoning,omitempty"`
-	PresencePenalty    float64                `json:"presence_penalty,omitempty"`
-	FrequencyPenalty   float64                `json:"frequency_penalty,omitempty"`
-	ParallelToolCalls  bool                   `json:"parallel_tool_calls,omitempty"`
+	PresencePenalty    *float64               `json:"presence_penalty,omitempty"`
+	FrequencyPenalty   *float64               `json:"frequency_penalty,omitempty"`
+	ParallelToolCalls  *bool                  `json:"parallel_tool_calls,omitempty"`
+	Text               *TextConfig            `json:"text,omitempty"`
+	ToolChoice         interface{}            `json:"tool_choice,omitempty"`
+	User               string                 `json:"user,omitempty"`
+	Metadata           map[string]string      `json:"metadata,omitempty"`
+}
+
+// TextConfig Responses API 的文本输出配置
+type TextConfig struct {
+	Format map[string]interface{} `json:"format"`
 }
 
 // ReasoningConfig OpenAI 的推理配置
@@ -86,101 +150,126 @@ type ReasoningConfig struct {
 }
 
 // TransformToAnthropic 将 OpenAI 格式转换为 Anthropic 格式
-func TransformToAnthropic(req *OpenAIRequest) *AnthropicRequest {
+// 返回的错误均为客户端请求内容不合法，调用方应返回 400
+func TransformToAnthropic(req *OpenAIRequest) (*AnthropicRequest, error) {
+	if err := validateResponseFormat(req.ResponseFormat); err != nil {
+		return nil, err
+	}
+	if err := validateSamplingParams(req); err != nil {
+		return nil, err
+	}
+
 	anthropicReq := &AnthropicRequest{
 		Model:    req.Model,
 		Messages: []AnthropicMessage{},
 		Stream:   req.Stream,
 	}
 
-	// 设置 max_tokens
-	if req.MaxTokens > 0 {
-		anthropicReq.MaxTokens = req.MaxTokens
-	} else {
-		anthropicReq.MaxTokens = 64000 // 默认值
+	// 设置 max_tokens 和 thinking 预算，未指定时使用默认值，且不超过模型输出上限
+	reasoning := config.GetModelReasoning(req.Model)
+	maxTokens, thinkingBudget := anthropicOutputTokens(req.MaxTokens, config.GetModelMaxOutput(req.Model), reasoning)
+	anthropicReq.MaxTokens = maxTokens
+
+	// 设置采样参数，nil 表示未设置，0 是合法值
+	// Anthropic 的 temperature 范围是 0-1，OpenAI 是 0-2，超出部分截断为 1
+	if req.Temperature != nil {
+		temperature := math.Min(*req.Temperature, 1)
+		anthropicReq.Temperature = &temperature
 	}
+	anthropicReq.TopP = req.TopP
 
-	// 设置 temperature
-	if req.Temperature > 0 {
-		anthropicReq.Temperature = req.Temperature
+	// 规范化消息：映射角色、合并相邻同角色消息、过滤空内容
+	userSystemBlocks, messages, err := normalizeAnthropicMessages(req.requestContext(), req.Messages)
+	if err != nil {
+		return nil, err
 	}
-
-	// 转换消息并提取 system
-	var systemPrompts []string
-	systemPrompt := config.GetSystemPrompt()
-	if systemPrompt != "" {
-		systemPrompts = append(systemPrompts, systemPrompt)
+	anthropicReq.Messages = messages
+
+	// 按注入策略组合系统提示词
+	var injectedBlocks []map[string]interface{}
+	policy := resolveSystemPrompt(req)
+	if policy.Prompt != "" {
+		injectedBlocks = append(injectedBlocks, map[string]interface{}{
+			"type": "text",
+			"text": policy.Prompt,
+		})
 	}
+	systemBlocks := arrangeSystemPrompt(policy.Mode, injectedBlocks, userSystemBlocks)
 
-	for _, msg := range req.Messages {
-		if msg.Role == "system" {
-			// 提取 system 消息
-			if text, ok := msg.Content.(string); ok {
-				systemPrompts = append(systemPrompts, text)
-			}
-			continue
-		}
-
-		// 转换 user 和 assistant 消息
-		anthropicMsg := AnthropicMessage{
-			Role:    msg.Role,
-			Content: []map[string]interface{}{},
-		}
+	// 设置 system 字段
+	if len(systemBlocks) > 0 {
+		anthropicReq.System = systemBlocks
+	}
 
-		if text, ok := msg.Content.(string); ok {
-			anthropicMsg.Content = append(anthropicMsg.Content, map[string]interface{}{
-				"type": "text",
-				"text": text,
-			})
-		} else if parts, ok := msg.Content.([]interface{}); ok {
-			for _, part := range parts {
-				if partMap, ok := part.(map[string]interface{}); ok {
-					anthropicMsg.Content = append(anthropicMsg.Content, partMap)
-				}
+	// 处理 thinking 字段
+	if reasoning != "" {
+		if thinkingBudget < minThinkingBudget {
+			log.Printf("⚠️ max_tokens=%d 不足以启用 extended thinking，已关闭", anthropicReq.MaxTokens)
+		} else {
+			anthropicReq.Thinking = &ThinkingConfig{
+				Type:         "enabled",
+				BudgetTokens: thinkingBudget,
 			}
 		}
+	}
 
-		anthropicReq.Messages = append(anthropicReq.Messages, anthropicMsg)
+	// 转换 stop 和 user
+	if len(req.Stop) > 0 {
+		anthropicReq.StopSequences = req.Stop
+	}
+	if req.User != "" {
+		anthropicReq.Metadata = map[string]interface{}{"user_id": req.User}
 	}
 
-	// 设置 system 字段
-	if len(systemPrompts) > 0 {
-		anthropicReq.System = []map[string]interface{}{}
-		for _, prompt := range systemPrompts {
-			anthropicReq.System = append(anthropicReq.System, map[string]interface{}{
-				"type": "text",
-				"text": prompt,
-			})
+	// 转换工具和工具选择
+	if len(req.Tools) > 0 {
+		tools, err := anthropicTools(req.Tools)
+		if err != nil {
+			return nil, err
 		}
+		anthropicReq.Tools = tools
+	}
+	toolChoice, err := anthropicToolChoice(req.ToolChoice, req.ParallelToolCalls)
+	if err != nil {
+		return nil, err
+	}
+	anthropicReq.ToolChoice = toolChoice
+	// 强制调用工具（any / tool）与 extended thinking 不兼容
+	if toolChoice != nil && (toolChoice["type"] == "any" || toolChoice["type"] == "tool") && anthropicReq.Thinking != nil {
+		log.Printf("⚠️ tool_choice=%v 与 extended thinking 不兼容，已关闭 thinking", toolChoice["type"])
+		anthropicReq.Thinking = nil
 	}
 
-	// 处理 thinking 字段
-	reasoning := config.GetModelReasoning(req.Model)
-	if reasoning != "" {
-		budgetTokens := map[string]int{
-			"low":    4096,
-			"medium": 12288,
-			"high":   24576,
-		}
-		
-		// 确保 max_tokens 大于 budget_tokens
-		requiredBudget := budgetTokens[reasoning]
-		if anthropicReq.MaxTokens <= requiredBudget {
-			// 增加 max_tokens 以满足要求
-			anthropicReq.MaxTokens = requiredBudget + 4000
-		}
-		
-		anthropicReq.Thinking = &ThinkingConfig{
-			Type:         "enabled",
-			BudgetTokens: requiredBudget,
+	// 处理 response_format：Anthropic 没有原生结构化输出，通过强制调用工具模拟
+	// 强制 tool_choice 与 extended thinking 不兼容，因此需要关闭 thinking
+	if req.ResponseFormat.IsStructured() {
+		anthropicReq.Tools = append(anthropicReq.Tools, req.ResponseFormat.toAnthropicTool())
+		anthropicReq.ToolChoice = map[string]interface{}{
+			"type": "tool",
+			"name": StructuredOutputToolName,
 		}
+		anthropicReq.Thinking = nil
 	}
 
-	return anthropicReq
+	applyAnthropicSamplingConstraints(anthropicReq)
+
+	// 处理 prompt caching 断点
+	trimCacheBreakpoints(anthropicReq)
+	applyPromptCaching(anthropicReq)
+
+	return anthropicReq, nil
 }
 
 // TransformToFactoryOpenAI 将 OpenAI 格式转换为 Factory OpenAI 格式
-func TransformToFactoryOpenAI(req *OpenAIRequest) *FactoryOpenAIRequest {
+// 返回的错误均为客户端请求内容不合法，调用方应返回 400
+func TransformToFactoryOpenAI(req *OpenAIRequest) (*FactoryOpenAIRequest, error) {
+	if err := validateResponseFormat(req.ResponseFormat); err != nil {
+		return nil, err
+	}
+	if err := validateSamplingParams(req); err != nil {
+		return nil, err
+	}
+
 	factoryReq := &FactoryOpenAIRequest{
 		Model:  req.Model,
 		Input:  []FactoryOpenAIMessage{},
@@ -193,27 +282,31 @@ func TransformToFactoryOpenAI(req *OpenAIRequest) *FactoryOpenAIRequest {
 		factoryReq.MaxOutputTokens = req.MaxTokens
 	}
 
-	// 转换其他参数
-	if req.Temperature > 0 {
-		factoryReq.Temperature = req.Temperature
-	}
-	if req.TopP > 0 {
-		factoryReq.TopP = req.TopP
-	}
-	if req.PresencePenalty != 0 {
-		factoryReq.PresencePenalty = req.PresencePenalty
-	}
-	if req.FrequencyPenalty != 0 {
-		factoryReq.FrequencyPenalty = req.FrequencyPenalty
-	}
+	// 转换采样参数，nil 表示未设置，0 是合法值
+	factoryReq.Temperature = req.Temperature
+	factoryReq.TopP = req.TopP
+	factoryReq.PresencePenalty = req.PresencePenalty
+	factoryReq.FrequencyPenalty = req.FrequencyPenalty
 
 	// 转换工具
 	if len(req.Tools) > 0 {
 		factoryReq.Tools = req.Tools
 	}
 
+	// 转换工具选择、user 和 metadata
+	if req.ToolChoice != nil {
+		factoryReq.ToolChoice = transformToolChoiceToResponses(req.ToolChoice)
+	}
+	factoryReq.ParallelToolCalls = req.ParallelToolCalls
+	factoryReq.User = req.User
+	factoryReq.Metadata = req.Metadata
+
+	// 转换 response_format 为 text.format
+	if req.ResponseFormat.IsStructured() {
+		factoryReq.Text = &TextConfig{Format: req.ResponseFormat.toResponsesTextFormat()}
+	}
+
 	// 提取 system 消息作为 instructions
-	systemPrompt := config.GetSystemPrompt()
 	var userSystemMessages []string
 
 	for _, msg := range req.Messages {
@@ -257,6 +350,12 @@ func TransformToFactoryOpenAI(req *OpenAIRequest) *FactoryOpenAIRequest {
 							"type":      imageType,
 							"image_url": partMap["image_url"],
 						})
+					} else if partType == "file" {
+						inputFile, err := transformFileToFactoryOpenAI(partMap)
+						if err != nil {
+							return nil, err
+						}
+						factoryMsg.Content = append(factoryMsg.Content, inputFile)
 					} else {
 						// 其他类型直接传递
 						factoryMsg.Content = append(factoryMsg.Content, partMap)
@@ -268,14 +367,13 @@ func TransformToFactoryOpenAI(req *OpenAIRequest) *FactoryOpenAIRequest {
 		factoryReq.Input = append(factoryReq.Input, factoryMsg)
 	}
 
-	// 设置 instructions
-	if systemPrompt != "" || len(userSystemMessages) > 0 {
-		instructions := systemPrompt
-		for _, msg := range userSystemMessages {
-			instructions += msg
-		}
-		factoryReq.Instructions = instructions
+	// 按注入策略组合 instructions，多段之间使用空行分隔
+	var injected []string
+	policy := resolveSystemPrompt(req)
+	if policy.Prompt != "" {
+		injected = append(injected, policy.Prompt)
 	}
+	factoryReq.Instructions = strings.Join(arrangeSystemPrompt(policy.Mode, injected, userSystemMessages), systemPromptSeparator)
 
 	// 处理 reasoning 字段
 	// 注意：GPT 模型的 reasoning 模式会导致只输出推理过程而无实际答案
@@ -295,9 +393,10 @@ func TransformToFactoryOpenAI(req *OpenAIRequest) *FactoryOpenAIRequest {
 			// 确保至少有足够的 token 用于实际输出
 			factoryReq.MaxOutputTokens = factoryReq.MaxOutputTokens + 2000
 		}
+		factoryReq.MaxOutputTokens = capMaxTokens(factoryReq.MaxOutputTokens, config.GetModelMaxOutput(req.Model))
 	}
 
-	return factoryReq
+	return factoryReq, nil
 }
 
 // GetAnthropicHeaders 获取 Anthropic 请求头
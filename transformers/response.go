@@ -30,8 +30,23 @@ type OpenAIChoice struct {
 
 // OpenAIMessageResponse 消息响应
 type OpenAIMessageResponse struct {
-	Role    string `json:"role,omitempty"`
-	Content string `json:"content,omitempty"`
+	Role      string           `json:"role,omitempty"`
+	Content   string           `json:"content,omitempty"`
+	ToolCalls []OpenAIToolCall `json:"tool_calls,omitempty"`
+}
+
+// OpenAIToolCall 响应中的工具调用，Index 只在流式响应中设置
+type OpenAIToolCall struct {
+	Index    *int               `json:"index,omitempty"`
+	ID       string             `json:"id,omitempty"`
+	Type     string             `json:"type,omitempty"`
+	Function OpenAIFunctionCall `json:"function"`
+}
+
+// OpenAIFunctionCall 工具调用的函数名和 JSON 参数
+type OpenAIFunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
 }
 
 // AnthropicResponseTransformer Anthropic 响应转换器
@@ -39,6 +54,15 @@ type AnthropicResponseTransformer struct {
 	Model     string
 	RequestID string
 	Created   int64
+	// StructuredOutput 为 true 时，将模拟结构化输出的工具调用参数作为消息内容返回
+	StructuredOutput bool
+	// IncludeUsage 为 true 时，流式响应结束前发送包含 usage（含 prompt caching 命中情况）的块
+	IncludeUsage bool
+
+	// toolBlocks 流式响应中 tool_use 内容块的下标到 tool_calls 序号的映射
+	toolBlocks map[int]int
+	// usage 流式响应中 message_start 和 message_delta 累计的 usage
+	usage map[string]interface{}
 }
 
 // NewAnthropicResponseTransformer 创建 Anthropic 响应转换器
@@ -75,7 +99,19 @@ func (t *AnthropicResponseTransformer) TransformNonStreamResponse(anthropicResp
 	// 提取内容
 	// Extended Thinking 模型会返回多个 content 块：thinking + text
 	// 我们需要找到 type=text 的块
-	if content, ok := anthropicResp["content"].([]interface{}); ok && len(content) > 0 {
+	content, _ := anthropicResp["content"].([]interface{})
+	if t.StructuredOutput {
+		// 结构化输出：工具调用参数即为 JSON 结果
+		for _, item := range content {
+			if contentItem, ok := item.(map[string]interface{}); ok && contentItem["type"] == "tool_use" && contentItem["name"] == StructuredOutputToolName {
+				if input, err := json.Marshal(contentItem["input"]); err == nil {
+					openaiResp.Choices[0].Message.Content = string(input)
+				}
+				break
+			}
+		}
+	}
+	if openaiResp.Choices[0].Message.Content == "" && len(content) > 0 {
 		for _, item := range content {
 			if contentItem, ok := item.(map[string]interface{}); ok {
 				// 检查类型
@@ -97,30 +133,22 @@ func (t *AnthropicResponseTransformer) TransformNonStreamResponse(anthropicResp
 		}
 	}
 
+	// 工具调用转换为 tool_calls，结构化输出使用的工具已作为消息内容返回
+	for _, item := range content {
+		if contentItem, ok := item.(map[string]interface{}); ok && contentItem["type"] == "tool_use" && !t.isStructuredOutputTool(contentItem) {
+			openaiResp.Choices[0].Message.ToolCalls = append(openaiResp.Choices[0].Message.ToolCalls, newAnthropicToolCall(contentItem, nil))
+		}
+	}
+
 	// 转换 stop_reason
 	if stopReason, ok := anthropicResp["stop_reason"].(string); ok {
-		finishReason := "stop"
-		if stopReason == "max_tokens" {
-			finishReason = "length"
-		}
+		finishReason := anthropicFinishReason(stopReason, len(openaiResp.Choices[0].Message.ToolCalls) > 0)
 		openaiResp.Choices[0].FinishReason = &finishReason
 	}
 
-	// 添加 usage 信息
+	// 添加 usage 信息（包含 prompt caching 命中情况）
 	if usage, ok := anthropicResp["usage"].(map[string]interface{}); ok {
-		inputTokens := 0
-		outputTokens := 0
-		if it, ok := usage["input_tokens"].(float64); ok {
-			inputTokens = int(it)
-		}
-		if ot, ok := usage["output_tokens"].(float64); ok {
-			outputTokens = int(ot)
-		}
-		openaiResp.Usage = map[string]interface{}{
-			"prompt_tokens":     inputTokens,
-			"completion_tokens": outputTokens,
-			"total_tokens":      inputTokens + outputTokens,
-		}
+		openaiResp.Usage = transformCachedTokensUsage(usage)
 	}
 
 	return openaiResp, nil
@@ -130,28 +158,62 @@ func (t *AnthropicResponseTransformer) TransformNonStreamResponse(anthropicResp
 func (t *AnthropicResponseTransformer) TransformStreamChunk(eventType string, eventData map[string]interface{}) (string, error) {
 	switch eventType {
 	case "message_start":
+		// message_start 携带输入和缓存 token 数，message_delta 再更新输出 token 数
+		if message, ok := eventData["message"].(map[string]interface{}); ok {
+			t.mergeUsage(message["usage"])
+		}
 		return t.createOpenAIChunk("", "assistant", false, ""), nil
 
+	case "content_block_start":
+		// 工具调用开始时发送 id 和函数名，参数通过后续的 input_json_delta 增量发送
+		block, _ := eventData["content_block"].(map[string]interface{})
+		if block["type"] != "tool_use" || t.isStructuredOutputTool(block) {
+			return "", nil
+		}
+		blockIndex, _ := eventData["index"].(float64)
+		if t.toolBlocks == nil {
+			t.toolBlocks = make(map[int]int)
+		}
+		toolIndex := len(t.toolBlocks)
+		t.toolBlocks[int(blockIndex)] = toolIndex
+		call := newAnthropicToolCall(block, &toolIndex)
+		call.Function.Arguments = ""
+		return t.createToolCallChunk(call), nil
+
 	case "content_block_delta":
 		text := ""
 		if delta, ok := eventData["delta"].(map[string]interface{}); ok {
 			if textVal, ok := delta["text"].(string); ok {
 				text = textVal
+			} else if partialJSON, ok := delta["partial_json"].(string); ok {
+				blockIndex, _ := eventData["index"].(float64)
+				if toolIndex, isTool := t.toolBlocks[int(blockIndex)]; isTool {
+					return t.createToolCallChunk(OpenAIToolCall{Index: &toolIndex, Function: OpenAIFunctionCall{Arguments: partialJSON}}), nil
+				}
+				if t.StructuredOutput {
+					// 结构化输出：工具调用参数增量即为 JSON 内容
+					text = partialJSON
+				}
 			}
 		}
 		return t.createOpenAIChunk(text, "", false, ""), nil
 
 	case "message_delta":
+		t.mergeUsage(eventData["usage"])
 		finishReason := "stop"
 		if delta, ok := eventData["delta"].(map[string]interface{}); ok {
-			if stopReason, ok := delta["stop_reason"].(string); ok && stopReason == "max_tokens" {
-				finishReason = "length"
+			if stopReason, ok := delta["stop_reason"].(string); ok {
+				finishReason = anthropicFinishReason(stopReason, len(t.toolBlocks) > 0)
 			}
 		}
 		return t.createOpenAIChunk("", "", true, finishReason), nil
 
 	case "message_stop":
-		return "", nil // 已经在 message_delta 中处理
+		// 结束原因已经在 message_delta 中处理，这里按需发送 usage
+		if !t.IncludeUsage || t.usage == nil {
+			return "", nil
+		}
+		return t.createUsageChunk(transformCachedTokensUsage(t.usage)), nil
 
 	default:
 		return "", nil // 忽略其他事件
@@ -187,6 +249,85 @@ func (t *AnthropicResponseTransformer) createOpenAIChunk(content, role string, f
 	return fmt.Sprintf("data: %s\n\n", string(jsonData))
 }
 
+// mergeUsage 合并流式事件中的 usage，后到的字段覆盖先到的
+func (t *AnthropicResponseTransformer) mergeUsage(usage interface{}) {
+	usageMap, ok := usage.(map[string]interface{})
+	if !ok {
+		return
+	}
+	if t.usage == nil {
+		t.usage = make(map[string]interface{}, len(usageMap))
+	}
+	for key, value := range usageMap {
+		if value != nil {
+			t.usage[key] = value
+		}
+	}
+}
+
+// createUsageChunk 创建 stream_options.include_usage 要求的 usage 块，choices 为空
+func (t *AnthropicResponseTransformer) createUsageChunk(usage map[string]interface{}) string {
+	chunk := OpenAIResponse{
+		ID:      t.RequestID,
+		Object:  "chat.completion.chunk",
+		Created: t.Created,
+		Model:   t.Model,
+		Choices: []OpenAIChoice{},
+		Usage:   usage,
+	}
+
+	jsonData, _ := json.Marshal(chunk)
+	return fmt.Sprintf("data: %s\n\n", string(jsonData))
+}
+
+// createToolCallChunk 创建只包含一个工具调用增量的流式块
+func (t *AnthropicResponseTransformer) createToolCallChunk(call OpenAIToolCall) string {
+	chunk := OpenAIResponse{
+		ID:      t.RequestID,
+		Object:  "chat.completion.chunk",
+		Created: t.Created,
+		Model:   t.Model,
+		Choices: []OpenAIChoice{{Index: 0, Delta: &OpenAIMessageResponse{ToolCalls: []OpenAIToolCall{call}}}},
+	}
+
+	jsonData, _ := json.Marshal(chunk)
+	return fmt.Sprintf("data: %s\n\n", string(jsonData))
+}
+
+// isStructuredOutputTool 判断 tool_use 块是否是模拟结构化输出的工具调用
+func (t *AnthropicResponseTransformer) isStructuredOutputTool(block map[string]interface{}) bool {
+	return t.StructuredOutput && block["name"] == StructuredOutputToolName
+}
+
+// newAnthropicToolCall 将 tool_use 块转换为 OpenAI tool_call
+func newAnthropicToolCall(block map[string]interface{}, index *int) OpenAIToolCall {
+	id, _ := block["id"].(string)
+	name, _ := block["name"].(string)
+	arguments := "{}"
+	if input, ok := block["input"]; ok && input != nil {
+		if data, err := json.Marshal(input); err == nil {
+			arguments = string(data)
+		}
+	}
+	return OpenAIToolCall{
+		Index:    index,
+		ID:       id,
+		Type:     "function",
+		Function: OpenAIFunctionCall{Name: name, Arguments: arguments},
+	}
+}
+
+// anthropicFinishReason 转换 stop_reason，调用了工具时为 tool_calls
+func anthropicFinishReason(stopReason string, hasToolCalls bool) string {
+	switch {
+	case stopReason == "max_tokens":
+		return "length"
+	case stopReason == "tool_use" && hasToolCalls:
+		return "tool_calls"
+	}
+	return "stop"
+}
+
 // TransformStream 转换流式响应
 func (t *AnthropicResponseTransformer) TransformStream(reader io.Reader) chan string {
 	output := make(chan string, 100)
@@ -357,6 +498,13 @@ func (t *FactoryOpenAIResponseTransformer) TransformNonStreamResponse(factoryRes
 			"completion_tokens": outputTokens,
 			"total_tokens":      inputTokens + outputTokens,
 		}
+		if details, ok := usage["input_tokens_details"].(map[string]interface{}); ok {
+			if cached, ok := details["cached_tokens"].(float64); ok {
+				openaiResp.Usage["prompt_tokens_details"] = map[string]interface{}{
+					"cached_tokens": int(cached),
+				}
+			}
+		}
 	}
 
 	return openaiResp, nil
@@ -471,6 +619,7 @@ func (t *FactoryOpenAIResponseTransformer) TransformStream(reader io.Reader) cha
 
 		scanner := bufio.NewScanner(reader)
 		var currentEvent string
+		doneSent := false
 
 		for scanner.Scan() {
 			line := scanner.Text()
@@ -485,7 +634,10 @@ func (t *FactoryOpenAIResponseTransformer) TransformStream(reader io.Reader) cha
 				
 				// 检查是否是 [DONE] 标记
 				if strings.TrimSpace(dataStr) == "[DONE]" {
-					output <- "data: [DONE]\n\n"
+					if !doneSent {
+						output <- "data: [DONE]\n\n"
+						doneSent = true
+					}
 					continue
 				}
 				
@@ -513,7 +665,9 @@ func (t *FactoryOpenAIResponseTransformer) TransformStream(reader io.Reader) cha
 		}
 
 		// 发送结束标记（如果还没发送）
-		output <- "data: [DONE]\n\n"
+		if !doneSent {
+			output <- "data: [DONE]\n\n"
+		}
 	}()
 
 	return output
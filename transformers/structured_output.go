@@ -0,0 +1,277 @@
+package transformers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+)
+
+// StructuredOutputToolName Anthropic 模拟结构化输出时使用的强制工具名称
+const StructuredOutputToolName = "json_response"
+
+// ResponseFormat OpenAI response_format 参数
+type ResponseFormat struct {
+	Type       string            `json:"type"`
+	JSONSchema *JSONSchemaFormat `json:"json_schema,omitempty"`
+}
+
+// JSONSchemaFormat response_format.json_schema 参数
+type JSONSchemaFormat struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Schema      map[string]interface{} `json:"schema,omitempty"`
+	Strict      *bool                  `json:"strict,omitempty"`
+}
+
+// IsStructured 是否要求 JSON 结构化输出（text 类型等同于未设置）
+func (f *ResponseFormat) IsStructured() bool {
+	return f != nil && (f.Type == "json_object" || f.Type == "json_schema")
+}
+
+// validateResponseFormat 校验 response_format 参数
+func validateResponseFormat(f *ResponseFormat) error {
+	if f == nil {
+		return nil
+	}
+	switch f.Type {
+	case "text", "json_object":
+		return nil
+	case "json_schema":
+		if f.JSONSchema == nil || f.JSONSchema.Name == "" {
+			return fmt.Errorf("response_format.json_schema.name is required")
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid response_format.type '%s': expected text, json_object or json_schema", f.Type)
+	}
+}
+
+// toResponsesTextFormat 转换为 Responses API 的 text.format
+func (f *ResponseFormat) toResponsesTextFormat() map[string]interface{} {
+	if f.Type != "json_schema" {
+		return map[string]interface{}{"type": f.Type}
+	}
+	format := map[string]interface{}{
+		"type":   "json_schema",
+		"name":   f.JSONSchema.Name,
+		"schema": f.schema(),
+	}
+	if f.JSONSchema.Description != "" {
+		format["description"] = f.JSONSchema.Description
+	}
+	if f.JSONSchema.Strict != nil {
+		format["strict"] = *f.JSONSchema.Strict
+	}
+	return format
+}
+
+// toAnthropicTool 构造用于模拟结构化输出的 Anthropic 工具定义
+func (f *ResponseFormat) toAnthropicTool() map[string]interface{} {
+	description := "Respond with a JSON object."
+	if f.Type == "json_schema" {
+		description = fmt.Sprintf("Respond with a JSON object matching the '%s' schema.", f.JSONSchema.Name)
+		if f.JSONSchema.Description != "" {
+			description += " " + f.JSONSchema.Description
+		}
+	}
+	return map[string]interface{}{
+		"name":         StructuredOutputToolName,
+		"description":  description,
+		"input_schema": f.schema(),
+	}
+}
+
+// schema 返回 JSON schema，json_object 模式下为任意对象
+func (f *ResponseFormat) schema() map[string]interface{} {
+	if f.Type == "json_schema" && f.JSONSchema.Schema != nil {
+		return f.JSONSchema.Schema
+	}
+	return map[string]interface{}{"type": "object"}
+}
+
+// ValidateStructuredOutput 校验模型输出是否为合法 JSON 并符合 response_format 中的 schema
+func ValidateStructuredOutput(f *ResponseFormat, content string) error {
+	if !f.IsStructured() {
+		return nil
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(content), &value); err != nil {
+		return fmt.Errorf("model output is not valid JSON: %v", err)
+	}
+	return validateJSONSchema(f.schema(), value, "$")
+}
+
+// validateJSONSchema 按 JSON Schema 的常用子集校验数据
+// 支持 type、enum、const、properties、required、additionalProperties、items、
+// anyOf/oneOf/allOf 以及常见的长度和数值约束，$ref 等其他关键字会被忽略
+func validateJSONSchema(schema map[string]interface{}, value interface{}, path string) error {
+	if schema == nil {
+		return nil
+	}
+
+	if t, ok := schema["type"]; ok && !matchesSchemaType(t, value) {
+		return fmt.Errorf("%s: expected type %v", path, t)
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, candidate := range enum {
+			if jsonEqual(candidate, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: value is not one of %v", path, enum)
+		}
+	}
+	if c, ok := schema["const"]; ok && !jsonEqual(c, value) {
+		return fmt.Errorf("%s: value must be %v", path, c)
+	}
+
+	if subSchemas, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range subSchemas {
+			subMap, _ := sub.(map[string]interface{})
+			if err := validateJSONSchema(subMap, value, path); err != nil {
+				return err
+			}
+		}
+	}
+	for _, keyword := range []string{"anyOf", "oneOf"} {
+		if subSchemas, ok := schema[keyword].([]interface{}); ok {
+			matched := false
+			for _, sub := range subSchemas {
+				subMap, _ := sub.(map[string]interface{})
+				if validateJSONSchema(subMap, value, path) == nil {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return fmt.Errorf("%s: value does not match any schema in %s", path, keyword)
+			}
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if key, ok := name.(string); ok {
+					if _, exists := v[key]; !exists {
+						return fmt.Errorf("%s: missing required property '%s'", path, key)
+					}
+				}
+			}
+		}
+		for key, propValue := range v {
+			if propSchema, ok := properties[key].(map[string]interface{}); ok {
+				if err := validateJSONSchema(propSchema, propValue, path+"."+key); err != nil {
+					return err
+				}
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					return fmt.Errorf("%s: unexpected property '%s'", path, key)
+				}
+			case map[string]interface{}:
+				if err := validateJSONSchema(additional, propValue, path+"."+key); err != nil {
+					return err
+				}
+			}
+		}
+
+	case []interface{}:
+		if minItems, ok := schema["minItems"].(float64); ok && float64(len(v)) < minItems {
+			return fmt.Errorf("%s: expected at least %v items", path, minItems)
+		}
+		if maxItems, ok := schema["maxItems"].(float64); ok && float64(len(v)) > maxItems {
+			return fmt.Errorf("%s: expected at most %v items", path, maxItems)
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				if err := validateJSONSchema(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+
+	case string:
+		length := float64(len([]rune(v)))
+		if minLength, ok := schema["minLength"].(float64); ok && length < minLength {
+			return fmt.Errorf("%s: expected at least %v characters", path, minLength)
+		}
+		if maxLength, ok := schema["maxLength"].(float64); ok && length > maxLength {
+			return fmt.Errorf("%s: expected at most %v characters", path, maxLength)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(v) {
+				return fmt.Errorf("%s: value does not match pattern %s", path, pattern)
+			}
+		}
+
+	case float64:
+		if minimum, ok := schema["minimum"].(float64); ok && v < minimum {
+			return fmt.Errorf("%s: value must be >= %v", path, minimum)
+		}
+		if maximum, ok := schema["maximum"].(float64); ok && v > maximum {
+			return fmt.Errorf("%s: value must be <= %v", path, maximum)
+		}
+	}
+
+	return nil
+}
+
+// matchesSchemaType 检查值是否符合 schema 的 type（支持字符串或数组形式）
+func matchesSchemaType(schemaType interface{}, value interface{}) bool {
+	switch t := schemaType.(type) {
+	case string:
+		return matchesSingleType(t, value)
+	case []interface{}:
+		for _, item := range t {
+			if name, ok := item.(string); ok && matchesSingleType(name, value) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// matchesSingleType 检查值是否为指定的 JSON 类型
+func matchesSingleType(schemaType string, value interface{}) bool {
+	switch schemaType {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return true
+}
+
+// jsonEqual 比较两个 JSON 值是否相等
+func jsonEqual(a, b interface{}) bool {
+	aBytes, errA := json.Marshal(a)
+	bBytes, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(aBytes) == string(bBytes)
+}
@@ -0,0 +1,80 @@
+package transformers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateStructuredOutput(t *testing.T) {
+	format := &ResponseFormat{
+		Type: "json_schema",
+		JSONSchema: &JSONSchemaFormat{
+			Name: "weather",
+			Schema: map[string]interface{}{
+				"type":                 "object",
+				"required":             []interface{}{"city", "temp"},
+				"additionalProperties": false,
+				"properties": map[string]interface{}{
+					"city": map[string]interface{}{"type": "string"},
+					"temp": map[string]interface{}{"type": "integer"},
+					"unit": map[string]interface{}{"enum": []interface{}{"c", "f"}},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "合法输出", content: `{"city":"Paris","temp":21,"unit":"c"}`},
+		{name: "非 JSON", content: `Sure! {"city":"Paris"}`, wantErr: "not valid JSON"},
+		{name: "缺少必填字段", content: `{"city":"Paris"}`, wantErr: "missing required property 'temp'"},
+		{name: "类型错误", content: `{"city":"Paris","temp":21.5}`, wantErr: "$.temp: expected type integer"},
+		{name: "枚举不匹配", content: `{"city":"Paris","temp":21,"unit":"k"}`, wantErr: "$.unit: value is not one of"},
+		{name: "多余字段", content: `{"city":"Paris","temp":21,"extra":true}`, wantErr: "unexpected property 'extra'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateStructuredOutput(format, tt.content)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ValidateStructuredOutput() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateStructuredOutput() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAnthropicStructuredOutputResponse(t *testing.T) {
+	transformer := NewAnthropicResponseTransformer("claude-sonnet-4-5-20250929", "")
+	transformer.StructuredOutput = true
+
+	resp, err := transformer.TransformNonStreamResponse(map[string]interface{}{
+		"id":          "msg_1",
+		"stop_reason": "tool_use",
+		"content": []interface{}{
+			map[string]interface{}{"type": "text", "text": "Here you go"},
+			map[string]interface{}{
+				"type":  "tool_use",
+				"name":  StructuredOutputToolName,
+				"input": map[string]interface{}{"city": "Paris"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("TransformNonStreamResponse() unexpected error: %v", err)
+	}
+	if got := resp.Choices[0].Message.Content; got != `{"city":"Paris"}` {
+		t.Errorf("content = %q, want tool input JSON", got)
+	}
+	if got := *resp.Choices[0].FinishReason; got != "stop" {
+		t.Errorf("finish_reason = %q, want stop", got)
+	}
+}
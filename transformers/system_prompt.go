@@ -0,0 +1,52 @@
+package transformers
+
+import (
+	"factory-go-api/config"
+	"strings"
+	"time"
+)
+
+// systemPromptSeparator 多段系统提示词拼接为单个字符串时使用的分隔符
+const systemPromptSeparator = "\n\n"
+
+// resolveSystemPrompt 解析当前请求生效的注入策略，并渲染模板变量
+func resolveSystemPrompt(req *OpenAIRequest) config.SystemPromptPolicy {
+	policy := config.ResolveSystemPromptPolicy(req.Model, req.ClientName)
+	if policy.Mode == config.SystemPromptDisabled {
+		policy.Prompt = ""
+		return policy
+	}
+	policy.Prompt = renderSystemPrompt(policy.Prompt, req)
+	return policy
+}
+
+// renderSystemPrompt 替换系统提示词中的模板变量
+func renderSystemPrompt(prompt string, req *OpenAIRequest) string {
+	if !strings.Contains(prompt, "{{") {
+		return prompt
+	}
+	now := time.Now()
+	return strings.NewReplacer(
+		"{{date}}", now.Format("2006-01-02"),
+		"{{datetime}}", now.Format(time.RFC3339),
+		"{{model}}", req.Model,
+		"{{client}}", req.ClientName,
+	).Replace(prompt)
+}
+
+// arrangeSystemPrompt 按注入方式组合注入的提示词和客户端自己的 system 消息
+func arrangeSystemPrompt[T any](mode string, injected, client []T) []T {
+	if len(injected) == 0 {
+		return client
+	}
+	switch mode {
+	case config.SystemPromptAppend:
+		return append(append([]T{}, client...), injected...)
+	case config.SystemPromptReplace:
+		return injected
+	case config.SystemPromptDisabled:
+		return client
+	default:
+		return append(append([]T{}, injected...), client...)
+	}
+}
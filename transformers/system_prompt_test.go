@@ -0,0 +1,59 @@
+package transformers
+
+import (
+	"factory-go-api/config"
+	"testing"
+)
+
+func TestSystemPromptPolicies(t *testing.T) {
+	setTestConfig(t, &config.Config{
+		SystemPrompt:     "You are Droid.",
+		SystemPromptMode: config.SystemPromptPrepend,
+		Models: []config.Model{
+			{ID: "claude", Type: "anthropic"},
+			{ID: "gpt", Type: "openai", SystemPrompt: &config.SystemPromptPolicy{Mode: config.SystemPromptAppend}},
+			{ID: "raw", Type: "openai", SystemPrompt: &config.SystemPromptPolicy{Mode: config.SystemPromptDisabled}},
+		},
+		Clients: []config.Client{
+			{Name: "acme", Key: "k1", SystemPrompt: &config.SystemPromptPolicy{Mode: config.SystemPromptReplace, Prompt: "You are {{client}}'s assistant on {{model}}."}},
+		},
+	})
+
+	messages := []OpenAIMessage{
+		{Role: "system", Content: "Answer in French."},
+		{Role: "user", Content: "hi"},
+	}
+
+	tests := []struct {
+		name   string
+		model  string
+		client string
+		want   string
+	}{
+		{name: "全局 prepend", model: "gpt-default", want: "You are Droid.\n\nAnswer in French."},
+		{name: "模型 append", model: "gpt", want: "Answer in French.\n\nYou are Droid."},
+		{name: "模型 disabled", model: "raw", want: "Answer in French."},
+		{name: "客户端 replace 与模板变量", model: "gpt", client: "acme", want: "You are acme's assistant on gpt."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &OpenAIRequest{Model: tt.model, Messages: messages, ClientName: tt.client}
+			factoryReq, err := TransformToFactoryOpenAI(req)
+			if err != nil {
+				t.Fatalf("TransformToFactoryOpenAI() unexpected error: %v", err)
+			}
+			if factoryReq.Instructions != tt.want {
+				t.Errorf("instructions = %q, want %q", factoryReq.Instructions, tt.want)
+			}
+		})
+	}
+
+	anthropicReq, err := TransformToAnthropic(&OpenAIRequest{Model: "claude", Messages: messages})
+	if err != nil {
+		t.Fatalf("TransformToAnthropic() unexpected error: %v", err)
+	}
+	if len(anthropicReq.System) != 2 || anthropicReq.System[0]["text"] != "You are Droid." {
+		t.Errorf("anthropic system = %v, want injected prompt first", anthropicReq.System)
+	}
+}
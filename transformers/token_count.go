@@ -0,0 +1,312 @@
+package transformers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	_ "image/gif"  // 注册 GIF 解码器，用于读取图片尺寸
+	_ "image/jpeg" // 注册 JPEG 解码器
+	_ "image/png"  // 注册 PNG 解码器
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// 本地估算使用的经验值
+const (
+	messageOverheadTokens      = 3    // 每条消息的角色和分隔符开销
+	replyPrimingTokens         = 3    // 模型回复前缀
+	anthropicToolSystemTokens  = 346  // Anthropic 启用工具时附加的系统提示词
+	defaultImageTokens         = 1600 // 无法获取尺寸时的 Anthropic 图片估算值（约 1.15MP）
+	openAILowDetailImageTokens = 85
+	openAIImageTileTokens      = 170
+	documentPageTokens         = 1500 // PDF 每页的估算值（文本 + 页面图像）
+	geminiImageTileTokens      = 258  // Gemini 每个 768x768 图片分块（两边都不超过 384 时整张图）
+)
+
+// AnthropicCountTokensRequest Anthropic count_tokens 端点的请求体
+type AnthropicCountTokensRequest struct {
+	Model      string                   `json:"model"`
+	Messages   []AnthropicMessage       `json:"messages"`
+	System     []map[string]interface{} `json:"system,omitempty"`
+	Tools      []map[string]interface{} `json:"tools,omitempty"`
+	ToolChoice map[string]interface{}   `json:"tool_choice,omitempty"`
+	Thinking   *ThinkingConfig          `json:"thinking,omitempty"`
+}
+
+// NewAnthropicCountTokensRequest 从转换后的 Anthropic 请求中提取 count_tokens 支持的字段
+func NewAnthropicCountTokensRequest(req *AnthropicRequest) *AnthropicCountTokensRequest {
+	return &AnthropicCountTokensRequest{
+		Model:      req.Model,
+		Messages:   req.Messages,
+		System:     req.System,
+		Tools:      req.Tools,
+		ToolChoice: req.ToolChoice,
+		Thinking:   req.Thinking,
+	}
+}
+
+// EstimateAnthropicTokens 本地估算 Anthropic 请求的输入 token 数，用于无法调用 count_tokens 时
+func EstimateAnthropicTokens(req *AnthropicRequest) int {
+	total := replyPrimingTokens
+	for _, block := range req.System {
+		total += estimateAnthropicBlockTokens(block)
+	}
+	for _, msg := range req.Messages {
+		total += messageOverheadTokens
+		for _, block := range msg.Content {
+			total += estimateAnthropicBlockTokens(block)
+		}
+	}
+	if len(req.Tools) > 0 {
+		total += anthropicToolSystemTokens
+		for _, tool := range req.Tools {
+			total += estimateJSONTokens(tool)
+		}
+	}
+	return total
+}
+
+// estimateAnthropicBlockTokens 估算单个 Anthropic 内容块
+func estimateAnthropicBlockTokens(block map[string]interface{}) int {
+	switch block["type"] {
+	case "text":
+		text, _ := block["text"].(string)
+		return estimateTextTokens(text)
+	case "image":
+		source, _ := block["source"].(map[string]interface{})
+		if data, ok := source["data"].(string); ok {
+			if width, height, ok := imageDimensions(data); ok {
+				return anthropicImageTokens(width, height)
+			}
+		}
+		return defaultImageTokens
+	case "document":
+		source, _ := block["source"].(map[string]interface{})
+		if data, ok := source["data"].(string); ok {
+			if source["type"] == "text" {
+				return estimateTextTokens(data)
+			}
+			return estimateDocumentTokens(data)
+		}
+		return documentPageTokens
+	case "tool_use":
+		name, _ := block["name"].(string)
+		return estimateTextTokens(name) + estimateJSONTokens(block["input"])
+	case "tool_result":
+		switch content := block["content"].(type) {
+		case string:
+			return estimateTextTokens(content)
+		case []map[string]interface{}:
+			total := 0
+			for _, inner := range content {
+				total += estimateAnthropicBlockTokens(inner)
+			}
+			return total
+		}
+		return estimateJSONTokens(block["content"])
+	default:
+		return estimateJSONTokens(block)
+	}
+}
+
+// EstimateFactoryOpenAITokens 本地估算 Responses API 请求的输入 token 数
+func EstimateFactoryOpenAITokens(req *FactoryOpenAIRequest) int {
+	total := replyPrimingTokens
+	if req.Instructions != "" {
+		total += messageOverheadTokens + estimateTextTokens(req.Instructions)
+	}
+	for _, msg := range req.Input {
+		total += messageOverheadTokens
+		for _, part := range msg.Content {
+			total += estimateResponsesPartTokens(part)
+		}
+	}
+	for _, tool := range req.Tools {
+		total += estimateJSONTokens(tool)
+	}
+	if req.Text != nil {
+		total += estimateJSONTokens(req.Text.Format)
+	}
+	return total
+}
+
+// estimateResponsesPartTokens 估算单个 Responses API 内容块
+func estimateResponsesPartTokens(part map[string]interface{}) int {
+	switch part["type"] {
+	case "input_text", "output_text":
+		text, _ := part["text"].(string)
+		return estimateTextTokens(text)
+	case "input_image", "output_image":
+		url, detail := extractImageURL(part["image_url"])
+		if detail == "low" {
+			return openAILowDetailImageTokens
+		}
+		if _, data, found := strings.Cut(url, ","); found && strings.HasPrefix(url, "data:") {
+			if width, height, ok := imageDimensions(data); ok {
+				return openAIImageTokens(width, height)
+			}
+		}
+		// 未知尺寸按 1024x1024 估算
+		return openAIImageTokens(1024, 1024)
+	case "input_file":
+		fileData, _ := part["file_data"].(string)
+		if _, data, found := strings.Cut(fileData, ","); found {
+			return estimateDocumentTokens(data)
+		}
+		return documentPageTokens
+	default:
+		return estimateJSONTokens(part)
+	}
+}
+
+// EstimateGeminiTokens 本地估算 Gemini 请求的输入 token 数
+func EstimateGeminiTokens(req *GeminiRequest) int {
+	total := replyPrimingTokens
+	contents := req.Contents
+	if req.SystemInstruction != nil {
+		contents = append([]GeminiContent{*req.SystemInstruction}, contents...)
+	}
+	for _, content := range contents {
+		total += messageOverheadTokens
+		for _, part := range content.Parts {
+			total += estimateGeminiPartTokens(part)
+		}
+	}
+	for _, tool := range req.Tools {
+		total += estimateJSONTokens(tool.FunctionDeclarations)
+	}
+	if req.GenerationConfig != nil {
+		total += estimateJSONTokens(req.GenerationConfig.ResponseJSONSchema)
+	}
+	return total
+}
+
+// estimateGeminiPartTokens 估算单个 Gemini part
+func estimateGeminiPartTokens(part map[string]interface{}) int {
+	if text, ok := part["text"].(string); ok {
+		return estimateTextTokens(text)
+	}
+	if inlineData, ok := part["inlineData"].(map[string]interface{}); ok {
+		mimeType, _ := inlineData["mimeType"].(string)
+		data, _ := inlineData["data"].(string)
+		if !strings.HasPrefix(mimeType, "image/") {
+			return estimateDocumentTokens(data)
+		}
+		if width, height, ok := imageDimensions(data); ok {
+			return geminiImageTokens(width, height)
+		}
+		return geminiImageTileTokens
+	}
+	if _, ok := part["fileData"]; ok {
+		return geminiImageTileTokens
+	}
+	return estimateJSONTokens(part)
+}
+
+// geminiImageTokens Gemini 图片 token 估算：两边都不超过 384 时按一块计算，否则按 768x768 分块
+func geminiImageTokens(width, height int) int {
+	if width <= 384 && height <= 384 {
+		return geminiImageTileTokens
+	}
+	tiles := int(math.Ceil(float64(width)/768) * math.Ceil(float64(height)/768))
+	return tiles * geminiImageTileTokens
+}
+
+// EstimateTextTokens 近似估算文本 token 数，用于上游未返回 usage 时的用量统计
+func EstimateTextTokens(text string) int {
+	return estimateTextTokens(text)
+}
+
+// estimateTextTokens 近似估算文本 token 数
+// 拉丁字母和数字组成的单词按约 5 个字符一个 token，CJK 等其他文字每个字符一个 token，标点单独计数
+func estimateTextTokens(text string) int {
+	tokens, wordLen := 0, 0
+	flush := func() {
+		tokens += (wordLen + 4) / 5
+		wordLen = 0
+	}
+	for _, r := range text {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			wordLen++
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			tokens++
+		}
+	}
+	flush()
+	return tokens
+}
+
+// estimateJSONTokens 按 JSON 文本估算结构化内容（工具定义、工具参数等）
+func estimateJSONTokens(v interface{}) int {
+	if v == nil {
+		return 0
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return estimateTextTokens(string(data))
+}
+
+// imageDimensions 从 base64 图片数据中读取宽高
+func imageDimensions(data string) (int, int, bool) {
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return 0, 0, false
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(decoded))
+	if err != nil || cfg.Width <= 0 || cfg.Height <= 0 {
+		return 0, 0, false
+	}
+	return cfg.Width, cfg.Height, true
+}
+
+// anthropicImageTokens Anthropic 图片 token 估算：长边缩放到 1568 以内后按 宽×高/750 计算
+func anthropicImageTokens(width, height int) int {
+	w, h := float64(width), float64(height)
+	if long := math.Max(w, h); long > 1568 {
+		w, h = w*1568/long, h*1568/long
+	}
+	return int(math.Ceil(w * h / 750))
+}
+
+// openAIImageTokens OpenAI high detail 图片 token 估算：
+// 缩放到 2048x2048 以内，再将短边缩放到 768，按 512x512 分块计算
+func openAIImageTokens(width, height int) int {
+	w, h := float64(width), float64(height)
+	if long := math.Max(w, h); long > 2048 {
+		w, h = w*2048/long, h*2048/long
+	}
+	if short := math.Min(w, h); short > 768 {
+		w, h = w*768/short, h*768/short
+	}
+	tiles := int(math.Ceil(w/512) * math.Ceil(h/512))
+	return openAILowDetailImageTokens + openAIImageTileTokens*tiles
+}
+
+// pdfPagePattern 匹配 PDF 页面对象（不匹配 /Type /Pages）
+var pdfPagePattern = regexp.MustCompile(`/Type\s*/Page[^s]`)
+
+// estimateDocumentTokens 按页数估算 PDF，无法识别页数时按一页计算
+func estimateDocumentTokens(data string) int {
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return documentPageTokens
+	}
+	pages := len(pdfPagePattern.FindAllIndex(decoded, -1))
+	if pages == 0 {
+		if !bytes.HasPrefix(decoded, []byte("%PDF")) {
+			// 纯文本文件
+			return estimateTextTokens(string(decoded))
+		}
+		pages = 1
+	}
+	return pages * documentPageTokens
+}
@@ -0,0 +1,78 @@
+package transformers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func pngDataURI(t *testing.T, width, height int) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestEstimateTextTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"hello world", 2},
+		{"internationalization", 4},
+		{"Hello, world!", 4},
+		{"你好世界", 4},
+	}
+	for _, tt := range tests {
+		if got := estimateTextTokens(tt.text); got != tt.want {
+			t.Errorf("estimateTextTokens(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestImageTokens(t *testing.T) {
+	// OpenAI 文档示例：1024x1024 → 765，2048x4096 → 1105
+	if got := openAIImageTokens(1024, 1024); got != 765 {
+		t.Errorf("openAIImageTokens(1024, 1024) = %d, want 765", got)
+	}
+	if got := openAIImageTokens(2048, 4096); got != 1105 {
+		t.Errorf("openAIImageTokens(2048, 4096) = %d, want 1105", got)
+	}
+	// Anthropic 文档示例：1000x1000 → 约 1334
+	if got := anthropicImageTokens(1000, 1000); got != 1334 {
+		t.Errorf("anthropicImageTokens(1000, 1000) = %d, want 1334", got)
+	}
+}
+
+func TestEstimateFactoryOpenAITokensImages(t *testing.T) {
+	req := &FactoryOpenAIRequest{
+		Input: []FactoryOpenAIMessage{{
+			Role: "user",
+			Content: []map[string]interface{}{
+				{"type": "input_image", "image_url": map[string]interface{}{"url": pngDataURI(t, 512, 512)}},
+				{"type": "input_image", "image_url": map[string]interface{}{"url": "https://example.com/a.png", "detail": "low"}},
+			},
+		}},
+	}
+	// 512x512 为 1 个分块：85 + 170
+	want := replyPrimingTokens + messageOverheadTokens + 255 + openAILowDetailImageTokens
+	if got := EstimateFactoryOpenAITokens(req); got != want {
+		t.Errorf("EstimateFactoryOpenAITokens() = %d, want %d", got, want)
+	}
+}
+
+func TestEstimateAnthropicTokensTools(t *testing.T) {
+	req := &AnthropicRequest{
+		Messages: []AnthropicMessage{{Role: "user", Content: []map[string]interface{}{{"type": "text", "text": "hi"}}}},
+	}
+	withoutTools := EstimateAnthropicTokens(req)
+	req.Tools = []map[string]interface{}{{"name": "get_weather", "input_schema": map[string]interface{}{"type": "object"}}}
+	if got := EstimateAnthropicTokens(req); got <= withoutTools+anthropicToolSystemTokens {
+		t.Errorf("tools should add the tool system prompt and definitions: %d vs %d", got, withoutTools)
+	}
+}
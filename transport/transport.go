@@ -0,0 +1,192 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"factory-go-api/config"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// 未配置时使用的默认值
+const (
+	DefaultTimeout             = 120 * time.Second
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 20
+	defaultIdleConnTimeout     = 90 * time.Second
+)
+
+// Timeout 返回单次上游请求的总超时
+func Timeout(cfg *config.TransportConfig) time.Duration {
+	if cfg == nil || cfg.TimeoutSeconds <= 0 {
+		return DefaultTimeout
+	}
+	return time.Duration(cfg.TimeoutSeconds) * time.Second
+}
+
+// New 根据端点的连接设置创建 Transport，cfg 为 nil 时使用默认值
+func New(cfg *config.TransportConfig) (*http.Transport, error) {
+	if cfg == nil {
+		cfg = &config.TransportConfig{}
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	t := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialContext(dialer, cfg.DNSOverrides),
+		ForceAttemptHTTP2:     !cfg.DisableHTTP2,
+		MaxIdleConns:          defaultMaxIdleConns,
+		MaxIdleConnsPerHost:   defaultMaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       defaultIdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	if cfg.MaxIdleConns > 0 {
+		t.MaxIdleConns = cfg.MaxIdleConns
+	}
+	if cfg.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	}
+	if cfg.IdleConnTimeoutSeconds > 0 {
+		t.IdleConnTimeout = time.Duration(cfg.IdleConnTimeoutSeconds) * time.Second
+	}
+	if cfg.DisableHTTP2 {
+		// 非 nil 的空 map 禁止 TLS 连接协商 HTTP/2
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	t.TLSClientConfig = tlsConfig
+
+	switch cfg.Proxy {
+	case config.ProxyFromEnvironment:
+	case config.ProxyDirect:
+		t.Proxy = nil
+	default:
+		proxyURL, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("proxy 无效: %w", err)
+		}
+		// http.Transport 原生支持 http、https 和 socks5 代理
+		t.Proxy = http.ProxyURL(proxyURL)
+	}
+	return t, nil
+}
+
+// newTLSConfig 创建 TLS 设置，ca_file 中的证书追加到系统根证书之后
+func newTLSConfig(cfg *config.TransportConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.TLSServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify, // 由配置显式开启，仅用于调试
+	}
+	if version, ok := config.TLSVersions[cfg.TLSMinVersion]; ok {
+		tlsConfig.MinVersion = version
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取 ca_file 失败: %w", err)
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca_file 中没有有效的 PEM 证书: %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = roots
+	}
+	return tlsConfig, nil
+}
+
+// dialContext 在建立连接前应用 DNS 覆盖
+func dialContext(dialer *net.Dialer, overrides map[string]string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if len(overrides) == 0 {
+		return dialer.DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, resolveOverride(overrides, addr))
+	}
+}
+
+// resolveOverride 按 主机:端口 优先、主机名其次的顺序查找覆盖地址，覆盖地址未带端口时沿用原端口
+func resolveOverride(overrides map[string]string, addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	target, ok := overrides[addr]
+	if !ok {
+		if target, ok = overrides[host]; !ok {
+			return addr
+		}
+	}
+	if _, _, err := net.SplitHostPort(target); err == nil {
+		return target
+	}
+	return net.JoinHostPort(target, port)
+}
+
+// Pool 按端点名称共享 Transport，使同一端点的请求复用连接
+// 端点的连接设置变化时（例如通过管理 API 修改）重建 Transport 并关闭旧的空闲连接
+type Pool struct {
+	mu      sync.Mutex
+	entries map[string]*poolEntry
+}
+
+type poolEntry struct {
+	settings  string
+	transport *http.Transport
+}
+
+// NewPool 创建连接池
+func NewPool() *Pool {
+	return &Pool{entries: make(map[string]*poolEntry)}
+}
+
+// Get 返回端点的 Transport，首次使用或设置变化时创建
+func (p *Pool) Get(endpoint *config.Endpoint) (*http.Transport, error) {
+	settings, err := json.Marshal(endpoint.Transport)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entry := p.entries[endpoint.Name]
+	if entry != nil && entry.settings == string(settings) {
+		return entry.transport, nil
+	}
+
+	t, err := New(endpoint.Transport)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		entry.transport.CloseIdleConnections()
+	}
+	p.entries[endpoint.Name] = &poolEntry{settings: string(settings), transport: t}
+	return t, nil
+}
+
+// CloseIdleConnections 关闭所有端点的空闲连接
+func (p *Pool) CloseIdleConnections() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, entry := range p.entries {
+		entry.transport.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,174 @@
+package transport
+
+import (
+	"encoding/pem"
+	"factory-go-api/config"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func get(t *testing.T, rt http.RoundTripper, url string) (*http.Response, string, error) {
+	t.Helper()
+	client := &http.Client{Transport: rt, Timeout: 5 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body), nil
+}
+
+func TestResolveOverride(t *testing.T) {
+	overrides := map[string]string{
+		"api.example.com":      "127.0.0.1",
+		"api.example.com:8443": "10.0.0.1:443",
+		"other.example.com":    "10.0.0.2:8080",
+	}
+	for addr, want := range map[string]string{
+		"api.example.com:443":   "127.0.0.1:443",
+		"api.example.com:8443":  "10.0.0.1:443",
+		"other.example.com:443": "10.0.0.2:8080",
+		"unrelated.com:443":     "unrelated.com:443",
+	} {
+		if got := resolveOverride(overrides, addr); got != want {
+			t.Errorf("resolveOverride(%q) = %q, want %q", addr, got, want)
+		}
+	}
+}
+
+func TestDNSOverride(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Host)
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+
+	rt, err := New(&config.TransportConfig{Proxy: config.ProxyDirect, DNSOverrides: map[string]string{"upstream.invalid": "127.0.0.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, body, err := get(t, rt, "http://upstream.invalid:"+port+"/")
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	if body != "upstream.invalid:"+port {
+		t.Errorf("Host = %q, the original host name should be kept", body)
+	}
+}
+
+func TestProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		_, _ = io.WriteString(w, "via proxy")
+	}))
+	defer proxy.Close()
+
+	rt, err := New(&config.TransportConfig{Proxy: proxy.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, body, err := get(t, rt, "http://upstream.invalid/v1/messages")
+	if err != nil || body != "via proxy" {
+		t.Fatalf("body = %q, err = %v", body, err)
+	}
+	if proxied != "http://upstream.invalid/v1/messages" {
+		t.Errorf("proxy received %q", proxied)
+	}
+}
+
+func TestCAFileAndHTTP2(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	// 未信任自签名证书时校验失败
+	rt, err := New(&config.TransportConfig{Proxy: config.ProxyDirect})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := get(t, rt, server.URL); err == nil {
+		t.Fatal("expected certificate verification error")
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	rt, err = New(&config.TransportConfig{Proxy: config.ProxyDirect, CAFile: caFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, body, err := get(t, rt, server.URL)
+	if err != nil || body != "ok" {
+		t.Fatalf("body = %q, err = %v", body, err)
+	}
+	if resp.ProtoMajor != 2 {
+		t.Errorf("protocol = %s, want HTTP/2", resp.Proto)
+	}
+
+	rt, err = New(&config.TransportConfig{Proxy: config.ProxyDirect, CAFile: caFile, DisableHTTP2: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, _, err := get(t, rt, server.URL); err != nil || resp.ProtoMajor != 1 {
+		t.Errorf("disable_http2: resp = %v, err = %v", resp, err)
+	}
+}
+
+func TestInvalidCAFile(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(&config.TransportConfig{CAFile: caFile}); err == nil {
+		t.Error("expected error for invalid PEM")
+	}
+	if _, err := New(&config.TransportConfig{CAFile: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestPoolSharesAndRebuilds(t *testing.T) {
+	pool := NewPool()
+	endpoint := &config.Endpoint{Name: "anthropic"}
+
+	first, err := pool.Get(endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := pool.Get(endpoint); again != first {
+		t.Error("same endpoint should share a transport")
+	}
+	if other, _ := pool.Get(&config.Endpoint{Name: "openai"}); other == first {
+		t.Error("different endpoints should not share a transport")
+	}
+
+	endpoint.Transport = &config.TransportConfig{MaxIdleConnsPerHost: 50}
+	rebuilt, err := pool.Get(endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rebuilt == first || rebuilt.MaxIdleConnsPerHost != 50 {
+		t.Errorf("transport not rebuilt after settings changed: %+v", rebuilt)
+	}
+	if first.MaxIdleConnsPerHost != defaultMaxIdleConnsPerHost || Timeout(nil) != DefaultTimeout {
+		t.Error("defaults not applied")
+	}
+}
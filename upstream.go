@@ -0,0 +1,47 @@
+package main
+
+import (
+	"factory-go-api/config"
+	"factory-go-api/recorder"
+	"factory-go-api/transport"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// upstreamTransports 各端点共享的连接池
+var upstreamTransports = transport.NewPool()
+
+// upstreamRecorder 录制/回放 Transport，未启用时为 nil
+var upstreamRecorder *recorder.Transport
+
+// upstreamRecorderMutex 保护 upstreamRecorder，重新加载配置时会替换它
+var upstreamRecorderMutex sync.RWMutex
+
+// currentUpstreamRecorder 返回当前的录制/回放 Transport
+func currentUpstreamRecorder() *recorder.Transport {
+	upstreamRecorderMutex.RLock()
+	defer upstreamRecorderMutex.RUnlock()
+	return upstreamRecorder
+}
+
+// setUpstreamRecorder 替换录制/回放 Transport
+func setUpstreamRecorder(t *recorder.Transport) {
+	upstreamRecorderMutex.Lock()
+	defer upstreamRecorderMutex.Unlock()
+	upstreamRecorder = t
+}
+
+// newUpstreamClient 创建访问端点的 HTTP 客户端，连接由同一端点的请求共享
+// 请求依次经过统计、录制/回放，最后使用该端点的连接池发送
+func newUpstreamClient(endpoint *config.Endpoint) (*http.Client, error) {
+	t, err := upstreamTransports.Get(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("端点 %s 的 transport 配置错误: %w", endpoint.Name, err)
+	}
+	var next http.RoundTripper = t
+	if rec := currentUpstreamRecorder(); rec != nil {
+		next = rec.Wrap(t)
+	}
+	return &http.Client{Timeout: transport.Timeout(endpoint.Transport), Transport: &metricsTransport{endpoint: endpoint.Name, next: next}}, nil
+}